@@ -5,23 +5,21 @@ import (
 	"os"
 	"strings"
 
+	"github.com/skulesh01/ceres/pkg/config"
 	"github.com/skulesh01/ceres/pkg/ui"
 )
 
 func main() {
-	listen := strings.TrimSpace(os.Getenv("CERES_UI_LISTEN"))
-	if listen == "" {
-		listen = ":8090"
-	}
+	cfg := config.Current().Config
 
 	s := &ui.Server{
-		ListenAddr: listen,
-		ConfigPath: strings.TrimSpace(os.Getenv("CERES_UI_CONFIG")),
-		BasicUser:  strings.TrimSpace(os.Getenv("CERES_UI_BASIC_USER")),
+		ListenAddr: cfg.UI.Mail.Listen,
+		ConfigPath: cfg.UI.Mail.State,
+		BasicUser:  cfg.UI.BasicUser,
 		BasicPass:  strings.TrimSpace(os.Getenv("CERES_UI_BASIC_PASS")),
 	}
 
-	log.Printf("CERES Mail UI listening on %s", listen)
+	log.Printf("CERES Mail UI listening on %s", s.ListenAddr)
 	if err := s.Run(); err != nil {
 		log.Fatal(err)
 	}
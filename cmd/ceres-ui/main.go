@@ -5,25 +5,23 @@ import (
 	"os"
 	"strings"
 
+	"github.com/skulesh01/ceres/pkg/config"
 	"github.com/skulesh01/ceres/pkg/ui"
 )
 
 func main() {
-	listen := strings.TrimSpace(os.Getenv("CERES_CONSOLE_LISTEN"))
-	if listen == "" {
-		listen = ":8091"
-	}
+	cfg := config.Current().Config
 
 	s := &ui.ConsoleServer{
-		ListenAddr: listen,
-		ConfigPath: strings.TrimSpace(os.Getenv("CERES_CONSOLE_CONFIG")),
-		BasicUser:  strings.TrimSpace(os.Getenv("CERES_UI_BASIC_USER")),
+		ListenAddr: cfg.UI.Console.Listen,
+		ConfigPath: cfg.UI.Console.State,
+		BasicUser:  cfg.UI.BasicUser,
 		BasicPass:  strings.TrimSpace(os.Getenv("CERES_UI_BASIC_PASS")),
-		WorkDir:    strings.TrimSpace(os.Getenv("CERES_ROOT")),
+		WorkDir:    config.Root(),
 		Jobs:       ui.NewJobManager(),
 	}
 
-	log.Printf("CERES Console listening on %s", listen)
+	log.Printf("CERES Console listening on %s", s.ListenAddr)
 	if err := s.Run(); err != nil {
 		log.Fatal(err)
 	}
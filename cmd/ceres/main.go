@@ -1,19 +1,35 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/skulesh01/ceres/pkg/backup"
+	"github.com/skulesh01/ceres/pkg/bundle"
+	"github.com/skulesh01/ceres/pkg/catalog"
 	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/db"
 	"github.com/skulesh01/ceres/pkg/deployment"
+	"github.com/skulesh01/ceres/pkg/dns"
+	"github.com/skulesh01/ceres/pkg/domain"
+	"github.com/skulesh01/ceres/pkg/images"
+	"github.com/skulesh01/ceres/pkg/infra"
 	"github.com/skulesh01/ceres/pkg/mail"
 	"github.com/skulesh01/ceres/pkg/onboarding"
+	"github.com/skulesh01/ceres/pkg/proxmox"
+	"github.com/skulesh01/ceres/pkg/secrets"
 	"github.com/skulesh01/ceres/pkg/sso"
 	"github.com/skulesh01/ceres/pkg/tls"
-	"github.com/skulesh01/ceres/pkg/utils"
 	"github.com/skulesh01/ceres/pkg/vpn"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -55,6 +71,17 @@ Features: Cert-Manager, Velero, Promtail, Mailcow, Keycloak SSO`,
 	rootCmd.AddCommand(newSSOCmd())            // НОВОЕ
 	rootCmd.AddCommand(newHealthCmd())         // НОВОЕ
 	rootCmd.AddCommand(newOnboardingCmd())     // НОВОЕ
+	rootCmd.AddCommand(newBundleCmd())
+	rootCmd.AddCommand(newImagesCmd())
+	rootCmd.AddCommand(newPlanCmd())
+	rootCmd.AddCommand(newRenderCmd())
+	rootCmd.AddCommand(newSecretsCmd())
+	rootCmd.AddCommand(newDBCmd())
+	rootCmd.AddCommand(newDomainCmd())
+	rootCmd.AddCommand(newDNSCmd())
+	rootCmd.AddCommand(newServicesCmd())
+	rootCmd.AddCommand(newProxmoxCmd())
+	rootCmd.AddCommand(newInfraCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -69,6 +96,11 @@ func newDeployCmd() *cobra.Command {
 		cloud       string
 		dryRun      bool
 		namespace   string
+		engine      string
+		configPath  string
+		pin         bool
+		lockPath    string
+		profile     string
 	)
 
 	cmd := &cobra.Command{
@@ -76,31 +108,82 @@ func newDeployCmd() *cobra.Command {
 		Short: "Deploy CERES platform",
 		Long: `Deploy CERES platform to Kubernetes cluster.
 
+Engines:
+  kubectl  apply the manifests in deployment/ (default)
+  helm     install/upgrade the deployment/ceres-platform chart
+
 Examples:
   ceres deploy --cloud proxmox --environment prod
   ceres deploy --cloud k3s --dry-run
+  ceres deploy --engine helm --config ~/.ceres/config.yaml
+  ceres deploy --pin                     # images by digest from deployment/images.lock.yaml
+  ceres deploy --profile small           # sizing profile (small, medium, large)
   ceres deploy --help`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if dryRun {
-				fmt.Println("📋 DRY-RUN: No changes will be made")
-				return nil
+			overlay := ""
+			if cmd.Flags().Changed("environment") {
+				overlay = environment
 			}
+			r, invalid := resolveCLIConfig(configPath, overlay, changedFlags(cmd, map[string]string{
+				"cloud":       "cloud.provider",
+				"environment": "platform.environment",
+				"profile":     "sizing.profile",
+			}))
+			if r == nil {
+				return invalid
+			}
+			cfg, path := r.Config, r.ConfigPath
 
 			// Create deployer
-			deployer, err := deployment.NewDeployer(cloud, environment, namespace)
+			deployer, err := deployment.NewDeployer(cfg.Cloud.Provider, cfg.Platform.Environment, namespace)
 			if err != nil {
 				return fmt.Errorf("failed to create deployer: %w", err)
 			}
+			if pin {
+				if err := deployer.PinImages(lockPath); err != nil {
+					return err
+				}
+			}
+			if err := deployer.UseProfile(cfg.Sizing.Profile, cfg.Sizing.Components); err != nil {
+				return err
+			}
 
-			// Execute deployment
-			return deployer.Deploy()
+			switch engine {
+			case "kubectl":
+				if invalid != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  configuration invalid (%s): %v\n", path, invalid)
+				}
+				if dryRun {
+					fmt.Println("📋 DRY-RUN: No changes will be made")
+					return nil
+				}
+				// Execute deployment
+				return deployer.Deploy()
+			case "helm":
+				if invalid != nil {
+					return fmt.Errorf("configuration invalid (%s): %w", path, invalid)
+				}
+				if dryRun {
+					fmt.Println("📋 DRY-RUN: No changes will be made")
+					deployer.PrintHelmValues(cfg)
+					return nil
+				}
+				return deployer.DeployHelm(cfg)
+			default:
+				return fmt.Errorf("unsupported engine: %s (use kubectl or helm)", engine)
+			}
 		},
 	}
 
-	cmd.Flags().StringVar(&environment, "environment", "prod", "Environment (dev, staging, prod)")
-	cmd.Flags().StringVar(&cloud, "cloud", "proxmox", "Cloud provider (proxmox, k3s, aws, azure, gcp)")
+	cmd.Flags().StringVar(&environment, "environment", "", "Environment: dev, staging, prod (default: platform.environment from config)")
+	cmd.Flags().StringVar(&cloud, "cloud", "", "Cloud provider: proxmox, k3s, aws, azure, gcp (default: cloud.provider from config)")
 	cmd.Flags().StringVar(&namespace, "namespace", "ceres", "Kubernetes namespace")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
+	cmd.Flags().StringVar(&engine, "engine", "kubectl", "Install engine (kubectl, helm)")
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().BoolVar(&pin, "pin", false, "Reference images by the digests in the image lock file")
+	cmd.Flags().StringVar(&lockPath, "lock", "", "Image lock file (default: deployment/images.lock.yaml)")
+	cmd.Flags().StringVar(&profile, "profile", "", "Sizing profile: small, medium, large (default: sizing.profile from config)")
 
 	return cmd
 }
@@ -146,21 +229,43 @@ Examples:
 
 // newConfigCmd creates the config command
 func newConfigCmd() *cobra.Command {
-	var configPath string
+	var configPath, environment string
 
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Manage CERES configuration",
 		Long: `Manage CERES configuration files.
 
+The config file (schemaVersion: 2) is merged with the overlay of its
+environment when present: config.yaml + config.<env>.yaml (dev, staging, prod).
+Unknown keys are rejected; errors name the field, e.g. services.redis.storage.
+
+Settings are resolved in layers, each overriding the previous one:
+  defaults < instance env (/etc/ceres/ceres.env) < config file < env vars < flags
+The config file is --config, $CERES_CONFIG or ~/.ceres/config.yaml.
+
 Examples:
   ceres config show
-	  ceres config validate
-	  ceres config sync`,
+  ceres config show --env staging
+  ceres config validate
+  ceres config schema -o config/ceres.schema.json
+  ceres config migrate
+  ceres config explain services.keycloak.adminUser
+  ceres config get services.keycloak.replicas
+  ceres config set services.keycloak.replicas 2
+  ceres config edit
+  ceres config sync`,
 	}
 
 	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.PersistentFlags().StringVar(&environment, "env", "", "Overlay to merge: dev, staging, prod (default: platform.environment)")
 	cmd.AddCommand(newConfigSyncCmd(&configPath))
+	cmd.AddCommand(newConfigSchemaCmd())
+	cmd.AddCommand(newConfigMigrateCmd(&configPath))
+	cmd.AddCommand(newConfigExplainCmd(&configPath, &environment))
+	cmd.AddCommand(newConfigGetCmd(&configPath, &environment))
+	cmd.AddCommand(newConfigSetCmd(&configPath))
+	cmd.AddCommand(newConfigEditCmd(&configPath))
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "show",
@@ -169,19 +274,21 @@ Examples:
 			fmt.Println("📋 CERES Configuration")
 			fmt.Println("=====================================")
 
-			path := strings.TrimSpace(configPath)
-			if path == "" {
-				path = utils.GetConfigPath()
-			}
-			cfg, err := config.LoadConfig(path)
-			if err != nil {
-				return fmt.Errorf("failed to load config %s: %w", path, err)
+			r, invalid := resolveCLIConfig(configPath, environment, nil)
+			if r == nil {
+				return invalid
 			}
+			cfg, path := r.Config, r.ConfigPath
 			out, err := yaml.Marshal(cfg)
 			if err != nil {
 				return fmt.Errorf("failed to render config as yaml: %w", err)
 			}
-			fmt.Printf("Path: %s\n\n", path)
+			fmt.Printf("Path: %s\n", path)
+			if overlay := config.OverlayPath(path, cfg.Platform.Environment); fileExists(overlay) {
+				fmt.Printf("Overlay: %s\n", overlay)
+			}
+			fmt.Println("Effective values (defaults < instance env < config file < env); see `ceres config explain`")
+			fmt.Println()
 			fmt.Print(string(out))
 			return nil
 		},
@@ -193,16 +300,16 @@ Examples:
 		RunE: func(cmd *cobra.Command, args []string) error {
 			path := strings.TrimSpace(configPath)
 			if path == "" {
-				path = utils.GetConfigPath()
+				path = config.DefaultPath()
 			}
-			cfg, err := config.LoadConfig(path)
-			if err != nil {
-				return fmt.Errorf("failed to load config %s: %w", path, err)
+			cfg, err := config.LoadFile(path, config.LoadOptions{Environment: environment})
+			if err == nil {
+				err = cfg.Validate()
 			}
-			if err := cfg.Validate(); err != nil {
+			if err != nil {
 				return fmt.Errorf("configuration invalid (%s): %w", path, err)
 			}
-			fmt.Println("✅ Configuration is valid")
+			fmt.Printf("✅ Configuration is valid (environment: %s)\n", cfg.Platform.Environment)
 			return nil
 		},
 	})
@@ -210,6 +317,468 @@ Examples:
 	return cmd
 }
 
+// resolveCLIConfig resolves the effective configuration (defaults, instance
+// env, --config or ~/.ceres/config.yaml which may be missing, environment,
+// flags) and installs it for the other packages. When only validation fails
+// (CERES_SMTP_PORT=abc) the errors are printed as a warning and the
+// configuration is returned with its *config.ValidationError; a nil result
+// means it could not be loaded.
+func resolveCLIConfig(configPath, environment string, flags map[string]string) (*config.Resolved, error) {
+	path := strings.TrimSpace(configPath)
+	optional := path == ""
+	if optional {
+		path = config.DefaultPath()
+	}
+	names := map[string]string{}
+	for p := range flags {
+		names[p] = cliFlagNames[p]
+	}
+	r, err := config.Resolve(config.ResolveOptions{
+		ConfigPath:     path,
+		ConfigOptional: optional,
+		Environment:    environment,
+		Flags:          flags,
+		FlagNames:      names,
+	})
+	if r == nil {
+		return nil, fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	config.SetCurrent(r)
+	// a cluster profile made by ceres infra up; KUBECONFIG still wins
+	if kubeconfig := r.Config.Cloud.Kubernetes.Kubeconfig; kubeconfig != "" && os.Getenv("KUBECONFIG") == "" {
+		os.Setenv("KUBECONFIG", kubeconfig)
+	}
+	if optional && !fileExists(path) {
+		fmt.Fprintf(os.Stderr, "ℹ️  No config at %s, using defaults\n", path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  configuration invalid (%s): %v\n", path, err)
+	}
+	return r, err
+}
+
+// cliFlagNames names the flags that set a setting, for config explain
+var cliFlagNames = map[string]string{
+	"cloud.provider":       "--cloud",
+	"platform.environment": "--environment",
+	"sizing.profile":       "--profile",
+}
+
+// changedFlags returns the settings given on the command line: flag name
+// to setting path in, setting path to value out
+func changedFlags(cmd *cobra.Command, paths map[string]string) map[string]string {
+	out := map[string]string{}
+	for name, p := range paths {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+			out[p] = f.Value.String()
+		}
+	}
+	return out
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// newConfigExplainCmd shows which layer a setting comes from
+func newConfigExplainCmd(configPath, environment *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain [setting]",
+		Short: "Show where a setting's effective value comes from",
+		Long: `Show every layer that sets a setting, lowest precedence first, and the
+environment variables bound to it. Without a setting, list the settings
+that differ from the defaults and their source.
+
+Examples:
+  ceres config explain platform.domain
+  ceres config explain mail.smtp.port
+  ceres config explain`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, invalid := resolveCLIConfig(*configPath, *environment, nil)
+			if r == nil {
+				return invalid
+			}
+
+			if len(args) == 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+				for _, p := range config.Paths() {
+					o := r.Source(p)
+					if o.Source == config.SourceDefault {
+						continue
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\n", p, oneLine(o.Value), originLabel(o))
+				}
+				return w.Flush()
+			}
+
+			key := args[0]
+			origins, err := r.Explain(key)
+			if err != nil {
+				return err
+			}
+			value, _ := r.Config.Get(key)
+			fmt.Printf("%s = %s\n", key, oneLine(value))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for i, o := range origins {
+				mark := " "
+				if i == len(origins)-1 {
+					mark = "→"
+				}
+				fmt.Fprintf(w, "%s %s\t%s\t%s\n", mark, o.Source, oneLine(o.Value), o.Name)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if envs := config.BindingsFor(key); len(envs) > 0 {
+				fmt.Printf("Environment: %s\n", strings.Join(envs, ", "))
+			}
+			if flag := cliFlagNames[key]; flag != "" {
+				fmt.Printf("Flag: %s\n", flag)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// originLabel renders an origin as "config file (/path)"
+func originLabel(o config.Origin) string {
+	if o.Name == "" {
+		return o.Source
+	}
+	return fmt.Sprintf("%s (%s)", o.Source, o.Name)
+}
+
+// oneLine shortens multi-line (mapping) values for tables
+func oneLine(v string) string {
+	if i := strings.Index(v, "\n"); i >= 0 {
+		return v[:i] + " …"
+	}
+	if v == "" {
+		return `""`
+	}
+	return v
+}
+
+// newConfigGetCmd prints one effective setting
+func newConfigGetCmd(configPath, environment *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <setting>",
+		Short: "Print the effective value of a setting",
+		Long: `Print the effective value of a setting, addressed by its path in the
+config file. Lists print comma separated, sections and maps as YAML.
+` + "`ceres config explain`" + ` shows where the value comes from.
+
+Examples:
+  ceres config get platform.domain
+  ceres config get services.keycloak.replicas
+  ceres config get sizing.components`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, invalid := resolveCLIConfig(*configPath, *environment, nil)
+			if r == nil {
+				return invalid
+			}
+			value, err := r.Config.Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		},
+	}
+}
+
+// newConfigSetCmd changes one setting of the config file
+func newConfigSetCmd(configPath *string) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "set <setting> <value>",
+		Short: "Change a setting in the config file",
+		Long: `Change one setting of the config file (the base file, not an overlay).
+Comments and the order of keys are kept. The value is checked against the
+setting's type and the resulting configuration must validate, otherwise
+nothing is written. Lists are comma separated, maps are given as YAML.
+
+Examples:
+  ceres config set services.keycloak.replicas 2
+  ceres config set mail.mode external
+  ceres config set sso.clients gitlab,grafana
+  ceres config set sizing.components.gitlab.memory 6Gi
+  ceres config set mail.smtp '{host: smtp.company.com, port: 465, tls: true}'`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := strings.TrimSpace(*configPath)
+			if path == "" {
+				path = config.DefaultPath()
+			}
+			data, err := os.ReadFile(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to read config %s: %w", path, err)
+			}
+
+			out, err := config.SetInFile(data, args[0], args[1])
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			// as ceres loads it: ${CERES_DOMAIN} in the file is set from the env
+			if _, err := config.Resolve(config.ResolveOptions{ConfigPath: path, ConfigData: out}); err != nil {
+				return fmt.Errorf("not written, the result would be invalid: %w", err)
+			}
+
+			if dryRun {
+				fmt.Print(config.UnifiedDiff(data, out, path, path+" (new)"))
+				fmt.Println("📋 DRY-RUN: No changes will be made")
+				return nil
+			}
+			if err := config.WriteFile(path, out); err != nil {
+				return err
+			}
+			cfg, _ := config.ParseFile(path, out, config.LoadOptions{BaseOnly: true})
+			value, _ := cfg.Get(args[0])
+			fmt.Printf("✓ %s = %s (%s)\n", args[0], oneLine(value), path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the change without writing")
+
+	return cmd
+}
+
+// newConfigEditCmd opens the config file in $EDITOR and validates it on save
+func newConfigEditCmd(configPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the config file in $EDITOR",
+		Long: `Open a copy of the config file in $VISUAL or $EDITOR (default vi). The copy
+is validated when the editor exits and only replaces the config file if it is
+valid; otherwise you can go back to the editor or discard the changes.
+
+Examples:
+  ceres config edit
+  EDITOR=nano ceres config edit --config config/proxmox.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := strings.TrimSpace(*configPath)
+			if path == "" {
+				path = config.DefaultPath()
+			}
+			original, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				original = []byte(fmt.Sprintf("schemaVersion: %d\n", config.SchemaVersion))
+			} else if err != nil {
+				return fmt.Errorf("failed to read config %s: %w", path, err)
+			}
+
+			tmp, err := os.CreateTemp("", "ceres-config-*.yaml")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(tmp.Name())
+			if _, err := tmp.Write(original); err != nil {
+				tmp.Close()
+				return err
+			}
+			if err := tmp.Close(); err != nil {
+				return err
+			}
+
+			for {
+				if err := runEditor(tmp.Name()); err != nil {
+					return err
+				}
+				edited, err := os.ReadFile(tmp.Name())
+				if err != nil {
+					return err
+				}
+				if bytes.Equal(edited, original) {
+					fmt.Println("ℹ️  No changes")
+					return nil
+				}
+				_, err = config.Resolve(config.ResolveOptions{ConfigPath: path, ConfigData: edited})
+				if err == nil {
+					if err := config.WriteFile(path, edited); err != nil {
+						return err
+					}
+					fmt.Printf("✓ saved %s\n", path)
+					return nil
+				}
+
+				fmt.Printf("❌ %v\n", err)
+				fmt.Print("Edit again? (y/n): ")
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Printf("❌ Cancelled, %s is unchanged\n", path)
+					return nil
+				}
+			}
+		},
+	}
+}
+
+// runEditor opens file in $VISUAL, $EDITOR or vi
+func runEditor(file string) error {
+	editor := strings.TrimSpace(os.Getenv("VISUAL"))
+	if editor == "" {
+		editor = strings.TrimSpace(os.Getenv("EDITOR"))
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// EDITOR may carry arguments, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	c := exec.Command(parts[0], append(parts[1:], file)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", editor, err)
+	}
+	return nil
+}
+
+// newConfigMigrateCmd creates the config migrate command
+func newConfigMigrateCmd(configPath *string) *cobra.Command {
+	var (
+		dryRun      bool
+		yes         bool
+		dropUnknown bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade a config file to the current schema",
+		Long: `Detect the schema version of a config file and upgrade it in place.
+
+Files without schemaVersion (examples/ceres-config.yaml, config/proxmox.yaml
+and ~/.ceres/config.yaml written by older releases) are version 1. Comments and
+key order are kept. The diff is shown first and the original is saved next to
+the file as <file>.v<version>.bak.
+
+Inline passwords are removed, not migrated: set them with ceres secrets set.
+
+Examples:
+  ceres config migrate --dry-run
+  ceres config migrate --config config/proxmox.yaml
+  ceres config migrate --yes --drop-unknown`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := strings.TrimSpace(*configPath)
+			if path == "" {
+				path = config.DefaultPath()
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read config %s: %w", path, err)
+			}
+			m, err := config.Migrate(data, config.MigrateOptions{DropUnknown: dropUnknown})
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if m.From == m.To {
+				fmt.Printf("✓ %s is already at schema version %d\n", path, m.To)
+				return nil
+			}
+
+			fmt.Printf("🔄 %s: schema version %d → %d\n\n", path, m.From, m.To)
+			fmt.Print(config.UnifiedDiff(m.Original, m.Migrated, path, path+" (migrated)"))
+			fmt.Println()
+			for _, n := range m.Notes {
+				fmt.Printf("⚠️  %s\n", n)
+			}
+			if len(m.Unknown) > 0 {
+				fmt.Println("❌ Keys the current schema does not know:")
+				for _, fe := range m.Unknown {
+					fmt.Printf("   %s\n", fe.Error())
+				}
+				return fmt.Errorf("fix or remove them, or rerun with --drop-unknown")
+			}
+			if m.Problems != nil {
+				fmt.Printf("⚠️  The migrated config does not validate yet:\n%v\n", m.Problems)
+			}
+			if dryRun {
+				fmt.Println("📋 DRY-RUN: No changes will be made")
+				return nil
+			}
+
+			if !yes {
+				fmt.Print("Write the migrated config? (y/n): ")
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Println("❌ Cancelled")
+					return nil
+				}
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			backup := fmt.Sprintf("%s.v%d.bak", path, m.From)
+			if fileExists(backup) {
+				backup = fmt.Sprintf("%s.v%d.%s.bak", path, m.From, time.Now().Format("20060102-150405"))
+			}
+			if err := os.WriteFile(backup, m.Original, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", path, err)
+			}
+			if err := config.WriteFile(path, m.Migrated); err != nil {
+				return err
+			}
+			fmt.Printf("✓ migrated %s (backup: %s)\n", path, backup)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the diff without writing")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Write without asking")
+	cmd.Flags().BoolVar(&dropUnknown, "drop-unknown", false, "Remove keys the current schema does not know")
+
+	return cmd
+}
+
+// newConfigSchemaCmd creates the config schema command
+func newConfigSchemaCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the config file",
+		Long: `Print the JSON Schema of the config file for editor completion and validation.
+
+With the YAML language server (VS Code YAML extension, neovim, ...) add a
+modeline at the top of the config:
+
+  # yaml-language-server: $schema=<path or URL of ceres.schema.json>
+
+Examples:
+  ceres config schema
+  ceres config schema -o config/ceres.schema.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := config.JSONSchema()
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+			if output == "" {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("✓ wrote %s\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to file instead of stdout")
+
+	return cmd
+}
+
+// newConfigSyncCmd creates the config sync command
 func newConfigSyncCmd(configPath *string) *cobra.Command {
 	var (
 		instanceEnvPath string
@@ -221,7 +790,10 @@ func newConfigSyncCmd(configPath *string) *cobra.Command {
 		Short: "Sync CLI config from instance env",
 		Long: `Sync ~/.ceres/config.yaml from the instance-wide /etc/ceres/ceres.env.
 
-Currently it writes platform.domain from CERES_DOMAIN so CLI outputs and helpers stay consistent with the deployed domain.
+Every setting the env file sets (CERES_DOMAIN, CERES_MAIL_MODE, CERES_SMTP_*,
+CERES_VPN_ENDPOINT, ...; see ` + "`ceres config explain`" + `) is written to the config
+file, so the CLI keeps working the same when the env file is gone. Only those
+settings are rewritten: comments, key order and the rest of the file are kept.
 
 Examples:
   ceres config sync
@@ -233,41 +805,67 @@ Examples:
 				path = strings.TrimSpace(*configPath)
 			}
 			if path == "" {
-				path = utils.GetConfigPath()
+				path = config.DefaultPath()
 			}
 
-			domain := strings.TrimSpace(domainOverride)
-			if domain == "" {
-				vars, err := config.LoadInstanceEnv(instanceEnvPath)
-				if err != nil {
+			vars, err := config.LoadInstanceEnv(instanceEnvPath)
+			if err != nil {
+				// --domain alone is enough to sync
+				if !errors.Is(err, os.ErrNotExist) || strings.TrimSpace(domainOverride) == "" {
 					return fmt.Errorf("failed to load instance env: %w", err)
 				}
-				domain = strings.TrimSpace(vars["CERES_DOMAIN"])
+				vars = map[string]string{}
 			}
-			if domain == "" {
-				return fmt.Errorf("CERES_DOMAIN is not set (use --domain or set it in %s)", instanceEnvPath)
+			if d := strings.TrimSpace(domainOverride); d != "" {
+				vars["CERES_DOMAIN"] = d
 			}
 
-			cfg, err := config.LoadConfig(path)
-			if err != nil {
-				return fmt.Errorf("failed to load config %s: %w", path, err)
+			data, err := os.ReadFile(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to read config %s: %w", path, err)
+			}
+
+			// set in the YAML tree as config set does: comments, key order
+			// and the settings the env does not name are kept
+			type change struct{ path, value, from string }
+			var changes []change
+			out := data
+			for _, b := range config.Bindings {
+				v := strings.TrimSpace(vars[b.Env])
+				if v == "" {
+					continue
+				}
+				if b.Convert != nil {
+					var ok bool
+					if v, ok = b.Convert(v); !ok {
+						continue
+					}
+				}
+				if out, err = config.SetInFile(out, b.Path, v); err != nil {
+					return fmt.Errorf("%s: %s: %w", path, b.Env, err)
+				}
+				changes = append(changes, change{b.Path, v, b.Env})
+			}
+			if len(changes) == 0 {
+				return fmt.Errorf("nothing to sync: %s sets none of the CERES_* settings (use --domain to set the domain)", instanceEnvPath)
 			}
 
-			cfg.Platform.Domain = domain
-			if err := cfg.Validate(); err != nil {
-				return fmt.Errorf("resulting config invalid: %w", err)
+			if _, err := config.Resolve(config.ResolveOptions{ConfigPath: path, ConfigData: out, InstanceEnvPath: instanceEnvPath}); err != nil {
+				return fmt.Errorf("not written, the result would be invalid: %w", err)
 			}
-			if err := cfg.SaveConfig(path); err != nil {
-				return fmt.Errorf("failed to save config %s: %w", path, err)
+			if err := config.WriteFile(path, out); err != nil {
+				return err
 			}
 
 			fmt.Printf("✓ synced config: %s\n", path)
-			fmt.Printf("  domain: %s\n", domain)
+			for _, c := range changes {
+				fmt.Printf("  %s: %s (%s)\n", c.path, c.value, c.from)
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&instanceEnvPath, "instance-env", "/etc/ceres/ceres.env", "Path to instance env file")
+	cmd.Flags().StringVar(&instanceEnvPath, "instance-env", config.DefaultInstanceEnvPath, "Path to instance env file")
 	cmd.Flags().StringVar(&domainOverride, "domain", "", "Override domain instead of reading CERES_DOMAIN from instance env")
 
 	return cmd
@@ -695,163 +1293,2602 @@ func newUpgradeCmd() *cobra.Command {
 
 // newBackupCmd команды бэкапа
 func newBackupCmd() *cobra.Command {
+	var configPath string
+
+	// open loads the config, whose namespaces the components live in
+	open := func() (*backup.Manager, error) {
+		if r, invalid := resolveCLIConfig(configPath, "", nil); r == nil {
+			return nil, invalid
+		}
+		return backup.NewManager()
+	}
+	scope := func(components []string) (*backup.Scope, error) {
+		if len(components) == 0 {
+			return nil, nil
+		}
+		return backup.ComponentScope(components, &config.Current().Config)
+	}
+
 	cmd := &cobra.Command{
 		Use:   "backup",
 		Short: "Управление бэкапами",
+		Long: `Back up and restore the platform with Velero.
+
+A backup covers every namespace but the cluster's own, or the components
+named with --component (see "ceres services"): their namespace, or in a
+shared namespace (ceres-core, ceres, monitoring) the objects they own, which
+ceres labels ceres.io/component before each backup.
+
+Examples:
+  ceres backup create
+  ceres backup create --component gitlab,keycloak
+  ceres backup policy apply
+  ceres backup location add offsite --bucket ceres-offsite --url https://s3.example.com
+  ceres backup restore backup-20260101-020000 --component gitlab --namespace-mapping gitlab:gitlab-restore`,
 	}
-	
-	cmd.AddCommand(&cobra.Command{
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+
+	var (
+		createComponents []string
+		createLocation   string
+	)
+	createCmd := &cobra.Command{
 		Use:   "create [name]",
 		Short: "Создать backup",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			backupMgr := backup.NewManager()
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			s, err := scope(createComponents)
+			if err != nil {
+				return err
+			}
 			name := ""
 			if len(args) > 0 {
 				name = args[0]
 			}
-			return backupMgr.CreateBackup(name)
+			_, err = backupMgr.CreateBackup(name, backup.BackupOptions{Scope: s, Location: createLocation})
+			return err
 		},
-	})
-	
+	}
+	createCmd.Flags().StringSliceVar(&createComponents, "component", nil, "Back up only these components (comma-separated)")
+	createCmd.Flags().StringVar(&createLocation, "location", "", "Storage location (default: the one of backup.location)")
+	cmd.AddCommand(createCmd)
+
 	cmd.AddCommand(&cobra.Command{
 		Use:   "list",
 		Short: "Список backups",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			backupMgr := backup.NewManager()
-			backups, err := backupMgr.ListBackups()
+			backupMgr, err := open()
 			if err != nil {
 				return err
 			}
-			for _, b := range backups {
-				fmt.Println(b)
+			backups, err := backupMgr.ListBackups()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTATUS\tCOMPONENTS\tLOCATION\tSTARTED\tCOMPLETED\tEXPIRES\tITEMS\tERRORS\tWARNINGS\tSCHEDULE")
+			for _, b := range backups {
+				schedule := b.Schedule
+				if schedule == "" {
+					schedule = "-"
+				}
+				components := strings.Join(b.Components, ",")
+				if components == "" {
+					components = "all"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", b.Name, b.Phase, components, b.StorageLocation,
+					backupTime(b.Started), backupTime(b.Completed), backupTime(b.Expiration),
+					b.Items, b.Errors, b.Warnings, schedule)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if name, at, ok := backup.LastVerification(); ok {
+				fmt.Printf("\n🧪 Last verified: %s at %s\n", name, backupTime(at))
 			}
 			return nil
 		},
 	})
-	
-	cmd.AddCommand(&cobra.Command{
+
+	var (
+		restoreComponents []string
+		namespaceMapping  []string
+	)
+	restoreCmd := &cobra.Command{
 		Use:   "restore <name>",
 		Short: "Восстановить из backup",
-		Args:  cobra.ExactArgs(1),
+		Long: `Restore a backup, or with --component only some of its components.
+
+--namespace-mapping restores a namespace under another name, e.g. GitLab into
+gitlab-restore for inspection, without touching the running one.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			backupMgr := backup.NewManager()
-			return backupMgr.Restore(args[0])
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			s, err := scope(restoreComponents)
+			if err != nil {
+				return err
+			}
+			mapping, err := backup.ParseNamespaceMapping(namespaceMapping)
+			if err != nil {
+				return err
+			}
+			_, err = backupMgr.Restore(args[0], backup.RestoreOptions{Scope: s, NamespaceMapping: mapping})
+			return err
 		},
-	})
-	
-	return cmd
-}
-
-// newMailCmd команды почты
-func newMailCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "mail",
-		Short: "Управление почтовым сервером",
 	}
+	restoreCmd.Flags().StringSliceVar(&restoreComponents, "component", nil, "Restore only these components (comma-separated)")
+	restoreCmd.Flags().StringSliceVar(&namespaceMapping, "namespace-mapping", nil, "Restore a namespace as another, old:new (repeatable)")
+	cmd.AddCommand(restoreCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schedules",
+		Short: "List the backup schedules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			schedules, err := backupMgr.ListSchedules()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSCHEDULE\tTTL\tSTATUS\tLAST BACKUP")
+			for _, s := range schedules {
+				status := s.Phase
+				if s.Paused {
+					status = "Paused"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.Cron, s.TTL, status, backupTime(s.LastBackup))
+			}
+			return w.Flush()
+		},
+	})
 
 	var (
-		toEmails      []string
-		vpnEndpoint   string
-		vpnPort       int
-		vpnClientIP   string
-		vpnFilename   string
-		subject       string
-		body          string
+		verifyComponents []string
+		verifySuffix     string
+		verifyTimeout    time.Duration
+		verifyLatest     bool
+		verifyKeep       bool
+		verifyRecord     bool
 	)
-
-	sendOnboardingCmd := &cobra.Command{
-		Use:   "send-onboarding",
-		Short: "Отправить пользователю Root CA сертификат и WireGuard конфиг",
+	verifyCmd := &cobra.Command{
+		Use:   "verify [name]",
+		Short: "Restore a backup into throwaway namespaces and check it works",
+		Long: `Prove a backup restores: restore it into copies of its namespaces
+(<namespace>-verify), wait until the components are healthy, probe them
+(HTTP 200 on their Service, following redirects within the copy; a
+connection to each service database; Redis PING) and delete the copy. The report lists every check; the command fails when
+one does.
+
+The copy cannot reach the running platform: a NetworkPolicy limits it to
+its own namespaces, the addresses of the running namespaces in workloads and
+ConfigMaps are pointed at the copies, and CronJobs are suspended. Verify
+applications together with the data stores they use (postgresql, redis).
+Cluster-wide components (ingress-nginx, cert-manager, promtail) are left out.
+
+--record notes a successful verification in the deployment state, for a
+scheduled drill, e.g. a systemd timer (scripts/install-backup-verify.sh)
+running: ceres backup verify --latest --record`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			toEmails = splitAndTrim(toEmails)
-			if len(toEmails) != 1 {
-				return fmt.Errorf("ровно один получатель обязателен: используйте --to user@domain")
+			backupMgr, err := open()
+			if err != nil {
+				return err
 			}
-			if strings.TrimSpace(vpnEndpoint) == "" {
-				return fmt.Errorf("--vpn-endpoint обязателен (например 192.168.1.3 или vpn.company.ru)")
+			var name string
+			switch {
+			case len(args) == 1:
+				name = args[0]
+			case verifyLatest:
+				backups, err := backupMgr.ListBackups()
+				if err != nil {
+					return err
+				}
+				for _, b := range backups {
+					if b.Succeeded() {
+						name = b.Name
+						break
+					}
+				}
+				if name == "" {
+					return fmt.Errorf("no completed backup to verify")
+				}
+			default:
+				return fmt.Errorf("name a backup or use --latest")
 			}
-			if vpnPort == 0 {
-				vpnPort = 51820
+			s, err := scope(verifyComponents)
+			if err != nil {
+				return err
 			}
 
-			// Export CERES Root CA from cluster
-			ca, err := tls.ReadPEMFromKubernetesTLSSecret("cert-manager", "ceres-root-ca")
+			report, err := backupMgr.Verify(name, backup.VerifyOptions{
+				Scope:   s,
+				Suffix:  verifySuffix,
+				Timeout: verifyTimeout,
+				Keep:    verifyKeep,
+				Record:  verifyRecord,
+			})
+			if report == nil {
+				return err
+			}
+
+			fmt.Printf("\n📋 Verification of %s (restore %s, %s)\n", report.Backup, report.Restore,
+				report.Finished.Sub(report.Started).Round(time.Second))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "COMPONENT\tCHECK\tRESULT\tDETAIL")
+			for _, c := range report.Checks {
+				result := "pass"
+				if !c.Passed {
+					result = "FAIL"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Component, c.Name, result, c.Detail)
+			}
+			w.Flush()
+			if verifyKeep {
+				for from, to := range report.Namespaces {
+					fmt.Printf("🔎 %s kept as %s (kubectl delete namespace %s)\n", from, to, to)
+				}
+			}
+			if !report.Passed() {
+				return fmt.Errorf("backup %s failed verification", report.Backup)
+			}
 			if err != nil {
 				return err
 			}
+			fmt.Printf("✅ Backup %s verified\n", report.Backup)
+			return nil
+		},
+	}
+	verifyCmd.Flags().StringSliceVar(&verifyComponents, "component", nil, "Verify only these components (comma-separated)")
+	verifyCmd.Flags().StringVar(&verifySuffix, "suffix", "-verify", "Suffix of the throwaway namespaces")
+	verifyCmd.Flags().DurationVar(&verifyTimeout, "timeout", 15*time.Minute, "How long the components get to become healthy")
+	verifyCmd.Flags().BoolVar(&verifyLatest, "latest", false, "Verify the latest completed backup")
+	verifyCmd.Flags().BoolVar(&verifyKeep, "keep", false, "Keep the throwaway namespaces for inspection")
+	verifyCmd.Flags().BoolVar(&verifyRecord, "record", false, "Record a successful verification in the deployment state")
+	cmd.AddCommand(verifyCmd)
+
+	locationCmd := &cobra.Command{
+		Use:   "location",
+		Short: "List the backup storage locations",
+		Long: `Manage the S3-compatible storage locations backups are written to.
+
+The default location is backup.location in the config. More locations keep
+backups outside the cluster they protect: "ceres backup create --location"
+writes one there, a policy with location: replicates on a schedule (a
+daily policy to the default location and one to the off-site location), and
+"ceres backup copy" copies an existing backup. The credentials of each
+location are kept in the Secret velero/ceres-location-<name>.
 
-			// Generate WireGuard client config and register peer on server
-			cfg, err := vpn.CreateClientConfig(vpnEndpoint, vpnPort, vpnClientIP)
+Examples:
+  ceres backup location add offsite --bucket ceres-offsite --url https://s3.example.com --region us-east-1
+  ceres backup location add dr --bucket ceres-backups --url http://10.0.0.5:9000 --read-only
+  ceres backup create --location offsite
+  ceres backup copy backup-20260101-020000 --to offsite`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
 			if err != nil {
 				return err
 			}
-			if strings.TrimSpace(vpnFilename) == "" {
-				vpnFilename = "ceres-vpn.conf"
+			locations, err := backupMgr.ListLocations()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tBUCKET\tURL\tREGION\tACCESS\tDEFAULT\tSTATUS\tVALIDATED")
+			for _, l := range locations {
+				bucket := l.Bucket
+				if l.Prefix != "" {
+					bucket += "/" + l.Prefix
+				}
+				url := l.URL
+				if url == "" {
+					url = "-"
+				}
+				access := "read-write"
+				if l.ReadOnly {
+					access = "read-only"
+				}
+				isDefault := ""
+				if l.Default {
+					isDefault = "yes"
+				}
+				status := l.Phase
+				if l.Message != "" && l.Phase != "Available" {
+					status += ": " + l.Message
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", l.Name, bucket, url, l.Region, access, isDefault, status, backupTime(l.LastValidated))
 			}
+			return w.Flush()
+		},
+	}
 
-			if strings.TrimSpace(subject) == "" {
-				subject = "CERES: VPN + сертификат"
+	var location backup.LocationOptions
+	addLocationCmd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add or update an S3-compatible storage location",
+		Long: `Add or update an S3-compatible storage location and wait until Velero
+reaches its bucket, which must exist.
+
+The keys default to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY; without
+any, Velero uses the credentials of its node.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == backup.DefaultLocation {
+				return fmt.Errorf("the default location is backup.location in the config (ceres config set backup.location.bucket ...)")
 			}
-			if strings.TrimSpace(body) == "" {
-				body = "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат (установить в доверенные корневые)\n2) WireGuard конфигурация (импортировать в приложение WireGuard)\n\nЕсли браузер ругается на HTTPS — установите Root CA, и предупреждения исчезнут.\n"
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			location.Name = args[0]
+			if location.AccessKey == "" && location.SecretKey == "" {
+				location.AccessKey, location.SecretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+			}
+			fmt.Printf("🪣 Adding location %s...\n", location.Name)
+			l, err := backupMgr.EnsureLocation(location)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✅ Location %s is %s\n", l.Name, l.Phase)
+			return nil
+		},
+	}
+	addLocationCmd.Flags().StringVar(&location.Bucket, "bucket", "", "Bucket (must exist)")
+	addLocationCmd.Flags().StringVar(&location.Prefix, "prefix", "", "Directory in the bucket")
+	addLocationCmd.Flags().StringVar(&location.URL, "url", "", "S3 endpoint URL, e.g. https://minio.example.com:9000 (empty for AWS)")
+	addLocationCmd.Flags().StringVar(&location.Region, "region", "us-east-1", "Bucket region")
+	addLocationCmd.Flags().StringVar(&location.AccessKey, "access-key", "", "Access key (default: $AWS_ACCESS_KEY_ID)")
+	addLocationCmd.Flags().StringVar(&location.SecretKey, "secret-key", "", "Secret key (default: $AWS_SECRET_ACCESS_KEY)")
+	addLocationCmd.Flags().BoolVar(&location.ReadOnly, "read-only", false, "Only restore from it, e.g. the backups of another cluster")
+	addLocationCmd.MarkFlagRequired("bucket")
+	locationCmd.AddCommand(addLocationCmd)
+
+	var removeYes bool
+	removeLocationCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a storage location and its credentials",
+		Long: `Remove a storage location and its credentials. The backups in its bucket
+stay there; Velero no longer lists them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			for _, p := range backup.Policies(&config.Current().Config) {
+				if p.Location == args[0] {
+					return fmt.Errorf("policy %s backs up to %s: change backup.policies first", p.Name, args[0])
+				}
+			}
+			if !removeYes {
+				fmt.Printf("Remove location %s? (y/n): ", args[0])
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Println("❌ Cancelled")
+					return nil
+				}
 			}
+			if err := backupMgr.RemoveLocation(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Location %s removed\n", args[0])
+			return nil
+		},
+	}
+	removeLocationCmd.Flags().BoolVarP(&removeYes, "yes", "y", false, "Do not ask for confirmation")
+	locationCmd.AddCommand(removeLocationCmd)
+	cmd.AddCommand(locationCmd)
+
+	var copyTo string
+	copyCmd := &cobra.Command{
+		Use:   "copy <backup> --to <location>",
+		Short: "Copy an existing backup to another storage location",
+		Long: `Copy the files of a completed backup from its storage location into another
+one, with a Job in the velero namespace. Both locations need keys (ceres
+backup location add --access-key). A cluster that has the target location,
+read-only for instance, restores the copy; this cluster keeps listing the
+original. Copies are not expired with the original, and the data of
+file-system volume backups is not copied.
 
-			mailMgr := mail.NewManager()
-			atts := []mail.Attachment{
-				{Filename: "ceres-root-ca.crt", ContentType: "application/x-x509-ca-cert", Data: ca},
-				{Filename: filepath.Base(vpnFilename), ContentType: "text/plain", Data: cfg},
+Examples:
+  ceres backup copy backup-20260101-020000 --to offsite`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
+			if err != nil {
+				return err
 			}
-			return mailMgr.SendEmail(toEmails, subject, body, atts)
+			if err := backupMgr.CopyBackup(args[0], copyTo); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Backup %s copied to %s\n", args[0], copyTo)
+			return nil
+		},
+	}
+	copyCmd.Flags().StringVar(&copyTo, "to", "", "Storage location to copy to (ceres backup location)")
+	copyCmd.MarkFlagRequired("to")
+	cmd.AddCommand(copyCmd)
+
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "List the backup policies and their schedules",
+		Long: `List the backup policies of backup.policies in the config, or the default
+daily one, with the Velero Schedule of each.
+
+"ceres backup policy apply" creates and updates the Schedules (ceres-<name>)
+and deletes those of removed policies; "ceres update" applies them too.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			policies, err := backupMgr.Policies(&config.Current().Config)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "POLICY\tSCHEDULE\tRETENTION\tCOMPONENTS\tLOCATION\tSTATUS\tLAST BACKUP")
+			for _, p := range policies {
+				components := strings.Join(p.Components, ",")
+				if components == "" {
+					components = "all"
+				}
+				status, last := "not applied", "-"
+				if s := p.Schedule; s != nil {
+					status, last = s.Phase, backupTime(s.LastBackup)
+					if s.Paused {
+						status = "Paused"
+					}
+					if s.Cron != p.BackupPolicy.Schedule {
+						status += " (changed, apply)"
+					}
+				}
+				location := p.Location
+				if location == "" {
+					location = backup.DefaultLocation
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.BackupPolicy.Schedule, p.Retention, components, location, status, last)
+			}
+			return w.Flush()
+		},
+	}
+	var dryRun bool
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Reconcile the backup policies into Velero schedules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupMgr, err := open()
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Println("📅 Backup policies (dry run):")
+			} else {
+				fmt.Println("📅 Applying backup policies...")
+			}
+			if err := backupMgr.ApplyPolicies(&config.Current().Config, dryRun); err != nil {
+				return err
+			}
+			if !dryRun {
+				fmt.Println("✅ Backup policies applied")
+			}
+			return nil
 		},
 	}
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes without making them")
+	policyCmd.AddCommand(applyCmd)
+	cmd.AddCommand(policyCmd)
 
-	sendOnboardingCmd.Flags().StringSliceVar(&toEmails, "to", nil, "Получатель (ровно один). Можно повторять флаг")
-	sendOnboardingCmd.Flags().StringVar(&vpnEndpoint, "vpn-endpoint", os.Getenv("CERES_VPN_ENDPOINT"), "VPN endpoint host/IP")
-	sendOnboardingCmd.Flags().IntVar(&vpnPort, "vpn-port", 51820, "VPN endpoint port")
-	sendOnboardingCmd.Flags().StringVar(&vpnClientIP, "vpn-client-ip", "", "Client VPN IP (по умолчанию выберется следующий свободный)")
-	sendOnboardingCmd.Flags().StringVar(&vpnFilename, "vpn-filename", "", "Имя вложения для VPN конфига")
-	sendOnboardingCmd.Flags().StringVar(&subject, "subject", "", "Тема письма")
-	sendOnboardingCmd.Flags().StringVar(&body, "body", "", "Текст письма")
+	return cmd
+}
 
-	cmd.AddCommand(sendOnboardingCmd)
-	
-	cmd.AddCommand(&cobra.Command{
-		Use:   "status",
-		Short: "Статус Mailcow",
+// backupTime formats a Velero timestamp for tables
+func backupTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// newBundleCmd creates the air-gapped bundle commands
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Offline bundles: images and charts for air-gapped installs",
+		Long: `Offline bundles for sites without internet access.
+
+  ceres bundle create -o ceres-bundle.tar.gz        # on a connected machine
+  ceres bundle load ceres-bundle.tar.gz --registry registry.lan:5000
+  CERES_IMAGE_REGISTRY=registry.lan:5000 ceres deploy
+
+Requires skopeo and helm.`,
+	}
+
+	var output string
+	var ignoreMissing bool
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Collect all images and charts into an OCI layout tarball",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mailMgr := mail.NewManager()
-			return mailMgr.Status()
+			deployer, err := deployment.NewDeployer("", "", "ceres")
+			if err != nil {
+				return err
+			}
+			refs, err := deployer.Images()
+			if err != nil {
+				return err
+			}
+
+			charts := []bundle.ChartSource{{
+				Name:    "ceres-platform",
+				Version: deployment.CeresVersion,
+				Path:    deployer.ChartPath(),
+			}}
+			for _, c := range deployment.UpstreamCharts {
+				charts = append(charts, bundle.ChartSource{Name: c.Name, RepoURL: c.RepoURL, Version: c.Version})
+			}
+
+			return bundle.Create(bundle.CreateOptions{
+				Output:        output,
+				CeresVersion:  deployment.CeresVersion,
+				Images:        refs,
+				Charts:        charts,
+				IgnoreMissing: ignoreMissing,
+			})
 		},
-	})
-	
+	}
+	createCmd.Flags().StringVarP(&output, "output", "o", "ceres-bundle-"+deployment.CeresVersion+".tar.gz", "Bundle file to write")
+	createCmd.Flags().BoolVar(&ignoreMissing, "ignore-missing", false, "Skip images that cannot be pulled (e.g. locally built ones)")
+
+	var registry string
+	var insecure bool
+	loadCmd := &cobra.Command{
+		Use:   "load <bundle.tar.gz>",
+		Short: "Push bundle images and charts into a private registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if registry == "" {
+				registry = deployment.ImageRegistry()
+			}
+			return bundle.Load(bundle.LoadOptions{Bundle: args[0], Registry: registry, Insecure: insecure})
+		},
+	}
+	loadCmd.Flags().StringVar(&registry, "registry", "", "Private registry host[:port] (default: CERES_IMAGE_REGISTRY)")
+	loadCmd.Flags().BoolVar(&insecure, "insecure", false, "Registry uses plain HTTP or a self-signed certificate")
+
+	cmd.AddCommand(createCmd)
+	cmd.AddCommand(loadCmd)
 	cmd.AddCommand(&cobra.Command{
-		Use:   "test <email>",
-		Short: "Отправить тестовое письмо",
+		Use:   "inspect <bundle.tar.gz>",
+		Short: "List images and charts in a bundle",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mailMgr := mail.NewManager()
-			return mailMgr.SendTestEmail(args[0])
+			index, err := bundle.Inspect(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("CERES %s bundle, created %s\n", index.CeresVersion, index.Created.Format("2006-01-02 15:04"))
+			fmt.Printf("\nImages (%d):\n", len(index.Images))
+			for _, img := range index.Images {
+				fmt.Printf("  %s\n", img.Source)
+			}
+			fmt.Printf("\nCharts (%d):\n", len(index.Charts))
+			for _, c := range index.Charts {
+				fmt.Printf("  %s %s\n", c.Name, c.Version)
+			}
+			return nil
 		},
 	})
-	
+
 	return cmd
 }
 
-func splitAndTrim(values []string) []string {
-	var out []string
-	for _, v := range values {
-		v = strings.TrimSpace(v)
-		if v == "" {
-			continue
+// newImagesCmd creates the image inventory / pinning commands
+func newImagesCmd() *cobra.Command {
+	var (
+		lockPath    string
+		registryURL string
+		insecure    bool
+		resolve     bool
+	)
+
+	loadDeployer := func() (*deployment.Deployer, string, error) {
+		deployer, err := deployment.NewDeployer("", "", "ceres")
+		if err != nil {
+			return nil, "", err
 		}
-		for _, p := range strings.Split(v, ",") {
-			p = strings.TrimSpace(p)
-			if p != "" {
-				out = append(out, p)
-			}
+		path := lockPath
+		if path == "" {
+			path = deployer.ResolvePath(images.LockFile)
 		}
+		return deployer, path, nil
 	}
-	return out
+	loadLock := func(path string) *images.Lock {
+		lock, err := images.LoadLock(path)
+		if err != nil {
+			return &images.Lock{}
+		}
+		return lock
+	}
+
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List images per component with tags and digests",
+		Long: `List every image used by the platform, per component, with its tag and digest.
+
+Digests come from the lock file (deployment/images.lock.yaml); --resolve
+looks up unpinned ones in the registry.
+
+Examples:
+  ceres images
+  ceres images lock                          # resolve digests, write the lock file
+  ceres deploy --pin                         # deploy by digest
+  ceres images outdated
+  ceres images outdated --registry-url http://localhost:5000   # stand-in registry`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployer, path, err := loadDeployer()
+			if err != nil {
+				return err
+			}
+			usages, err := deployer.Usages()
+			if err != nil {
+				return err
+			}
+			lock := loadLock(path)
+			registry := images.NewRegistry(registryURL, insecure)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "COMPONENT\tCONTAINER\tIMAGE\tTAG\tDIGEST")
+			for _, u := range usages {
+				ref := images.Parse(u.Image)
+				digest := lock.Digest(u.Image)
+				switch {
+				case ref.Digest != "":
+					digest = ref.Digest
+				case digest == "" && resolve:
+					if d, err := registry.Digest(ref); err == nil {
+						digest = d + " (unpinned)"
+					} else {
+						digest = "error: " + err.Error()
+					}
+				case digest == "":
+					digest = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.Component, u.Container, ref.Registry+"/"+ref.Path, ref.Tag, digest)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&lockPath, "lock", "", "Image lock file (default: deployment/images.lock.yaml)")
+	cmd.PersistentFlags().StringVar(&registryURL, "registry-url", "", "Query this registry instead of each image's own (default: images.mirror, $CERES_REGISTRY_URL)")
+	cmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "Skip TLS verification for registry lookups")
+	cmd.Flags().BoolVar(&resolve, "resolve", false, "Resolve digests of unpinned images from the registry")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "lock",
+		Short: "Resolve every image tag to a digest and write the lock file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployer, path, err := loadDeployer()
+			if err != nil {
+				return err
+			}
+			refs, err := deployer.Images()
+			if err != nil {
+				return err
+			}
+			registry := images.NewRegistry(registryURL, insecure)
+
+			lock := loadLock(path)
+			failed := 0
+			for _, r := range refs {
+				digest, err := registry.Digest(images.Parse(r))
+				if err != nil {
+					fmt.Printf("  ❌ %s: %v\n", r, err)
+					failed++
+					continue
+				}
+				if old := lock.Digest(r); old != "" && old != digest {
+					fmt.Printf("  🔄 %s: %s → %s\n", r, old, digest)
+				} else {
+					fmt.Printf("  ✓ %s %s\n", r, digest)
+				}
+				lock.Set(r, digest)
+			}
+			lock.Generated = time.Now().UTC()
+			if err := lock.Save(path); err != nil {
+				return err
+			}
+			fmt.Printf("\n✅ %d images pinned in %s\n", len(lock.Images), path)
+			if failed > 0 {
+				return fmt.Errorf("%d images could not be resolved", failed)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "outdated",
+		Short: "Compare pinned tags against the registry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployer, path, err := loadDeployer()
+			if err != nil {
+				return err
+			}
+			refs, err := deployer.Images()
+			if err != nil {
+				return err
+			}
+			lock := loadLock(path)
+			registry := images.NewRegistry(registryURL, insecure)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "IMAGE\tCURRENT\tLATEST\tNOTE")
+			outdated := 0
+			for _, r := range refs {
+				st := checkImage(registry, lock, r)
+				switch {
+				case st.Err != nil:
+					fmt.Fprintf(w, "%s\t%s\t?\t%v\n", r, st.Tag, st.Err)
+				case st.Outdated():
+					outdated++
+					note := ""
+					if st.DigestChanged {
+						note = "tag moved since lock"
+					}
+					latest := st.Latest
+					if latest == "" {
+						latest = st.Tag
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r, st.Tag, latest, note)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Printf("\n%d of %d images outdated\n", outdated, len(refs))
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// checkImage looks up newer tags and, for locked images, whether the tag moved
+func checkImage(registry *images.Registry, lock *images.Lock, ref string) images.Status {
+	r := images.Parse(ref)
+	st := images.Status{Image: ref, Tag: r.Tag}
+	if r.Tag == "" {
+		return st
+	}
+
+	tags, err := registry.Tags(r)
+	if err != nil {
+		st.Err = err
+		return st
+	}
+	st.Latest = images.NewerTag(r.Tag, tags)
+
+	if pinned := lock.Digest(ref); pinned != "" {
+		current, err := registry.Digest(r)
+		if err != nil {
+			st.Err = err
+			return st
+		}
+		st.DigestChanged = current != pinned
+	}
+	return st
+}
+
+// newPlanCmd creates the capacity planning command
+func newPlanCmd() *cobra.Command {
+	var (
+		profile    string
+		configPath string
+		engine     string
+		nodes      int
+		verbose    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Estimate CPU/memory/storage of a sizing profile against node capacity",
+		Long: `Render what deploy would apply with the selected sizing profile and add up
+CPU/memory requests and limits and persistent storage, then compare them
+with the allocatable capacity of the cluster nodes.
+
+Examples:
+  ceres plan --profile small
+  ceres plan --profile large --engine helm
+  ceres plan --profile medium --nodes 3 -v`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, invalid := resolveCLIConfig(configPath, "", changedFlags(cmd, map[string]string{"profile": "sizing.profile"}))
+			if r == nil {
+				return invalid
+			}
+			cfg := r.Config
+			if invalid != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  configuration invalid (%s): %v\n", r.ConfigPath, invalid)
+			}
+
+			deployer, err := deployment.NewDeployer(cfg.Cloud.Provider, cfg.Platform.Environment, "ceres")
+			if err != nil {
+				return err
+			}
+			if err := deployer.UseProfile(cfg.Sizing.Profile, cfg.Sizing.Components); err != nil {
+				return err
+			}
+
+			capacity, capErr := deployer.NodeCapacity()
+			if capErr == nil && !cmd.Flags().Changed("nodes") {
+				nodes = capacity.Nodes
+			}
+
+			totals, err := deployer.Plan(engine, cfg, nodes)
+			if err != nil {
+				return err
+			}
+
+			name := cfg.Sizing.Profile
+			if name == "" {
+				name = "none (manifests as written)"
+			}
+			fmt.Printf("📐 Sizing plan — profile: %s, engine: %s\n", name, engine)
+			fmt.Println("=====================================")
+
+			if verbose {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "COMPONENT\tKIND\tREPLICAS\tCPU REQ\tMEM REQ\tCPU LIM\tMEM LIM\tSTORAGE")
+				for _, u := range totals.Usages {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", u.Component, u.Kind, u.Replicas,
+						u.CPU.String(), u.Memory.String(), u.CPULimit.String(), u.MemoryLimit.String(), u.Storage.String())
+				}
+				w.Flush()
+				fmt.Println()
+			}
+
+			fmt.Printf("  CPU requests:    %s (limits %s)\n", totals.CPU.String(), totals.CPULimit.String())
+			fmt.Printf("  Memory requests: %s (limits %s)\n", formatBytes(totals.Memory.Value()), formatBytes(totals.MemoryLimit.Value()))
+			fmt.Printf("  Storage (PVCs):  %s\n", formatBytes(totals.Storage.Value()))
+			fmt.Println()
+
+			if capErr != nil {
+				fmt.Printf("⚠️  Node capacity unknown: %v\n", capErr)
+				return nil
+			}
+			fmt.Printf("  Cluster: %d node(s), allocatable CPU %s, memory %s\n",
+				capacity.Nodes, capacity.CPU.String(), formatBytes(capacity.Memory.Value()))
+
+			fits := true
+			if totals.CPU.Cmp(capacity.CPU) > 0 {
+				fits = false
+				fmt.Println("  ❌ CPU requests exceed allocatable CPU")
+			}
+			if totals.Memory.Cmp(capacity.Memory) > 0 {
+				fits = false
+				fmt.Println("  ❌ Memory requests exceed allocatable memory")
+			}
+			if fits {
+				cpuPct := float64(totals.CPU.MilliValue()) * 100 / float64(capacity.CPU.MilliValue())
+				memPct := float64(totals.Memory.Value()) * 100 / float64(capacity.Memory.Value())
+				fmt.Printf("  ✅ Fits: %.0f%% CPU, %.0f%% memory requested\n", cpuPct, memPct)
+				return nil
+			}
+			return fmt.Errorf("profile %q does not fit the cluster; try a smaller profile", cfg.Sizing.Profile)
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Sizing profile: small, medium, large (default: sizing.profile from config)")
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().StringVar(&engine, "engine", "kubectl", "Install engine to plan for (kubectl, helm)")
+	cmd.Flags().IntVar(&nodes, "nodes", 1, "Node count for DaemonSets when the cluster is not reachable")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show per-component breakdown")
+
+	return cmd
+}
+
+// formatBytes renders a byte count in Gi/Mi
+func formatBytes(b int64) string {
+	const gi = 1 << 30
+	if b >= gi {
+		return fmt.Sprintf("%.1fGi", float64(b)/gi)
+	}
+	return fmt.Sprintf("%dMi", b>>20)
+}
+
+// newRenderCmd creates the hidden helm post-renderer: sizing and image pinning
+// applied to manifests read from stdin
+func newRenderCmd() *cobra.Command {
+	var (
+		lockPath    string
+		profileFile string
+		sizeStorage bool
+	)
+
+	cmd := &cobra.Command{
+		Use:    "render",
+		Short:  "Apply sizing and image pinning to manifests on stdin (helm post-renderer)",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployer, err := deployment.NewDeployer("", "", "ceres")
+			if err != nil {
+				return err
+			}
+			if lockPath != "" {
+				if err := deployer.PinImages(lockPath); err != nil {
+					return err
+				}
+			}
+			if profileFile != "" {
+				if err := deployer.UseProfileFile(profileFile, sizeStorage); err != nil {
+					return err
+				}
+			}
+
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			out, err := deployer.PostRender(data)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(out)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&lockPath, "lock", "", "Image lock file")
+	cmd.Flags().StringVar(&profileFile, "profile-file", "", "Resolved sizing profile (YAML)")
+	cmd.Flags().BoolVar(&sizeStorage, "size-storage", false, "Also resize PVCs (fresh installs only)")
+
+	return cmd
+}
+
+// newSecretsCmd creates the credentials commands
+func newSecretsCmd() *cobra.Command {
+	var (
+		engine  string
+		backend string
+		file    string
+	)
+
+	openProvider := func() (secrets.Provider, error) {
+		opts := secrets.DefaultOptions()
+		if backend != "" {
+			opts.Backend = backend
+		}
+		if file != "" {
+			opts.File = file
+		}
+		return secrets.Open(opts)
+	}
+	openManager := func() (*secrets.Manager, error) {
+		p, err := openProvider()
+		if err != nil {
+			return nil, err
+		}
+		return secrets.NewManager(engine, p), nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "List and rotate generated credentials",
+		Long: `List and rotate the credentials generated on first install.
+
+Values are kept in a secrets backend and copied into the Secrets each service
+reads. They are never printed, except by "ceres secrets get".
+
+Backends (--backend or CERES_SECRETS_BACKEND):
+  kubernetes  the kube-system/ceres-credentials Secret (default)
+  vault       a KV v2 secret: VAULT_ADDR, VAULT_TOKEN, CERES_VAULT_MOUNT (secret), CERES_VAULT_PATH (ceres)
+  sops        an encrypted file in the repo (--file, default config/secrets.enc.yaml)
+
+Examples:
+  ceres secrets
+  ceres secrets get grafana
+  ceres secrets rotate postgresql     # ALTER ROLE, update secrets, restart apps
+  ceres secrets set smtp-password < pass.txt
+  VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root ceres secrets --backend vault`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := openManager()
+			if err != nil {
+				return err
+			}
+			list, err := m.List()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Engine: %s, backend: %s\n\n", m.Engine(), m.Provider().Name())
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "COMPONENT\tDESCRIPTION\tSTATUS\tROTATED\tSECRETS")
+			for _, s := range list {
+				status := "generated"
+				if !s.Generated {
+					status = "missing"
+				}
+				rotated := s.Rotated
+				if rotated == "" {
+					rotated = "-"
+				}
+				targets := strings.Join(s.Targets, ",")
+				if targets == "" {
+					targets = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Credential.Component, s.Credential.Description, status, rotated, targets)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&engine, "engine", "", "Deployment engine: kubectl or helm (default: detected)")
+	cmd.PersistentFlags().StringVar(&backend, "backend", "", "Secrets backend: kubernetes, vault or sops (default: $CERES_SECRETS_BACKEND)")
+	cmd.PersistentFlags().StringVar(&file, "file", "", "Encrypted file for the sops backend (default: config/secrets.enc.yaml in the CERES root)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the current value of a credential",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := openProvider()
+			if err != nil {
+				return err
+			}
+			v, err := p.Get(args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			fmt.Println(v)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <key>",
+		Short: "Store a value read from stdin (e.g. smtp-password)",
+		Long: `Store a value read from stdin, e.g. credentials of external services
+(smtp-password). Generated credentials should be changed with rotate instead,
+which also updates the running service.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			value := strings.TrimRight(string(data), "\r\n")
+			if value == "" {
+				return fmt.Errorf("no value on stdin")
+			}
+			p, err := openProvider()
+			if err != nil {
+				return err
+			}
+			if err := p.Set(map[string]string{args[0]: value}); err != nil {
+				return err
+			}
+			fmt.Printf("✅ %s stored in %s\n", args[0], p.Name())
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rotate <component>",
+		Short: "Rotate a credential and restart its dependents in order",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := openManager()
+			if err != nil {
+				return err
+			}
+			return m.Rotate(args[0])
+		},
+	})
+
+	return cmd
+}
+
+// newMailCmd команды почты
+func newMailCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mail",
+		Short: "Управление почтовым сервером",
+	}
+
+	var (
+		toEmails      []string
+		vpnEndpoint   string
+		vpnPort       int
+		vpnClientIP   string
+		vpnFilename   string
+		subject       string
+		body          string
+	)
+
+	sendOnboardingCmd := &cobra.Command{
+		Use:   "send-onboarding",
+		Short: "Отправить пользователю Root CA сертификат и WireGuard конфиг",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			toEmails = splitAndTrim(toEmails)
+			if len(toEmails) != 1 {
+				return fmt.Errorf("ровно один получатель обязателен: используйте --to user@domain")
+			}
+			platform := config.Current().Config
+			if strings.TrimSpace(vpnEndpoint) == "" {
+				vpnEndpoint = platform.VPN.Endpoint
+			}
+			if strings.TrimSpace(vpnEndpoint) == "" {
+				return fmt.Errorf("--vpn-endpoint обязателен (или vpn.endpoint в конфиге; например 192.168.1.3 или vpn.company.ru)")
+			}
+			if !cmd.Flags().Changed("vpn-port") && platform.VPN.Port != 0 {
+				vpnPort = platform.VPN.Port
+			}
+			if vpnPort == 0 {
+				vpnPort = 51820
+			}
+
+			// Export CERES Root CA from cluster
+			ca, err := tls.ReadPEMFromKubernetesTLSSecret("cert-manager", "ceres-root-ca")
+			if err != nil {
+				return err
+			}
+
+			// Generate WireGuard client config and register peer on server
+			cfg, err := vpn.CreateClientConfig(vpnEndpoint, vpnPort, vpnClientIP)
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(vpnFilename) == "" {
+				vpnFilename = "ceres-vpn.conf"
+			}
+
+			if strings.TrimSpace(subject) == "" {
+				subject = "CERES: VPN + сертификат"
+			}
+			if strings.TrimSpace(body) == "" {
+				body = "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат (установить в доверенные корневые)\n2) WireGuard конфигурация (импортировать в приложение WireGuard)\n\nЕсли браузер ругается на HTTPS — установите Root CA, и предупреждения исчезнут.\n"
+			}
+
+			mailMgr := mail.NewManager()
+			atts := []mail.Attachment{
+				{Filename: "ceres-root-ca.crt", ContentType: "application/x-x509-ca-cert", Data: ca},
+				{Filename: filepath.Base(vpnFilename), ContentType: "text/plain", Data: cfg},
+			}
+			return mailMgr.SendEmail(toEmails, subject, body, atts)
+		},
+	}
+
+	sendOnboardingCmd.Flags().StringSliceVar(&toEmails, "to", nil, "Получатель (ровно один). Можно повторять флаг")
+	sendOnboardingCmd.Flags().StringVar(&vpnEndpoint, "vpn-endpoint", "", "VPN endpoint host/IP (по умолчанию vpn.endpoint из конфига)")
+	sendOnboardingCmd.Flags().IntVar(&vpnPort, "vpn-port", 51820, "VPN endpoint port")
+	sendOnboardingCmd.Flags().StringVar(&vpnClientIP, "vpn-client-ip", "", "Client VPN IP (по умолчанию выберется следующий свободный)")
+	sendOnboardingCmd.Flags().StringVar(&vpnFilename, "vpn-filename", "", "Имя вложения для VPN конфига")
+	sendOnboardingCmd.Flags().StringVar(&subject, "subject", "", "Тема письма")
+	sendOnboardingCmd.Flags().StringVar(&body, "body", "", "Текст письма")
+
+	cmd.AddCommand(sendOnboardingCmd)
+	
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Статус Mailcow",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mailMgr := mail.NewManager()
+			return mailMgr.Status()
+		},
+	})
+	
+	cmd.AddCommand(&cobra.Command{
+		Use:   "test <email>",
+		Short: "Отправить тестовое письмо",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mailMgr := mail.NewManager()
+			return mailMgr.SendTestEmail(args[0])
+		},
+	})
+	
+	return cmd
+}
+
+func splitAndTrim(values []string) []string {
+	var out []string
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// newDomainCmd creates the domain command
+func newDomainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "domain",
+		Short: "Manage the platform domain",
+	}
+	cmd.AddCommand(newDomainChangeCmd())
+	return cmd
+}
+
+// newDomainChangeCmd creates the domain change command
+func newDomainChangeCmd() *cobra.Command {
+	var (
+		configPath  string
+		from        string
+		dryRun      bool
+		yes         bool
+		skipCluster bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "change <new-domain>",
+		Short: "Move the platform to another domain",
+		Long: `Move the platform to another domain. Everything that names the current
+domain is updated:
+
+  - Keycloak: realm frontend URL, client redirect URIs and web origins
+  - ingress hosts, TLS hosts and annotations (oauth2-proxy auth URLs)
+  - cert-manager Certificates (those of ingresses follow their ingress)
+  - config maps (oauth2-proxy cookie domain, mail domain, ...) and the
+    workloads that read them are restarted, env values in pod templates
+  - the config file (platform.domain, mail.from), /etc/ceres/ceres.env and
+    a customised config/keycloak-realm.json
+
+Examples:
+  ceres domain change company.com --dry-run
+  ceres domain change company.com
+  ceres domain change company.com --from old.company.com --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, invalid := resolveCLIConfig(configPath, "", nil)
+			if r == nil {
+				return invalid
+			}
+			if strings.TrimSpace(from) == "" {
+				from = r.Config.Platform.Domain
+			}
+			deployer, err := deployment.NewDeployer("", "", "ceres")
+			if err != nil {
+				return err
+			}
+
+			plan, err := domain.NewPlan(from, args[0], domain.Options{
+				ConfigPath:  r.ConfigPath,
+				RealmFile:   deployer.ResolvePath("config/keycloak-realm.json"),
+				SkipCluster: skipCluster,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("🌐 Domain change: %s → %s\n", plan.Old, plan.New)
+			fmt.Println("=====================================")
+			for _, step := range plan.Steps {
+				fmt.Printf("\n%s %s\n", step.Kind, step.Name)
+				for _, c := range step.Changes {
+					fmt.Printf("  %s\n    - %s\n    + %s\n", c.Field, c.From, c.To)
+				}
+				for _, ref := range step.Restarts {
+					fmt.Printf("  restart %s\n", ref)
+				}
+			}
+			if plan.Empty() {
+				fmt.Println("\nNothing names " + plan.Old)
+			}
+			fmt.Println()
+			for _, s := range plan.Skipped {
+				fmt.Printf("⚠️  not checked: %s\n", s)
+			}
+			for _, n := range plan.Notes {
+				fmt.Printf("ℹ️  %s\n", n)
+			}
+			if plan.Empty() {
+				return nil
+			}
+			if dryRun {
+				fmt.Println("📋 DRY-RUN: No changes will be made")
+				return nil
+			}
+
+			if !yes {
+				fmt.Printf("Apply %d changes? (y/n): ", len(plan.Steps))
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Println("❌ Cancelled")
+					return nil
+				}
+			}
+			if err := plan.Apply(); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Platform domain is now %s\n", plan.New)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().StringVar(&from, "from", "", "Current domain (default: platform.domain)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the plan without changing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply without asking")
+	cmd.Flags().BoolVar(&skipCluster, "skip-cluster", false, "Only update the local files")
+
+	return cmd
+}
+
+// newDBCmd creates the database commands
+func newDBCmd() *cobra.Command {
+	var (
+		configPath  string
+		portForward bool
+	)
+
+	// prepare loads the config and refuses the helm engine, whose
+	// PostgreSQL chart creates the users of the services itself
+	prepare := func() error {
+		if r, invalid := resolveCLIConfig(configPath, "", nil); r == nil {
+			return invalid
+		}
+		if secrets.DetectEngine() == secrets.EngineHelm {
+			return fmt.Errorf("ceres db manages the kubectl engine: the helm chart creates the databases of the services")
+		}
+		return nil
+	}
+	connect := func() (*db.Client, error) {
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+		return db.Connect(db.Options{PortForward: portForward})
+	}
+
+	list := func(cmd *cobra.Command, args []string) error {
+		c, err := connect()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		dbs := db.Enabled(config.Current().Config)
+		if len(dbs) == 0 {
+			fmt.Println("No enabled service keeps its data in PostgreSQL")
+			return nil
+		}
+		list, err := c.List(dbs)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("PostgreSQL: %s\n\n", c.Target())
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tDATABASE\tOWNER\tSIZE\tSTATUS")
+		for _, s := range list {
+			status, owner, size := "ok", s.Owner, s.Size
+			switch {
+			case !s.Exists:
+				status, owner, size = "missing", "-", "-"
+			case s.Owner != s.Role:
+				status = "owner is not " + s.Role
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Service, s.Name, owner, size, status)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		for _, s := range list {
+			if !s.Exists || s.Owner != s.Role {
+				fmt.Println("\nRun \"ceres db ensure\" to create the missing databases and roles")
+				break
+			}
+		}
+		return nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the PostgreSQL databases of the services",
+		Long: `Manage the databases of the shared PostgreSQL (kubectl engine).
+
+Each service that keeps its data in PostgreSQL has its own database and an
+owner role of the same name, whose password is the <service>-db credential
+("ceres secrets"). Deploy and update ensure them; psql runs inside the
+PostgreSQL pod as the superuser of ceres-core/postgresql-secret, or locally
+with --port-forward.
+
+Examples:
+  ceres db
+  ceres db ensure
+  ceres db shell gitlab
+  ceres db dump nextcloud -o nextcloud.sql
+  ceres db dump gitlab --format custom --port-forward -o gitlab.dump
+  ceres db backups                    # scheduled pg_dumps in MinIO (backup.databases)
+  ceres db restore gitlab --from 20260101-013000`,
+		RunE: list,
+	}
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.PersistentFlags().BoolVar(&portForward, "port-forward", false, "Run the local psql and pg_dump through kubectl port-forward")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the databases of the enabled services",
+		Args:  cobra.NoArgs,
+		RunE:  list,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "ensure",
+		Short: "Create the missing databases and owner roles",
+		Long: `Write the <service>-db credentials into the Secrets of the services and
+create the database and owner role of every enabled service, or bring them in
+line: the role logs in with its credential and owns the database and the
+objects the superuser created in it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := prepare(); err != nil {
+				return err
+			}
+			deployer, err := deployment.NewDeployer("", "", "ceres")
+			if err != nil {
+				return err
+			}
+			return deployer.EnsureDatabases()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "shell <service>",
+		Short: "Open psql in the database of a service",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := db.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			c, err := connect()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			return c.Shell(d.Name)
+		},
+	})
+
+	var (
+		output string
+		format string
+	)
+	dumpCmd := &cobra.Command{
+		Use:   "dump <service>",
+		Short: "Write pg_dump of the database of a service",
+		Long: `Write pg_dump of the database of a service to stdout or --output. The dump
+has no owners or grants, so it restores into a database of any role.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "plain" && format != "custom" {
+				return fmt.Errorf("unknown format %q (one of plain, custom)", format)
+			}
+			d, err := db.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			c, err := connect()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			if output == "" || output == "-" {
+				return c.Dump(d.Name, format, os.Stdout)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := c.Dump(d.Name, format, f); err != nil {
+				f.Close()
+				os.Remove(output)
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "✅ %s dumped to %s\n", d.Name, output)
+			return nil
+		},
+	}
+	dumpCmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default: stdout)")
+	dumpCmd.Flags().StringVar(&format, "format", "plain", "pg_dump format: plain or custom")
+	cmd.AddCommand(dumpCmd)
+
+	openBackups := func() (*deployment.Deployer, *db.Backups, error) {
+		if err := prepare(); err != nil {
+			return nil, nil, err
+		}
+		deployer, err := deployment.NewDeployer("", "", "ceres")
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := deployer.DatabaseBackups()
+		return deployer, b, err
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "backups [service]",
+		Short: "List the logical backups in the object storage",
+		Long: `List the pg_dump backups of the service databases kept in the bucket of
+backup.databases. The timestamps are what "ceres db restore --from" takes.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var only string
+			if len(args) == 1 {
+				d, err := db.Lookup(args[0])
+				if err != nil {
+					return err
+				}
+				only = d.Name
+			}
+			_, b, err := openBackups()
+			if err != nil {
+				return err
+			}
+			dumps, err := b.List()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tTIMESTAMP")
+			n := 0
+			for _, dump := range dumps {
+				if only == "" || dump.Database == only {
+					fmt.Fprintf(w, "%s\t%s\n", dump.Database, dump.Stamp)
+					n++
+				}
+			}
+			if n == 0 {
+				fmt.Println("No database backups yet")
+				return nil
+			}
+			return w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "backup <service>",
+		Short: "Dump the database of a service to the object storage now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := db.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			_, b, err := openBackups()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("💾 Dumping %s...\n", d.Name)
+			if err := b.Backup(d); err != nil {
+				return err
+			}
+			fmt.Printf("✅ %s backed up\n", d.Name)
+			return nil
+		},
+	})
+
+	var verifyFrom string
+	verifyCmd := &cobra.Command{
+		Use:   "verify <service>",
+		Short: "Restore a backup into a scratch database to prove it is usable",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := db.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			_, b, err := openBackups()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("🔍 Verifying %s %s...\n", d.Name, verifyFrom)
+			if err := b.Verify(d, verifyFrom); err != nil {
+				return err
+			}
+			fmt.Printf("✅ %s restores\n", d.Name)
+			return nil
+		},
+	}
+	verifyCmd.Flags().StringVar(&verifyFrom, "from", "latest", "Timestamp of the backup (ceres db backups)")
+	cmd.AddCommand(verifyCmd)
+
+	var (
+		from string
+		yes  bool
+	)
+	restoreCmd := &cobra.Command{
+		Use:   "restore <service> --from <timestamp>",
+		Short: "Replace the database of a service with a backup",
+		Long: `Replace the database of a service with a backup: the service is stopped,
+the database dropped and restored from the dump, its objects handed to the
+owner role, and the service started again.
+
+Examples:
+  ceres db backups gitlab
+  ceres db restore gitlab --from 20260101-013000
+  ceres db restore wiki --from latest --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" {
+				return fmt.Errorf("--from is required: a timestamp of \"ceres db backups\" or latest")
+			}
+			d, err := db.Lookup(args[0])
+			if err != nil {
+				return err
+			}
+			deployer, b, err := openBackups()
+			if err != nil {
+				return err
+			}
+			dump, err := b.Find(d, from)
+			if err != nil {
+				return err
+			}
+			if !yes {
+				fmt.Printf("Replace the %s database with the backup %s? %s is stopped meanwhile (y/n): ", d.Name, dump.Stamp, d.Service)
+				var confirm string
+				if _, err := fmt.Scanln(&confirm); err != nil || (confirm != "y" && confirm != "Y") {
+					fmt.Println("❌ Cancelled")
+					return nil
+				}
+			}
+
+			store, err := deployer.SecretProvider()
+			if err != nil {
+				return err
+			}
+			password, err := secrets.NewManager(secrets.EngineKubectl, store).Get(d.Credential())
+			if err != nil {
+				return err
+			}
+			c, err := db.Connect(db.Options{PortForward: portForward})
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			fmt.Printf("🔄 Restoring %s from %s...\n", d.Name, dump.Stamp)
+			if err := b.Restore(c, d, dump, password); err != nil {
+				return err
+			}
+			fmt.Printf("✅ %s restored\n", d.Name)
+			return nil
+		},
+	}
+	restoreCmd.Flags().StringVar(&from, "from", "", "Timestamp of the backup (ceres db backups), or latest")
+	restoreCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+	cmd.AddCommand(restoreCmd)
+
+	return cmd
+}
+
+// newDNSCmd creates the dns command
+func newDNSCmd() *cobra.Command {
+	var (
+		configPath string
+		domainName string
+		format     string
+		ip         string
+		output     string
+		apply      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dns",
+		Short: "Print DNS records for the platform hosts",
+		Long: `Print DNS records for the ingress hosts of the platform domain, read from
+the cluster. Each host gets the address of its ingress load balancer, else
+the ingress controller's load balancer, else a node address (ExternalIP
+before InternalIP); --ip overrides it.
+
+Formats:
+  hosts    /etc/hosts snippet
+  zone     BIND zone file
+  dnsmasq  dnsmasq address= lines
+  coredns  coredns-custom ConfigMap for the k3s CoreDNS, which VPN
+           clients use as their resolver (--apply installs it)
+
+Examples:
+  ceres dns
+  ceres dns --format zone -o /etc/bind/db.company.com
+  ceres dns --format coredns --apply`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains(dns.Formats, format) {
+				return fmt.Errorf("unknown format %q (one of %s)", format, strings.Join(dns.Formats, ", "))
+			}
+			if apply && format != "coredns" {
+				return fmt.Errorf("--apply needs --format coredns")
+			}
+			if domainName == "" {
+				r, invalid := resolveCLIConfig(configPath, "", nil)
+				if r == nil {
+					return invalid
+				}
+				domainName = r.Config.Platform.Domain
+			}
+
+			inv, err := dns.Discover(dns.Options{Domain: domainName, IP: ip})
+			if err != nil {
+				return err
+			}
+			if missing := inv.Unresolved(); len(missing) > 0 {
+				return fmt.Errorf("no address found for %s: use --ip", strings.Join(missing, ", "))
+			}
+			text, err := dns.Render(inv, format)
+			if err != nil {
+				return err
+			}
+
+			sources := map[string]bool{}
+			for _, r := range inv.Records {
+				if !sources[r.Source] {
+					sources[r.Source] = true
+					fmt.Fprintf(os.Stderr, "ℹ️  %s from %s\n", r.IP, r.Source)
+				}
+			}
+
+			switch {
+			case apply:
+				c := exec.Command("kubectl", "apply", "-f", "-")
+				c.Stdin = strings.NewReader(text)
+				c.Stdout, c.Stderr = os.Stdout, os.Stderr
+				if err := c.Run(); err != nil {
+					return fmt.Errorf("failed to apply %s: %w", dns.CoreDNSConfigMap, err)
+				}
+				fmt.Printf("✅ CoreDNS resolves %d hosts of %s\n", len(inv.Records), inv.Domain)
+			case output != "":
+				if err := os.WriteFile(output, []byte(text), 0644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", output, err)
+				}
+				fmt.Fprintf(os.Stderr, "✅ %d hosts written to %s\n", len(inv.Records), output)
+			default:
+				fmt.Print(text)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().StringVar(&domainName, "domain", "", "Domain to list (default: platform.domain)")
+	cmd.Flags().StringVarP(&format, "format", "f", "hosts", "Output format: "+strings.Join(dns.Formats, ", "))
+	cmd.Flags().StringVar(&ip, "ip", "", "Address for all hosts instead of the discovered one")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to a file instead of stdout")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Apply the coredns ConfigMap to the cluster")
+
+	return cmd
+}
+
+// newServicesCmd creates the services command
+func newServicesCmd() *cobra.Command {
+	var (
+		configPath   string
+		format       string
+		all          bool
+		skipKeycloak bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "services [service...]",
+		Short: "List the platform services: URLs, SSO, health and credentials",
+		Long: `List the platform services from the cluster: the URLs each is reached at
+(ingress, load balancer, NodePort, cluster address), how it logs users in
+(Keycloak OIDC client or oauth2-proxy), the readiness of its workloads and
+the Secrets its generated credentials are kept in.
+
+Naming services shows them in detail.
+
+Examples:
+  ceres services
+  ceres services gitlab grafana
+  ceres services --format json
+  ceres services --format markdown   # the Proxmox notes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" && format != "markdown" {
+				return fmt.Errorf("unknown format %q (one of table, json, markdown)", format)
+			}
+			if r, invalid := resolveCLIConfig(configPath, "", nil); r == nil {
+				return invalid
+			}
+			cat, err := catalog.Discover(catalog.Options{Names: args, All: all, SkipKeycloak: skipKeycloak})
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case format == "json":
+				data, err := json.MarshalIndent(cat, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			case format == "markdown":
+				fmt.Print(cat.Markdown())
+				return nil
+			case len(args) > 0:
+				printServiceDetails(cat)
+			default:
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "SERVICE\tHEALTH\tSSO\tURL")
+				for _, s := range cat.Services {
+					url := s.URL()
+					if url == "" {
+						url = "-"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.Health, s.SSO, url)
+				}
+				w.Flush()
+			}
+			for _, warning := range cat.Warnings {
+				fmt.Printf("\n⚠️  %s\n", warning)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().StringVarP(&format, "format", "f", "table", "Output format: table, json, markdown")
+	cmd.Flags().BoolVar(&all, "all", false, "Include the services the config leaves out")
+	cmd.Flags().BoolVar(&skipKeycloak, "skip-keycloak", false, "Do not ask Keycloak which OIDC clients are registered")
+
+	return cmd
+}
+
+func printServiceDetails(cat *catalog.Catalog) {
+	for i, s := range cat.Services {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s, namespace %s)\n", s.Title, s.Name, s.Namespace)
+		if !s.Enabled {
+			fmt.Println("  disabled in the config")
+		}
+		fmt.Printf("  Health: %s\n", s.Health)
+		for _, w := range s.Health.Workloads {
+			fmt.Printf("    %s\n", w)
+		}
+		fmt.Printf("  SSO:    %s\n", s.SSO)
+		if len(s.URLs) > 0 {
+			fmt.Println("  URLs:")
+			for _, u := range s.URLs {
+				fmt.Printf("    %-12s %s (%s)\n", u.Kind, u.URL, u.Object)
+			}
+		}
+		if len(s.Credentials) > 0 {
+			fmt.Println("  Credentials:")
+			for _, c := range s.Credentials {
+				fmt.Printf("    %s: %s\n      %s\n", c.Description, c.Secret, c.Command)
+			}
+		}
+	}
+}
+
+// newProxmoxCmd creates the Proxmox commands
+func newProxmoxCmd() *cobra.Command {
+	var configPath string
+
+	cmd := &cobra.Command{
+		Use:   "proxmox",
+		Short: "Proxmox VE inventory and notes",
+		Long: `Talk to the Proxmox VE API configured in cloud.proxmox with an API token.
+
+The token ID is cloud.proxmox.tokenID (user@realm!name); its secret is
+CERES_PROXMOX_TOKEN or proxmox-token in the secrets backend:
+  ceres secrets set proxmox-token`,
+	}
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+
+	client := func() (*proxmox.Client, error) {
+		if r, invalid := resolveCLIConfig(configPath, "", nil); r == nil {
+			return nil, invalid
+		}
+		return proxmox.FromConfig()
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "nodes",
+		Short: "List the cluster nodes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := client()
+			if err != nil {
+				return err
+			}
+			nodes, err := c.Nodes()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tSTATUS\tCPU\tMEMORY")
+			for _, n := range nodes {
+				fmt.Fprintf(w, "%s\t%s\t%.0f%% of %d\t%d/%d MiB\n", n.Name, n.Status, n.CPU*100, n.MaxCPU, n.Mem>>20, n.MaxMem>>20)
+			}
+			return w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "vms",
+		Short: "List the VMs and containers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := client()
+			if err != nil {
+				return err
+			}
+			vms, err := c.VMs()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TARGET\tNAME\tNODE\tSTATUS\tTAGS")
+			for _, vm := range vms {
+				status := vm.Status
+				if vm.Template != 0 {
+					status = "template"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", vm.Target(), vm.Name, vm.Node, status, vm.Tags)
+			}
+			return w.Flush()
+		},
+	})
+
+	notesCmd := &cobra.Command{
+		Use:   "notes",
+		Short: "Keep the service catalog in the Proxmox notes",
+	}
+	notesCmd.AddCommand(newProxmoxNotesSyncCmd(client))
+	cmd.AddCommand(notesCmd)
+
+	return cmd
+}
+
+// newProxmoxNotesSyncCmd creates the proxmox notes sync command
+func newProxmoxNotesSyncCmd(client func() (*proxmox.Client, error)) *cobra.Command {
+	var (
+		targets      []string
+		dryRun       bool
+		skipKeycloak bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Write the service catalog into the notes of the Proxmox VMs",
+		Long: `Render the service catalog (see ceres services --format markdown) and write it
+into the notes of the given targets. Only the block between the
+CERES-AUTO-NOTES markers is replaced; notes written by hand are kept.
+
+Targets are node, node/<name>, qemu/<vmid> or lxc/<vmid>. Without --target
+they are cloud.proxmox.notes, else the VMs and containers tagged "ceres",
+else the node.
+
+Examples:
+  ceres proxmox notes sync
+  ceres proxmox notes sync --target qemu/100 --target node
+  ceres proxmox notes sync --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := client()
+			if err != nil {
+				return err
+			}
+			if len(targets) == 0 {
+				targets = config.Current().Config.Cloud.Proxmox.Notes
+			}
+			var list []proxmox.Target
+			for _, s := range targets {
+				t, err := proxmox.ParseTarget(s)
+				if err != nil {
+					return err
+				}
+				list = append(list, t)
+			}
+			if len(list) == 0 {
+				if list, err = c.DefaultTargets("ceres"); err != nil {
+					return err
+				}
+			}
+
+			cat, err := catalog.Discover(catalog.Options{SkipKeycloak: skipKeycloak})
+			if err != nil {
+				return err
+			}
+			results, err := c.SyncNotes(list, cat.Markdown(), dryRun)
+			for _, r := range results {
+				switch {
+				case !r.Changed:
+					fmt.Printf("  %s: up to date\n", r.Target)
+				case dryRun:
+					fmt.Printf("  %s: would update\n", r.Target)
+				default:
+					fmt.Printf("✅ %s: notes updated\n", r.Target)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Println()
+				fmt.Print(proxmox.MergeNotes("", cat.Markdown()))
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&targets, "target", nil, "Target to update: node, node/<name>, qemu/<vmid>, lxc/<vmid> (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the notes without writing them")
+	cmd.Flags().BoolVar(&skipKeycloak, "skip-keycloak", false, "Do not ask Keycloak which OIDC clients are registered")
+
+	return cmd
+}
+
+// newInfraCmd creates the infrastructure commands
+func newInfraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "infra",
+		Short: "Create and remove the machines CERES runs on",
+		Long: `Create the cluster CERES is deployed to and keep a cluster profile for it in
+~/.ceres/clusters/<name>: where the cluster is and its kubeconfig. The CLI
+config points cloud.kubernetes.kubeconfig at the profile, so later commands
+talk to the new cluster.
+
+proxmox clones cloud.proxmox.vm.template through the Proxmox API, sets the
+cloud-init user, SSH key and address, starts the VM and installs k3s on it
+over SSH.
+
+aws, azure and gcp run the Terraform in infrastructure/, in the workspace
+<cloud>-<environment>. plan, apply and destroy drive it step by step; up and
+down do the same as apply and destroy.`,
+	}
+
+	cmd.AddCommand(newInfraUpCmd())
+	cmd.AddCommand(newInfraDownCmd())
+	cmd.AddCommand(newInfraPlanCmd())
+	cmd.AddCommand(newInfraApplyCmd())
+	cmd.AddCommand(newInfraDestroyCmd())
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the cluster profiles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := infra.Profiles()
+			if err != nil {
+				return err
+			}
+			if len(profiles) == 0 {
+				fmt.Println("No clusters, create one with `ceres infra up`")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCLOUD\tMACHINES\tENDPOINT\tKUBECONFIG")
+			for _, p := range profiles {
+				machines, endpoint := "-", p.Endpoint
+				switch {
+				case p.VMID != 0:
+					machines = fmt.Sprintf("%s/qemu/%d", p.Node, p.VMID)
+				case p.Workspace != "":
+					machines = p.Cluster + " (workspace " + p.Workspace + ")"
+				}
+				if endpoint == "" {
+					endpoint = "(not finished)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, p.Cloud, machines, endpoint, p.Kubeconfig())
+			}
+			return w.Flush()
+		},
+	})
+
+	return cmd
+}
+
+// infraFlags are the flags the infra commands share
+type infraFlags struct {
+	configPath  string
+	cloud       string
+	environment string
+	name        string
+	dir         string
+	vars        []string
+}
+
+func (f *infraFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.configPath, "config", "", "Path to CLI config.yaml (default: ~/.ceres/config.yaml)")
+	cmd.Flags().StringVar(&f.cloud, "cloud", "", "Cloud provider: proxmox, aws, azure, gcp (default: cloud.provider from config)")
+	cmd.Flags().StringVar(&f.environment, "environment", "", "Environment: dev, staging, prod (default: platform.environment from config)")
+	cmd.Flags().StringVar(&f.name, "name", "", "Cluster profile (default: cloud.proxmox.vm.name or ceres on proxmox, <cloud>-<environment> with Terraform)")
+	cmd.Flags().StringVar(&f.dir, "dir", "", "Terraform module (default: infrastructure/ of the CERES checkout)")
+	cmd.Flags().StringArrayVar(&f.vars, "var", nil, "Extra Terraform variable, name=value (repeatable)")
+}
+
+// resolve loads the config with the flags on top
+func (f *infraFlags) resolve(cmd *cobra.Command) (*config.Resolved, error) {
+	overlay := ""
+	if cmd.Flags().Changed("environment") {
+		overlay = f.environment
+	}
+	r, invalid := resolveCLIConfig(f.configPath, overlay, changedFlags(cmd, map[string]string{
+		"cloud":       "cloud.provider",
+		"environment": "platform.environment",
+	}))
+	if r == nil {
+		return nil, invalid
+	}
+	if invalid != nil {
+		return nil, fmt.Errorf("configuration invalid (%s), see above", r.ConfigPath)
+	}
+	return r, nil
+}
+
+// terraform returns the Terraform runner for cloud and environment, with
+// the variables of cfg and --var on top
+func (f *infraFlags) terraform(cfg *config.Config, cloud, environment string) (*infra.Terraform, error) {
+	tf, err := infra.NewTerraform(cloud, environment, f.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range f.vars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("--var %q: expected name=value", kv)
+		}
+		tf.Vars[k] = v
+	}
+	tf.Variables(cfg)
+	return tf, nil
+}
+
+// profileName is --name, else the default profile of the cloud
+func (f *infraFlags) profileName(cfg *config.Config) string {
+	switch {
+	case f.name != "":
+		return f.name
+	case infra.IsTerraformCloud(cfg.Cloud.Provider):
+		return cfg.Cloud.Provider + "-" + cfg.Platform.Environment
+	case cfg.Cloud.Proxmox.VM.Name != "":
+		return cfg.Cloud.Proxmox.VM.Name
+	}
+	return infra.DefaultName
+}
+
+// newInfraUpCmd creates the infra up command
+func newInfraUpCmd() *cobra.Command {
+	var (
+		flags     infraFlags
+		namespace string
+		noDeploy  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Create the cluster and deploy CERES to it",
+		Long: `Create the cluster, save its profile and kubeconfig, point the CLI config
+at it and deploy CERES (like ceres deploy) unless --no-deploy is given.
+Running it again for an existing proxmox profile only deploys; with
+Terraform it applies changes first.
+
+The proxmox API token secret is needed before the cluster exists, when the
+kubernetes secrets backend cannot be read yet: set CERES_PROXMOX_TOKEN, or
+store it in the sops file of the checkout first, which is read when the
+cluster is unreachable (ceres secrets set proxmox-token --backend sops).
+
+Examples:
+  ceres infra up --cloud proxmox
+  ceres infra up --cloud proxmox --name ceres-dev --no-deploy
+  ceres infra up --cloud aws --environment prod`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := flags.resolve(cmd)
+			if err != nil {
+				return err
+			}
+			cfg := &r.Config
+
+			var prof *infra.Profile
+			switch {
+			case cfg.Cloud.Provider == "proxmox":
+				p, err := infra.NewProxmox()
+				if err != nil {
+					return err
+				}
+				if flags.name != "" {
+					p.VM.Name = flags.name
+				}
+				if prof, err = p.Up(); err != nil {
+					if prof != nil {
+						fmt.Fprintf(os.Stderr, "⚠️  VM %d is left as it is: fix the problem and run `ceres infra down --name %s` to remove it\n", prof.VMID, prof.Name)
+					}
+					return err
+				}
+			case infra.IsTerraformCloud(cfg.Cloud.Provider):
+				tf, err := flags.terraform(cfg, cfg.Cloud.Provider, cfg.Platform.Environment)
+				if err != nil {
+					return err
+				}
+				if prof, err = terraformApply(tf, "", flags.profileName(cfg)); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("ceres infra up does not support %s: it creates proxmox, aws, azure and gcp clusters", cfg.Cloud.Provider)
+			}
+
+			if err := useClusterProfile(r.ConfigPath, prof); err != nil {
+				return err
+			}
+			if noDeploy {
+				fmt.Println("Deploy with: ceres deploy")
+				return nil
+			}
+			return deployToCluster(cfg, namespace, prof)
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVar(&namespace, "namespace", "ceres", "Kubernetes namespace")
+	cmd.Flags().BoolVar(&noDeploy, "no-deploy", false, "Only create the cluster")
+
+	return cmd
+}
+
+// newInfraDownCmd creates the infra down command
+func newInfraDownCmd() *cobra.Command {
+	var (
+		flags infraFlags
+		yes   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Delete the cluster and its profile",
+		Long: `Delete the machines of a cluster profile, with everything deployed on them,
+and remove the profile. The CLI config stops pointing at it.
+
+Examples:
+  ceres infra down
+  ceres infra down --name ceres-dev --yes
+  ceres infra down --name aws-prod`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := flags.resolve(cmd)
+			if err != nil {
+				return err
+			}
+			prof, err := infra.LoadProfile(flags.profileName(&r.Config))
+			if err != nil {
+				return err
+			}
+
+			if !yes {
+				target := prof.Name
+				switch {
+				case prof.VMID != 0:
+					target = fmt.Sprintf("%s (VM %d on %s, %s)", prof.Name, prof.VMID, prof.Node, prof.Address)
+				case prof.Workspace != "":
+					target = fmt.Sprintf("%s (%s, Terraform workspace %s)", prof.Name, prof.Cluster, prof.Workspace)
+				}
+				if !confirmDeletion(target) {
+					return nil
+				}
+			}
+
+			switch {
+			case prof.Cloud == "proxmox":
+				p, err := infra.NewProxmox()
+				if err != nil {
+					return err
+				}
+				if err := p.Down(prof); err != nil {
+					return err
+				}
+			case infra.IsTerraformCloud(prof.Cloud):
+				environment := strings.TrimPrefix(prof.Workspace, prof.Cloud+"-")
+				tf, err := flags.terraform(&r.Config, prof.Cloud, environment)
+				if err != nil {
+					return err
+				}
+				if err := terraformDestroy(tf, prof); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("cluster %s: unsupported cloud %q", prof.Name, prof.Cloud)
+			}
+			return forgetClusterProfile(r, prof)
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+// newInfraPlanCmd creates the infra plan command
+func newInfraPlanCmd() *cobra.Command {
+	var (
+		flags infraFlags
+		out   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show what Terraform would change (aws, azure, gcp)",
+		Long: `Initialize infrastructure/, select the workspace <cloud>-<environment> and
+run terraform plan with the variables of the config: the selected cloud
+enabled, cloud.region, cloud.project, platform.domain and --var.
+
+Examples:
+  ceres infra plan --cloud aws --environment staging
+  ceres infra plan --cloud gcp --var gcp_node_count=2 --out gcp.plan`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := flags.resolve(cmd)
+			if err != nil {
+				return err
+			}
+			cfg := &r.Config
+			tf, err := flags.terraform(cfg, cfg.Cloud.Provider, cfg.Platform.Environment)
+			if err != nil {
+				return err
+			}
+			if err := tf.Init(); err != nil {
+				return err
+			}
+			if err := tf.Plan(out); err != nil {
+				return err
+			}
+			if out != "" {
+				fmt.Printf("Apply it with: ceres infra apply --cloud %s --environment %s --plan %s\n", tf.Cloud, tf.Environment, out)
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVar(&out, "out", "", "Save the plan to this file (relative to the Terraform module)")
+
+	return cmd
+}
+
+// newInfraApplyCmd creates the infra apply command
+func newInfraApplyCmd() *cobra.Command {
+	var (
+		flags     infraFlags
+		plan      string
+		namespace string
+		noDeploy  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update the cluster with Terraform and deploy CERES (aws, azure, gcp)",
+		Long: `Run terraform apply in the workspace <cloud>-<environment>, save the cluster
+profile from the outputs of infrastructure/outputs.tf (cluster name,
+endpoint, kubeconfig), point the CLI config at it and deploy CERES unless
+--no-deploy is given. When the kubeconfig output is empty the aws or gcloud
+CLI writes it.
+
+Examples:
+  ceres infra apply --cloud aws --environment prod
+  ceres infra apply --cloud aws --environment prod --plan aws.plan
+  ceres infra apply --cloud azure --no-deploy`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := flags.resolve(cmd)
+			if err != nil {
+				return err
+			}
+			cfg := &r.Config
+			tf, err := flags.terraform(cfg, cfg.Cloud.Provider, cfg.Platform.Environment)
+			if err != nil {
+				return err
+			}
+			prof, err := terraformApply(tf, plan, flags.profileName(cfg))
+			if err != nil {
+				return err
+			}
+			if err := useClusterProfile(r.ConfigPath, prof); err != nil {
+				return err
+			}
+			if noDeploy {
+				fmt.Println("Deploy with: ceres deploy")
+				return nil
+			}
+			return deployToCluster(cfg, namespace, prof)
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringVar(&plan, "plan", "", "Apply a plan saved by ceres infra plan --out")
+	cmd.Flags().StringVar(&namespace, "namespace", "ceres", "Kubernetes namespace")
+	cmd.Flags().BoolVar(&noDeploy, "no-deploy", false, "Only create the cluster")
+
+	return cmd
+}
+
+// newInfraDestroyCmd creates the infra destroy command
+func newInfraDestroyCmd() *cobra.Command {
+	var (
+		flags infraFlags
+		yes   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "destroy",
+		Short: "Destroy the Terraform infrastructure of a cloud and environment (aws, azure, gcp)",
+		Long: `Run terraform destroy in the workspace <cloud>-<environment> and remove the
+cluster profile of it, if there is one. The CLI config stops pointing at it.
+
+Examples:
+  ceres infra destroy --cloud aws --environment staging`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := flags.resolve(cmd)
+			if err != nil {
+				return err
+			}
+			cfg := &r.Config
+			tf, err := flags.terraform(cfg, cfg.Cloud.Provider, cfg.Platform.Environment)
+			if err != nil {
+				return err
+			}
+			prof, _ := infra.LoadProfile(flags.profileName(cfg))
+			if !yes && !confirmDeletion(fmt.Sprintf("%s (Terraform workspace %s)", tf.ClusterName(), tf.Workspace())) {
+				return nil
+			}
+			if err := terraformDestroy(tf, prof); err != nil {
+				return err
+			}
+			if prof == nil {
+				return nil
+			}
+			return forgetClusterProfile(r, prof)
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+// confirmDeletion asks before a cluster is deleted
+func confirmDeletion(target string) bool {
+	fmt.Printf("⚠️  This deletes cluster %s and all data on it.\n", target)
+	fmt.Print("Continue? (y/n): ")
+	var confirm string
+	fmt.Scanln(&confirm)
+	if confirm != "y" && confirm != "Y" {
+		fmt.Println("Cancelled")
+		return false
+	}
+	return true
+}
+
+// terraformApply applies the workspace and saves the cluster profile
+func terraformApply(tf *infra.Terraform, plan, name string) (*infra.Profile, error) {
+	if err := tf.Init(); err != nil {
+		return nil, err
+	}
+	if err := tf.Apply(plan); err != nil {
+		return nil, err
+	}
+	prof, err := tf.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("✅ Cluster %s is up: %s (kubeconfig %s)\n", prof.Cluster, prof.Endpoint, prof.Kubeconfig())
+	return prof, nil
+}
+
+// terraformDestroy destroys the workspace and removes prof, if not nil
+func terraformDestroy(tf *infra.Terraform, prof *infra.Profile) error {
+	if err := tf.Init(); err != nil {
+		return err
+	}
+	if err := tf.Destroy(); err != nil {
+		return err
+	}
+	if prof == nil {
+		return nil
+	}
+	if err := prof.Remove(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Cluster %s removed\n", prof.Name)
+	return nil
+}
+
+// deployToCluster deploys CERES like ceres deploy. For Terraform clusters
+// the address of the ingress load balancer is saved in the profile.
+func deployToCluster(cfg *config.Config, namespace string, prof *infra.Profile) error {
+	deployer, err := deployment.NewDeployer(cfg.Cloud.Provider, cfg.Platform.Environment, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create deployer: %w", err)
+	}
+	if err := deployer.UseProfile(cfg.Sizing.Profile, cfg.Sizing.Components); err != nil {
+		return err
+	}
+	if err := deployer.Deploy(); err != nil {
+		return err
+	}
+	if infra.IsTerraformCloud(prof.Cloud) {
+		if ip, source := dns.EntryAddress(); ip != "" {
+			prof.Address = ip
+			fmt.Printf("🌐 Ingress at %s (%s)\n", ip, source)
+			return prof.Save()
+		}
+	}
+	return nil
+}
+
+// forgetClusterProfile stops the CLI config pointing at a removed profile
+func forgetClusterProfile(r *config.Resolved, prof *infra.Profile) error {
+	if r.Config.Cloud.Kubernetes.Kubeconfig != prof.Kubeconfig() {
+		return nil
+	}
+	return setConfigValues(r.ConfigPath, map[string]string{
+		"cloud.kubernetes.kubeconfig": "",
+		"cloud.kubernetes.endpoint":   "",
+	})
+}
+
+// useClusterProfile points the CLI config and this process at the
+// kubeconfig of prof
+func useClusterProfile(configPath string, prof *infra.Profile) error {
+	if err := prof.Ready(); err != nil {
+		return err
+	}
+	distribution := map[string]string{"aws": "eks", "azure": "aks", "gcp": "gke"}[prof.Cloud]
+	if distribution == "" {
+		distribution = "k3s"
+	}
+	if err := setConfigValues(configPath, map[string]string{
+		"cloud.kubernetes.type":       distribution,
+		"cloud.kubernetes.endpoint":   prof.Endpoint,
+		"cloud.kubernetes.kubeconfig": prof.Kubeconfig(),
+	}); err != nil {
+		return err
+	}
+	return os.Setenv("KUBECONFIG", prof.Kubeconfig())
+}
+
+// setConfigValues changes settings of the config file as ceres config set
+// does, sorted by path
+func setConfigValues(path string, settings map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	paths := make([]string, 0, len(settings))
+	for p := range settings {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	out := data
+	for _, p := range paths {
+		if out, err = config.SetInFile(out, p, settings[p]); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if bytes.Equal(out, data) {
+		return nil
+	}
+	if err := config.WriteFile(path, out); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s updated: %s\n", path, strings.Join(paths, ", "))
+	return nil
 }
 
 // newSSOCmd команды SSO
@@ -0,0 +1,58 @@
+{{/*
+Common labels applied to every object rendered by the chart.
+*/}}
+{{- define "ceres.labels" -}}
+app.kubernetes.io/part-of: ceres
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+helm.sh/chart: {{ .Chart.Name }}-{{ .Chart.Version }}
+{{- end }}
+
+{{/*
+Image reference with global.imageRegistry applied. When a private registry is
+set (anything but docker.io) every image is pulled from it: the original
+registry host is dropped and the repository path kept, the same layout
+`ceres bundle load` pushes to.
+Usage: {{ include "ceres.image" (dict "image" .Values.grafana.image "global" .Values.global) }}
+*/}}
+{{- define "ceres.image" -}}
+{{- $repo := .image.repository -}}
+{{- $parts := splitList "/" $repo -}}
+{{- $first := first $parts -}}
+{{- $hasRegistry := and (gt (len $parts) 1) (or (contains "." $first) (contains ":" $first) (eq $first "localhost")) -}}
+{{- if and .global.imageRegistry (ne .global.imageRegistry "docker.io") -}}
+{{- $path := ternary (join "/" (rest $parts)) $repo $hasRegistry -}}
+{{ trimSuffix "/" .global.imageRegistry }}/{{ $path }}:{{ .image.tag }}
+{{- else -}}
+{{ $repo }}:{{ .image.tag }}
+{{- end -}}
+{{- end }}
+
+{{/*
+storageClassName line for PVCs; omitted when global.storageClass is empty.
+*/}}
+{{- define "ceres.storageClass" -}}
+{{- if .Values.global.storageClass }}
+storageClassName: {{ .Values.global.storageClass }}
+{{- end }}
+{{- end }}
+
+{{/*
+Host for a component: first label of the configured host + global.domain.
+Usage: {{ include "ceres.host" (dict "ingress" .Values.grafana.ingress "global" .Values.global) }}
+*/}}
+{{- define "ceres.host" -}}
+{{- $host := (first .ingress.hosts).host -}}
+{{ first (splitList "." $host) }}.{{ .global.domain }}
+{{- end }}
+
+{{/*
+Fully qualified host for a service in the ceres namespace (postgresql, redis).
+Hosts that already contain a dot are returned unchanged.
+*/}}
+{{- define "ceres.svcHost" -}}
+{{- if contains "." . -}}
+{{ . }}
+{{- else -}}
+{{ . }}.ceres.svc.cluster.local
+{{- end -}}
+{{- end }}
@@ -113,3 +113,14 @@ output "kubeconfig_gcp" {
   value       = try(google_container_cluster.gke[0].master_auth[0].client_certificate, "")
   sensitive   = true
 }
+
+# Read by ceres infra apply to get the kubeconfig with the cloud CLI
+output "aws_region" {
+  description = "AWS регион кластера"
+  value       = var.aws_enabled ? var.aws_region : ""
+}
+
+output "gcp_cluster_location" {
+  description = "Регион GCP GKE кластера"
+  value       = try(google_container_cluster.gke[0].location, "")
+}
@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var jobsResource = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+// copyImage is the MinIO client of deployment/postgresql-backup.yaml
+const copyImage = "minio/mc:RELEASE.2024-01-13T08-44-48Z"
+
+// copyScript mirrors backups/<name> of one location into another. The keys
+// are read from the AWS credentials files of the location Secrets.
+const copyScript = `set -eu
+keys() { awk -F= '{gsub(/[ \t\r]/, "")} $1 == "aws_access_key_id" {k = $2} $1 == "aws_secret_access_key" {s = $2} END {print k, s}' "$1"; }
+set -- $(keys /from/cloud); mc alias set from "$FROM_URL" "$1" "$2" >/dev/null
+set -- $(keys /to/cloud); mc alias set to "$TO_URL" "$1" "$2" >/dev/null
+mc mirror --overwrite "from/$FROM_PATH" "to/$TO_PATH"
+mc ls --recursive "to/$TO_PATH" | wc -l | xargs echo objects:
+`
+
+// CopyBackup copies a completed backup from its storage location into
+// another one, with a Job in the Velero namespace. Velero of a cluster that
+// has the location restores the copy; this cluster keeps listing the
+// original. Copies are not expired, and the data of file-system backups is
+// not copied.
+func (m *Manager) CopyBackup(name, to string) error {
+	b, err := m.GetBackup(name)
+	if err != nil {
+		return err
+	}
+	if !b.Succeeded() {
+		return fmt.Errorf("backup %s is %s: only completed backups are copied", name, b.Phase)
+	}
+	fromName := b.StorageLocation
+	if fromName == "" {
+		fromName = DefaultLocation
+	}
+	if fromName == to {
+		return fmt.Errorf("backup %s is already in %s", name, to)
+	}
+	from, err := m.GetLocation(fromName)
+	if err != nil {
+		return err
+	}
+	target, err := m.GetLocation(to)
+	if err != nil {
+		return err
+	}
+	if target.ReadOnly {
+		return fmt.Errorf("location %s is read-only", to)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	for _, l := range []*Location{from, target} {
+		if _, err := m.client.Resource(secretsResource).Namespace(m.namespace).Get(ctx, locationSecret(l.Name), getOptions); err != nil {
+			return fmt.Errorf("location %s has no keys to copy with (ceres backup location add %s --access-key ...): %w", l.Name, l.Name, err)
+		}
+	}
+
+	job := fmt.Sprintf("ceres-copy-%s", time.Now().UTC().Format("20060102150405"))
+	volume := func(name, location string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "secret": map[string]interface{}{"secretName": locationSecret(location)}}
+	}
+	mount := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "mountPath": "/" + name, "readOnly": true}
+	}
+	env := func(name, value string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "value": value}
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":      job,
+			"namespace": m.namespace,
+			"labels":    map[string]interface{}{"app.kubernetes.io/managed-by": "ceres", "ceres.io/backup": name},
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit":            int64(0),
+			"ttlSecondsAfterFinished": int64(3600),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"restartPolicy": "Never",
+					"containers": []interface{}{map[string]interface{}{
+						"name":    "copy",
+						"image":   copyImage,
+						"command": []interface{}{"/bin/sh", "-c", copyScript},
+						"env": []interface{}{
+							env("FROM_URL", endpoint(from)),
+							env("FROM_PATH", backupPath(from, name)),
+							env("TO_URL", endpoint(target)),
+							env("TO_PATH", backupPath(target, name)),
+						},
+						"volumeMounts": []interface{}{mount("from"), mount("to")},
+					}},
+					"volumes": []interface{}{volume("from", from.Name), volume("to", target.Name)},
+				},
+			},
+		},
+	}}
+	jobs := m.client.Resource(jobsResource).Namespace(m.namespace)
+	if _, err := jobs.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to start copy of %s: %w", name, err)
+	}
+
+	fmt.Printf("    ⏳ Copying %s from %s to %s...\n", name, from.Name, target.Name)
+	var succeeded, failed int64
+	err = m.watch(ctx, jobsResource, job, func(u *unstructured.Unstructured) bool {
+		succeeded, _, _ = unstructured.NestedInt64(u.Object, "status", "succeeded")
+		failed, _, _ = unstructured.NestedInt64(u.Object, "status", "failed")
+		return succeeded > 0 || failed > 0
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch copy %s: %w", job, err)
+	}
+	logs, _ := exec.Command("kubectl", "logs", "job/"+job, "-n", m.namespace).CombinedOutput()
+	if failed > 0 {
+		return fmt.Errorf("copy of %s to %s failed:\n%s", name, to, strings.TrimSpace(string(logs)))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(logs)), "\n") {
+		if strings.HasPrefix(line, "objects:") {
+			fmt.Printf("    ✓ %s\n", line)
+		}
+	}
+	return nil
+}
+
+// endpoint is the S3 URL of a location for mc
+func endpoint(l *Location) string {
+	if l.URL != "" {
+		return l.URL
+	}
+	if l.Region != "" {
+		return "https://s3." + l.Region + ".amazonaws.com"
+	}
+	return "https://s3.amazonaws.com"
+}
+
+// backupPath is where Velero keeps the files of a backup in a location
+func backupPath(l *Location, name string) string {
+	return path.Join(l.Bucket, l.Prefix, "backups", name)
+}
@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+var (
+	locationsResource = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backupstoragelocations"}
+	secretsResource   = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// DefaultLocation is the storage location of backup.location
+const DefaultLocation = "default"
+
+// MinIOUser is the root user of the in-cluster MinIO (MINIO_ROOT_USER in
+// all-services.yaml); its password is the minio credential
+const MinIOUser = "minioadmin"
+
+// credentialKey is the key of the AWS credentials file in a location Secret
+const credentialKey = "cloud"
+
+var locationName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,40}[a-z0-9])?$`)
+
+// Location is a velero.io/v1 BackupStorageLocation
+type Location struct {
+	Name     string
+	Provider string
+	Bucket   string
+	Prefix   string
+	URL      string
+	Region   string
+	Default  bool
+	ReadOnly bool
+	// Phase is Available once Velero reached the bucket, Unavailable with
+	// Message when it could not
+	Phase         string
+	Message       string
+	LastValidated time.Time
+}
+
+// LocationOptions is an S3-compatible storage location
+type LocationOptions struct {
+	Name   string
+	Bucket string
+	Prefix string // directory in the bucket, for a bucket shared with others
+	URL    string // S3 endpoint, empty for AWS
+	Region string
+	// AccessKey and SecretKey are kept in the Secret ceres-location-<name>;
+	// without them Velero uses the credentials of its node (an IAM role)
+	AccessKey string
+	SecretKey string
+	// ReadOnly locations are only restored from, e.g. the backups of
+	// another cluster
+	ReadOnly bool
+	Default  bool
+}
+
+// DefaultLocationOptions is the default location of backup.location, without
+// credentials
+func DefaultLocationOptions(loc config.BackupLocation) LocationOptions {
+	region := loc.Region
+	if region == "" && loc.Provider == "minio" {
+		region = "minio"
+	}
+	return LocationOptions{Name: DefaultLocation, Bucket: loc.Bucket, URL: loc.URL, Region: region, Default: true}
+}
+
+func locationSecret(name string) string {
+	return "ceres-location-" + name
+}
+
+// EnsureLocation creates or updates a storage location and the Secret of its
+// credentials, then waits for Velero to reach its bucket. An unreachable
+// location is returned with an error.
+func (m *Manager) EnsureLocation(opts LocationOptions) (*Location, error) {
+	if !locationName.MatchString(opts.Name) {
+		return nil, fmt.Errorf("location name %q is not lowercase letters, digits and dashes", opts.Name)
+	}
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("location %s: bucket required", opts.Name)
+	}
+	if (opts.AccessKey == "") != (opts.SecretKey == "") {
+		return nil, fmt.Errorf("location %s: give both the access and the secret key, or neither", opts.Name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	objectStorage := map[string]interface{}{"bucket": opts.Bucket}
+	if opts.Prefix != "" {
+		objectStorage["prefix"] = opts.Prefix
+	}
+	cfg := map[string]interface{}{}
+	if opts.Region != "" {
+		cfg["region"] = opts.Region
+	}
+	if opts.URL != "" {
+		cfg["s3Url"] = opts.URL
+		cfg["s3ForcePathStyle"] = "true"
+	}
+	accessMode := "ReadWrite"
+	if opts.ReadOnly {
+		accessMode = "ReadOnly"
+	}
+	spec := map[string]interface{}{
+		"provider":      "aws",
+		"objectStorage": objectStorage,
+		"config":        cfg,
+		"accessMode":    accessMode,
+		"default":       opts.Default,
+	}
+
+	secrets := m.client.Resource(secretsResource).Namespace(m.namespace)
+	if opts.AccessKey != "" {
+		secret := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":      locationSecret(opts.Name),
+				"namespace": m.namespace,
+				"labels":    map[string]interface{}{"app.kubernetes.io/managed-by": "ceres"},
+			},
+			"type": "Opaque",
+			"stringData": map[string]interface{}{
+				credentialKey: fmt.Sprintf("[default]\naws_access_key_id=%s\naws_secret_access_key=%s\n", opts.AccessKey, opts.SecretKey),
+			},
+		}}
+		_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			var existing *unstructured.Unstructured
+			if existing, err = secrets.Get(ctx, secret.GetName(), getOptions); err == nil {
+				secret.SetResourceVersion(existing.GetResourceVersion())
+				_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store the credentials of %s: %w", opts.Name, err)
+		}
+		spec["credential"] = map[string]interface{}{"name": locationSecret(opts.Name), "key": credentialKey}
+	} else if err := secrets.Delete(ctx, locationSecret(opts.Name), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete the credentials of %s: %w", opts.Name, err)
+	}
+
+	// validated again: a later lastValidationTime of the server, whose clock
+	// may differ from ours
+	var previous time.Time
+	client := m.client.Resource(locationsResource).Namespace(m.namespace)
+	u, err := client.Get(ctx, opts.Name, getOptions)
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = client.Create(ctx, m.object("BackupStorageLocation", opts.Name, spec), metav1.CreateOptions{})
+	case err == nil:
+		previous = locationFrom(u).LastValidated
+		u.Object["spec"] = spec
+		_, err = client.Update(ctx, u, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply location %s: %w", opts.Name, err)
+	}
+
+	fmt.Printf("    ⏳ Waiting for Velero to reach %s...\n", opts.Bucket)
+	var l *Location
+	err = m.watch(ctx, locationsResource, opts.Name, func(u *unstructured.Unstructured) bool {
+		l = locationFrom(u)
+		return l.LastValidated.After(previous) && l.Phase != ""
+	})
+	if err != nil {
+		return l, fmt.Errorf("location %s was not validated: %w (kubectl logs -n velero deploy/velero)", opts.Name, err)
+	}
+	if l.Phase != "Available" {
+		return l, fmt.Errorf("location %s is %s: %s", opts.Name, l.Phase, l.Message)
+	}
+	return l, nil
+}
+
+// GetLocation reads a storage location
+func (m *Manager) GetLocation(name string) (*Location, error) {
+	u, err := m.client.Resource(locationsResource).Namespace(m.namespace).Get(context.Background(), name, getOptions)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("no storage location %s (ceres backup location add)", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location %s: %w", name, err)
+	}
+	return locationFrom(u), nil
+}
+
+// ListLocations returns the storage locations, the default first
+func (m *Manager) ListLocations() ([]Location, error) {
+	list, err := m.client.Resource(locationsResource).Namespace(m.namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+	locations := make([]Location, 0, len(list.Items))
+	for i := range list.Items {
+		locations = append(locations, *locationFrom(&list.Items[i]))
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Default && !locations[j].Default
+	})
+	return locations, nil
+}
+
+// RemoveLocation deletes a storage location and its credentials. The backups
+// in its bucket stay; Velero stops listing them.
+func (m *Manager) RemoveLocation(name string) error {
+	if name == DefaultLocation {
+		return fmt.Errorf("the default location is backup.location in the config")
+	}
+	ctx := context.Background()
+	err := m.client.Resource(locationsResource).Namespace(m.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("no storage location %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete location %s: %w", name, err)
+	}
+	err = m.client.Resource(secretsResource).Namespace(m.namespace).Delete(ctx, locationSecret(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the credentials of %s: %w", name, err)
+	}
+	return nil
+}
+
+func locationFrom(u *unstructured.Unstructured) *Location {
+	isDefault, _, _ := unstructured.NestedBool(u.Object, "spec", "default")
+	return &Location{
+		Name:          u.GetName(),
+		Provider:      str(u, "spec", "provider"),
+		Bucket:        str(u, "spec", "objectStorage", "bucket"),
+		Prefix:        str(u, "spec", "objectStorage", "prefix"),
+		URL:           str(u, "spec", "config", "s3Url"),
+		Region:        str(u, "spec", "config", "region"),
+		Default:       isDefault,
+		ReadOnly:      str(u, "spec", "accessMode") == "ReadOnly",
+		Phase:         str(u, "status", "phase"),
+		Message:       str(u, "status", "message"),
+		LastValidated: timestamp(u, "status", "lastValidationTime"),
+	}
+}
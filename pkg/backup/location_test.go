@@ -0,0 +1,211 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fakeVelero is the Velero namespace of a fake cluster whose server clock
+// is an hour behind ours. A location written to is validated on the next
+// read, as Available unless its bucket is in unreachable; a copy Job
+// succeeds on the first read.
+type fakeVelero struct {
+	client      *fake.FakeDynamicClient
+	clock       time.Time
+	unreachable map[string]bool
+	written     map[string]bool
+}
+
+func newFakeVelero(t *testing.T, objects ...runtime.Object) (*Manager, *fakeVelero) {
+	t.Helper()
+	f := &fakeVelero{
+		clock:       time.Now().Add(-time.Hour).Truncate(time.Second),
+		unreachable: map[string]bool{},
+		written:     map[string]bool{},
+	}
+	f.client = fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		locationsResource: "BackupStorageLocationList",
+		secretsResource:   "SecretList",
+		backupsResource:   "BackupList",
+		jobsResource:      "JobList",
+	}, objects...)
+
+	written := func(action clienttesting.Action) (bool, runtime.Object, error) {
+		u := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		f.written[u.GetName()] = true
+		return false, nil, nil
+	}
+	f.client.PrependReactor("create", "backupstoragelocations", written)
+	f.client.PrependReactor("update", "backupstoragelocations", written)
+	f.client.PrependReactor("get", "backupstoragelocations", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		name := action.(clienttesting.GetAction).GetName()
+		if !f.written[name] {
+			return false, nil, nil
+		}
+		obj, err := f.client.Tracker().Get(locationsResource, "velero", name)
+		if err != nil {
+			return true, nil, err
+		}
+		u := obj.(*unstructured.Unstructured).DeepCopy()
+		f.clock = f.clock.Add(time.Second)
+		phase := "Available"
+		if bucket, _, _ := unstructured.NestedString(u.Object, "spec", "objectStorage", "bucket"); f.unreachable[bucket] {
+			phase = "Unavailable"
+			unstructured.SetNestedField(u.Object, "BackupStorageLocation is unavailable: bucket not found", "status", "message")
+		}
+		unstructured.SetNestedField(u.Object, phase, "status", "phase")
+		unstructured.SetNestedField(u.Object, f.clock.Format(time.RFC3339), "status", "lastValidationTime")
+		if err := f.client.Tracker().Update(locationsResource, u, "velero"); err != nil {
+			return true, nil, err
+		}
+		f.written[name] = false
+		return true, u, nil
+	})
+	f.client.PrependReactor("get", "jobs", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj, err := f.client.Tracker().Get(jobsResource, "velero", action.(clienttesting.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		u := obj.(*unstructured.Unstructured).DeepCopy()
+		unstructured.SetNestedField(u.Object, int64(1), "status", "succeeded")
+		return true, u, nil
+	})
+	return &Manager{namespace: "velero", client: f.client}, f
+}
+
+func location(name, bucket string, validated time.Time) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       "BackupStorageLocation",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "velero"},
+		"spec": map[string]interface{}{
+			"provider":      "aws",
+			"objectStorage": map[string]interface{}{"bucket": bucket},
+			"config":        map[string]interface{}{"region": "minio", "s3Url": "http://minio.minio:9000"},
+		},
+		"status": map[string]interface{}{"phase": "Available", "lastValidationTime": validated.Format(time.RFC3339)},
+	}}
+}
+
+func TestEnsureLocation(t *testing.T) {
+	m, f := newFakeVelero(t)
+	opts := LocationOptions{Name: "offsite", Bucket: "ceres-dr", Prefix: "cluster-a", URL: "https://s3.example.com", Region: "eu-1", AccessKey: "AK", SecretKey: "SK"}
+	l, err := m.EnsureLocation(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Phase != "Available" || l.Bucket != "ceres-dr" || l.Prefix != "cluster-a" || l.URL != "https://s3.example.com" {
+		t.Errorf("location = %+v", l)
+	}
+
+	secret, err := f.client.Resource(secretsResource).Namespace("velero").Get(context.Background(), "ceres-location-offsite", getOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _, _ := unstructured.NestedString(secret.Object, "stringData", credentialKey)
+	if !strings.Contains(keys, "aws_access_key_id=AK") || !strings.Contains(keys, "aws_secret_access_key=SK") {
+		t.Errorf("credentials = %q", keys)
+	}
+
+	// without keys the location uses the node's credentials
+	opts.AccessKey, opts.SecretKey = "", ""
+	if _, err := m.EnsureLocation(opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.client.Resource(secretsResource).Namespace("velero").Get(context.Background(), "ceres-location-offsite", getOptions); err == nil {
+		t.Error("credentials kept")
+	}
+}
+
+func TestEnsureLocationRevalidated(t *testing.T) {
+	// validated a minute ago by the server's clock, which is behind ours:
+	// only a later validation counts, not one later than our clock
+	m, f := newFakeVelero(t)
+	f.client.Tracker().Add(location("offsite", "old-bucket", f.clock.Add(-time.Minute)))
+	f.unreachable["new-bucket"] = true
+
+	l, err := m.EnsureLocation(LocationOptions{Name: "offsite", Bucket: "new-bucket"})
+	if err == nil || !strings.Contains(err.Error(), "bucket not found") {
+		t.Fatalf("unreachable bucket: %v", err)
+	}
+	if l == nil || l.Phase != "Unavailable" {
+		t.Errorf("location = %+v", l)
+	}
+}
+
+func TestEnsureLocationOptions(t *testing.T) {
+	m, _ := newFakeVelero(t)
+	for _, opts := range []LocationOptions{
+		{Name: "Off_Site", Bucket: "b"},
+		{Name: "offsite"},
+		{Name: "offsite", Bucket: "b", AccessKey: "AK"},
+	} {
+		if _, err := m.EnsureLocation(opts); err == nil {
+			t.Errorf("EnsureLocation(%+v) accepted", opts)
+		}
+	}
+}
+
+func TestCopyBackup(t *testing.T) {
+	t.Setenv("PATH", t.TempDir()) // no kubectl for the logs
+	backup := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       "Backup",
+		"metadata":   map[string]interface{}{"name": "nightly", "namespace": "velero"},
+		"spec":       map[string]interface{}{"storageLocation": "default"},
+		"status":     map[string]interface{}{"phase": "Completed"},
+	}}
+	now := time.Now()
+	offsite := location("offsite", "ceres-dr", now)
+	unstructured.SetNestedField(offsite.Object, "cluster-a", "spec", "objectStorage", "prefix")
+	unstructured.SetNestedField(offsite.Object, map[string]interface{}{}, "spec", "config")
+	secret := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": locationSecret(name), "namespace": "velero"},
+		}}
+	}
+	m, f := newFakeVelero(t, backup, location("default", "velero", now), offsite, secret("default"))
+
+	if err := m.CopyBackup("nightly", "default"); err == nil {
+		t.Error("copy into its own location")
+	}
+	if err := m.CopyBackup("nightly", "offsite"); err == nil || !strings.Contains(err.Error(), "no keys") {
+		t.Errorf("copy without keys: %v", err)
+	}
+
+	f.client.Tracker().Add(secret("offsite"))
+	if err := m.CopyBackup("nightly", "offsite"); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := f.client.Resource(jobsResource).Namespace("velero").List(context.Background(), listOptions("", ""))
+	if err != nil || len(jobs.Items) != 1 {
+		t.Fatalf("jobs = %v, %v", jobs, err)
+	}
+	containers, _, _ := unstructured.NestedSlice(jobs.Items[0].Object, "spec", "template", "spec", "containers")
+	env := map[string]string{}
+	for _, e := range containers[0].(map[string]interface{})["env"].([]interface{}) {
+		e := e.(map[string]interface{})
+		env[e["name"].(string)] = e["value"].(string)
+	}
+	want := map[string]string{
+		"FROM_URL":  "http://minio.minio:9000",
+		"FROM_PATH": "velero/backups/nightly",
+		"TO_URL":    "https://s3.amazonaws.com",
+		"TO_PATH":   "ceres-dr/cluster-a/backups/nightly",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("%s = %q, want %q", k, env[k], v)
+		}
+	}
+}
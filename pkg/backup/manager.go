@@ -1,26 +1,65 @@
 package backup
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
+	"sort"
 	"strings"
 	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/skulesh01/ceres/pkg/config"
 )
 
-// Manager управляет резервным копированием через Velero
+// Manager управляет резервным копированием через Velero. Backup, Restore и
+// Schedule создаются и читаются как объекты velero.io/v1.
 type Manager struct {
 	namespace string
+	client    dynamic.Interface
 }
 
-// NewManager создает новый менеджер бэкапов
-func NewManager() *Manager {
+// excludedNamespaces are left out of platform backups
+var excludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// defaultTTL is how long Velero keeps a backup
+const defaultTTL = "720h0m0s"
+
+// waitTimeout bounds how long a backup or restore is watched
+const waitTimeout = 2 * time.Hour
+
+var getOptions = metav1.GetOptions{}
+
+func listOptions(fieldSelector, resourceVersion string) metav1.ListOptions {
+	return metav1.ListOptions{FieldSelector: fieldSelector, ResourceVersion: resourceVersion}
+}
+
+// NewManager создает новый менеджер бэкапов для кластера из kubeconfig
+// (KUBECONFIG, ~/.kube/config)
+func NewManager() (*Manager, error) {
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
 	return &Manager{
 		namespace: "velero",
-	}
+		client:    client,
+	}, nil
 }
 
-// Install устанавливает Velero через Helm
-func (m *Manager) Install() error {
+// Install устанавливает Velero через Helm, с хранилищем по умолчанию из
+// location. Velero has no location of its own: every location, the
+// default one too, carries its credentials in a Secret.
+func (m *Manager) Install(location LocationOptions) error {
 	fmt.Println("📦 Устанавливаем Velero...")
 
 	// Добавить Helm repo
@@ -38,11 +77,9 @@ func (m *Manager) Install() error {
 	cmd = exec.Command("helm", "install", "velero", "vmware-tanzu/velero",
 		"--namespace", m.namespace,
 		"--create-namespace",
-		"--set", "configuration.provider=aws",
-		"--set", "configuration.backupStorageLocation.bucket=ceres-backups",
-		"--set", "configuration.backupStorageLocation.config.region=minio",
-		"--set", "configuration.backupStorageLocation.config.s3ForcePathStyle=true",
-		"--set", "configuration.backupStorageLocation.config.s3Url=http://minio.minio.svc.cluster.local:9000",
+		"--set-json", "configuration.backupStorageLocation=[]",
+		"--set-json", "configuration.volumeSnapshotLocation=[]",
+		"--set", "credentials.useSecret=false",
 		"--set", "snapshotsEnabled=false",
 		"--set", "initContainers[0].name=velero-plugin-for-aws",
 		"--set", "initContainers[0].image=velero/velero-plugin-for-aws:v1.8.0",
@@ -55,101 +92,225 @@ func (m *Manager) Install() error {
 		return fmt.Errorf("failed to install velero: %w\nOutput: %s", err, output)
 	}
 
+	if _, err := m.EnsureLocation(location); err != nil {
+		return err
+	}
 	fmt.Println("✅ Velero установлен")
 	return nil
 }
 
-// CreateBackup создает новый бэкап
-func (m *Manager) CreateBackup(name string) error {
+// BackupOptions controls CreateBackup
+type BackupOptions struct {
+	// Scope limits the backup to components; nil backs up every namespace
+	// but the cluster's own
+	Scope *Scope
+	// Location is the storage location, empty for the default one
+	Location string
+}
+
+// CreateBackup создает новый бэкап и следит за ним до завершения
+func (m *Manager) CreateBackup(name string, opts BackupOptions) (*Backup, error) {
 	if name == "" {
 		name = fmt.Sprintf("backup-%s", time.Now().Format("20060102-150405"))
 	}
+	if opts.Location != "" {
+		if l, err := m.GetLocation(opts.Location); err != nil {
+			return nil, err
+		} else if l.ReadOnly {
+			return nil, fmt.Errorf("location %s is read-only", opts.Location)
+		}
+	}
 
-	fmt.Printf("💾 Создаем backup: %s...\n", name)
+	spec := backupSpec()
+	hooked := enabledScope(&config.Current().Config)
+	if opts.Scope != nil {
+		fmt.Printf("💾 Создаем backup: %s (%s)...\n", name, strings.Join(opts.Scope.Names(), ", "))
+		if err := opts.Scope.label(); err != nil {
+			return nil, err
+		}
+		opts.Scope.restrict(spec)
+		hooked = opts.Scope
+	} else {
+		fmt.Printf("💾 Создаем backup: %s...\n", name)
+		// labeled, a full backup restores single components too
+		if err := hooked.label(); err != nil {
+			fmt.Printf("    ⚠️  %v: restores of this backup cannot select components\n", err)
+		}
+	}
+	if hooks := hookSpec(&config.Current().Config, hooked); hooks != nil {
+		spec["hooks"] = hooks
+	}
+	if opts.Location != "" {
+		spec["storageLocation"] = opts.Location
+	}
 
-	cmd := exec.Command("kubectl", "exec", "-n", m.namespace,
-		"deploy/velero", "--",
-		"velero", "backup", "create", name,
-		"--wait",
-	)
+	obj := m.object("Backup", name, spec)
+	if opts.Scope != nil {
+		obj.SetAnnotations(map[string]string{componentsAnnotation: strings.Join(opts.Scope.Names(), ",")})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if _, err := m.client.Resource(backupsResource).Namespace(m.namespace).Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
 
-	output, err := cmd.CombinedOutput()
+	b, err := m.WaitBackup(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to create backup: %w\nOutput: %s", err, output)
+		return b, err
 	}
+	fmt.Printf("✅ Backup создан: %s (%s items, expires %s)\n", name, b.Items, b.Expiration.Local().Format("2006-01-02 15:04"))
+	return b, nil
+}
 
-	fmt.Printf("✅ Backup создан: %s\n", name)
-	return nil
+// WaitBackup watches a backup, printing its progress, until it finished.
+// A backup that did not complete is returned with an error.
+func (m *Manager) WaitBackup(ctx context.Context, name string) (*Backup, error) {
+	var b *Backup
+	var last string
+	err := m.watch(ctx, backupsResource, name, func(u *unstructured.Unstructured) bool {
+		b = backupFrom(u)
+		if p := b.Phase + " " + b.Items.String(); p != last {
+			last = p
+			fmt.Printf("    ⏳ %s %s items\n", b.Phase, b.Items)
+		}
+		return b.Done()
+	})
+	if err != nil {
+		return b, fmt.Errorf("failed to watch backup %s: %w", name, err)
+	}
+	if !b.Succeeded() {
+		return b, fmt.Errorf("backup %s %s: %s", name, b.Phase, failure(b.FailureReason, b.ValidationErrors, b.Errors, b.Warnings))
+	}
+	return b, nil
 }
 
-// ListBackups показывает список всех бэкапов
-func (m *Manager) ListBackups() ([]string, error) {
-	cmd := exec.Command("kubectl", "exec", "-n", m.namespace,
-		"deploy/velero", "--",
-		"velero", "backup", "get",
-	)
+// GetBackup reads a backup
+func (m *Manager) GetBackup(name string) (*Backup, error) {
+	u, err := m.client.Resource(backupsResource).Namespace(m.namespace).Get(context.Background(), name, getOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup %s: %w", name, err)
+	}
+	return backupFrom(u), nil
+}
 
-	output, err := cmd.CombinedOutput()
+// ListBackups возвращает все бэкапы, новые первыми
+func (m *Manager) ListBackups() ([]Backup, error) {
+	list, err := m.client.Resource(backupsResource).Namespace(m.namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list backups: %w", err)
 	}
 
-	lines := strings.Split(string(output), "\n")
-	var backups []string
-
-	for i, line := range lines {
-		if i == 0 || line == "" {
-			continue // Skip header and empty lines
-		}
-		fields := strings.Fields(line)
-		if len(fields) > 0 {
-			backups = append(backups, fields[0])
-		}
+	backups := make([]Backup, 0, len(list.Items))
+	for i := range list.Items {
+		backups = append(backups, *backupFrom(&list.Items[i]))
 	}
-
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Started.After(backups[j].Started)
+	})
 	return backups, nil
 }
 
-// Restore восстанавливает из бэкапа
-func (m *Manager) Restore(backupName string) error {
+// RestoreOptions controls Restore
+type RestoreOptions struct {
+	// Scope limits the restore to components; nil restores everything in
+	// the backup
+	Scope *Scope
+	// NamespaceMapping restores namespaces under other names, e.g. gitlab
+	// into gitlab-restore, leaving the running ones alone
+	NamespaceMapping map[string]string
+	// NamespacedOnly leaves out cluster-scoped objects, so a copy does not
+	// touch what the running components share
+	NamespacedOnly bool
+}
+
+// Restore восстанавливает из бэкапа и следит за восстановлением до завершения
+func (m *Manager) Restore(backupName string, opts RestoreOptions) (*Restore, error) {
 	restoreName := fmt.Sprintf("restore-%s", time.Now().Format("20060102-150405"))
 
 	fmt.Printf("🔄 Восстанавливаем из backup: %s...\n", backupName)
 
-	cmd := exec.Command("kubectl", "exec", "-n", m.namespace,
-		"deploy/velero", "--",
-		"velero", "restore", "create", restoreName,
-		"--from-backup", backupName,
-		"--wait",
-	)
-
-	output, err := cmd.CombinedOutput()
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	b, err := m.GetBackup(backupName)
 	if err != nil {
-		return fmt.Errorf("failed to restore: %w\nOutput: %s", err, output)
+		return nil, err
+	}
+	if b.Phase != "Completed" && b.Phase != "PartiallyFailed" {
+		return nil, fmt.Errorf("backup %s is %s, not restorable", backupName, b.Phase)
 	}
 
-	fmt.Printf("✅ Восстановление завершено: %s\n", restoreName)
-	return nil
-}
+	spec := map[string]interface{}{
+		"backupName": backupName,
+	}
+	if opts.Scope != nil && len(b.Components) > 0 {
+		for _, name := range opts.Scope.Names() {
+			if !contains(b.Components, name) {
+				return nil, fmt.Errorf("backup %s has no %s (it has %s)", backupName, name, strings.Join(b.Components, ", "))
+			}
+		}
+	}
+	if opts.Scope != nil {
+		namespaces := opts.Scope.Namespaces()
+		for from := range opts.NamespaceMapping {
+			if !contains(namespaces, from) {
+				return nil, fmt.Errorf("namespace mapping %s: not a namespace of %s (%s)", from, strings.Join(opts.Scope.Names(), ", "), strings.Join(namespaces, ", "))
+			}
+		}
+		spec["includedNamespaces"] = toList(namespaces)
+		if selectors := opts.Scope.selectors(); selectors != nil {
+			spec["orLabelSelectors"] = selectors
+		}
+	}
+	if len(opts.NamespaceMapping) > 0 {
+		mapping := map[string]interface{}{}
+		for from, to := range opts.NamespaceMapping {
+			mapping[from] = to
+			fmt.Printf("    ↪ %s → %s\n", from, to)
+		}
+		spec["namespaceMapping"] = mapping
+		// a copy must not take the hosts of the running ingresses
+		spec["excludedResources"] = []interface{}{"ingresses.networking.k8s.io"}
+	}
+	if opts.NamespacedOnly {
+		spec["includeClusterResources"] = false
+	}
+	obj := m.object("Restore", restoreName, spec)
+	if _, err := m.client.Resource(restoresResource).Namespace(m.namespace).Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to restore: %w", err)
+	}
 
-// ScheduleDaily настраивает ежедневный бэкап
-func (m *Manager) ScheduleDaily() error {
-	fmt.Println("⏰ Настраиваем ежедневный backup (2:00 AM)...")
+	var r *Restore
+	var last string
+	err = m.watch(ctx, restoresResource, restoreName, func(u *unstructured.Unstructured) bool {
+		r = restoreFrom(u)
+		if p := r.Phase + " " + r.Items.String(); p != last {
+			last = p
+			fmt.Printf("    ⏳ %s %s items\n", r.Phase, r.Items)
+		}
+		return r.Done()
+	})
+	if err != nil {
+		return r, fmt.Errorf("failed to watch restore %s: %w", restoreName, err)
+	}
+	if !r.Succeeded() {
+		return r, fmt.Errorf("restore %s %s: %s", restoreName, r.Phase, failure(r.FailureReason, r.ValidationErrors, r.Errors, r.Warnings))
+	}
 
-	cmd := exec.Command("kubectl", "exec", "-n", m.namespace,
-		"deploy/velero", "--",
-		"velero", "schedule", "create", "daily-backup",
-		"--schedule=0 2 * * *",
-		"--ttl", "720h", // 30 дней
-	)
+	fmt.Printf("✅ Восстановление завершено: %s (%s items)\n", restoreName, r.Items)
+	return r, nil
+}
 
-	output, err := cmd.CombinedOutput()
+// ListSchedules returns the backup schedules
+func (m *Manager) ListSchedules() ([]Schedule, error) {
+	list, err := m.client.Resource(schedulesResource).Namespace(m.namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to create schedule: %w\nOutput: %s", err, output)
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
 	}
-
-	fmt.Println("✅ Ежедневный backup настроен")
-	return nil
+	schedules := make([]Schedule, 0, len(list.Items))
+	for i := range list.Items {
+		schedules = append(schedules, *scheduleFrom(&list.Items[i]))
+	}
+	return schedules, nil
 }
 
 // Status показывает статус Velero
@@ -163,3 +324,59 @@ func (m *Manager) Status() error {
 	fmt.Println(string(output))
 	return nil
 }
+
+// object returns a velero.io/v1 object of the manager's namespace
+func (m *Manager) object(kind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "velero.io/v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": m.namespace,
+		},
+		"spec": spec,
+	}}
+}
+
+// backupSpec is the spec of platform backups: every namespace but the
+// cluster's own
+func backupSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"includedNamespaces": []interface{}{"*"},
+		"excludedNamespaces": toList(excludedNamespaces),
+		"ttl":                defaultTTL,
+	}
+}
+
+func toList(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// failure explains a backup or restore that did not complete
+func failure(reason string, validation []string, errors, warnings int64) string {
+	var parts []string
+	if reason != "" {
+		parts = append(parts, reason)
+	}
+	parts = append(parts, validation...)
+	if errors > 0 || warnings > 0 {
+		parts = append(parts, fmt.Sprintf("%d errors, %d warnings (kubectl logs -n velero deploy/velero)", errors, warnings))
+	}
+	if len(parts) == 0 {
+		return "no reason given"
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,231 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// policyLabel marks the Schedules made from backup policies, so apply
+// deletes the ones of policies no longer configured
+const policyLabel = "ceres.io/policy"
+
+// legacySchedule is the daily Schedule of earlier releases, replaced by
+// the daily policy
+const legacySchedule = "daily-backup"
+
+// Policies returns the backup policies of cfg: backup.policies, or one daily
+// policy from backup.schedule and backup.retention
+func Policies(cfg *config.Config) []config.BackupPolicy {
+	if len(cfg.Backup.Policies) > 0 {
+		return cfg.Backup.Policies
+	}
+	return []config.BackupPolicy{{
+		Name:      "daily",
+		Schedule:  cfg.Backup.Schedule,
+		Retention: cfg.Backup.Retention,
+	}}
+}
+
+// ScheduleName is the Velero Schedule of a policy
+func ScheduleName(p config.BackupPolicy) string {
+	return "ceres-" + p.Name
+}
+
+// PolicyStatus is a policy and its Schedule, nil until the policy is applied
+type PolicyStatus struct {
+	config.BackupPolicy
+	Schedule *Schedule
+}
+
+// Policies returns the policies of cfg with their Schedules
+func (m *Manager) Policies(cfg *config.Config) ([]PolicyStatus, error) {
+	schedules, err := m.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*Schedule{}
+	for i := range schedules {
+		byName[schedules[i].Name] = &schedules[i]
+	}
+	var out []PolicyStatus
+	for _, p := range Policies(cfg) {
+		out = append(out, PolicyStatus{BackupPolicy: p, Schedule: byName[ScheduleName(p)]})
+	}
+	return out, nil
+}
+
+// ApplyPolicies makes the Velero Schedules match the policies of cfg: one
+// per policy, created or updated, and none for removed policies. A policy
+// of components labels their objects again, so objects created since the
+// last apply are backed up too. With dryRun it only prints the changes.
+func (m *Manager) ApplyPolicies(cfg *config.Config, dryRun bool) error {
+	ctx := context.Background()
+	client := m.client.Resource(schedulesResource).Namespace(m.namespace)
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	keep := map[string]bool{}
+	for _, p := range Policies(cfg) {
+		name := ScheduleName(p)
+		keep[name] = true
+		spec, scope, err := policySpec(cfg, p)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		if p.Location != "" {
+			if l, err := m.GetLocation(p.Location); err != nil {
+				return fmt.Errorf("policy %s: %w", p.Name, err)
+			} else if l.ReadOnly {
+				return fmt.Errorf("policy %s: location %s is read-only", p.Name, p.Location)
+			}
+		}
+		if scope != nil && !dryRun {
+			if err := scope.label(); err != nil {
+				return fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+		}
+
+		u, err := client.Get(ctx, name, getOptions)
+		switch {
+		case err == nil && equality.Semantic.DeepEqual(u.Object["spec"], spec):
+			fmt.Printf("    ✓ %s\n", name)
+			continue
+		case apierrors.IsNotFound(err):
+			fmt.Printf("    + %s: %s, kept %s, %s\n", name, p.Schedule, p.Retention, policyComponents(p))
+			if dryRun {
+				continue
+			}
+			obj := m.object("Schedule", name, spec)
+			obj.SetLabels(map[string]string{policyLabel: p.Name})
+			_, err = client.Create(ctx, obj, metav1.CreateOptions{})
+		case err == nil:
+			fmt.Printf("    ~ %s: %s, kept %s, %s\n", name, p.Schedule, p.Retention, policyComponents(p))
+			if dryRun {
+				continue
+			}
+			u.Object["spec"] = spec
+			labels := u.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[policyLabel] = p.Name
+			u.SetLabels(labels)
+			_, err = client.Update(ctx, u, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply schedule %s: %w", name, err)
+		}
+	}
+
+	for _, u := range list.Items {
+		name := u.GetName()
+		if keep[name] || (name != legacySchedule && u.GetLabels()[policyLabel] == "") {
+			continue
+		}
+		fmt.Printf("    - %s\n", name)
+		if dryRun {
+			continue
+		}
+		if err := client.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete schedule %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// policySpec is the Schedule spec of a policy, and the scope of a policy of
+// components
+func policySpec(cfg *config.Config, p config.BackupPolicy) (map[string]interface{}, *Scope, error) {
+	ttl, err := time.ParseDuration(p.Retention)
+	if err != nil {
+		return nil, nil, fmt.Errorf("retention: %w", err)
+	}
+	template := backupSpec()
+	template["ttl"] = ttl.String()
+	if p.Location != "" {
+		template["storageLocation"] = p.Location
+	}
+
+	var scope *Scope
+	hooked := enabledScope(cfg)
+	if len(p.Components) > 0 {
+		if scope, err = ComponentScope(p.Components, cfg); err != nil {
+			return nil, nil, err
+		}
+		scope.restrict(template)
+		hooked = scope
+	}
+	if hooks := hookSpec(cfg, hooked); hooks != nil {
+		template["hooks"] = hooks
+	}
+	return map[string]interface{}{
+		"schedule": p.Schedule,
+		"template": template,
+	}, scope, nil
+}
+
+// hookSpec is the Velero backup hooks of the backup.hooks of components in
+// s, run in their pods by the app label; nil without any
+func hookSpec(cfg *config.Config, s *Scope) map[string]interface{} {
+	var resources []interface{}
+	for _, c := range s.components {
+		for i, h := range cfg.Backup.Hooks {
+			if h.Component != c.Name {
+				continue
+			}
+			r := map[string]interface{}{
+				"name":               fmt.Sprintf("%s-%d", c.Name, i),
+				"includedNamespaces": []interface{}{s.homes[c.Name]},
+				"labelSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"app": c.Workload},
+				},
+			}
+			if len(h.Pre) > 0 {
+				r["pre"] = []interface{}{hookExec(h, h.Pre)}
+			}
+			if len(h.Post) > 0 {
+				r["post"] = []interface{}{hookExec(h, h.Post)}
+			}
+			resources = append(resources, r)
+		}
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"resources": resources}
+}
+
+func hookExec(h config.BackupHook, command []string) map[string]interface{} {
+	exec := map[string]interface{}{"command": toList(command)}
+	if h.Container != "" {
+		exec["container"] = h.Container
+	}
+	if h.OnError != "" {
+		exec["onError"] = h.OnError
+	}
+	if h.Timeout != "" {
+		exec["timeout"] = h.Timeout
+	}
+	return map[string]interface{}{"exec": exec}
+}
+
+func policyComponents(p config.BackupPolicy) string {
+	components := "all components"
+	if len(p.Components) > 0 {
+		components = strings.Join(p.Components, ", ")
+	}
+	if p.Location != "" {
+		components += " to " + p.Location
+	}
+	return components
+}
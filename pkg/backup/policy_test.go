@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+func TestHookSpec(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Backup.Hooks = []config.BackupHook{
+		{Component: "postgresql", Container: "postgres", Pre: []string{"psql", "-c", "CHECKPOINT"}, OnError: "Continue", Timeout: "2m"},
+		{Component: "gitlab", Post: []string{"true"}},
+	}
+
+	if hooks := hookSpec(&cfg, scope(t, "redis")); hooks != nil {
+		t.Errorf("hooks without a hooked component: %v", hooks)
+	}
+
+	want := map[string]interface{}{"resources": []interface{}{
+		map[string]interface{}{
+			"name":               "postgresql-0",
+			"includedNamespaces": []interface{}{"ceres-core"},
+			"labelSelector":      map[string]interface{}{"matchLabels": map[string]interface{}{"app": "postgresql"}},
+			"pre": []interface{}{map[string]interface{}{"exec": map[string]interface{}{
+				"command":   []interface{}{"psql", "-c", "CHECKPOINT"},
+				"container": "postgres",
+				"onError":   "Continue",
+				"timeout":   "2m",
+			}}},
+		},
+		map[string]interface{}{
+			"name":               "gitlab-1",
+			"includedNamespaces": []interface{}{"gitlab"},
+			"labelSelector":      map[string]interface{}{"matchLabels": map[string]interface{}{"app": "gitlab"}},
+			"post":               []interface{}{map[string]interface{}{"exec": map[string]interface{}{"command": []interface{}{"true"}}}},
+		},
+	}}
+	if got := hookSpec(&cfg, scope(t, "postgresql", "gitlab")); !reflect.DeepEqual(got, want) {
+		t.Errorf("hookSpec =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestPolicySpec(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Backup.Hooks = []config.BackupHook{{Component: "postgresql", Pre: []string{"sync"}}}
+	spec, s, err := policySpec(&cfg, config.BackupPolicy{Name: "db", Schedule: "0 * * * *", Retention: "48h", Components: []string{"postgresql"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := spec["template"].(map[string]interface{})
+	if template["ttl"] != "48h0m0s" || s == nil || template["hooks"] == nil {
+		t.Errorf("template = %v", template)
+	}
+	if _, _, err := policySpec(&cfg, config.BackupPolicy{Name: "db", Retention: "two days"}); err == nil {
+		t.Error("invalid retention accepted")
+	}
+}
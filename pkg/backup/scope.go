@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/catalog"
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// ComponentLabel marks the objects of a CERES component, so a backup or
+// restore can select components with one label selector. The manifests do
+// not set it: ceres labels the objects before every backup.
+const ComponentLabel = "ceres.io/component"
+
+// componentsAnnotation lists the components of a selective backup
+const componentsAnnotation = "ceres.io/components"
+
+// labeledKinds are the kinds ceres labels with their component. Objects
+// their controllers create later (ReplicaSets, new pods) are recreated on
+// restore from the labeled Deployments and StatefulSets.
+var labeledKinds = []string{
+	"deployments", "statefulsets", "daemonsets", "cronjobs", "jobs", "pods",
+	"services", "ingresses", "configmaps", "secrets", "persistentvolumeclaims",
+	"serviceaccounts", "roles", "rolebindings",
+}
+
+// Scope is the components a backup or restore covers
+type Scope struct {
+	components []catalog.Component
+	homes      map[string]string // component → namespace
+}
+
+// ComponentScope returns the scope of the named components under cfg
+func ComponentScope(names []string, cfg *config.Config) (*Scope, error) {
+	s := &Scope{homes: map[string]string{}}
+	for _, name := range names {
+		c, err := catalog.Lookup(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := s.homes[c.Name]; dup {
+			continue
+		}
+		s.components = append(s.components, *c)
+		s.homes[c.Name] = c.Home(cfg)
+	}
+	if len(s.components) == 0 {
+		return nil, fmt.Errorf("no component given")
+	}
+	return s, nil
+}
+
+// enabledScope is the scope of every component cfg deploys
+func enabledScope(cfg *config.Config) *Scope {
+	s := &Scope{homes: map[string]string{}}
+	for _, c := range catalog.Components {
+		if c.Enabled(cfg) {
+			s.components = append(s.components, c)
+			s.homes[c.Name] = c.Home(cfg)
+		}
+	}
+	return s
+}
+
+// Names returns the component names
+func (s *Scope) Names() []string {
+	names := make([]string, len(s.components))
+	for i, c := range s.components {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Namespaces returns the namespaces of the components
+func (s *Scope) Namespaces() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, c := range s.components {
+		if ns := s.homes[c.Name]; !seen[ns] {
+			seen[ns] = true
+			out = append(out, ns)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// shared returns the namespaces the scope holds only some of the components
+// of, e.g. postgresql without redis in ceres-core. A namespace with every
+// component of its own in the scope is backed up whole.
+func (s *Scope) shared() map[string]bool {
+	in := map[string]bool{}
+	for _, c := range s.components {
+		in[c.Name] = true
+	}
+	out := map[string]bool{}
+	for _, c := range s.components {
+		for _, o := range catalog.Components {
+			if o.Namespace == c.Namespace && !in[o.Name] {
+				out[s.homes[c.Name]] = true
+			}
+		}
+	}
+	return out
+}
+
+// selectors are the Velero orLabelSelectors of the components, nil when
+// every namespace is backed up whole. In a shared namespace they select the
+// objects ceres labeled and, by their app label, the pods controllers
+// created since. Velero applies them to every namespace, so with a whole
+// namespace in the scope the objects without a component label are selected
+// too: those created since the last label pass (operator Secrets, the PVCs
+// of volumeClaimTemplates), taking the few of the shared namespace along.
+func (s *Scope) selectors() []interface{} {
+	shared := s.shared()
+	if len(shared) == 0 {
+		return nil
+	}
+	names := make([]interface{}, len(s.components))
+	workloads := make([]interface{}, len(s.components))
+	for i, c := range s.components {
+		names[i] = c.Name
+		workloads[i] = c.Workload
+	}
+	match := func(key, operator string, values []interface{}) interface{} {
+		expr := map[string]interface{}{"key": key, "operator": operator}
+		if values != nil {
+			expr["values"] = values
+		}
+		return map[string]interface{}{"matchExpressions": []interface{}{expr}}
+	}
+	selectors := []interface{}{match(ComponentLabel, "In", names), match("app", "In", workloads)}
+	if len(shared) < len(s.Namespaces()) {
+		selectors = append(selectors, match(ComponentLabel, "DoesNotExist", nil))
+	}
+	return selectors
+}
+
+// restrict limits a backup spec to the components: their namespaces, and
+// the selectors in shared ones
+func (s *Scope) restrict(spec map[string]interface{}) {
+	spec["includedNamespaces"] = toList(s.Namespaces())
+	if selectors := s.selectors(); selectors != nil {
+		spec["orLabelSelectors"] = selectors
+	} else {
+		delete(spec, "orLabelSelectors")
+	}
+	delete(spec, "excludedNamespaces")
+}
+
+// label sets ComponentLabel on the objects of the components: everything
+// in a namespace of its own, the objects the component owns by name in a
+// shared one (postgresql-secret in ceres-core)
+func (s *Scope) label() error {
+	kinds := strings.Join(labeledKinds, ",")
+	for _, c := range s.components {
+		ns := s.homes[c.Name]
+		value := ComponentLabel + "=" + c.Name
+		if !c.SharesNamespace() {
+			if out, err := exec.Command("kubectl", "label", kinds, "--all", "-n", ns, value, "--overwrite").CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to label %s: %w: %s", c.Name, err, strings.TrimSpace(string(out)))
+			}
+			continue
+		}
+
+		out, err := exec.Command("kubectl", "get", kinds, "-n", ns, "-o", "name").Output()
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", ns, err)
+		}
+		var owned []string
+		for _, obj := range strings.Fields(string(out)) {
+			// deployment.apps/grafana
+			if c.Owns(ns, ns, path.Base(obj)) {
+				owned = append(owned, obj)
+			}
+		}
+		if len(owned) == 0 {
+			continue
+		}
+		args := append([]string{"label", "-n", ns}, owned...)
+		if out, err := exec.Command("kubectl", append(args, value, "--overwrite")...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to label %s: %w: %s", c.Name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// ParseNamespaceMapping reads old:new pairs, e.g. gitlab:gitlab-restore
+func ParseNamespaceMapping(pairs []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, p := range pairs {
+		from, to, ok := strings.Cut(p, ":")
+		if !ok || from == "" || to == "" || from == to {
+			return nil, fmt.Errorf("namespace mapping %q is not old:new", p)
+		}
+		mapping[from] = to
+	}
+	return mapping, nil
+}
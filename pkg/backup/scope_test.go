@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+func scope(t *testing.T, names ...string) *Scope {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	s, err := ComponentScope(names, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// expressions flattens selectors to key/operator/values triples
+func expressions(selectors []interface{}) [][]interface{} {
+	var out [][]interface{}
+	for _, sel := range selectors {
+		for _, e := range sel.(map[string]interface{})["matchExpressions"].([]interface{}) {
+			expr := e.(map[string]interface{})
+			values, _ := expr["values"].([]interface{})
+			out = append(out, []interface{}{expr["key"], expr["operator"], values})
+		}
+	}
+	return out
+}
+
+func TestScopeSelectors(t *testing.T) {
+	// gitlab has its namespace to itself: backed up whole
+	if sel := scope(t, "gitlab").selectors(); sel != nil {
+		t.Errorf("whole namespace selected by label: %v", sel)
+	}
+	// postgresql and redis are all of ceres-core
+	if sel := scope(t, "postgresql", "redis").selectors(); sel != nil {
+		t.Errorf("complete shared namespace selected by label: %v", sel)
+	}
+
+	want := [][]interface{}{
+		{ComponentLabel, "In", []interface{}{"postgresql"}},
+		{"app", "In", []interface{}{"postgresql"}},
+	}
+	if got := expressions(scope(t, "postgresql").selectors()); !reflect.DeepEqual(got, want) {
+		t.Errorf("postgresql selectors = %v, want %v", got, want)
+	}
+
+	// a whole namespace next to a shared one keeps its unlabelled objects
+	want = [][]interface{}{
+		{ComponentLabel, "In", []interface{}{"grafana", "gitlab"}},
+		{"app", "In", []interface{}{"grafana", "gitlab"}},
+		{ComponentLabel, "DoesNotExist", []interface{}(nil)},
+	}
+	if got := expressions(scope(t, "grafana", "gitlab").selectors()); !reflect.DeepEqual(got, want) {
+		t.Errorf("grafana, gitlab selectors = %v, want %v", got, want)
+	}
+}
+
+func TestScopeRestrict(t *testing.T) {
+	spec := backupSpec()
+	spec["orLabelSelectors"] = []interface{}{"stale"}
+	scope(t, "gitlab", "nextcloud").restrict(spec)
+	if _, ok := spec["orLabelSelectors"]; ok {
+		t.Error("selectors kept for whole namespaces")
+	}
+	if _, ok := spec["excludedNamespaces"]; ok {
+		t.Error("excludedNamespaces kept")
+	}
+	if got := spec["includedNamespaces"]; !reflect.DeepEqual(got, []interface{}{"gitlab", "nextcloud"}) {
+		t.Errorf("includedNamespaces = %v", got)
+	}
+
+	scope(t, "redis").restrict(spec)
+	if _, ok := spec["orLabelSelectors"]; !ok {
+		t.Error("no selectors in a shared namespace")
+	}
+}
+
+func TestComponentScope(t *testing.T) {
+	s := scope(t, "gitlab", " gitlab", "postgresql")
+	if got := s.Names(); !reflect.DeepEqual(got, []string{"gitlab", "postgresql"}) {
+		t.Errorf("Names = %v", got)
+	}
+	if got := s.Namespaces(); !reflect.DeepEqual(got, []string{"ceres-core", "gitlab"}) {
+		t.Errorf("Namespaces = %v", got)
+	}
+	cfg := config.DefaultConfig()
+	if _, err := ComponentScope([]string{"nope"}, &cfg); err == nil {
+		t.Error("unknown component accepted")
+	}
+	if _, err := ComponentScope(nil, &cfg); err == nil {
+		t.Error("empty scope accepted")
+	}
+}
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The velero.io/v1 resources the manager reads and writes
+var (
+	backupsResource   = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backups"}
+	restoresResource  = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "restores"}
+	schedulesResource = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "schedules"}
+)
+
+// Phases of a Backup or Restore after which it no longer changes
+var finalPhases = map[string]bool{
+	"Completed":        true,
+	"PartiallyFailed":  true,
+	"Failed":           true,
+	"FailedValidation": true,
+}
+
+// Progress counts the items of a running or finished Backup or Restore
+type Progress struct {
+	Done  int64
+	Total int64
+}
+
+func (p Progress) String() string {
+	if p.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", p.Done, p.Total)
+}
+
+// Backup is a velero.io/v1 Backup
+type Backup struct {
+	Name            string
+	Phase           string
+	Schedule        string // the Schedule that made it, if any
+	StorageLocation string
+	// Components of a selective backup; empty for a full one
+	Components []string
+	Started    time.Time
+	Completed  time.Time
+	Expiration time.Time
+	Errors     int64
+	Warnings   int64
+	Items      Progress
+	// FailureReason and ValidationErrors explain Failed and FailedValidation
+	FailureReason    string
+	ValidationErrors []string
+}
+
+// Done reports whether the backup finished, successfully or not
+func (b *Backup) Done() bool {
+	return finalPhases[b.Phase]
+}
+
+// Succeeded reports whether the backup completed without errors
+func (b *Backup) Succeeded() bool {
+	return b.Phase == "Completed"
+}
+
+// Restore is a velero.io/v1 Restore
+type Restore struct {
+	Name             string
+	Backup           string
+	Phase            string
+	NamespaceMapping map[string]string
+	Started          time.Time
+	Completed        time.Time
+	Errors           int64
+	Warnings         int64
+	Items            Progress
+	FailureReason    string
+	ValidationErrors []string
+}
+
+// Done reports whether the restore finished, successfully or not
+func (r *Restore) Done() bool {
+	return finalPhases[r.Phase]
+}
+
+// Succeeded reports whether the restore completed without errors
+func (r *Restore) Succeeded() bool {
+	return r.Phase == "Completed"
+}
+
+// Schedule is a velero.io/v1 Schedule
+type Schedule struct {
+	Name       string
+	Cron       string
+	TTL        string
+	Paused     bool
+	Phase      string
+	LastBackup time.Time
+}
+
+func backupFrom(u *unstructured.Unstructured) *Backup {
+	b := &Backup{
+		Name:             u.GetName(),
+		Phase:            str(u, "status", "phase"),
+		Schedule:         u.GetLabels()["velero.io/schedule-name"],
+		StorageLocation:  str(u, "spec", "storageLocation"),
+		Started:          timestamp(u, "status", "startTimestamp"),
+		Completed:        timestamp(u, "status", "completionTimestamp"),
+		Expiration:       timestamp(u, "status", "expiration"),
+		Errors:           num(u, "status", "errors"),
+		Warnings:         num(u, "status", "warnings"),
+		Items:            Progress{num(u, "status", "progress", "itemsBackedUp"), num(u, "status", "progress", "totalItems")},
+		FailureReason:    str(u, "status", "failureReason"),
+		ValidationErrors: strs(u, "status", "validationErrors"),
+	}
+	if c := u.GetAnnotations()[componentsAnnotation]; c != "" {
+		b.Components = strings.Split(c, ",")
+	} else {
+		b.Components = selectedComponents(u)
+	}
+	if b.Phase == "" {
+		b.Phase = "New"
+	}
+	return b
+}
+
+func restoreFrom(u *unstructured.Unstructured) *Restore {
+	r := &Restore{
+		Name:             u.GetName(),
+		Backup:           str(u, "spec", "backupName"),
+		Phase:            str(u, "status", "phase"),
+		Started:          timestamp(u, "status", "startTimestamp"),
+		Completed:        timestamp(u, "status", "completionTimestamp"),
+		Errors:           num(u, "status", "errors"),
+		Warnings:         num(u, "status", "warnings"),
+		Items:            Progress{num(u, "status", "progress", "itemsRestored"), num(u, "status", "progress", "totalItems")},
+		FailureReason:    str(u, "status", "failureReason"),
+		ValidationErrors: strs(u, "status", "validationErrors"),
+	}
+	r.NamespaceMapping, _, _ = unstructured.NestedStringMap(u.Object, "spec", "namespaceMapping")
+	if r.Phase == "" {
+		r.Phase = "New"
+	}
+	return r
+}
+
+func scheduleFrom(u *unstructured.Unstructured) *Schedule {
+	paused, _, _ := unstructured.NestedBool(u.Object, "spec", "paused")
+	return &Schedule{
+		Name:       u.GetName(),
+		Cron:       str(u, "spec", "schedule"),
+		TTL:        str(u, "spec", "template", "ttl"),
+		Paused:     paused,
+		Phase:      str(u, "status", "phase"),
+		LastBackup: timestamp(u, "status", "lastBackup"),
+	}
+}
+
+// selectedComponents reads the components of a selective backup made by a
+// Schedule, which cannot annotate its backups, from its label selectors
+func selectedComponents(u *unstructured.Unstructured) []string {
+	selectors, _, _ := unstructured.NestedSlice(u.Object, "spec", "orLabelSelectors")
+	for _, sel := range selectors {
+		m, _ := sel.(map[string]interface{})
+		exprs, _, _ := unstructured.NestedSlice(m, "matchExpressions")
+		for _, e := range exprs {
+			expr, _ := e.(map[string]interface{})
+			if expr["key"] != ComponentLabel {
+				continue
+			}
+			values, _, _ := unstructured.NestedStringSlice(expr, "values")
+			return values
+		}
+	}
+	return nil
+}
+
+func str(u *unstructured.Unstructured, path ...string) string {
+	v, _, _ := unstructured.NestedString(u.Object, path...)
+	return v
+}
+
+func strs(u *unstructured.Unstructured, path ...string) []string {
+	v, _, _ := unstructured.NestedStringSlice(u.Object, path...)
+	return v
+}
+
+// num reads an integer; JSON decoding leaves int64 or float64
+func num(u *unstructured.Unstructured, path ...string) int64 {
+	v, ok, _ := unstructured.NestedFieldNoCopy(u.Object, path...)
+	if !ok {
+		return 0
+	}
+	switch n := v.(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func timestamp(u *unstructured.Unstructured, path ...string) time.Time {
+	t, _ := time.Parse(time.RFC3339, str(u, path...))
+	return t
+}
+
+// watch calls update with every version of the named object until done
+// returns true, re-watching when the API server closes the stream
+func (m *Manager) watch(ctx context.Context, resource schema.GroupVersionResource, name string, done func(*unstructured.Unstructured) bool) error {
+	client := m.client.Resource(resource).Namespace(m.namespace)
+	for {
+		u, err := client.Get(ctx, name, getOptions)
+		if err != nil {
+			return err
+		}
+		if done(u) {
+			return nil
+		}
+		w, err := client.Watch(ctx, listOptions("metadata.name="+name, u.GetResourceVersion()))
+		if err != nil {
+			return err
+		}
+		for ev := range w.ResultChan() {
+			if u, ok := ev.Object.(*unstructured.Unstructured); ok && done(u) {
+				w.Stop()
+				return nil
+			}
+		}
+		w.Stop()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
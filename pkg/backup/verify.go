@@ -0,0 +1,514 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/catalog"
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/db"
+)
+
+// clusterWide components watch the whole cluster; a second copy would fight
+// the running one, so they are not verified
+var clusterWide = map[string]bool{"ingress-nginx": true, "cert-manager": true, "promtail": true}
+
+// notHTTP components serve no HTTP on their Service and pass on health
+var notHTTP = map[string]bool{"openldap": true, "rabbitmq": true}
+
+// webPorts are the Service port names probed over HTTP before the first port
+var webPorts = map[string]bool{"http": true, "https": true, "web": true, "ui": true}
+
+// State keys of the last successful verification
+const (
+	verifiedKey       = "backupVerified"
+	verifiedBackupKey = "backupVerifiedName"
+)
+
+// isolationPolicy keeps the pods of a verification from reaching the running
+// components; they reach each other and DNS only
+const isolationPolicy = "ceres-verify-isolation"
+
+// VerifyOptions controls Verify
+type VerifyOptions struct {
+	// Scope is the components to verify; nil verifies the components of a
+	// selective backup, or every enabled one
+	Scope *Scope
+	// Suffix is appended to the namespaces of the copy, default -verify
+	Suffix string
+	// Timeout bounds the wait for the components to become healthy
+	Timeout time.Duration
+	// Keep leaves the copy for inspection
+	Keep bool
+	// Record notes a successful verification in the deployment state
+	Record bool
+}
+
+// Check is one step of a verification
+type Check struct {
+	Component string
+	Name      string // restore, health, http or database
+	Passed    bool
+	Detail    string
+}
+
+// Report is the result of a verification
+type Report struct {
+	Backup     string
+	Restore    string
+	Namespaces map[string]string // original → copy
+	Started    time.Time
+	Finished   time.Time
+	Checks     []Check
+}
+
+// Passed reports whether every check passed
+func (r *Report) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+func (r *Report) add(component, name string, passed bool, format string, args ...interface{}) {
+	c := Check{Component: component, Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)}
+	r.Checks = append(r.Checks, c)
+	mark := "✅"
+	if !passed {
+		mark = "❌"
+	}
+	fmt.Printf("    %s %s %s: %s\n", mark, component, name, c.Detail)
+}
+
+// Verify restores a backup into copies of its namespaces, waits for the
+// components to become healthy, probes them and deletes the copy. The pods
+// of the copy cannot reach the running namespaces: references to them in
+// the workloads and ConfigMaps are pointed at the copies, and CronJobs are
+// suspended.
+func (m *Manager) Verify(backupName string, opts VerifyOptions) (*Report, error) {
+	cfg := &config.Current().Config
+	b, err := m.GetBackup(backupName)
+	if err != nil {
+		return nil, err
+	}
+	scope := opts.Scope
+	switch {
+	case scope != nil:
+		for _, name := range scope.Names() {
+			if clusterWide[name] {
+				return nil, fmt.Errorf("%s runs cluster-wide and cannot be verified in a copy", name)
+			}
+		}
+	case len(b.Components) > 0:
+		if scope, err = ComponentScope(b.Components, cfg); err != nil {
+			return nil, err
+		}
+	default:
+		scope = enabledScope(cfg)
+	}
+	scope = scope.without(clusterWide)
+	if len(scope.components) == 0 {
+		return nil, fmt.Errorf("backup %s has no component to verify", backupName)
+	}
+
+	suffix := opts.Suffix
+	if suffix == "" {
+		suffix = "-verify"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 15 * time.Minute
+	}
+	r := &Report{Backup: backupName, Namespaces: map[string]string{}, Started: time.Now()}
+	for _, ns := range scope.Namespaces() {
+		to := ns + suffix
+		if len(to) > 63 {
+			return nil, fmt.Errorf("namespace %s is longer than 63 characters, use a shorter suffix", to)
+		}
+		if exec.Command("kubectl", "get", "namespace", to).Run() == nil {
+			return nil, fmt.Errorf("namespace %s exists: delete it or pick another suffix", to)
+		}
+		r.Namespaces[ns] = to
+	}
+
+	fmt.Printf("🧪 Verifying backup %s (%s)...\n", backupName, strings.Join(scope.Names(), ", "))
+	if err := isolate(r.Namespaces, suffix); err != nil {
+		return nil, err
+	}
+	if !opts.Keep {
+		defer func() {
+			fmt.Println("🧹 Deleting the copy...")
+			for _, to := range r.Namespaces {
+				if out, err := exec.Command("kubectl", "delete", "namespace", to, "--wait=true", "--timeout=5m").CombinedOutput(); err != nil {
+					fmt.Printf("    ⚠️  %s: %v: %s\n", to, err, strings.TrimSpace(string(out)))
+				}
+			}
+		}()
+	}
+
+	restore, err := m.Restore(backupName, RestoreOptions{Scope: scope, NamespaceMapping: r.Namespaces, NamespacedOnly: true})
+	if restore != nil {
+		r.Restore = restore.Name
+	}
+	if err != nil {
+		r.add("backup", "restore", false, "%v", err)
+		r.Finished = time.Now()
+		return r, nil
+	}
+	r.add("backup", "restore", true, "%s items restored", restore.Items)
+	if err := redirect(r.Namespaces); err != nil {
+		r.add("backup", "restore", false, "%v", err)
+		r.Finished = time.Now()
+		return r, nil
+	}
+
+	fmt.Printf("⏳ Waiting up to %s for the components...\n", opts.Timeout)
+	healthy := waitHealthy(scope, r, opts.Timeout)
+	for _, c := range scope.components {
+		if healthy[c.Name] {
+			probe(cfg, c, scope.homes[c.Name], r.Namespaces[scope.homes[c.Name]], r)
+		}
+	}
+	r.Finished = time.Now()
+
+	if r.Passed() && opts.Record {
+		if err := recordVerification(r); err != nil {
+			return r, fmt.Errorf("backup %s verified but not recorded: %w", backupName, err)
+		}
+	}
+	return r, nil
+}
+
+// LastVerification returns the backup last verified with Record and when
+func LastVerification() (backup string, at time.Time, ok bool) {
+	out, err := exec.Command("kubectl", "get", "configmap", "ceres-deployment-state", "-n", "kube-system", "-o", "jsonpath={.data}").Output()
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	var data map[string]string
+	if json.Unmarshal(out, &data) != nil || data[verifiedKey] == "" {
+		return "", time.Time{}, false
+	}
+	at, err = time.Parse(time.RFC3339, data[verifiedKey])
+	return data[verifiedBackupKey], at, err == nil
+}
+
+func recordVerification(r *Report) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"data": map[string]string{
+			verifiedKey:       r.Finished.UTC().Format(time.RFC3339),
+			verifiedBackupKey: r.Backup,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("kubectl", "patch", "configmap", "ceres-deployment-state", "-n", "kube-system",
+		"--type", "merge", "-p", string(patch)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// without returns the scope less the named components
+func (s *Scope) without(names map[string]bool) *Scope {
+	out := &Scope{homes: map[string]string{}}
+	for _, c := range s.components {
+		if !names[c.Name] {
+			out.components = append(out.components, c)
+			out.homes[c.Name] = s.homes[c.Name]
+		}
+	}
+	return out
+}
+
+// isolate creates the namespaces of the copy with a NetworkPolicy letting
+// their pods reach each other and DNS only
+func isolate(namespaces map[string]string, suffix string) error {
+	label := map[string]interface{}{"ceres.io/verify": strings.TrimPrefix(suffix, "-")}
+	var items []interface{}
+	for _, to := range namespaces {
+		items = append(items,
+			map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata":   map[string]interface{}{"name": to, "labels": label},
+			},
+			map[string]interface{}{
+				"apiVersion": "networking.k8s.io/v1",
+				"kind":       "NetworkPolicy",
+				"metadata":   map[string]interface{}{"name": isolationPolicy, "namespace": to},
+				"spec": map[string]interface{}{
+					"podSelector": map[string]interface{}{},
+					"policyTypes": []interface{}{"Egress"},
+					"egress": []interface{}{
+						map[string]interface{}{"to": []interface{}{
+							map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": label}},
+						}},
+						map[string]interface{}{
+							"to": []interface{}{map[string]interface{}{"namespaceSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": "kube-system"},
+							}}},
+							"ports": []interface{}{
+								map[string]interface{}{"protocol": "UDP", "port": 53},
+								map[string]interface{}{"protocol": "TCP", "port": 53},
+							},
+						},
+					},
+				},
+			})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create the namespaces of the copy: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// redirect points the restored workloads and ConfigMaps at the copies of
+// the namespaces they address (postgresql.ceres-core.svc) and suspends the
+// restored CronJobs
+func redirect(namespaces map[string]string) error {
+	var pairs []string
+	for from, to := range namespaces {
+		pairs = append(pairs, "."+from+".svc", "."+to+".svc")
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	for _, to := range namespaces {
+		out, err := exec.Command("kubectl", "get", "deployments,statefulsets,daemonsets,cronjobs,configmaps", "-n", to, "-o", "json").Output()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", to, err)
+		}
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(out, &list); err != nil {
+			return fmt.Errorf("invalid list of %s: %w", to, err)
+		}
+		var changed []interface{}
+		for _, raw := range list.Items {
+			rewritten := replacer.Replace(string(raw))
+			var obj map[string]interface{}
+			if err := json.Unmarshal([]byte(rewritten), &obj); err != nil {
+				return err
+			}
+			if spec, ok := obj["spec"].(map[string]interface{}); ok && obj["kind"] == "CronJob" {
+				spec["suspend"] = true
+			} else if rewritten == string(raw) {
+				continue
+			}
+			changed = append(changed, obj)
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		data, _ := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": changed})
+		cmd := exec.Command("kubectl", "replace", "-f", "-")
+		cmd.Stdin = bytes.NewReader(data)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to redirect %s: %w: %s", to, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// waitHealthy polls the health of the components in the copy until all are
+// healthy or the timeout passed, and reports each
+func waitHealthy(s *Scope, r *Report, timeout time.Duration) map[string]bool {
+	deadline := time.Now().Add(timeout)
+	last := map[string]catalog.Health{}
+	for {
+		pending := 0
+		for _, c := range s.components {
+			h, err := catalog.HealthIn(c, r.Namespaces[s.homes[c.Name]])
+			if err != nil {
+				h.Status = err.Error()
+			}
+			last[c.Name] = h
+			if h.Status != catalog.Healthy && h.Status != catalog.Stopped {
+				pending++
+			}
+		}
+		if pending == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	healthy := map[string]bool{}
+	for _, c := range s.components {
+		h := last[c.Name]
+		switch h.Status {
+		case catalog.Healthy:
+			healthy[c.Name] = true
+			r.add(c.Name, "health", true, "%d/%d ready", h.Ready, h.Desired)
+		case catalog.Stopped:
+			r.add(c.Name, "health", true, "scaled to zero in the backup")
+		default:
+			r.add(c.Name, "health", false, "%s, %d/%d ready", h.Status, h.Ready, h.Desired)
+		}
+	}
+	return healthy
+}
+
+// probe runs the smoke test of a healthy component restored from home into
+// namespace: connecting to the service databases, a Redis PING, or an HTTP
+// request to its Service
+func probe(cfg *config.Config, c catalog.Component, home, namespace string, r *Report) {
+	switch {
+	case c.Name == "postgresql":
+		pod, err := podOf(namespace, c.Workload)
+		if err != nil {
+			r.add(c.Name, "database", false, "%v", err)
+			return
+		}
+		for _, d := range db.Enabled(*cfg) {
+			script := `PGPASSWORD="$POSTGRES_PASSWORD" exec psql -h localhost -U ` + db.Superuser + ` -d "$0" -X -t -A -c "SELECT count(*) FROM pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema')"`
+			out, err := exec.Command("kubectl", "exec", "-n", namespace, pod, "--", "sh", "-c", script, d.Name).CombinedOutput()
+			if err != nil {
+				r.add(c.Name, "database", false, "%s: %s", d.Name, strings.TrimSpace(string(out)))
+				continue
+			}
+			r.add(c.Name, "database", true, "%s: %s tables", d.Name, strings.TrimSpace(string(out)))
+		}
+	case c.Name == "redis":
+		pod, err := podOf(namespace, c.Workload)
+		if err != nil {
+			r.add(c.Name, "database", false, "%v", err)
+			return
+		}
+		out, err := exec.Command("kubectl", "exec", "-n", namespace, pod, "--", "sh", "-c",
+			`exec redis-cli ${REDIS_PASSWORD:+-a "$REDIS_PASSWORD"} --no-auth-warning ping`).CombinedOutput()
+		pong := strings.TrimSpace(string(out))
+		r.add(c.Name, "database", err == nil && pong == "PONG", "PING: %s", pong)
+	case !notHTTP[c.Name]:
+		probeHTTP(c, home, namespace, r)
+	}
+}
+
+// probeHTTP requests / from the component's Service through a port-forward
+// and expects HTTP 200. Redirects are followed inside the copy: relative
+// ones, and those to the hosts of the component's ingresses in home, which
+// the copy has none of. A redirect elsewhere, e.g. a Keycloak login, fails.
+func probeHTTP(c catalog.Component, home, namespace string, r *Report) {
+	out, err := exec.Command("kubectl", "get", "service", c.Workload, "-n", namespace,
+		"-o", `jsonpath={range .spec.ports[*]}{.name} {.port}{"\n"}{end}`).Output()
+	if err != nil {
+		// no Service of its own: health is all there is to check
+		return
+	}
+	port := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, number, _ := strings.Cut(line, " ")
+		if port == "" {
+			port = number
+		}
+		if webPorts[name] {
+			port = number
+			break
+		}
+	}
+	if port == "" {
+		return
+	}
+
+	forward, local, err := portForward(namespace, "svc/"+c.Workload, port)
+	if err != nil {
+		r.add(c.Name, "http", false, "%v", err)
+		return
+	}
+	defer func() {
+		forward.Process.Kill()
+		forward.Wait()
+	}()
+
+	scheme := "http"
+	if port == "443" || port == "8443" {
+		scheme = "https"
+	}
+	hosts := map[string]bool{}
+	out, _ = exec.Command("kubectl", "get", "ingresses", "-n", home, "-o", "jsonpath={.items[*].spec.rules[*].host}").Output()
+	for _, h := range strings.Fields(string(out)) {
+		hosts[h] = true
+	}
+	base := scheme + "://127.0.0.1:" + local
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("more than 10 redirects")
+			}
+			if req.URL.Host == "127.0.0.1:"+local {
+				return nil
+			}
+			if !hosts[req.URL.Hostname()] {
+				return http.ErrUseLastResponse
+			}
+			// the running host: the same path on the copy
+			u := *req.URL
+			u.Scheme, u.Host = scheme, "127.0.0.1:"+local
+			req.URL, req.Host = &u, ""
+			return nil
+		},
+		// the copy serves the certificates of the running hosts
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(base + "/")
+	if err != nil {
+		r.add(c.Name, "http", false, "%v", err)
+		return
+	}
+	resp.Body.Close()
+	if location := resp.Header.Get("Location"); resp.StatusCode/100 == 3 && location != "" {
+		r.add(c.Name, "http", false, "GET / on port %s: %s to %s, outside the copy", port, resp.Status, location)
+		return
+	}
+	path := resp.Request.URL.Path
+	r.add(c.Name, "http", resp.StatusCode == http.StatusOK, "GET %s on port %s: %s", path, port, resp.Status)
+}
+
+// podOf returns a running pod of a workload
+func podOf(namespace, workload string) (string, error) {
+	out, _ := exec.Command("kubectl", "get", "pods", "-n", namespace, "-l", "app="+workload,
+		"--field-selector", "status.phase=Running", "-o", "jsonpath={.items[0].metadata.name}").Output()
+	if pod := strings.TrimSpace(string(out)); pod != "" {
+		return pod, nil
+	}
+	return "", fmt.Errorf("no running %s pod in %s", workload, namespace)
+}
+
+// portForward forwards a free local port to target and returns the port
+func portForward(namespace, target, port string) (*exec.Cmd, string, error) {
+	cmd := exec.Command("kubectl", "port-forward", "-n", namespace, target, ":"+port)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("kubectl port-forward: %w", err)
+	}
+	// Forwarding from 127.0.0.1:54321 -> 80
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if i, j := strings.LastIndex(line, ":"), strings.Index(line, " ->"); err == nil && i >= 0 && j > i {
+		go io.Copy(io.Discard, stdout)
+		return cmd, line[i+1 : j], nil
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil, "", fmt.Errorf("kubectl port-forward %s failed: %s", target, strings.TrimSpace(stderr.String()))
+}
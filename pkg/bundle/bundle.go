@@ -0,0 +1,296 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/images"
+)
+
+const (
+	// IndexFile describes the bundle contents (images and charts)
+	IndexFile = "bundle.json"
+	// ImagesDir is the OCI image layout holding all images
+	ImagesDir = "oci"
+	// ChartsDir holds packaged charts (.tgz)
+	ChartsDir = "charts"
+)
+
+// Image is an image stored in the bundle's OCI layout
+type Image struct {
+	Source string `json:"source"` // upstream reference
+	Name   string `json:"name"`   // reference name inside the OCI layout
+}
+
+// Chart is a packaged Helm chart stored in the bundle
+type Chart struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	File    string `json:"file"`
+}
+
+// Index is the bundle.json manifest
+type Index struct {
+	CeresVersion string    `json:"ceresVersion"`
+	Created      time.Time `json:"created"`
+	Images       []Image   `json:"images"`
+	Charts       []Chart   `json:"charts"`
+}
+
+// ChartSource is a chart to package: a repo chart (RepoURL) or a local chart directory (Path)
+type ChartSource struct {
+	Name    string
+	RepoURL string
+	Version string
+	Path    string
+}
+
+// CreateOptions configures Create
+type CreateOptions struct {
+	Output        string
+	CeresVersion  string
+	Images        []string
+	Charts        []ChartSource
+	IgnoreMissing bool // skip images that cannot be pulled instead of failing
+}
+
+// Create pulls images and charts into a temporary directory and writes it as a .tar.gz bundle
+func Create(opts CreateOptions) error {
+	if err := requireTools("skopeo", "helm"); err != nil {
+		return err
+	}
+
+	work, err := os.MkdirTemp("", "ceres-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	index := Index{CeresVersion: opts.CeresVersion, Created: time.Now().UTC()}
+	layout := filepath.Join(work, ImagesDir)
+
+	fmt.Printf("📦 Copying %d images...\n", len(opts.Images))
+	var missing []string
+	for i, ref := range opts.Images {
+		name := fmt.Sprintf("img-%03d", i+1)
+		src := "docker://" + images.Parse(ref).String()
+		fmt.Printf("  → %s\n", ref)
+		out, err := exec.Command("skopeo", "copy", "--quiet", src, "oci:"+layout+":"+name).CombinedOutput()
+		if err != nil {
+			if !opts.IgnoreMissing {
+				return fmt.Errorf("failed to copy %s: %w\nOutput: %s", ref, err, out)
+			}
+			fmt.Printf("    ⚠️  skipped: %s\n", strings.TrimSpace(string(out)))
+			missing = append(missing, ref)
+			continue
+		}
+		index.Images = append(index.Images, Image{Source: ref, Name: name})
+	}
+
+	chartsDir := filepath.Join(work, ChartsDir)
+	if err := os.MkdirAll(chartsDir, 0755); err != nil {
+		return err
+	}
+	fmt.Printf("📦 Packaging %d charts...\n", len(opts.Charts))
+	for _, c := range opts.Charts {
+		fmt.Printf("  → %s %s\n", c.Name, c.Version)
+		file, err := fetchChart(c, chartsDir)
+		if err != nil {
+			return err
+		}
+		index.Charts = append(index.Charts, Chart{Name: c.Name, Version: c.Version, File: ChartsDir + "/" + file})
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(work, IndexFile), data, 0644); err != nil {
+		return err
+	}
+
+	if err := writeTarGz(work, opts.Output); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Output, err)
+	}
+
+	fmt.Printf("✅ Bundle written: %s (%d images, %d charts)\n", opts.Output, len(index.Images), len(index.Charts))
+	if len(missing) > 0 {
+		fmt.Printf("⚠️  %d images skipped:\n", len(missing))
+		for _, ref := range missing {
+			fmt.Printf("   - %s\n", ref)
+		}
+	}
+	return nil
+}
+
+// fetchChart pulls or packages a chart into dir and returns the file name
+func fetchChart(c ChartSource, dir string) (string, error) {
+	before, _ := filepath.Glob(filepath.Join(dir, "*.tgz"))
+
+	var cmd *exec.Cmd
+	if c.Path != "" {
+		cmd = exec.Command("helm", "package", c.Path, "--destination", dir)
+	} else {
+		args := []string{"pull", c.Name, "--repo", c.RepoURL, "--destination", dir}
+		if c.Version != "" {
+			args = append(args, "--version", c.Version)
+		}
+		cmd = exec.Command("helm", args...)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to fetch chart %s: %w\nOutput: %s", c.Name, err, out)
+	}
+
+	after, _ := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	known := map[string]bool{}
+	for _, f := range before {
+		known[f] = true
+	}
+	for _, f := range after {
+		if !known[f] {
+			return filepath.Base(f), nil
+		}
+	}
+	return "", fmt.Errorf("chart %s: no package written", c.Name)
+}
+
+// LoadOptions configures Load
+type LoadOptions struct {
+	Bundle   string
+	Registry string
+	Insecure bool // plain HTTP / self-signed registry
+}
+
+// Load pushes every image and chart in a bundle to a private registry.
+// Images keep their repository path (images.Mirror), charts go to <registry>/charts.
+func Load(opts LoadOptions) error {
+	registry := strings.TrimRight(strings.TrimSpace(opts.Registry), "/")
+	if registry == "" {
+		return fmt.Errorf("registry is required (--registry or CERES_IMAGE_REGISTRY)")
+	}
+	if err := requireTools("skopeo", "helm"); err != nil {
+		return err
+	}
+
+	work, err := os.MkdirTemp("", "ceres-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	fmt.Printf("📂 Extracting %s...\n", opts.Bundle)
+	if err := extractTarGz(opts.Bundle, work); err != nil {
+		return fmt.Errorf("failed to extract bundle: %w", err)
+	}
+
+	index, err := readIndex(work)
+	if err != nil {
+		return err
+	}
+
+	layout := filepath.Join(work, ImagesDir)
+	fmt.Printf("📤 Pushing %d images to %s...\n", len(index.Images), registry)
+	for _, img := range index.Images {
+		dest, extra := pushRef(img.Source, registry)
+		fmt.Printf("  → %s\n", dest)
+		args := []string{"copy", "--quiet"}
+		if opts.Insecure {
+			args = append(args, "--dest-tls-verify=false")
+		}
+		args = append(args, extra...)
+		args = append(args, "oci:"+layout+":"+img.Name, "docker://"+dest)
+		if out, err := exec.Command("skopeo", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to push %s: %w\nOutput: %s", img.Source, err, out)
+		}
+	}
+
+	fmt.Printf("📤 Pushing %d charts to oci://%s/charts...\n", len(index.Charts), registry)
+	for _, c := range index.Charts {
+		fmt.Printf("  → %s %s\n", c.Name, c.Version)
+		args := []string{"push", filepath.Join(work, filepath.FromSlash(c.File)), "oci://" + registry + "/charts"}
+		if opts.Insecure {
+			args = append(args, "--plain-http")
+		}
+		if out, err := exec.Command("helm", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to push chart %s: %w\nOutput: %s", c.Name, err, out)
+		}
+	}
+
+	fmt.Println("✅ Bundle loaded")
+	fmt.Printf("  Deploy with: CERES_IMAGE_REGISTRY=%s ceres deploy\n", registry)
+	return nil
+}
+
+// Inspect returns the index of a bundle without extracting images
+func Inspect(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", IndexFile, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == IndexFile {
+			var index Index
+			if err := json.NewDecoder(tr).Decode(&index); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", IndexFile, err)
+			}
+			return &index, nil
+		}
+	}
+}
+
+// pushRef returns the destination reference in the private registry and any
+// extra skopeo flags. Digest-pinned images are pushed by digest.
+func pushRef(source, registry string) (string, []string) {
+	r := images.Parse(images.Mirror(source, registry))
+	if r.Digest == "" {
+		return r.String(), nil
+	}
+	if r.Tag != "" {
+		r.Digest = ""
+		return r.String(), nil
+	}
+	return r.String(), []string{"--preserve-digests"}
+}
+
+func readIndex(dir string) (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("not a ceres bundle: %w", err)
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", IndexFile, err)
+	}
+	return &index, nil
+}
+
+func requireTools(tools ...string) error {
+	for _, t := range tools {
+		if _, err := exec.LookPath(t); err != nil {
+			return fmt.Errorf("%s not found in PATH (required for bundles)", t)
+		}
+	}
+	return nil
+}
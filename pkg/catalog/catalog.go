@@ -0,0 +1,509 @@
+// Package catalog is the service catalog: for each CERES component the URLs
+// it is reached at (ingress, NodePort, cluster address), its SSO status, its
+// health and the Secrets holding its credentials, read from the cluster.
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/dns"
+	"github.com/skulesh01/ceres/pkg/secrets"
+	"github.com/skulesh01/ceres/pkg/sso"
+)
+
+// URL kinds, in the order they are preferred
+const (
+	KindIngress      = "ingress"
+	KindLoadBalancer = "loadbalancer"
+	KindNodePort     = "nodeport"
+	KindCluster      = "cluster"
+)
+
+// Health states
+const (
+	Healthy  = "healthy"
+	Degraded = "degraded"
+	Down     = "down"
+	Stopped  = "stopped"  // scaled to zero
+	Missing  = "missing"  // enabled, but no workload found
+	Disabled = "disabled" // not deployed by the config
+)
+
+// Catalog is the service catalog of one cluster
+type Catalog struct {
+	Domain    string    `json:"domain"`
+	Generated time.Time `json:"generated"`
+	// Entry is the address the ingress hosts resolve to, EntrySource where
+	// it comes from (see dns.EntryAddress)
+	Entry       string `json:"entry,omitempty"`
+	EntrySource string `json:"entrySource,omitempty"`
+	// NodeIP is the address NodePort URLs use
+	NodeIP   string    `json:"nodeIP,omitempty"`
+	Services []Service `json:"services"`
+	// Warnings are the checks that could not be made
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Service is one component in the catalog
+type Service struct {
+	Name        string       `json:"name"`
+	Title       string       `json:"title"`
+	Namespace   string       `json:"namespace"`
+	Enabled     bool         `json:"enabled"`
+	URLs        []URL        `json:"urls,omitempty"`
+	SSO         SSO          `json:"sso"`
+	Health      Health       `json:"health"`
+	Credentials []Credential `json:"credentials,omitempty"`
+}
+
+// URL is one way to reach a service
+type URL struct {
+	Kind   string `json:"kind"`
+	URL    string `json:"url"`
+	Object string `json:"object"` // namespace/name of the Ingress or Service
+}
+
+// SSO is how a service logs users in
+type SSO struct {
+	// Mode is "oidc" (Keycloak client), "oauth2-proxy" or "none"
+	Mode   string `json:"mode"`
+	Client string `json:"client,omitempty"`
+	// Status of an OIDC client: "registered" or "not registered" in the
+	// realm, "configured" when Keycloak was not checked, "off" when the
+	// config leaves SSO off for the service. Of oauth2-proxy: "protected"
+	// or "not protected".
+	Status string `json:"status,omitempty"`
+}
+
+// Health is the readiness of the workloads of a service
+type Health struct {
+	Status    string   `json:"status"`
+	Ready     int      `json:"ready"`
+	Desired   int      `json:"desired"`
+	Workloads []string `json:"workloads,omitempty"`
+}
+
+// Credential is where a generated credential of a service is kept
+type Credential struct {
+	Description string `json:"description"`
+	Secret      string `json:"secret"` // namespace/name:key
+	// Command prints the value
+	Command string `json:"command"`
+}
+
+// Options controls Discover
+type Options struct {
+	// Names limits the catalog to these components
+	Names []string
+	// All includes the components the config leaves out
+	All bool
+	// SkipKeycloak does not ask Keycloak which clients exist
+	SkipKeycloak bool
+}
+
+// URL returns the preferred URL of s, if any
+func (s Service) URL() string {
+	if len(s.URLs) == 0 {
+		return ""
+	}
+	return s.URLs[0].URL
+}
+
+// Lookup returns the component called name
+func Lookup(name string) (*Component, error) {
+	var names []string
+	for i := range Components {
+		if Components[i].Name == name {
+			return &Components[i], nil
+		}
+		names = append(names, Components[i].Name)
+	}
+	return nil, fmt.Errorf("unknown service %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// Discover builds the catalog from the cluster under the current config
+func Discover(opts Options) (*Catalog, error) {
+	for _, n := range opts.Names {
+		if _, err := Lookup(n); err != nil {
+			return nil, err
+		}
+	}
+	cfg := config.Current().Config
+
+	var ingresses []ingress
+	if err := kubectlList("ingresses", &ingresses); err != nil {
+		return nil, err
+	}
+	var services []service
+	if err := kubectlList("services", &services); err != nil {
+		return nil, err
+	}
+	var workloads []workload
+	if err := kubectlList("deployments,statefulsets,daemonsets", &workloads); err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{Domain: cfg.Platform.Domain, Generated: time.Now()}
+	c.Entry, c.EntrySource = dns.EntryAddress()
+	c.NodeIP, _ = dns.NodeAddress()
+
+	var clients []string
+	keycloakChecked := false
+	if !opts.SkipKeycloak && cfg.SSO.Enabled {
+		var err error
+		if clients, err = sso.NewManager().Clients(); err != nil {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("keycloak clients not checked: %v", err))
+		} else {
+			keycloakChecked = true
+		}
+	}
+	engine := secrets.DetectEngine()
+
+	for _, comp := range Components {
+		if len(opts.Names) > 0 && !slices.Contains(opts.Names, comp.Name) {
+			continue
+		}
+		enabled := comp.Enabled(&cfg)
+		if !enabled && !opts.All && len(opts.Names) == 0 {
+			continue
+		}
+		home := comp.Home(&cfg)
+		s := Service{Name: comp.Name, Title: comp.Title, Namespace: home, Enabled: enabled}
+
+		var owned []service
+		for _, svc := range services {
+			if comp.Owns(home, svc.Metadata.Namespace, svc.Metadata.Name) {
+				owned = append(owned, svc)
+			}
+		}
+		var routes []ingress
+		for _, ing := range ingresses {
+			if comp.Owns(home, ing.Metadata.Namespace, ing.Metadata.Name) || ing.routesTo(comp, home) {
+				routes = append(routes, ing)
+			}
+		}
+
+		s.URLs = append(s.URLs, ingressURLs(routes)...)
+		s.URLs = append(s.URLs, serviceURLs(owned, c.NodeIP)...)
+		s.SSO = ssoStatus(comp, &cfg, routes, clients, keycloakChecked)
+		s.Health = health(comp, home, workloads, enabled)
+		s.Credentials = credentials(comp, home, engine)
+		c.Services = append(c.Services, s)
+	}
+	return c, nil
+}
+
+func ingressURLs(routes []ingress) []URL {
+	var urls []URL
+	seen := map[string]bool{}
+	for _, ing := range routes {
+		tls := map[string]bool{}
+		for _, t := range ing.Spec.TLS {
+			for _, h := range t.Hosts {
+				tls[h] = true
+			}
+		}
+		for _, r := range ing.Spec.Rules {
+			if r.Host == "" {
+				continue
+			}
+			scheme := "http"
+			if tls[r.Host] {
+				scheme = "https"
+			}
+			path := "/"
+			if r.HTTP != nil && len(r.HTTP.Paths) > 0 && r.HTTP.Paths[0].Path != "" {
+				path = r.HTTP.Paths[0].Path
+			}
+			u := scheme + "://" + r.Host + path
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, URL{Kind: KindIngress, URL: u, Object: ing.Metadata.Namespace + "/" + ing.Metadata.Name})
+			}
+		}
+	}
+	return urls
+}
+
+// serviceURLs lists load balancer and NodePort addresses before the
+// in-cluster ones
+func serviceURLs(owned []service, nodeIP string) []URL {
+	if nodeIP == "" {
+		nodeIP = "<node-ip>"
+	}
+	var external, internal []URL
+	for _, svc := range owned {
+		ref := svc.Metadata.Namespace + "/" + svc.Metadata.Name
+		for _, p := range svc.Spec.Ports {
+			switch {
+			case svc.Spec.Type == "LoadBalancer" && svc.lbAddress() != "":
+				external = append(external, URL{Kind: KindLoadBalancer, URL: fmt.Sprintf("%s://%s:%d", scheme(p.Port), svc.lbAddress(), p.Port), Object: ref})
+			case p.NodePort != 0:
+				external = append(external, URL{Kind: KindNodePort, URL: fmt.Sprintf("%s://%s:%d", scheme(p.Port), nodeIP, p.NodePort), Object: ref})
+			}
+			if svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != "None" && !strings.HasSuffix(svc.Metadata.Name, "-nodeport") {
+				internal = append(internal, URL{Kind: KindCluster, URL: fmt.Sprintf("%s.%s.svc:%d", svc.Metadata.Name, svc.Metadata.Namespace, p.Port), Object: ref})
+			}
+		}
+	}
+	return append(external, internal...)
+}
+
+func scheme(port int) string {
+	if port == 443 || port == 8443 {
+		return "https"
+	}
+	return "http"
+}
+
+// ssoStatus tells how a service logs users in. Proxied services count as
+// protected when one of their ingresses sends requests to oauth2-proxy
+// (nginx auth-url or a Traefik middleware).
+func ssoStatus(comp Component, cfg *config.Config, routes []ingress, clients []string, checked bool) SSO {
+	if comp.Client != "" {
+		s := SSO{Mode: "oidc", Client: comp.Client}
+		switch {
+		case !cfg.SSO.Enabled || !slices.Contains(cfg.SSO.Clients, comp.Name) && !slices.Contains(cfg.SSO.Clients, comp.Client):
+			s.Status = "off"
+		case !checked:
+			s.Status = "configured"
+		case slices.Contains(clients, comp.Client):
+			s.Status = "registered"
+		default:
+			s.Status = "not registered"
+		}
+		return s
+	}
+	for _, ing := range routes {
+		for k, v := range ing.Metadata.Annotations {
+			if (strings.HasSuffix(k, "/auth-url") || strings.HasSuffix(k, "/router.middlewares")) && strings.Contains(v, "oauth2") {
+				return SSO{Mode: "oauth2-proxy", Status: "protected"}
+			}
+		}
+	}
+	if comp.Proxied {
+		return SSO{Mode: "oauth2-proxy", Status: "not protected"}
+	}
+	return SSO{Mode: "none"}
+}
+
+// HealthIn checks the workloads of comp in namespace, its home or a copy of
+// it (a restore into another namespace)
+func HealthIn(comp Component, namespace string) (Health, error) {
+	var workloads []workload
+	if err := kubectlListIn(namespace, "deployments,statefulsets,daemonsets", &workloads); err != nil {
+		return Health{}, err
+	}
+	return health(comp, namespace, workloads, true), nil
+}
+
+func health(comp Component, home string, workloads []workload, enabled bool) Health {
+	var h Health
+	for _, w := range workloads {
+		if !comp.Owns(home, w.Metadata.Namespace, w.Metadata.Name) {
+			continue
+		}
+		h.Workloads = append(h.Workloads, strings.ToLower(w.Kind)+"/"+w.Metadata.Name)
+		h.Desired += w.desired()
+		h.Ready += w.ready()
+	}
+	switch {
+	case len(h.Workloads) == 0 && !enabled:
+		h.Status = Disabled
+	case len(h.Workloads) == 0:
+		h.Status = Missing
+	case h.Desired == 0:
+		h.Status = Stopped
+	case h.Ready >= h.Desired:
+		h.Status = Healthy
+	case h.Ready == 0:
+		h.Status = Down
+	default:
+		h.Status = Degraded
+	}
+	return h
+}
+
+// credentials lists the Secrets of the component's generated credentials
+// for the engine it was deployed with, preferring the copy in its own
+// namespace
+func credentials(comp Component, home, engine string) []Credential {
+	var out []Credential
+	for _, cred := range secrets.Catalog {
+		if cred.Component != comp.Name && cred.Component != comp.Name+"-db" {
+			continue
+		}
+		var ref *secrets.Ref
+		for i, t := range cred.Targets {
+			if t.Engine != engine || t.Embedded {
+				continue
+			}
+			if ref == nil || t.Namespace == home && ref.Namespace != home {
+				ref = &cred.Targets[i].Ref
+			}
+		}
+		if ref == nil {
+			continue
+		}
+		out = append(out, Credential{
+			Description: cred.Description,
+			Secret:      ref.String(),
+			Command:     "ceres secrets get " + cred.Component,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Secret < out[j].Secret })
+	return out
+}
+
+// The cluster objects are read with kubectl, like the rest of the deployer
+
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type backend struct {
+	Service *struct {
+		Name string `json:"name"`
+	} `json:"service"`
+}
+
+type ingress struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		DefaultBackend *backend `json:"defaultBackend"`
+		Rules          []struct {
+			Host string `json:"host"`
+			HTTP *struct {
+				Paths []struct {
+					Path    string  `json:"path"`
+					Backend backend `json:"backend"`
+				} `json:"paths"`
+			} `json:"http"`
+		} `json:"rules"`
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+	} `json:"spec"`
+}
+
+// routesTo reports whether the ingress sends traffic to a Service of comp
+func (ing ingress) routesTo(comp Component, home string) bool {
+	owns := func(b *backend) bool {
+		return b != nil && b.Service != nil && comp.Owns(home, ing.Metadata.Namespace, b.Service.Name)
+	}
+	if owns(ing.Spec.DefaultBackend) {
+		return true
+	}
+	for _, r := range ing.Spec.Rules {
+		if r.HTTP == nil {
+			continue
+		}
+		for _, p := range r.HTTP.Paths {
+			if owns(&p.Backend) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type service struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Type      string `json:"type"`
+		ClusterIP string `json:"clusterIP"`
+		Ports     []struct {
+			Port     int `json:"port"`
+			NodePort int `json:"nodePort"`
+		} `json:"ports"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP       string `json:"ip"`
+				Hostname string `json:"hostname"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+func (s service) lbAddress() string {
+	for _, in := range s.Status.LoadBalancer.Ingress {
+		if in.IP != "" {
+			return in.IP
+		}
+		if in.Hostname != "" {
+			return in.Hostname
+		}
+	}
+	return ""
+}
+
+type workload struct {
+	Kind     string     `json:"kind"`
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		ReadyReplicas          int `json:"readyReplicas"`
+		DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+		NumberReady            int `json:"numberReady"`
+	} `json:"status"`
+}
+
+func (w workload) desired() int {
+	if w.Kind == "DaemonSet" {
+		return w.Status.DesiredNumberScheduled
+	}
+	if w.Spec.Replicas == nil {
+		return 1
+	}
+	return *w.Spec.Replicas
+}
+
+func (w workload) ready() int {
+	if w.Kind == "DaemonSet" {
+		return w.Status.NumberReady
+	}
+	return w.Status.ReadyReplicas
+}
+
+// kubectlList reads the items of a resource in all namespaces
+func kubectlList(resource string, items any) error {
+	return kubectlListIn("", resource, items)
+}
+
+// kubectlListIn reads the items of a resource in namespace, all when empty
+func kubectlListIn(namespace, resource string, items any) error {
+	args := []string{"get", resource, "-o", "json", "--all-namespaces"}
+	if namespace != "" {
+		args[len(args)-1] = "--namespace=" + namespace
+	}
+	out, err := exec.Command("kubectl", args...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("kubectl get %s failed: %s", resource, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return fmt.Errorf("kubectl get %s failed: %w", resource, err)
+	}
+	var list struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return fmt.Errorf("invalid %s list: %w", resource, err)
+	}
+	if len(list.Items) == 0 || string(list.Items) == "null" {
+		return nil
+	}
+	return json.Unmarshal(list.Items, items)
+}
@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// Component is a CERES component as the manifests deploy it
+type Component struct {
+	Name  string // services.<name> in the config file
+	Title string
+	// Namespace of the default install; ceres-core, ceres and monitoring
+	// follow namespaces.core, namespaces.apps and namespaces.monitoring
+	Namespace string
+	// Workload is the name of its Deployment/StatefulSet and Service; objects
+	// named <workload>-* (e.g. grafana-nodeport) belong to it as well
+	Workload string
+	// Client is the Keycloak OIDC client the component logs in with
+	Client string
+	// Proxied components log in through oauth2-proxy in front of the ingress
+	Proxied bool
+}
+
+// Components lists the components in deployment order
+var Components = []Component{
+	{Name: "postgresql", Title: "PostgreSQL", Namespace: "ceres-core", Workload: "postgresql"},
+	{Name: "redis", Title: "Redis", Namespace: "ceres-core", Workload: "redis"},
+	{Name: "keycloak", Title: "Keycloak", Namespace: "ceres", Workload: "keycloak"},
+	{Name: "openldap", Title: "OpenLDAP", Namespace: "identity", Workload: "openldap"},
+	{Name: "oauth2-proxy", Title: "OAuth2 Proxy", Namespace: "oauth2-proxy", Workload: "oauth2-proxy"},
+	{Name: "gitlab", Title: "GitLab", Namespace: "gitlab", Workload: "gitlab", Client: "gitlab"},
+	{Name: "nextcloud", Title: "Nextcloud", Namespace: "nextcloud", Workload: "nextcloud", Client: "nextcloud"},
+	{Name: "mattermost", Title: "Mattermost", Namespace: "mattermost", Workload: "mattermost", Client: "mattermost"},
+	{Name: "wiki", Title: "Wiki.js", Namespace: "wiki", Workload: "wikijs", Client: "wikijs"},
+	{Name: "redmine", Title: "Redmine", Namespace: "redmine", Workload: "redmine", Client: "redmine"},
+	{Name: "mailcow", Title: "Mailcow", Namespace: "mailcow", Workload: "mailcow", Proxied: true},
+	{Name: "minio", Title: "MinIO", Namespace: "minio", Workload: "minio", Proxied: true},
+	{Name: "vault", Title: "Vault", Namespace: "vault", Workload: "vault"},
+	{Name: "jenkins", Title: "Jenkins", Namespace: "jenkins", Workload: "jenkins"},
+	{Name: "sonarqube", Title: "SonarQube", Namespace: "sonarqube", Workload: "sonarqube"},
+	{Name: "harbor", Title: "Harbor", Namespace: "harbor", Workload: "harbor"},
+	{Name: "rabbitmq", Title: "RabbitMQ", Namespace: "rabbitmq", Workload: "rabbitmq"},
+	{Name: "elasticsearch", Title: "Elasticsearch", Namespace: "elasticsearch", Workload: "elasticsearch"},
+	{Name: "kibana", Title: "Kibana", Namespace: "kibana", Workload: "kibana"},
+	{Name: "portainer", Title: "Portainer", Namespace: "portainer", Workload: "portainer", Proxied: true},
+	{Name: "uptime-kuma", Title: "Uptime Kuma", Namespace: "uptime-kuma", Workload: "uptime-kuma"},
+	{Name: "adminer", Title: "Adminer", Namespace: "adminer", Workload: "adminer", Proxied: true},
+	{Name: "prometheus", Title: "Prometheus", Namespace: "monitoring", Workload: "prometheus", Proxied: true},
+	{Name: "grafana", Title: "Grafana", Namespace: "monitoring", Workload: "grafana", Client: "grafana"},
+	{Name: "loki", Title: "Loki", Namespace: "monitoring", Workload: "loki"},
+	{Name: "promtail", Title: "Promtail", Namespace: "logging", Workload: "promtail"},
+	{Name: "alertmanager", Title: "Alertmanager", Namespace: "monitoring", Workload: "alertmanager"},
+	{Name: "jaeger", Title: "Jaeger", Namespace: "monitoring", Workload: "jaeger"},
+	{Name: "ingress-nginx", Title: "Ingress NGINX", Namespace: "ingress-nginx", Workload: "ingress-nginx-controller"},
+	{Name: "cert-manager", Title: "cert-manager", Namespace: "cert-manager", Workload: "cert-manager"},
+}
+
+// Home returns the namespace of c under cfg
+func (c Component) Home(cfg *config.Config) string {
+	switch c.Namespace {
+	case "ceres-core":
+		return cfg.Namespaces.Core
+	case "ceres":
+		return cfg.Namespaces.Apps
+	case "monitoring":
+		return cfg.Namespaces.Monitoring
+	}
+	return c.Namespace
+}
+
+// Enabled reports whether cfg deploys c. Mailcow is not a service entry:
+// it runs in the internal mail mode.
+func (c Component) Enabled(cfg *config.Config) bool {
+	if c.Name == "mailcow" {
+		return cfg.Mail.Mode != "external"
+	}
+	v, err := cfg.Get("services." + c.Name + ".enabled")
+	return err != nil || v == "true"
+}
+
+// Owns reports whether the object namespace/name belongs to c installed
+// in home
+func (c Component) Owns(home, namespace, name string) bool {
+	return namespace == home && (name == c.Workload || strings.HasPrefix(name, c.Workload+"-"))
+}
+
+// SharesNamespace reports whether other components are installed in the
+// namespace of c (ceres-core, ceres, monitoring)
+func (c Component) SharesNamespace() bool {
+	for _, o := range Components {
+		if o.Name != c.Name && o.Namespace == c.Namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the catalog as the access notes kept on the Proxmox
+// host: entry point, URLs, SSO and health per service, and where the
+// credentials are. Passwords are never included.
+func (c *Catalog) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# CERES - Service Access (auto-generated)\n\n")
+	fmt.Fprintf(&b, "Generated: %s\n\n", c.Generated.Format("2006-01-02 15:04:05"))
+
+	b.WriteString("## Entry point\n")
+	fmt.Fprintf(&b, "- Domain: %s\n", c.Domain)
+	if c.Entry != "" {
+		fmt.Fprintf(&b, "- Ingress: %s (%s)\n", c.Entry, c.EntrySource)
+	}
+	if c.NodeIP != "" && c.NodeIP != c.Entry {
+		fmt.Fprintf(&b, "- NodePorts: %s\n", c.NodeIP)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("## Services\n")
+	b.WriteString("| Service | URL | SSO | Health |\n")
+	b.WriteString("|---|---|---|---|\n")
+	for _, s := range c.Services {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", s.Title, markdownURLs(s), s.SSO.String(), s.Health.String())
+	}
+	b.WriteString("\n")
+
+	b.WriteString("## Credentials (where to find)\n")
+	b.WriteString("Don't paste passwords here; read them with the command shown:\n")
+	for _, s := range c.Services {
+		for _, cred := range s.Credentials {
+			fmt.Fprintf(&b, "- %s: %s (`%s`)\n", cred.Description, cred.Secret, cred.Command)
+		}
+	}
+
+	if len(c.Warnings) > 0 {
+		b.WriteString("\n## Not checked\n")
+		for _, w := range c.Warnings {
+			fmt.Fprintf(&b, "- %s\n", w)
+		}
+	}
+	return b.String()
+}
+
+// markdownURLs lists the external URLs, or the cluster address when there
+// is none
+func markdownURLs(s Service) string {
+	var out []string
+	for _, u := range s.URLs {
+		if u.Kind != KindCluster {
+			out = append(out, u.URL)
+		}
+	}
+	if len(out) == 0 && len(s.URLs) > 0 {
+		out = append(out, "`"+s.URLs[0].URL+"`")
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return strings.Join(out, "<br>")
+}
+
+func (s SSO) String() string {
+	switch {
+	case s.Mode == "none":
+		return "-"
+	case s.Status == "":
+		return s.Mode
+	}
+	return s.Mode + " (" + s.Status + ")"
+}
+
+func (h Health) String() string {
+	if h.Desired == 0 && h.Ready == 0 {
+		return h.Status
+	}
+	return fmt.Sprintf("%s %d/%d", h.Status, h.Ready, h.Desired)
+}
@@ -0,0 +1,167 @@
+// Package cloud holds what CERES renders differently per cloud provider:
+// the StorageClass of its volumes, the ingress class and how the ingress
+// controller is exposed. Config settings (cloud.storageClass,
+// cloud.ingress) override the provider defaults.
+package cloud
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// Service types of the ingress controller
+const (
+	NodePort     = "NodePort"
+	LoadBalancer = "LoadBalancer"
+)
+
+// Ingress classes; traefik ships with k3s, nginx is deployed by CERES
+// (deployment/ingress-nginx.yaml), the others are the cloud controllers
+const (
+	Traefik = "traefik"
+	Nginx   = "nginx"
+	ALB     = "alb"
+	GCE     = "gce"
+	AGIC    = "azure-application-gateway"
+)
+
+// StorageClass is a class CERES creates because the cloud has none like it
+type StorageClass struct {
+	Name        string
+	Provisioner string
+	Parameters  map[string]string
+}
+
+// Provider is the rendering of one cloud
+type Provider struct {
+	Name string
+	// StorageClass of the PVCs and claim templates that name none
+	StorageClass string
+	// Create is set when StorageClass does not exist on a new cluster
+	Create *StorageClass
+	// IngressClass replaces the class of every Ingress
+	IngressClass string
+	// IngressAnnotations are added to every Ingress (alb grouping)
+	IngressAnnotations map[string]string
+	// Service is how the nginx controller is exposed. With NodePort the
+	// per-service NodePorts of deployment/nodeport-services.yaml are
+	// deployed too.
+	Service string
+	// ServiceAnnotations are added to the LoadBalancer service of the
+	// nginx controller
+	ServiceAnnotations map[string]string
+}
+
+// defaults are the providers before config overrides
+var defaults = map[string]Provider{
+	"k3s": {
+		StorageClass: "local-path",
+		IngressClass: Traefik,
+		Service:      NodePort,
+	},
+	"proxmox": {
+		StorageClass: "local-path",
+		IngressClass: Traefik,
+		Service:      NodePort,
+	},
+	"aws": {
+		StorageClass: "gp3",
+		Create: &StorageClass{
+			Name:        "gp3",
+			Provisioner: "ebs.csi.aws.com",
+			Parameters:  map[string]string{"type": "gp3", "encrypted": "true"},
+		},
+		IngressClass: Nginx,
+		Service:      LoadBalancer,
+		ServiceAnnotations: map[string]string{
+			"service.beta.kubernetes.io/aws-load-balancer-type":   "nlb",
+			"service.beta.kubernetes.io/aws-load-balancer-scheme": "internet-facing",
+		},
+	},
+	"azure": {
+		StorageClass: "managed-csi",
+		IngressClass: Nginx,
+		Service:      LoadBalancer,
+		ServiceAnnotations: map[string]string{
+			"service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path": "/healthz",
+		},
+	},
+	"gcp": {
+		StorageClass: "standard-rwo",
+		IngressClass: Nginx,
+		Service:      LoadBalancer,
+		ServiceAnnotations: map[string]string{
+			"cloud.google.com/l4-rbs": "enabled",
+		},
+	},
+}
+
+// classAnnotations are the Ingress annotations a cloud ingress class needs
+var classAnnotations = map[string]map[string]string{
+	// one ALB for every CERES ingress
+	ALB: {
+		"alb.ingress.kubernetes.io/scheme":      "internet-facing",
+		"alb.ingress.kubernetes.io/target-type": "ip",
+		"alb.ingress.kubernetes.io/group.name":  "ceres",
+	},
+}
+
+// Names lists the providers with defaults
+func Names() []string {
+	names := make([]string, 0, len(defaults))
+	for n := range defaults {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the provider name with the overrides of cfg applied
+func Get(name string, cfg config.Cloud) (*Provider, error) {
+	d, ok := defaults[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cloud provider %q (%s)", name, strings.Join(Names(), ", "))
+	}
+	p := d
+	p.Name = name
+	if cfg.StorageClass != "" && cfg.StorageClass != p.StorageClass {
+		p.StorageClass = cfg.StorageClass
+		// a class named in the config is expected to exist
+		p.Create = nil
+	}
+	if cfg.Ingress.Class != "" {
+		p.IngressClass = cfg.Ingress.Class
+	}
+	if cfg.Ingress.Service != "" {
+		p.Service = cfg.Ingress.Service
+	}
+	p.IngressAnnotations = merge(classAnnotations[p.IngressClass], nil)
+	p.ServiceAnnotations = merge(p.ServiceAnnotations, cfg.Ingress.Annotations)
+	return &p, nil
+}
+
+// DeploysNginx reports whether CERES deploys the nginx ingress controller
+func (p *Provider) DeploysNginx() bool {
+	return p != nil && p.IngressClass == Nginx
+}
+
+// NodePorts reports whether services are also published on node ports, as
+// they are without a provider
+func (p *Provider) NodePorts() bool {
+	return p == nil || p.Service == NodePort
+}
+
+// merge returns a copy of a with b on top
+func merge(a, b map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
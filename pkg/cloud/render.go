@@ -0,0 +1,197 @@
+package cloud
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nginxService is the service of deployment/ingress-nginx.yaml
+const nginxService = "ingress-nginx-controller"
+
+// Options controls Apply
+type Options struct {
+	// Storage sets the StorageClass of PVCs and StatefulSet
+	// volumeClaimTemplates. Only safe on a fresh install: the class of a
+	// claim cannot change.
+	Storage bool
+}
+
+// Apply renders a multi-document YAML manifest for the provider: the
+// StorageClass of claims and CloudNativePG clusters that name none, the class and annotations of
+// Ingresses and the type and annotations of the nginx controller service
+func (p *Provider) Apply(data []byte, opts Options) ([]byte, error) {
+	if p == nil {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		spec := lookup(root, "spec")
+
+		switch scalar(root, "kind") {
+		case "PersistentVolumeClaim":
+			if opts.Storage {
+				p.setStorageClass(spec)
+			}
+		case "StatefulSet":
+			if vcts := lookup(spec, "volumeClaimTemplates"); opts.Storage && vcts != nil {
+				for _, vct := range vcts.Content {
+					p.setStorageClass(lookup(vct, "spec"))
+				}
+			}
+		case "Cluster":
+			// CloudNativePG (deployment/ha/postgresql.yaml)
+			if storage := lookup(spec, "storage"); opts.Storage && storage != nil && p.StorageClass != "" && scalar(storage, "storageClass") == "" {
+				set(storage, "storageClass", p.StorageClass)
+			}
+		case "Ingress":
+			if spec != nil && p.IngressClass != "" {
+				set(spec, "ingressClassName", p.IngressClass)
+			}
+			if len(p.IngressAnnotations) > 0 {
+				annotate(ensure(root, "metadata"), p.IngressAnnotations)
+			}
+		case "Service":
+			if scalar(lookup(root, "metadata"), "name") != nginxService || spec == nil {
+				break
+			}
+			set(spec, "type", p.Service)
+			if p.Service == LoadBalancer {
+				annotate(ensure(root, "metadata"), p.ServiceAnnotations)
+				// the fixed 30080/30443 are only needed without a load balancer
+				if ports := lookup(spec, "ports"); ports != nil {
+					for _, port := range ports.Content {
+						remove(port, "nodePort")
+					}
+				}
+			}
+		}
+
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// StorageClassManifest returns the StorageClass to create, or nil
+func (p *Provider) StorageClassManifest() []byte {
+	if p == nil || p.Create == nil {
+		return nil
+	}
+	sc := map[string]any{
+		"apiVersion":           "storage.k8s.io/v1",
+		"kind":                 "StorageClass",
+		"metadata":             map[string]any{"name": p.Create.Name, "labels": map[string]string{"app.kubernetes.io/managed-by": "ceres"}},
+		"provisioner":          p.Create.Provisioner,
+		"parameters":           p.Create.Parameters,
+		"allowVolumeExpansion": true,
+		"volumeBindingMode":    "WaitForFirstConsumer",
+	}
+	data, _ := yaml.Marshal(sc)
+	return data
+}
+
+// setStorageClass names the class of a claim spec that has none
+func (p *Provider) setStorageClass(claimSpec *yaml.Node) {
+	if claimSpec == nil || p.StorageClass == "" || scalar(claimSpec, "storageClassName") != "" {
+		return
+	}
+	set(claimSpec, "storageClassName", p.StorageClass)
+}
+
+// annotate adds annotations to metadata, sorted by key
+func annotate(meta *yaml.Node, annotations map[string]string) {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	a := ensure(meta, "annotations")
+	for _, k := range keys {
+		set(a, k, annotations[k])
+	}
+}
+
+// lookup returns the value node of key in a mapping, or nil
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(m *yaml.Node, key string) string {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// ensure returns the mapping under key, creating it if missing
+func ensure(m *yaml.Node, key string) *yaml.Node {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.MappingNode {
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setNode(m, key, v)
+	return v
+}
+
+// set sets a string value
+func set(m *yaml.Node, key, value string) {
+	setNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// remove deletes key from a mapping
+func remove(m *yaml.Node, key string) {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func setNode(m *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = v
+			return
+		}
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+}
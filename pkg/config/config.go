@@ -1,115 +1,589 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/skulesh01/ceres/pkg/sizing"
 	"gopkg.in/yaml.v3"
 )
 
-// Config represents CERES configuration
+// SchemaVersion is the config layout this package reads and writes
+const SchemaVersion = 2
+
+// Environments an overlay can be selected for
+var Environments = []string{"dev", "staging", "prod"}
+
+// Config represents CERES configuration. Struct tags drive strict decoding,
+// validation and the JSON Schema: `doc` is the description and `enum` lists
+// the allowed values.
 type Config struct {
-	Platform Platform `yaml:"platform"`
-	Cloud    Cloud    `yaml:"cloud"`
-	Services Services `yaml:"services"`
+	SchemaVersion int        `yaml:"schemaVersion" doc:"Config schema version, must be 2"`
+	Platform      Platform   `yaml:"platform"`
+	Cloud         Cloud      `yaml:"cloud"`
+	Namespaces    Namespaces `yaml:"namespaces"`
+	Services      Services   `yaml:"services"`
+	Mail          Mail       `yaml:"mail"`
+	VPN           VPN        `yaml:"vpn"`
+	Backup        Backup     `yaml:"backup"`
+	SSO           SSO        `yaml:"sso"`
+	Images        Images     `yaml:"images"`
+	Secrets       Secrets    `yaml:"secrets"`
+	Sizing        Sizing     `yaml:"sizing"`
+	Topology      Topology   `yaml:"topology"`
+	UI            UI         `yaml:"ui,omitempty"`
 }
 
 // Platform configuration
 type Platform struct {
-	Name        string `yaml:"name"`
-	Version     string `yaml:"version"`
-	Domain      string `yaml:"domain"`
-	Environment string `yaml:"environment"`
+	Name        string `yaml:"name" doc:"Platform display name"`
+	Version     string `yaml:"version" doc:"CERES release the config was written for"`
+	Domain      string `yaml:"domain" doc:"Base domain, service hosts default to <service>.<domain>"`
+	Environment string `yaml:"environment" doc:"Environment, selects the config.<environment>.yaml overlay" enum:"dev,staging,prod"`
+	Root        string `yaml:"root,omitempty" doc:"CERES checkout the manifests and scripts are read from, default the working directory, then the directory of the binary"`
+}
+
+// Sizing selects a resource profile (small, medium, large) and per-component
+// overrides keyed by workload name. An empty profile keeps the manifests as written.
+type Sizing struct {
+	Profile    string                 `yaml:"profile" doc:"Sizing profile: small, medium, large or a custom profile name"`
+	Components map[string]sizing.Size `yaml:"components,omitempty" doc:"Per-workload overrides on top of the profile"`
+}
+
+// Topology is how the core services are laid out. ha spreads the replicas
+// over nodes with anti-affinity: give the cluster three nodes or more.
+type Topology struct {
+	Mode       string `yaml:"mode" doc:"single runs one PostgreSQL, Redis and Keycloak; ha runs a CloudNativePG cluster, Redis with Sentinel and services.keycloak.replicas clustered Keycloaks (kubectl engine, fresh installs)" enum:"single,ha"`
+	PostgreSQL int    `yaml:"postgresql,omitempty" doc:"PostgreSQL instances in ha mode, a primary and streaming replicas, default 3"`
+	Redis      int    `yaml:"redis,omitempty" doc:"Redis nodes in ha mode, each with a Sentinel, default 3"`
 }
 
 // Cloud configuration
 type Cloud struct {
-	Provider string `yaml:"provider"` // aws, azure, gcp
-	Region   string `yaml:"region"`
-	Project  string `yaml:"project"`
+	Provider   string     `yaml:"provider" doc:"Where the cluster runs" enum:"proxmox,k3s,aws,azure,gcp"`
+	Region     string     `yaml:"region" doc:"Cloud region, required for aws, azure and gcp"`
+	Project    string     `yaml:"project" doc:"Cloud project or account label"`
+	Proxmox    Proxmox    `yaml:"proxmox,omitempty"`
+	Kubernetes Kubernetes `yaml:"kubernetes,omitempty"`
+
+	StorageClass string  `yaml:"storageClass,omitempty" doc:"StorageClass of the CERES volumes, default local-path (proxmox, k3s), gp3 (aws, created), managed-csi (azure), standard-rwo (gcp)"`
+	Ingress      Ingress `yaml:"ingress,omitempty"`
+}
+
+// Ingress is how CERES is reached from outside the cluster. Empty settings
+// take the defaults of cloud.provider.
+type Ingress struct {
+	Class       string            `yaml:"class,omitempty" doc:"Ingress class, default traefik (proxmox, k3s) or nginx, deployed by CERES; alb, gce and azure-application-gateway need the cloud's controller" enum:"traefik,nginx,alb,gce,azure-application-gateway"`
+	Service     string            `yaml:"service,omitempty" doc:"How the nginx controller is exposed, default NodePort (30080/30443, with per-service NodePorts) on proxmox and k3s, else LoadBalancer" enum:"NodePort,LoadBalancer"`
+	Annotations map[string]string `yaml:"annotations,omitempty" doc:"Annotations of the controller load balancer on top of the provider's, e.g. service.beta.kubernetes.io/aws-load-balancer-internal"`
+}
+
+// Proxmox connection. The API token secret is a credential: store it as
+// proxmox-token with `ceres secrets set`.
+type Proxmox struct {
+	Host     string    `yaml:"host,omitempty" doc:"Proxmox VE host name or address"`
+	Port     int       `yaml:"port,omitempty" doc:"Proxmox API port"`
+	User     string    `yaml:"user,omitempty" doc:"API user, e.g. root@pam"`
+	Node     string    `yaml:"node,omitempty" doc:"Node the CERES VMs run on"`
+	TokenID  string    `yaml:"tokenID,omitempty" doc:"API token ID, user@realm!name; its secret is the proxmox-token credential"`
+	Insecure bool      `yaml:"insecure,omitempty" doc:"Accept a self-signed API certificate"`
+	Notes    []string  `yaml:"notes,omitempty" doc:"Where ceres proxmox notes sync writes: node, qemu/<vmid> or lxc/<vmid>; default the VMs tagged ceres, else the node"`
+	VM       ProxmoxVM `yaml:"vm,omitempty"`
+}
+
+// ProxmoxVM is the k3s node `ceres infra up --cloud proxmox` clones from a
+// cloud-init template. The template needs qemu-guest-agent when the
+// address comes from DHCP.
+type ProxmoxVM struct {
+	Name     string `yaml:"name,omitempty" doc:"VM name and cluster profile name, default ceres"`
+	Template int    `yaml:"template,omitempty" doc:"VMID of the cloud-init template to clone"`
+	VMID     int    `yaml:"vmid,omitempty" doc:"VMID of the new VM, default the next free one"`
+	Storage  string `yaml:"storage,omitempty" doc:"Storage of the cloned disk, default the template's"`
+	Cores    int    `yaml:"cores,omitempty" doc:"CPU cores, default 4"`
+	Memory   int    `yaml:"memory,omitempty" doc:"Memory in MiB, default 8192"`
+	Disk     string `yaml:"disk,omitempty" doc:"Size the boot disk is grown to, e.g. 64G"`
+	IP       string `yaml:"ip,omitempty" doc:"Address in CIDR notation, e.g. 192.168.1.50/24, or dhcp (default)"`
+	Gateway  string `yaml:"gateway,omitempty" doc:"Default gateway, required with a static ip"`
+	User     string `yaml:"user,omitempty" doc:"User cloud-init creates for SSH, default ceres"`
+	SSHKey   string `yaml:"sshKey,omitempty" doc:"Public key file authorized for the user, default ~/.ssh/id_ed25519.pub or id_rsa.pub"`
+	K3s      string `yaml:"k3s,omitempty" doc:"k3s version to install, default the stable channel"`
+}
+
+// Kubernetes cluster CERES is deployed to
+type Kubernetes struct {
+	Type       string `yaml:"type,omitempty" doc:"Cluster distribution" enum:"k3s,k8s,eks,aks,gke"`
+	Endpoint   string `yaml:"endpoint,omitempty" doc:"API server URL"`
+	Kubeconfig string `yaml:"kubeconfig,omitempty" doc:"Path to the kubeconfig, default $KUBECONFIG or ~/.kube/config; ceres infra up points it at the cluster profile"`
+}
+
+// Namespaces CERES components are grouped in
+type Namespaces struct {
+	Core       string `yaml:"core" doc:"Shared infrastructure (PostgreSQL, Redis)"`
+	Apps       string `yaml:"apps" doc:"Platform applications"`
+	Monitoring string `yaml:"monitoring" doc:"Prometheus, Grafana, Loki"`
 }
 
-// Services configuration
+// Services configuration, one entry per CERES component
 type Services struct {
-	PostgreSQL PostgreSQL `yaml:"postgresql"`
-	Redis      Redis      `yaml:"redis"`
-	Keycloak   Service    `yaml:"keycloak"`
-	GitLab     Service    `yaml:"gitlab"`
+	PostgreSQL    PostgreSQL `yaml:"postgresql"`
+	Redis         Service    `yaml:"redis"`
+	Keycloak      AdminUI    `yaml:"keycloak"`
+	OpenLDAP      Service    `yaml:"openldap"`
+	OAuth2Proxy   Service    `yaml:"oauth2-proxy"`
+	GitLab        Service    `yaml:"gitlab"`
+	Nextcloud     AdminUI    `yaml:"nextcloud"`
+	Mattermost    Service    `yaml:"mattermost"`
+	Wiki          Service    `yaml:"wiki"`
+	Redmine       Service    `yaml:"redmine"`
+	MinIO         Service    `yaml:"minio"`
+	Vault         Service    `yaml:"vault"`
+	Jenkins       Service    `yaml:"jenkins"`
+	SonarQube     Service    `yaml:"sonarqube"`
+	Harbor        Service    `yaml:"harbor"`
+	RabbitMQ      Service    `yaml:"rabbitmq"`
+	Elasticsearch Service    `yaml:"elasticsearch"`
+	Kibana        Service    `yaml:"kibana"`
+	Portainer     Service    `yaml:"portainer"`
+	UptimeKuma    Service    `yaml:"uptime-kuma"`
+	Adminer       Service    `yaml:"adminer"`
+	Prometheus    Service    `yaml:"prometheus"`
+	Grafana       AdminUI    `yaml:"grafana"`
+	Loki          Service    `yaml:"loki"`
+	Promtail      Service    `yaml:"promtail"`
+	Alertmanager  Service    `yaml:"alertmanager"`
+	Jaeger        Service    `yaml:"jaeger"`
+	IngressNginx  Service    `yaml:"ingress-nginx"`
+	CertManager   Service    `yaml:"cert-manager"`
+}
+
+// Service generic configuration
+type Service struct {
+	Enabled  bool   `yaml:"enabled" doc:"Deploy this component"`
+	Replicas int    `yaml:"replicas,omitempty" doc:"Replica count, 0 keeps the manifest/sizing value"`
+	Version  string `yaml:"version,omitempty" doc:"Image version (tag) override"`
+	Storage  string `yaml:"storage,omitempty" doc:"Persistent volume size, e.g. 10Gi"`
+	Host     string `yaml:"host,omitempty" doc:"Ingress host, default <service>.<platform.domain>"`
 }
 
 // PostgreSQL configuration
 type PostgreSQL struct {
-	Enabled  bool   `yaml:"enabled"`
-	Version  string `yaml:"version"`
-	Database string `yaml:"database"`
+	Service  `yaml:",inline"`
+	Database string `yaml:"database" doc:"Platform database name"`
 }
 
-// Redis configuration
-type Redis struct {
-	Enabled bool   `yaml:"enabled"`
-	Version string `yaml:"version"`
+// AdminUI is a service with a built-in admin account. Its password is a
+// credential: see `ceres secrets`.
+type AdminUI struct {
+	Service   `yaml:",inline"`
+	AdminUser string `yaml:"adminUser,omitempty" doc:"Admin account name"`
 }
 
-// Service generic configuration
-type Service struct {
-	Enabled bool   `yaml:"enabled"`
-	Replicas int   `yaml:"replicas"`
+// Mail configuration
+type Mail struct {
+	Mode string `yaml:"mode" doc:"internal deploys Mailcow, external relays through smtp" enum:"internal,external"`
+	From string `yaml:"from,omitempty" doc:"Sender address for platform mail"`
+	SMTP SMTP   `yaml:"smtp"`
+}
+
+// SMTP relay used in external mode. The password is the smtp-password secret.
+type SMTP struct {
+	Host     string `yaml:"host,omitempty" doc:"SMTP server"`
+	Port     int    `yaml:"port,omitempty" doc:"SMTP port, 587 for STARTTLS, 465 for TLS"`
+	User     string `yaml:"user,omitempty" doc:"SMTP user"`
+	StartTLS bool   `yaml:"startTLS" doc:"Upgrade the connection with STARTTLS"`
+	TLS      bool   `yaml:"tls,omitempty" doc:"Implicit TLS (e.g. port 465), startTLS is then ignored"`
+}
+
+// VPN configuration
+type VPN struct {
+	Enabled  bool   `yaml:"enabled" doc:"Run the WireGuard server"`
+	Endpoint string `yaml:"endpoint,omitempty" doc:"Public host or address clients connect to"`
+	Port     int    `yaml:"port" doc:"WireGuard UDP port"`
+	Network  string `yaml:"network" doc:"Client address range (CIDR)"`
+}
+
+// Backup configuration
+type Backup struct {
+	Enabled   bool           `yaml:"enabled" doc:"Install Velero and schedule backups"`
+	Schedule  string         `yaml:"schedule" doc:"Cron schedule (5 fields) of the platform backup"`
+	Retention string         `yaml:"retention" doc:"How long backups are kept, e.g. 720h"`
+	Location  BackupLocation `yaml:"location"`
+	Databases DatabaseBackup `yaml:"databases"`
+	// Policies replace the schedule and retention above with tiers
+	Policies []BackupPolicy `yaml:"policies,omitempty" doc:"Velero schedules (ceres backup policy apply), default: one daily policy from backup.schedule and backup.retention"`
+	Hooks    []BackupHook   `yaml:"hooks,omitempty" doc:"Commands run in component pods around every backup"`
+}
+
+// BackupPolicy is a Velero Schedule: when it backs up what, and how long
+// the backups are kept
+type BackupPolicy struct {
+	Name       string   `yaml:"name" doc:"Policy name, e.g. hourly; the Schedule is ceres-<name>"`
+	Schedule   string   `yaml:"schedule" doc:"Cron schedule (5 fields)"`
+	Retention  string   `yaml:"retention" doc:"How long its backups are kept, e.g. 168h"`
+	Components []string `yaml:"components,omitempty" doc:"Components it backs up (ceres services), empty for every namespace"`
+	Location   string   `yaml:"location,omitempty" doc:"Storage location its backups go to (ceres backup location add), default the one of backup.location; a second policy to another location replicates off-site"`
+}
+
+// BackupHook runs commands in the pods of a component before and after
+// each backup that contains them
+type BackupHook struct {
+	Component string   `yaml:"component" doc:"Component whose pods run the commands (ceres services)"`
+	Container string   `yaml:"container,omitempty" doc:"Container, default the first"`
+	Pre       []string `yaml:"pre,omitempty" doc:"Command before the backup, e.g. [psql, -U, postgres, -c, CHECKPOINT]"`
+	Post      []string `yaml:"post,omitempty" doc:"Command after the backup"`
+	OnError   string   `yaml:"onError,omitempty" doc:"Continue or Fail the backup when a command fails, default Fail" enum:"Continue,Fail"`
+	Timeout   string   `yaml:"timeout,omitempty" doc:"How long a command may run, default 30s"`
+}
+
+// DatabaseBackup is the logical backup of the service databases: a pg_dump
+// per database, kept in its own bucket of the backup location
+type DatabaseBackup struct {
+	Enabled   bool   `yaml:"enabled" doc:"Dump the database of every service on a schedule (kubectl engine, minio location)"`
+	Schedule  string `yaml:"schedule" doc:"Cron schedule (5 fields) of the dumps"`
+	Retention string `yaml:"retention" doc:"How long dumps are kept, e.g. 336h"`
+	Bucket    string `yaml:"bucket" doc:"Bucket of the dumps, not the Velero bucket"`
+	Verify    bool   `yaml:"verify" doc:"Restore every dump into a scratch database before it is uploaded"`
+}
+
+// BackupLocation is the object storage backups are written to
+type BackupLocation struct {
+	Provider string `yaml:"provider" doc:"Object storage kind" enum:"minio,s3"`
+	Bucket   string `yaml:"bucket" doc:"Bucket name"`
+	URL      string `yaml:"url,omitempty" doc:"S3 endpoint URL, required for minio"`
+	Region   string `yaml:"region,omitempty" doc:"Bucket region"`
+}
+
+// SSO configuration
+type SSO struct {
+	Enabled bool     `yaml:"enabled" doc:"Configure Keycloak OIDC clients for platform services"`
+	Realm   string   `yaml:"realm" doc:"Keycloak realm"`
+	Clients []string `yaml:"clients,omitempty" doc:"Services that log in through Keycloak"`
+}
+
+// Images configuration. The password of the registry lookups stays in the
+// environment (CERES_REGISTRY_PASSWORD) and is never read from this file.
+type Images struct {
+	Registry string `yaml:"registry,omitempty" doc:"Private registry images are pulled from (air-gapped installs), empty for the upstream registries"`
+	Mirror   string `yaml:"mirror,omitempty" doc:"Registry ceres images queries instead of each image's own (a mirror, or a stand-in for testing)"`
+	User     string `yaml:"user,omitempty" doc:"User of the registry lookups"`
+}
+
+// Secrets selects the backend generated credentials are kept in. Tokens stay
+// in the environment (VAULT_TOKEN) and are never read from this file.
+type Secrets struct {
+	Backend string      `yaml:"backend" doc:"Credentials backend" enum:"kubernetes,vault,sops"`
+	File    string      `yaml:"file,omitempty" doc:"SOPS file, default config/secrets.enc.yaml"`
+	Vault   SecretVault `yaml:"vault,omitempty"`
+}
+
+// UI is the host services of the mail UI (ceres-mail-ui) and the console
+// (ceres-ui). The basic auth password stays in the environment
+// (CERES_UI_BASIC_PASS) and is never read from this file.
+type UI struct {
+	BasicUser string   `yaml:"basicUser,omitempty" doc:"Basic auth user of both UIs"`
+	Mail      UIServer `yaml:"mail,omitempty"`
+	Console   UIServer `yaml:"console,omitempty"`
+	Form      UIForm   `yaml:"form,omitempty"`
+}
+
+// UIServer is where a UI listens and keeps the settings saved in its form
+type UIServer struct {
+	Listen string `yaml:"listen,omitempty" doc:"Listen address"`
+	State  string `yaml:"state,omitempty" doc:"JSON file the form settings are saved to"`
+}
+
+// UIForm prefills the forms of the UIs until settings are saved. Empty
+// values take the platform settings.
+type UIForm struct {
+	Cloud       string `yaml:"cloud,omitempty" doc:"Cloud of the console deploys, default k3s"`
+	Environment string `yaml:"environment,omitempty" doc:"Environment of the console deploys, default platform.environment"`
+	Namespace   string `yaml:"namespace,omitempty" doc:"Namespace of the console deploys, default namespaces.apps"`
+	From        string `yaml:"from,omitempty" doc:"Sender of the access mail, default mail.from"`
+	To          string `yaml:"to,omitempty" doc:"Recipient of the access mail"`
+	Subject     string `yaml:"subject,omitempty" doc:"Subject of the access mail"`
+	Body        string `yaml:"body,omitempty" doc:"Body of the access mail"`
+	VPNEndpoint string `yaml:"vpnEndpoint,omitempty" doc:"WireGuard endpoint of the client configs, default vpn.endpoint"`
+	VPNPort     int    `yaml:"vpnPort,omitempty" doc:"WireGuard port of the client configs, default vpn.port"`
+}
+
+// SecretVault locates the Vault KV v2 secret of the vault backend
+type SecretVault struct {
+	Address   string `yaml:"address,omitempty" doc:"Vault address"`
+	Namespace string `yaml:"namespace,omitempty" doc:"Vault Enterprise namespace"`
+	Mount     string `yaml:"mount,omitempty" doc:"KV v2 mount, default secret"`
+	Path      string `yaml:"path,omitempty" doc:"Secret path under the mount, default ceres"`
 }
 
 // DefaultConfig returns default CERES configuration
 func DefaultConfig() Config {
+	on := Service{Enabled: true}
 	return Config{
+		SchemaVersion: SchemaVersion,
 		Platform: Platform{
 			Name:        "CERES",
 			Version:     "3.0.0",
-			Domain:      "ceres.local",
-			Environment: "production",
+			Domain:      DefaultDomain,
+			Environment: "prod",
 		},
 		Cloud: Cloud{
-			Provider: "aws",
-			Region:   "eu-west-1",
+			Provider: "proxmox",
+			Region:   "local",
+		},
+		Namespaces: Namespaces{
+			Core:       "ceres-core",
+			Apps:       "ceres",
+			Monitoring: "monitoring",
 		},
 		Services: Services{
 			PostgreSQL: PostgreSQL{
-				Enabled:  true,
-				Version:  "16",
+				Service:  Service{Enabled: true, Version: "16"},
 				Database: "ceres",
 			},
-			Redis: Redis{
-				Enabled: true,
-				Version: "7.0",
+			Redis:         Service{Enabled: true, Version: "7.0"},
+			Keycloak:      AdminUI{Service: Service{Enabled: true, Replicas: 3}, AdminUser: "admin"},
+			OpenLDAP:      on,
+			OAuth2Proxy:   on,
+			GitLab:        Service{Enabled: true, Replicas: 1},
+			Nextcloud:     AdminUI{Service: on, AdminUser: "admin"},
+			Mattermost:    on,
+			Wiki:          on,
+			Redmine:       on,
+			MinIO:         on,
+			Vault:         on,
+			Jenkins:       on,
+			SonarQube:     on,
+			Harbor:        on,
+			RabbitMQ:      on,
+			Elasticsearch: on,
+			Kibana:        on,
+			Portainer:     on,
+			UptimeKuma:    on,
+			Adminer:       on,
+			Prometheus:    on,
+			Grafana:       AdminUI{Service: on, AdminUser: "admin"},
+			Loki:          on,
+			Promtail:      on,
+			Alertmanager:  on,
+			Jaeger:        on,
+			IngressNginx:  on,
+			CertManager:   on,
+		},
+		Mail: Mail{
+			Mode: "internal",
+			SMTP: SMTP{Port: 587, StartTLS: true},
+		},
+		VPN: VPN{
+			Enabled: true,
+			Port:    51820,
+			Network: "10.8.0.0/24",
+		},
+		Backup: Backup{
+			Enabled:   true,
+			Schedule:  "0 2 * * *",
+			Retention: "720h",
+			Location: BackupLocation{
+				Provider: "minio",
+				Bucket:   "ceres-backups",
+				URL:      "http://minio.minio.svc.cluster.local:9000",
+				Region:   "minio",
 			},
-			Keycloak: Service{
-				Enabled:  true,
-				Replicas: 3,
+			Databases: DatabaseBackup{
+				Enabled:   true,
+				Schedule:  "30 1 * * *",
+				Retention: "336h",
+				Bucket:    "ceres-db-backups",
+				Verify:    true,
 			},
-			GitLab: Service{
-				Enabled:  true,
-				Replicas: 1,
+			Hooks: []BackupHook{
+				// flush dirty pages so the copied volume needs no WAL replay
+				{Component: "postgresql", Pre: []string{"psql", "-U", "postgres", "-c", "CHECKPOINT"}},
 			},
 		},
+		SSO: SSO{
+			Enabled: true,
+			Realm:   "ceres",
+			Clients: []string{"gitlab", "grafana", "nextcloud", "mattermost", "wiki", "redmine"},
+		},
+		Secrets: Secrets{
+			Backend: "kubernetes",
+		},
+		Topology: Topology{
+			Mode: "single",
+		},
+		UI: UI{
+			Mail:    UIServer{Listen: ":8090", State: "/var/lib/ceres-ui/config.json"},
+			Console: UIServer{Listen: ":8091", State: "/var/lib/ceres-ui/console.json"},
+		},
 	}
 }
 
-// LoadConfig loads configuration from file
+// LoadOptions controls LoadFile
+type LoadOptions struct {
+	// Environment selects the overlay; empty uses platform.environment
+	// from the base file
+	Environment string
+	// AllowMissing returns the defaults when the base file does not exist
+	// instead of an error wrapping os.ErrNotExist
+	AllowMissing bool
+	// BaseOnly skips the overlay, for commands that write the base file back
+	BaseOnly bool
+}
+
+// LoadConfig loads configuration from file and the overlay of its environment
 func LoadConfig(path string) (Config, error) {
+	return LoadFile(path, LoadOptions{})
+}
+
+// LoadFile reads path on top of the defaults, merges the environment overlay
+// (OverlayPath) when one exists and validates the result. Unknown keys and
+// invalid values are reported together as *ValidationError.
+func LoadFile(path string, opts LoadOptions) (Config, error) {
 	config := DefaultConfig()
+	if _, err := decodeFile(path, opts, &config); err != nil {
+		return config, err
+	}
+	return config, validateFile(path, &config)
+}
+
+// ParseFile is LoadFile for new content of path that is not written yet,
+// e.g. an edited copy: data replaces the base file, the overlay is still
+// read from disk.
+func ParseFile(path string, data []byte, opts LoadOptions) (Config, error) {
+	config := DefaultConfig()
+	if opts.Environment != "" {
+		config.Platform.Environment = opts.Environment
+	}
+	if _, err := decodeData(path, data, opts, &config); err != nil {
+		return config, err
+	}
+	return config, validateFile(path, &config)
+}
+
+func validateFile(path string, config *Config) error {
+	err := config.Validate()
+	var v *ValidationError
+	if errors.As(err, &v) {
+		v.File = path
+	}
+	return err
+}
 
+// decodeFile decodes path and its overlay onto config. It returns the file
+// each setting path was read from.
+func decodeFile(path string, opts LoadOptions, config *Config) (map[string]string, error) {
+	if opts.Environment != "" {
+		config.Platform.Environment = opts.Environment
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Return default config if file doesn't exist
-			return config, nil
+		if errors.Is(err, os.ErrNotExist) && opts.AllowMissing {
+			return nil, nil
 		}
-		return config, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return decodeData(path, data, opts, config)
+}
+
+// decodeData is decodeFile for the content of path
+func decodeData(path string, data []byte, opts LoadOptions, config *Config) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	root := documentRoot(&doc)
+	if root == nil {
+		return nil, &ValidationError{File: path, Errors: []FieldError{{Message: "config file is empty"}}}
 	}
+	origins := map[string]string{}
+	leafPaths(root, "", func(p string) { origins[p] = path })
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return config, fmt.Errorf("failed to parse config file: %w", err)
+	if !hasKey(root, "schemaVersion") {
+		return origins, decodeLegacy(path, root, config)
 	}
 
-	return config, nil
+	env := opts.Environment
+	if env == "" {
+		env = scalarAt(root, "platform", "environment")
+	}
+	if env == "" {
+		env = config.Platform.Environment
+	}
+
+	verr := &ValidationError{File: path}
+	verr.Errors = append(verr.Errors, checkKeys(root, typeOfConfig, "")...)
+
+	if !opts.BaseOnly {
+		overlay := OverlayPath(path, env)
+		oroot, errs, err := applyOverlay(root, overlay)
+		if err != nil {
+			return nil, err
+		}
+		verr.Errors = append(verr.Errors, errs...)
+		leafPaths(oroot, "", func(p string) { origins[p] = overlay })
+	}
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	if err := root.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	config.Platform.Environment = env
+	return origins, nil
+}
+
+// applyOverlay checks and merges the overlay file into root and returns the
+// overlay tree; a missing overlay is fine
+func applyOverlay(root *yaml.Node, overlay string) (*yaml.Node, []FieldError, error) {
+	data, err := os.ReadFile(overlay)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read overlay %s: %w", overlay, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse overlay %s: %w", overlay, err)
+	}
+	oroot := documentRoot(&doc)
+	if oroot == nil {
+		return nil, nil, nil
+	}
+	errs := checkKeys(oroot, typeOfConfig, "")
+	for i := range errs {
+		errs[i].File = overlay
+	}
+	mergeNodes(root, oroot)
+	return oroot, errs, nil
+}
+
+// decodeLegacy reads a file without schemaVersion: the pre-v2 layout is a
+// subset of the current one, so it decodes leniently without key checks
+func decodeLegacy(path string, root *yaml.Node, config *Config) error {
+	fmt.Fprintf(os.Stderr, "⚠️  %s has no schemaVersion; reading it as a legacy config (unknown keys are ignored), upgrade it with `ceres config migrate`\n", path)
+	if err := root.Decode(config); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	switch strings.ToLower(config.Platform.Environment) {
+	case "production":
+		config.Platform.Environment = "prod"
+	case "development":
+		config.Platform.Environment = "dev"
+	}
+	config.SchemaVersion = SchemaVersion
+	return nil
+}
+
+// OverlayPath returns the overlay file of env next to path:
+// config.yaml -> config.staging.yaml
+func OverlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
 }
 
 // SaveConfig saves configuration to file
@@ -120,33 +594,18 @@ func (c *Config) SaveConfig(path string) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Marshal config to YAML
-	data, err := yaml.Marshal(c)
-	if err != nil {
+	c.SchemaVersion = SchemaVersion
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
 	// Write to file
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
 	return nil
 }
-
-// Validate validates configuration
-func (c *Config) Validate() error {
-	if c.Platform.Name == "" {
-		return fmt.Errorf("platform name is required")
-	}
-	if c.Platform.Domain == "" {
-		return fmt.Errorf("platform domain is required")
-	}
-	if c.Cloud.Provider == "" {
-		return fmt.Errorf("cloud provider is required")
-	}
-	if c.Cloud.Region == "" {
-		return fmt.Errorf("cloud region is required")
-	}
-	return nil
-}
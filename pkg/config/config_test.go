@@ -0,0 +1,23 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveConfigFalseDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := DefaultConfig()
+	cfg.Platform.Domain = "ceres.example.com"
+	cfg.Mail.SMTP.StartTLS = false
+	if err := cfg.SaveConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Mail.SMTP.StartTLS {
+		t.Error("mail.smtp.startTLS false came back true")
+	}
+}
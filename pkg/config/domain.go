@@ -0,0 +1,47 @@
+package config
+
+import "strings"
+
+// DefaultDomain is the domain the manifests and templates are written for;
+// it is replaced by platform.domain when they are rendered
+const DefaultDomain = "ceres.local"
+
+// ReplaceDomain replaces the domain old and its subdomains in s:
+// "ceres.local", "keycloak.ceres.local" and "https://*.ceres.local/x"
+// change, "myceres.local" and "ceres.local.example.org" do not.
+func ReplaceDomain(s, old, new string) string {
+	if old == "" || old == new || !strings.Contains(s, old) {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(old)
+		if (i == 0 || !isLabelChar(s[i-1])) && !continuesName(s[end:]) {
+			b.WriteString(s[:i])
+			b.WriteString(new)
+		} else {
+			b.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+}
+
+// continuesName reports whether rest continues the domain name before it
+func continuesName(rest string) bool {
+	if rest == "" {
+		return false
+	}
+	if isLabelChar(rest[0]) {
+		return true
+	}
+	return rest[0] == '.' && len(rest) > 1 && isLabelChar(rest[1])
+}
+
+func isLabelChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
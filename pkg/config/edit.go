@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetInFile returns the config file data with the setting at path set to
+// value (parsed as Config.Set does). Like migrations it edits the YAML
+// tree, so comments and key order are kept and only that setting is
+// rewritten. Empty data starts a new file. The result is not validated,
+// see ParseFile.
+func SetInFile(data []byte, path, value string) ([]byte, error) {
+	segs := splitPath(path)
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("no setting given")
+	}
+
+	var doc yaml.Node
+	if strings.TrimSpace(string(data)) != "" {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	root := documentRoot(&doc)
+	switch {
+	case root == nil && doc.Kind == 0:
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+		setScalar(root, "schemaVersion", strconv.Itoa(SchemaVersion), "!!int")
+	case root == nil:
+		return nil, fmt.Errorf("config file is not a mapping")
+	case !hasKey(root, "schemaVersion"):
+		return nil, fmt.Errorf("config file has no schemaVersion; upgrade it with `ceres config migrate` first")
+	}
+
+	// parse and type-check the value on a typed config, then write that
+	// value back as YAML
+	cfg := DefaultConfig()
+	if err := cfg.Set(path, value); err != nil {
+		return nil, err
+	}
+	v, err := lookup(reflect.ValueOf(&cfg).Elem(), segs, path)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := node.Encode(v.Interface()); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	setNode(root, segs, &node)
+
+	if strings.TrimSpace(string(data)) == "" {
+		return encodeNode(&doc)
+	}
+	out, err := renderNode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return keepBlankLines(data, out), nil
+}
+
+// WriteFile replaces path atomically, keeping its mode: the config file
+// after SetInFile, or the files ceres domain change rewrites
+func WriteFile(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// keepBlankLines puts the blank lines of original back into out (which has
+// none): before every line that is unchanged from original, where original
+// had one, and before new lines that start a section as in encodeNode.
+func keepBlankLines(original, out []byte) []byte {
+	var x []string
+	blankBefore := map[int]bool{}
+	for _, line := range splitLines(string(original)) {
+		if strings.TrimSpace(line) == "" {
+			blankBefore[len(x)] = len(x) > 0
+			continue
+		}
+		x = append(x, line)
+	}
+
+	var lines []string
+	for _, op := range diffLines(x, splitLines(string(out))) {
+		blank := false
+		switch op.kind {
+		case '-':
+			continue
+		case ' ':
+			blank = blankBefore[op.i]
+		case '+':
+			blank = len(lines) > 0 && startsSection(op.text, lines[len(lines)-1])
+		}
+		if blank && len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, op.text)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// setNode puts value at the key path below the mapping n, creating
+// mappings on the way. A replaced value keeps its comments.
+func setNode(n *yaml.Node, segs []string, value *yaml.Node) {
+	for _, seg := range segs[:len(segs)-1] {
+		child := mappingValue(n, seg)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg}, child)
+		} else if child.Kind != yaml.MappingNode {
+			*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: child.HeadComment, LineComment: child.LineComment}
+		}
+		n = child
+	}
+
+	key := segs[len(segs)-1]
+	if existing := mappingValue(n, key); existing != nil {
+		value.HeadComment, value.LineComment, value.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = *value
+		return
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editConfig = `schemaVersion: 2
+
+# the public domain
+platform:
+  domain: ${CERES_DOMAIN} # from the instance env
+  environment: dev
+
+sizing:
+  profile: small
+`
+
+func TestSetInFile(t *testing.T) {
+	out, err := SetInFile([]byte(editConfig), "platform.environment", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(editConfig, "environment: dev", "environment: prod", 1)
+	if string(out) != want {
+		t.Errorf("SetInFile =\n%s\nwant\n%s", out, want)
+	}
+
+	// the placeholder is left to the resolver, which expands it from the env
+	t.Setenv("CERES_DOMAIN", "ceres.example.com")
+	dir := t.TempDir()
+	if _, err := Resolve(ResolveOptions{ConfigPath: filepath.Join(dir, "config.yaml"), ConfigData: out, InstanceEnvPath: filepath.Join(dir, "instance.env")}); err != nil {
+		t.Errorf("edited config does not resolve: %v", err)
+	}
+
+	if _, err := SetInFile([]byte(editConfig), "ui.form.vpnPort", "vpn"); err == nil {
+		t.Error("invalid value written")
+	}
+	if _, err := SetInFile([]byte(editConfig), "platform.nope", "x"); err == nil {
+		t.Error("unknown setting written")
+	}
+	if _, err := SetInFile([]byte("platform:\n  domain: a.example.com\n"), "platform.environment", "prod"); err == nil {
+		t.Error("legacy config edited without migration")
+	}
+}
+
+func TestSetInFileNew(t *testing.T) {
+	out, err := SetInFile(nil, "platform.domain", "ceres.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseFile("config.yaml", out, LoadOptions{BaseOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SchemaVersion != SchemaVersion || cfg.Platform.Domain != "ceres.example.com" {
+		t.Errorf("new file:\n%s", out)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var schemaVersionKey = regexp.MustCompile(`(?m)^schemaVersion:`)
+
+// TestShippedConfigs resolves the config files of config/ and examples/ the
+// way an install uses them: with CERES_DOMAIN from the instance env
+func TestShippedConfigs(t *testing.T) {
+	t.Setenv("CERES_DOMAIN", "example.com")
+	var files []string
+	for _, dir := range []string{"../../config", "../../examples"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	resolved := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// sso-configs.yaml and the like are Kubernetes manifests
+		if !schemaVersionKey.Match(data) {
+			continue
+		}
+		resolved++
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			if _, err := Resolve(ResolveOptions{ConfigPath: file, InstanceEnvPath: filepath.Join(t.TempDir(), "ceres.env")}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if resolved == 0 {
+		t.Fatal("no config files found")
+	}
+}
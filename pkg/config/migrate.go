@@ -0,0 +1,278 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migrations work on the YAML tree rather than on Config so comments and
+// key order survive. Files without schemaVersion are version 1: the
+// platform/cloud/services layout of examples/ceres-config.yaml, including
+// the extended variant of config/proxmox.yaml (storage, admin_user,
+// domain, cloud.proxmox, namespaces).
+
+// migration upgrades a tree from one schema version to the next
+type migration struct {
+	from  int
+	apply func(root *yaml.Node, m *Migration)
+}
+
+var migrations = []migration{
+	{from: 1, apply: migrateV1},
+}
+
+// MigrateOptions controls Migrate
+type MigrateOptions struct {
+	// DropUnknown removes keys the current schema does not know instead of
+	// reporting them in Migration.Unknown
+	DropUnknown bool
+}
+
+// Migration is the result of upgrading a config file
+type Migration struct {
+	From, To int
+	Original []byte
+	Migrated []byte
+	// Notes are changes that need a follow-up, e.g. removed passwords
+	Notes []string
+	// Unknown are keys left over that the current schema rejects
+	Unknown []FieldError
+	// Problems is the validation error of the migrated config, if any
+	Problems error
+}
+
+// Changed reports whether the migration rewrote the file
+func (m *Migration) Changed() bool {
+	return !bytes.Equal(m.Original, m.Migrated)
+}
+
+func (m *Migration) note(format string, args ...interface{}) {
+	m.Notes = append(m.Notes, fmt.Sprintf(format, args...))
+}
+
+// DetectVersion returns the schema version of a config file
+func DetectVersion(data []byte) (int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return detectVersion(documentRoot(&doc))
+}
+
+func detectVersion(root *yaml.Node) (int, error) {
+	if root == nil {
+		return 0, fmt.Errorf("config file is empty")
+	}
+	v := mappingValue(root, "schemaVersion")
+	if v == nil {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v.Value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("schemaVersion %q is not a version number", v.Value)
+	}
+	return n, nil
+}
+
+// Migrate upgrades a config file to SchemaVersion
+func Migrate(data []byte, opts MigrateOptions) (*Migration, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	root := documentRoot(&doc)
+	from, err := detectVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	if from > SchemaVersion {
+		return nil, fmt.Errorf("schemaVersion %d is newer than this ceres (%d); upgrade ceres", from, SchemaVersion)
+	}
+
+	m := &Migration{From: from, To: SchemaVersion, Original: data, Migrated: data}
+	if from == SchemaVersion {
+		return m, nil
+	}
+	for _, step := range migrations {
+		if step.from >= from {
+			step.apply(root, m)
+		}
+	}
+	setScalar(root, "schemaVersion", strconv.Itoa(SchemaVersion), "!!int")
+
+	if opts.DropUnknown {
+		for _, p := range pruneKeys(root, typeOfConfig, "") {
+			m.note("%s removed: not part of schema %d", p, SchemaVersion)
+		}
+	} else {
+		m.Unknown = checkKeys(root, typeOfConfig, "")
+	}
+
+	out, err := encodeNode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	m.Migrated = out
+
+	if len(m.Unknown) == 0 {
+		cfg := DefaultConfig()
+		if err := root.Decode(&cfg); err != nil {
+			m.Problems = err
+		} else {
+			m.Problems = cfg.Validate()
+		}
+	}
+	return m, nil
+}
+
+// migrateV1 renames the snake_case and domain keys of the extended v1
+// layout, normalises the environment name and drops inline passwords
+func migrateV1(root *yaml.Node, m *Migration) {
+	if env := mappingValue(mappingValue(root, "platform"), "environment"); env != nil {
+		switch strings.ToLower(env.Value) {
+		case "production":
+			env.Value = "prod"
+		case "development":
+			env.Value = "dev"
+		}
+	}
+
+	if proxmox := mappingValue(mappingValue(root, "cloud"), "proxmox"); proxmox != nil {
+		if deleteKey(proxmox, "password") {
+			m.note("cloud.proxmox.password removed: ceres uses an API token, set cloud.proxmox.tokenID and store its secret with `ceres secrets set proxmox-token`")
+		}
+	}
+
+	services := mappingValue(root, "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name, svc := services.Content[i].Value, services.Content[i+1]
+		if svc.Kind != yaml.MappingNode {
+			continue
+		}
+		renameKey(svc, "admin_user", "adminUser")
+		renameKey(svc, "domain", "host")
+		for _, k := range []string{"password", "admin_password", "adminPassword"} {
+			if deleteKey(svc, k) {
+				m.note("services.%s.%s removed: credentials are generated on install, change them with `ceres secrets rotate %s`", name, k, name)
+			}
+		}
+	}
+}
+
+// pruneKeys removes the keys checkKeys would reject and returns their paths
+func pruneKeys(n *yaml.Node, t reflect.Type, path string) []string {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	var removed []string
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := structFields(t)
+		kept := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			p := joinPath(path, key.Value)
+			ft, ok := fields[key.Value]
+			if !ok {
+				removed = append(removed, p)
+				continue
+			}
+			removed = append(removed, pruneKeys(value, ft, p)...)
+			kept = append(kept, key, value)
+		}
+		n.Content = kept
+	case reflect.Map:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			removed = append(removed, pruneKeys(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value))...)
+		}
+	}
+	return removed
+}
+
+// setScalar sets key in a mapping, adding it first when missing
+func setScalar(n *yaml.Node, key, value, tag string) {
+	if v := mappingValue(n, key); v != nil {
+		v.Kind, v.Tag, v.Value, v.Style = yaml.ScalarNode, tag, value, 0
+		return
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	n.Content = append([]*yaml.Node{k, v}, n.Content...)
+}
+
+func renameKey(n *yaml.Node, from, to string) {
+	if hasKey(n, to) {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == from {
+			n.Content[i].Value = to
+		}
+	}
+}
+
+func deleteKey(n *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// encodeNode writes the tree back with two-space indentation. yaml.v3 drops
+// blank lines, so one is put back between top-level sections and before
+// a comment that closes a nested block (a new group of keys).
+func encodeNode(doc *yaml.Node) ([]byte, error) {
+	data, err := renderNode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	out := make([]string, 0, len(lines)+16)
+	for i, line := range lines {
+		if i > 0 && startsSection(line, lines[i-1]) {
+			out = append(out, "")
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// renderNode writes the tree with two-space indentation, without blank lines
+func renderNode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func startsSection(line, prev string) bool {
+	topLevel := line != "" && line[0] != ' ' && line[0] != '-'
+	if topLevel {
+		return strings.HasPrefix(prev, " ")
+	}
+	return strings.HasPrefix(strings.TrimSpace(line), "#") &&
+		!strings.HasPrefix(strings.TrimSpace(prev), "#") &&
+		indent(line) < indent(prev)
+}
+
+func indent(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " "))
+}
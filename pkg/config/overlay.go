@@ -0,0 +1,82 @@
+package config
+
+import "gopkg.in/yaml.v3"
+
+// Overlays are merged on the YAML tree before decoding, so an overlay only
+// needs the keys it changes: mappings merge key by key, anything else
+// (scalars, lists) replaces the base value.
+
+// mergeNodes merges the mapping overlay into base
+func mergeNodes(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		existing := mappingValue(base, key.Value)
+		switch {
+		case existing == nil:
+			base.Content = append(base.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeNodes(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
+
+// documentRoot returns the top-level mapping of a parsed file, nil when empty
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	n := doc
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil
+		}
+		n = n.Content[0]
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	return n
+}
+
+// mappingValue returns the value of key in a mapping node
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func hasKey(n *yaml.Node, key string) bool {
+	return mappingValue(n, key) != nil
+}
+
+// scalarAt returns the scalar at a key path, "" when absent
+func scalarAt(n *yaml.Node, keys ...string) string {
+	for _, k := range keys {
+		n = mappingValue(n, k)
+	}
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+// leafPaths calls fn with the dotted path of every scalar or list in a tree
+func leafPaths(n *yaml.Node, path string, fn func(string)) {
+	if n == nil {
+		return
+	}
+	if n.Kind != yaml.MappingNode {
+		if path != "" {
+			fn(path)
+		}
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		leafPaths(n.Content[i+1], joinPath(path, n.Content[i].Value), fn)
+	}
+}
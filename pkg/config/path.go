@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are addressed by their dotted YAML path, e.g.
+// services.keycloak.replicas or sizing.components.gitlab.memory. Scalars
+// are plain strings, lists are comma separated and mappings are YAML.
+
+// Paths returns the path of every setting (scalar, list or map) in
+// declaration order
+func Paths() []string {
+	var out []string
+	var walk func(t reflect.Type, path string)
+	walk = func(t reflect.Type, path string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if isInline(f) {
+				walk(f.Type, path)
+				continue
+			}
+			p := joinPath(path, yamlName(f))
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, p)
+				continue
+			}
+			out = append(out, p)
+		}
+	}
+	walk(typeOfConfig, "")
+	return out
+}
+
+// Get returns the value at path
+func (c *Config) Get(path string) (string, error) {
+	v, err := lookup(reflect.ValueOf(c).Elem(), splitPath(path), path)
+	if err != nil {
+		return "", err
+	}
+	return formatValue(v)
+}
+
+// Set parses value into the setting at path. Map entries are created as
+// needed (sizing.components.<name>.cpu).
+func (c *Config) Set(path, value string) error {
+	return assign(reflect.ValueOf(c).Elem(), splitPath(path), path, value)
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(strings.TrimSpace(path), ".")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// fieldByKey returns the struct field with YAML key, looking into inlined structs
+func fieldByKey(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isInline(f) {
+			if fv, ok := fieldByKey(v.Field(i), key); ok {
+				return fv, true
+			}
+			continue
+		}
+		if yamlName(f) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func lookup(v reflect.Value, segs []string, path string) (reflect.Value, error) {
+	for i, seg := range segs {
+		switch v.Kind() {
+		case reflect.Struct:
+			f, ok := fieldByKey(v, seg)
+			if !ok {
+				return v, unknownPath(segs[:i+1], v)
+			}
+			v = f
+		case reflect.Map:
+			e := v.MapIndex(reflect.ValueOf(seg))
+			if !e.IsValid() {
+				return v, fmt.Errorf("%s: not set", strings.Join(segs[:i+1], "."))
+			}
+			v = e
+		default:
+			return v, fmt.Errorf("%s: cannot address into a %s setting", path, v.Kind())
+		}
+	}
+	return v, nil
+}
+
+func assign(v reflect.Value, segs []string, path, value string) error {
+	if len(segs) == 0 {
+		if err := parseValue(v, value); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+	seg := segs[0]
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := fieldByKey(v, seg)
+		if !ok {
+			done := len(splitPath(path)) - len(segs) + 1
+			return unknownPath(splitPath(path)[:done], v)
+		}
+		return assign(f, segs[1:], path, value)
+	case reflect.Map:
+		// map elements are not addressable: update a copy and store it back
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		e := reflect.New(v.Type().Elem()).Elem()
+		if cur := v.MapIndex(reflect.ValueOf(seg)); cur.IsValid() {
+			e.Set(cur)
+		}
+		if err := assign(e, segs[1:], path, value); err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(seg), e)
+		return nil
+	default:
+		return fmt.Errorf("%s: cannot address into a %s setting", path, v.Kind())
+	}
+}
+
+func unknownPath(segs []string, parent reflect.Value) error {
+	var keys []string
+	for k := range structFields(parent.Type()) {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("%s: unknown setting (known here: %s)", strings.Join(segs, "."), strings.Join(keys, ", "))
+}
+
+func formatValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return strings.Join(v.Interface().([]string), ","), nil
+		}
+	}
+	out, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func parseValue(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		// mappings are given as YAML and must only use known keys
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+			return fmt.Errorf("invalid YAML: %w", err)
+		}
+		if root := documentRoot(&node); root != nil {
+			if errs := checkKeys(root, v.Type(), ""); len(errs) > 0 {
+				return &ValidationError{Errors: errs}
+			}
+		}
+		fresh := reflect.New(v.Type())
+		if err := node.Decode(fresh.Interface()); err != nil {
+			return err
+		}
+		v.Set(fresh.Elem())
+	}
+	return nil
+}
+
+// parseBool accepts the spellings used in env files (1/0, yes/no, on/off)
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "y", "on":
+		return true, nil
+	case "0", "false", "no", "n", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean", s)
+}
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Settings are resolved in layers, each overriding the previous one:
+//
+//	defaults < instance env (/etc/ceres/ceres.env) < config file (+ overlay)
+//	         < environment variables < command-line flags
+//
+// The instance env file and the environment use the same variable names
+// (Bindings).
+
+// Sources of a setting, lowest precedence first
+const (
+	SourceDefault     = "default"
+	SourceInstanceEnv = "instance env"
+	SourceFile        = "config file"
+	SourceEnv         = "env"
+	SourceFlag        = "flag"
+)
+
+// DefaultInstanceEnvPath is the instance-wide env file written by the installer
+const DefaultInstanceEnvPath = "/etc/ceres/ceres.env"
+
+// DefaultPath returns the CLI config file: $CERES_CONFIG or ~/.ceres/config.yaml
+func DefaultPath() string {
+	if p := strings.TrimSpace(os.Getenv("CERES_CONFIG")); p != "" {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ceres", "config.yaml")
+}
+
+// Binding maps an environment variable onto a setting. Convert, when set,
+// turns the variable into the setting value; ok=false leaves it alone.
+type Binding struct {
+	Env     string
+	Path    string
+	Convert func(v string) (value string, ok bool)
+}
+
+// Bindings are the variables read from the instance env file and the
+// environment. Later bindings of the same path win.
+var Bindings = []Binding{
+	{Env: "CERES_DOMAIN", Path: "platform.domain"},
+	{Env: "CERES_ENVIRONMENT", Path: "platform.environment"},
+	{Env: "CERES_REPO_ROOT", Path: "platform.root"},
+	{Env: "CERES_ROOT", Path: "platform.root"},
+	{Env: "CERES_MAIL_MODE", Path: "mail.mode", Convert: func(v string) (string, bool) {
+		if strings.EqualFold(v, "external") {
+			return "external", true
+		}
+		return "internal", true
+	}},
+	{Env: "CERES_SKIP_MAILCOW", Path: "mail.mode", Convert: func(v string) (string, bool) {
+		skip, err := parseBool(v)
+		return "external", err == nil && skip
+	}},
+	{Env: "CERES_MAIL_FROM", Path: "mail.from"},
+	{Env: "CERES_SMTP_HOST", Path: "mail.smtp.host"},
+	{Env: "CERES_SMTP_PORT", Path: "mail.smtp.port"},
+	{Env: "CERES_SMTP_USER", Path: "mail.smtp.user"},
+	{Env: "CERES_SMTP_STARTTLS", Path: "mail.smtp.startTLS"},
+	{Env: "CERES_SMTP_TLS", Path: "mail.smtp.tls"},
+	{Env: "CERES_PROXMOX_HOST", Path: "cloud.proxmox.host"},
+	{Env: "CERES_PROXMOX_NODE", Path: "cloud.proxmox.node"},
+	{Env: "CERES_PROXMOX_TOKEN_ID", Path: "cloud.proxmox.tokenID"},
+	{Env: "CERES_VPN_ENDPOINT", Path: "vpn.endpoint"},
+	{Env: "CERES_KEYCLOAK_ADMIN", Path: "services.keycloak.adminUser"},
+	{Env: "CERES_IMAGE_REGISTRY", Path: "images.registry"},
+	{Env: "CERES_REGISTRY_URL", Path: "images.mirror"},
+	{Env: "CERES_REGISTRY_USER", Path: "images.user"},
+	{Env: "CERES_SECRETS_BACKEND", Path: "secrets.backend"},
+	{Env: "CERES_SECRETS_FILE", Path: "secrets.file"},
+	{Env: "VAULT_ADDR", Path: "secrets.vault.address"},
+	{Env: "VAULT_NAMESPACE", Path: "secrets.vault.namespace"},
+	{Env: "CERES_VAULT_MOUNT", Path: "secrets.vault.mount"},
+	{Env: "CERES_VAULT_PATH", Path: "secrets.vault.path"},
+	{Env: "CERES_UI_BASIC_USER", Path: "ui.basicUser"},
+	{Env: "CERES_UI_LISTEN", Path: "ui.mail.listen"},
+	{Env: "CERES_UI_CONFIG", Path: "ui.mail.state"},
+	{Env: "CERES_CONSOLE_LISTEN", Path: "ui.console.listen"},
+	{Env: "CERES_CONSOLE_CONFIG", Path: "ui.console.state"},
+	{Env: "CERES_UI_CLOUD", Path: "ui.form.cloud"},
+	{Env: "CERES_UI_ENV", Path: "ui.form.environment"},
+	{Env: "CERES_UI_NAMESPACE", Path: "ui.form.namespace"},
+	{Env: "CERES_UI_FROM", Path: "ui.form.from"},
+	{Env: "CERES_UI_TO", Path: "ui.form.to"},
+	{Env: "CERES_UI_SUBJECT", Path: "ui.form.subject"},
+	{Env: "CERES_UI_BODY", Path: "ui.form.body"},
+	{Env: "CERES_UI_VPN_ENDPOINT", Path: "ui.form.vpnEndpoint"},
+	{Env: "CERES_UI_VPN_PORT", Path: "ui.form.vpnPort"},
+}
+
+// ResolveOptions selects the files and flags of a resolution
+type ResolveOptions struct {
+	// ConfigPath is the config file, default DefaultPath(). A missing file
+	// is an error unless ConfigOptional is set.
+	ConfigPath     string
+	ConfigOptional bool
+	// ConfigData replaces the content of ConfigPath, e.g. an edited copy
+	// that is not written yet; the overlay is still read from disk
+	ConfigData []byte
+	// SkipConfig resolves without the config file
+	SkipConfig bool
+	// InstanceEnvPath defaults to DefaultInstanceEnvPath; it may be missing
+	InstanceEnvPath string
+	// Environment selects the overlay, see LoadOptions
+	Environment string
+	// Flags are the settings given on the command line, by path
+	Flags map[string]string
+	// FlagNames name the flag of a path in explanations, e.g. "--profile"
+	FlagNames map[string]string
+}
+
+// Origin is one layer that set a setting
+type Origin struct {
+	Source string // SourceDefault, SourceInstanceEnv, ...
+	Name   string // file, variable or flag
+	Value  string
+}
+
+// Resolved is the effective configuration and where each setting came from
+type Resolved struct {
+	Config     Config
+	ConfigPath string
+	origins    map[string][]Origin
+}
+
+// Resolve builds the effective configuration. When only validation fails,
+// the resolved configuration is returned with the *ValidationError.
+func Resolve(opts ResolveOptions) (*Resolved, error) {
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = DefaultPath()
+	}
+	if opts.InstanceEnvPath == "" {
+		opts.InstanceEnvPath = DefaultInstanceEnvPath
+	}
+	r := defaults(opts.ConfigPath)
+	verr := &ValidationError{File: opts.ConfigPath}
+
+	vars, err := LoadInstanceEnv(opts.InstanceEnvPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	verr.Errors = append(verr.Errors, r.applyVars(vars, SourceInstanceEnv, opts.InstanceEnvPath+": ")...)
+
+	if !opts.SkipConfig {
+		lopts := LoadOptions{Environment: opts.Environment, AllowMissing: opts.ConfigOptional}
+		var origins map[string]string
+		if opts.ConfigData != nil {
+			if opts.Environment != "" {
+				r.Config.Platform.Environment = opts.Environment
+			}
+			origins, err = decodeData(opts.ConfigPath, opts.ConfigData, lopts, &r.Config)
+		} else {
+			origins, err = decodeFile(opts.ConfigPath, lopts, &r.Config)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range Paths() {
+			if file, ok := fileOrigin(origins, p); ok {
+				r.record(p, SourceFile, file)
+			}
+		}
+	} else if opts.Environment != "" {
+		r.Config.Platform.Environment = opts.Environment
+	}
+
+	env := map[string]string{}
+	for _, b := range Bindings {
+		if v, ok := os.LookupEnv(b.Env); ok {
+			env[b.Env] = v
+		}
+	}
+	verr.Errors = append(verr.Errors, r.applyVars(env, SourceEnv, "")...)
+
+	flags := make([]string, 0, len(opts.Flags))
+	for p := range opts.Flags {
+		flags = append(flags, p)
+	}
+	sort.Strings(flags)
+	for _, p := range flags {
+		name := opts.FlagNames[p]
+		if name == "" {
+			name = p
+		}
+		if err := r.Config.Set(p, opts.Flags[p]); err != nil {
+			verr.Errors = append(verr.Errors, FieldError{Path: p, Message: fmt.Sprintf("from %s: %s", name, setError(p, err))})
+			continue
+		}
+		r.record(p, SourceFlag, name)
+	}
+
+	if len(verr.Errors) == 0 {
+		if err := r.Config.Validate(); err != nil {
+			var v *ValidationError
+			if errors.As(err, &v) {
+				verr.Errors = v.Errors
+			} else {
+				return r, err
+			}
+		}
+	}
+	if len(verr.Errors) > 0 {
+		return r, verr
+	}
+	return r, nil
+}
+
+// defaults returns the default layer
+func defaults(configPath string) *Resolved {
+	r := &Resolved{Config: DefaultConfig(), ConfigPath: configPath, origins: map[string][]Origin{}}
+	for _, p := range Paths() {
+		r.record(p, SourceDefault, "")
+	}
+	return r
+}
+
+// applyVars applies the bound variables of vars
+func (r *Resolved) applyVars(vars map[string]string, source, prefix string) []FieldError {
+	var errs []FieldError
+	for _, b := range Bindings {
+		v, ok := vars[b.Env]
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		value := strings.TrimSpace(v)
+		if b.Convert != nil {
+			if value, ok = b.Convert(value); !ok {
+				continue
+			}
+		}
+		if err := r.Config.Set(b.Path, value); err != nil {
+			errs = append(errs, FieldError{Path: b.Path, Message: fmt.Sprintf("from %s%s: %s", prefix, b.Env, setError(b.Path, err))})
+			continue
+		}
+		r.record(b.Path, source, prefix+b.Env)
+	}
+	return errs
+}
+
+// setError returns the message of a Set error without the path FieldError
+// already shows
+func setError(path string, err error) string {
+	return strings.TrimPrefix(err.Error(), path+": ")
+}
+
+// fileOrigin finds the file that set p or, for maps, one of its entries
+func fileOrigin(origins map[string]string, p string) (string, bool) {
+	if file, ok := origins[p]; ok {
+		return file, true
+	}
+	for leaf, file := range origins {
+		if strings.HasPrefix(leaf, p+".") {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func (r *Resolved) record(path, source, name string) {
+	value, _ := r.Config.Get(path)
+	r.origins[path] = append(r.origins[path], Origin{Source: source, Name: name, Value: value})
+}
+
+// Explain returns every layer that set path, lowest precedence first; the
+// last one is the effective value
+func (r *Resolved) Explain(path string) ([]Origin, error) {
+	path = strings.Trim(strings.TrimSpace(path), ".")
+	if o, ok := r.origins[path]; ok {
+		return o, nil
+	}
+	// an entry below a map setting (sizing.components.gitlab.cpu) can only
+	// come from the config file
+	value, err := r.Config.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	return []Origin{{Source: SourceFile, Name: r.ConfigPath, Value: value}}, nil
+}
+
+// Source returns the origin of the effective value of path
+func (r *Resolved) Source(path string) Origin {
+	o, err := r.Explain(path)
+	if err != nil || len(o) == 0 {
+		return Origin{Source: SourceDefault}
+	}
+	return o[len(o)-1]
+}
+
+// BindingsFor returns the variables bound to path
+func BindingsFor(path string) []string {
+	var out []string
+	for _, b := range Bindings {
+		if b.Path == path {
+			out = append(out, b.Env)
+		}
+	}
+	return out
+}
+
+var (
+	currentMu sync.Mutex
+	current   *Resolved
+)
+
+// Current returns the configuration packages read their settings from. It
+// is resolved on first use from the default files and the environment
+// unless a command installed its own with SetCurrent. A config that does
+// not load is reported once and resolution continues without it.
+func Current() *Resolved {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current != nil {
+		return current
+	}
+	r, err := Resolve(ResolveOptions{ConfigOptional: true})
+	if r == nil {
+		fmt.Fprintf(os.Stderr, "⚠️  config: %v; using defaults and environment only\n", err)
+		r, err = Resolve(ResolveOptions{SkipConfig: true})
+	}
+	if r == nil {
+		r = defaults(DefaultPath())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  config: %v\n", err)
+	}
+	current = r
+	return current
+}
+
+// SetCurrent installs the configuration returned by Current
+func SetCurrent(r *Resolved) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = r
+}
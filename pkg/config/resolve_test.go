@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resolveData resolves data as the config file, without the instance env
+func resolveData(t *testing.T, data string) (*Resolved, error) {
+	t.Helper()
+	dir := t.TempDir()
+	return Resolve(ResolveOptions{
+		ConfigPath:      filepath.Join(dir, "config.yaml"),
+		ConfigData:      []byte(data),
+		InstanceEnvPath: filepath.Join(dir, "instance.env"),
+	})
+}
+
+const placeholderConfig = "schemaVersion: 2\nplatform:\n  domain: ${CERES_DOMAIN}\n"
+
+func TestResolvePlaceholder(t *testing.T) {
+	t.Setenv("CERES_DOMAIN", "")
+	_, err := resolveData(t, placeholderConfig)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "unexpanded placeholder") {
+		t.Fatalf("unexpanded placeholder: %v", err)
+	}
+
+	// the env layer fills in what the file leaves to it
+	t.Setenv("CERES_DOMAIN", "ceres.example.com")
+	r, err := resolveData(t, placeholderConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Config.Platform.Domain != "ceres.example.com" {
+		t.Errorf("domain = %s", r.Config.Platform.Domain)
+	}
+	if o := r.Source("platform.domain"); o.Source != SourceEnv || o.Name != "CERES_DOMAIN" {
+		t.Errorf("domain source = %+v", o)
+	}
+}
+
+func TestResolveInvalidEnv(t *testing.T) {
+	t.Setenv("CERES_DOMAIN", "ceres.example.com")
+	t.Setenv("CERES_UI_VPN_PORT", "vpn")
+	r, err := resolveData(t, "schemaVersion: 2\n")
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "from CERES_UI_VPN_PORT") {
+		t.Fatalf("invalid env setting: %v", err)
+	}
+	// the rest of the configuration still resolves
+	if r == nil || r.Config.Platform.Domain != "ceres.example.com" {
+		t.Errorf("resolved = %+v", r)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePath finds a path relative to the CERES checkout: platform.root
+// (CERES_ROOT), the working directory, then the directory of the binary and
+// its parent. Absolute paths and URLs are returned as they are, as is a path
+// found nowhere.
+func ResolvePath(p string) string {
+	if p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") {
+		return p
+	}
+	for _, base := range roots() {
+		candidate := filepath.Join(base, p)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return p
+}
+
+// Root returns the CERES checkout: platform.root, else the working directory
+func Root() string {
+	if root := strings.TrimSpace(Current().Config.Platform.Root); root != "" {
+		return root
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+func roots() []string {
+	var out []string
+	if root := strings.TrimSpace(Current().Config.Platform.Root); root != "" {
+		out = append(out, root)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		out = append(out, cwd)
+	}
+	if exe, err := os.Executable(); err == nil {
+		dir := filepath.Dir(exe)
+		out = append(out, dir, filepath.Dir(dir))
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the $id of the generated JSON Schema
+const SchemaID = "https://raw.githubusercontent.com/skulesh01/ceres/main/config/ceres.schema.json"
+
+// JSONSchema returns the JSON Schema (draft-07) of the config file, generated
+// from the Config types with the DefaultConfig values as defaults. Editors
+// pick it up with a modeline:
+//
+//	# yaml-language-server: $schema=../config/ceres.schema.json
+func JSONSchema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}), reflect.ValueOf(DefaultConfig()))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = SchemaID
+	schema["title"] = "CERES configuration"
+	schema["required"] = []string{"schemaVersion"}
+	props := schema["properties"].(map[string]interface{})
+	props["schemaVersion"].(map[string]interface{})["const"] = SchemaVersion
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaFor describes t; def holds its default value, invalid when unknown
+func schemaFor(t reflect.Type, def reflect.Value) map[string]interface{} {
+	s := map[string]interface{}{}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		addProperties(props, t, def)
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+	case reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = schemaFor(t.Elem(), reflect.Value{})
+	case reflect.Slice:
+		s["type"] = "array"
+		s["items"] = schemaFor(t.Elem(), reflect.Value{})
+		if def.IsValid() && def.Len() > 0 {
+			s["default"] = def.Interface()
+		}
+	case reflect.Bool:
+		s["type"] = "boolean"
+		if def.IsValid() {
+			s["default"] = def.Bool()
+		}
+	case reflect.Int:
+		s["type"] = "integer"
+		s["minimum"] = 0
+		if def.IsValid() && def.Int() != 0 {
+			s["default"] = def.Int()
+		}
+	case reflect.String:
+		s["type"] = "string"
+		if def.IsValid() && def.String() != "" {
+			s["default"] = def.String()
+		}
+	}
+	return s
+}
+
+func addProperties(props map[string]interface{}, t reflect.Type, def reflect.Value) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		var fdef reflect.Value
+		if def.IsValid() {
+			fdef = def.Field(i)
+		}
+		if isInline(f) {
+			addProperties(props, f.Type, fdef)
+			continue
+		}
+		p := schemaFor(f.Type, fdef)
+		if doc := f.Tag.Get("doc"); doc != "" {
+			p["description"] = doc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			p["enum"] = strings.Split(enum, ",")
+		}
+		props[yamlName(f)] = p
+	}
+}
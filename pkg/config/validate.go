@@ -0,0 +1,613 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/sizing"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// FieldError is a problem with one config field
+type FieldError struct {
+	Path    string // dotted key path, e.g. services.redis.storage
+	Message string
+	File    string // set when the field comes from an overlay
+	Line    int    // 0 when unknown
+}
+
+func (e FieldError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ": ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, " (line %d)", e.Line)
+	}
+	if b.Len() > 0 {
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationError collects every FieldError of a config
+type ValidationError struct {
+	File   string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%d problems:", len(e.Errors)))
+	for _, fe := range e.Errors {
+		lines = append(lines, "  - "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// NamedService is a Services entry with its config key
+type NamedService struct {
+	Name string
+	Service
+}
+
+// List returns every service in declaration order
+func (s Services) List() []NamedService {
+	rv := reflect.ValueOf(s)
+	out := make([]NamedService, 0, rv.NumField())
+	for i := 0; i < rv.NumField(); i++ {
+		name := yamlName(rv.Type().Field(i))
+		f := rv.Field(i)
+		if f.Type() != reflect.TypeOf(Service{}) {
+			f = f.FieldByName("Service")
+		}
+		out = append(out, NamedService{Name: name, Service: f.Interface().(Service)})
+	}
+	return out
+}
+
+// Lookup returns the service with config key name
+func (s Services) Lookup(name string) (Service, bool) {
+	for _, svc := range s.List() {
+		if svc.Name == name {
+			return svc.Service, true
+		}
+	}
+	return Service{}, false
+}
+
+// Services that keep their data in the shared PostgreSQL
+var needsPostgreSQL = []string{"keycloak", "gitlab", "nextcloud", "mattermost", "wiki", "redmine", "sonarqube"}
+
+var (
+	dnsLabel  = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	cronField = regexp.MustCompile(`^[0-9*/,\-]+$`)
+
+	proxmoxTokenID = regexp.MustCompile(`^[^@!\s]+@[^@!\s]+![A-Za-z][A-Za-z0-9._-]*$`)
+	proxmoxTarget  = regexp.MustCompile(`^(node(/[A-Za-z0-9.-]+)?|(qemu|lxc)/[0-9]+)$`)
+	proxmoxSize    = regexp.MustCompile(`^[0-9]+[KMGT]?$`)
+)
+
+// Validate validates configuration. All problems are returned together as
+// *ValidationError with the dotted path of each field.
+func (c *Config) Validate() error {
+	v := &validator{}
+	checkEnums(v, reflect.ValueOf(*c), "")
+
+	if c.SchemaVersion != SchemaVersion {
+		v.add("schemaVersion", "unsupported version %d (this ceres reads %d)", c.SchemaVersion, SchemaVersion)
+	}
+
+	if c.Platform.Name == "" {
+		v.add("platform.name", "required")
+	}
+	checkDomain(v, "platform.domain", c.Platform.Domain, true)
+	if c.Platform.Environment == "" {
+		v.add("platform.environment", "required")
+	}
+
+	switch c.Cloud.Provider {
+	case "":
+		v.add("cloud.provider", "required")
+	case "aws", "azure", "gcp":
+		if c.Cloud.Region == "" {
+			v.add("cloud.region", "required for %s", c.Cloud.Provider)
+		}
+	}
+	checkPort(v, "cloud.proxmox.port", c.Cloud.Proxmox.Port, false)
+	if id := c.Cloud.Proxmox.TokenID; id != "" && !proxmoxTokenID.MatchString(id) {
+		v.add("cloud.proxmox.tokenID", "%q is not a token ID (user@realm!name)", id)
+	}
+	for i, target := range c.Cloud.Proxmox.Notes {
+		if !proxmoxTarget.MatchString(target) {
+			v.add(fmt.Sprintf("cloud.proxmox.notes[%d]", i), "%q is not node, node/<name>, qemu/<vmid> or lxc/<vmid>", target)
+		}
+	}
+	checkProxmoxVM(v, c.Cloud.Proxmox.VM)
+	checkURL(v, "cloud.kubernetes.endpoint", c.Cloud.Kubernetes.Endpoint)
+
+	checkNamespace(v, "namespaces.core", c.Namespaces.Core)
+	checkNamespace(v, "namespaces.apps", c.Namespaces.Apps)
+	checkNamespace(v, "namespaces.monitoring", c.Namespaces.Monitoring)
+
+	for _, svc := range c.Services.List() {
+		path := "services." + svc.Name
+		if svc.Replicas < 0 {
+			v.add(path+".replicas", "must not be negative")
+		}
+		if svc.Storage != "" {
+			if _, err := resource.ParseQuantity(svc.Storage); err != nil {
+				v.add(path+".storage", "%q is not a valid quantity (e.g. 10Gi)", svc.Storage)
+			}
+		}
+		if strings.ContainsAny(svc.Version, " :@") {
+			v.add(path+".version", "%q is not an image tag", svc.Version)
+		}
+		checkDomain(v, path+".host", svc.Host, false)
+	}
+	if !c.Services.PostgreSQL.Enabled {
+		for _, name := range needsPostgreSQL {
+			if svc, _ := c.Services.Lookup(name); svc.Enabled {
+				v.add("services."+name+".enabled", "requires services.postgresql.enabled")
+			}
+		}
+	}
+	if c.Services.PostgreSQL.Enabled && !dnsLabel.MatchString(strings.ReplaceAll(c.Services.PostgreSQL.Database, "_", "-")) {
+		v.add("services.postgresql.database", "%q is not a valid database name", c.Services.PostgreSQL.Database)
+	}
+
+	if c.Mail.From != "" {
+		if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+			v.add("mail.from", "%q is not an email address", c.Mail.From)
+		}
+	}
+	checkPort(v, "mail.smtp.port", c.Mail.SMTP.Port, false)
+	if net.ParseIP(c.Mail.SMTP.Host) == nil {
+		checkDomain(v, "mail.smtp.host", c.Mail.SMTP.Host, false)
+	}
+
+	if c.VPN.Enabled {
+		checkPort(v, "vpn.port", c.VPN.Port, true)
+		if _, _, err := net.ParseCIDR(c.VPN.Network); err != nil {
+			v.add("vpn.network", "%q is not a CIDR range (e.g. 10.8.0.0/24)", c.VPN.Network)
+		}
+	}
+	if c.VPN.Endpoint != "" && net.ParseIP(c.VPN.Endpoint) == nil {
+		checkDomain(v, "vpn.endpoint", c.VPN.Endpoint, false)
+	}
+	checkPort(v, "ui.form.vpnPort", c.UI.Form.VPNPort, false)
+
+	if c.Backup.Enabled {
+		checkCron(v, "backup.schedule", c.Backup.Schedule)
+		if d, err := time.ParseDuration(c.Backup.Retention); err != nil || d <= 0 {
+			v.add("backup.retention", "%q is not a positive duration (e.g. 720h)", c.Backup.Retention)
+		}
+	}
+	if c.Backup.Enabled || c.Backup.Databases.Enabled {
+		if c.Backup.Location.Provider == "" {
+			v.add("backup.location.provider", "required")
+		}
+		if c.Backup.Location.Bucket == "" {
+			v.add("backup.location.bucket", "required")
+		}
+		if c.Backup.Location.Provider == "minio" && c.Backup.Location.URL == "" {
+			v.add("backup.location.url", "required for minio")
+		}
+	}
+	if db := c.Backup.Databases; db.Enabled {
+		checkCron(v, "backup.databases.schedule", db.Schedule)
+		if d, err := time.ParseDuration(db.Retention); err != nil || d < time.Hour {
+			v.add("backup.databases.retention", "%q is not a duration of an hour or more (e.g. 336h)", db.Retention)
+		}
+		switch {
+		case db.Bucket == "":
+			v.add("backup.databases.bucket", "required")
+		case db.Bucket == c.Backup.Location.Bucket:
+			// Velero refuses a bucket with directories it did not write
+			v.add("backup.databases.bucket", "must differ from backup.location.bucket, which Velero owns")
+		}
+		if c.Backup.Location.Provider != "minio" {
+			v.add("backup.databases.enabled", "needs backup.location.provider minio")
+		} else if !c.Services.MinIO.Enabled {
+			v.add("backup.databases.enabled", "requires services.minio.enabled")
+		}
+	}
+	checkURL(v, "backup.location.url", c.Backup.Location.URL)
+	policies := map[string]bool{}
+	for i, p := range c.Backup.Policies {
+		path := fmt.Sprintf("backup.policies[%d]", i)
+		switch {
+		case !dnsLabel.MatchString(p.Name) || len(p.Name) > 50:
+			v.add(path+".name", "%q is not a lowercase name of letters, digits and dashes", p.Name)
+		case policies[p.Name]:
+			v.add(path+".name", "%q is used twice", p.Name)
+		}
+		policies[p.Name] = true
+		checkCron(v, path+".schedule", p.Schedule)
+		if d, err := time.ParseDuration(p.Retention); err != nil || d <= 0 {
+			v.add(path+".retention", "%q is not a positive duration (e.g. 168h)", p.Retention)
+		}
+		if p.Location != "" && !dnsLabel.MatchString(p.Location) {
+			v.add(path+".location", "%q is not a storage location name", p.Location)
+		}
+		for j, comp := range p.Components {
+			checkComponent(v, c, fmt.Sprintf("%s.components[%d]", path, j), comp)
+		}
+	}
+	for i, h := range c.Backup.Hooks {
+		path := fmt.Sprintf("backup.hooks[%d]", i)
+		checkComponent(v, c, path+".component", h.Component)
+		if len(h.Pre) == 0 && len(h.Post) == 0 {
+			v.add(path, "needs a pre or post command")
+		}
+		if h.Timeout != "" {
+			if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+				v.add(path+".timeout", "%q is not a positive duration (e.g. 30s)", h.Timeout)
+			}
+		}
+	}
+
+	if c.SSO.Enabled {
+		if c.SSO.Realm == "" {
+			v.add("sso.realm", "required")
+		}
+		if !c.Services.Keycloak.Enabled {
+			v.add("sso.enabled", "requires services.keycloak.enabled")
+		}
+	}
+	for i, client := range c.SSO.Clients {
+		if _, ok := c.Services.Lookup(client); !ok {
+			v.add(fmt.Sprintf("sso.clients[%d]", i), "unknown service %q", client)
+		}
+	}
+
+	if c.Images.Registry != "" && strings.Contains(c.Images.Registry, "://") {
+		v.add("images.registry", "%q must be a registry host[/path], without scheme", c.Images.Registry)
+	}
+	checkURL(v, "secrets.vault.address", c.Secrets.Vault.Address)
+
+	if c.Sizing.Profile != "" {
+		if _, err := sizing.Get(c.Sizing.Profile, nil); err != nil {
+			v.add("sizing.profile", "%v", err)
+		}
+	}
+	names := make([]string, 0, len(c.Sizing.Components))
+	for name := range c.Sizing.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		size := c.Sizing.Components[name]
+		fields := []struct{ key, value string }{
+			{"cpu", size.CPU}, {"memory", size.Memory}, {"cpuLimit", size.CPULimit},
+			{"memoryLimit", size.MemoryLimit}, {"storage", size.Storage},
+		}
+		for _, f := range fields {
+			if f.value == "" {
+				continue
+			}
+			if _, err := resource.ParseQuantity(f.value); err != nil {
+				v.add("sizing.components."+name+"."+f.key, "%q is not a valid quantity", f.value)
+			}
+		}
+	}
+
+	if c.Topology.Mode == "ha" {
+		if n := c.Topology.PostgreSQL; n != 0 && n < 2 {
+			v.add("topology.postgresql", "ha needs 2 instances or more, got %d", n)
+		}
+		// the Sentinels need a majority to fail over
+		if n := c.Topology.Redis; n != 0 && n < 3 {
+			v.add("topology.redis", "ha needs 3 nodes or more, got %d", n)
+		} else if n > 9 {
+			// redis-proxy has 9 server slots (deployment/ha/redis.yaml)
+			v.add("topology.redis", "at most 9 nodes, got %d", n)
+		}
+		if n := c.Services.Keycloak.Replicas; n == 1 {
+			v.add("services.keycloak.replicas", "ha needs 2 replicas or more, got 1")
+		}
+	} else if c.Topology.PostgreSQL < 0 || c.Topology.Redis < 0 {
+		v.add("topology", "instance counts must not be negative")
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+func checkDomain(v *validator, path, value string, required bool) {
+	if value == "" {
+		if required {
+			v.add(path, "required")
+		}
+		return
+	}
+	if strings.Contains(value, "${") {
+		v.add(path, "%q contains an unexpanded placeholder", value)
+		return
+	}
+	labels := strings.Split(strings.ToLower(value), ".")
+	for _, l := range labels {
+		if !dnsLabel.MatchString(l) {
+			v.add(path, "%q is not a valid DNS name", value)
+			return
+		}
+	}
+	if len(value) > 253 {
+		v.add(path, "%q is longer than 253 characters", value)
+	}
+}
+
+func checkNamespace(v *validator, path, value string) {
+	if value == "" {
+		v.add(path, "required")
+	} else if !dnsLabel.MatchString(value) {
+		v.add(path, "%q is not a valid namespace name", value)
+	}
+}
+
+func checkProxmoxVM(v *validator, vm ProxmoxVM) {
+	const path = "cloud.proxmox.vm"
+	if vm.Name != "" && !dnsLabel.MatchString(vm.Name) {
+		v.add(path+".name", "%q is not a valid host name (lowercase letters, digits, '-')", vm.Name)
+	}
+	if vm.Template < 0 {
+		v.add(path+".template", "must not be negative")
+	}
+	if vm.VMID != 0 && vm.VMID < 100 {
+		v.add(path+".vmid", "%d is not a VMID (100 or more)", vm.VMID)
+	}
+	if vm.Cores < 0 {
+		v.add(path+".cores", "must not be negative")
+	}
+	if vm.Memory < 0 {
+		v.add(path+".memory", "must not be negative")
+	}
+	if vm.Disk != "" && !proxmoxSize.MatchString(vm.Disk) {
+		v.add(path+".disk", "%q is not a disk size, e.g. 64G", vm.Disk)
+	}
+	switch {
+	case vm.IP == "" || vm.IP == "dhcp":
+		if vm.Gateway != "" {
+			v.add(path+".gateway", "only used with a static ip")
+		}
+	default:
+		if _, _, err := net.ParseCIDR(vm.IP); err != nil {
+			v.add(path+".ip", "%q is not dhcp or an address in CIDR notation, e.g. 192.168.1.50/24", vm.IP)
+		}
+		if vm.Gateway == "" {
+			v.add(path+".gateway", "required with a static ip")
+		}
+	}
+	if vm.Gateway != "" && net.ParseIP(vm.Gateway) == nil {
+		v.add(path+".gateway", "%q is not an IP address", vm.Gateway)
+	}
+}
+
+func checkPort(v *validator, path string, port int, required bool) {
+	if port == 0 && !required {
+		return
+	}
+	if port < 1 || port > 65535 {
+		v.add(path, "%d is not a port (1-65535)", port)
+	}
+}
+
+// checkComponent accepts the components of ceres services: the services and
+// mailcow
+func checkComponent(v *validator, c *Config, path, name string) {
+	if _, ok := c.Services.Lookup(name); !ok && name != "mailcow" {
+		v.add(path, "unknown component %q", name)
+	}
+}
+
+// checkCron accepts 5-field cron expressions of numbers, lists, ranges and steps
+func checkCron(v *validator, path, value string) {
+	f := strings.Fields(value)
+	if len(f) != 5 {
+		v.add(path, "%q is not a 5-field cron expression", value)
+		return
+	}
+	for _, field := range f {
+		if !cronField.MatchString(field) {
+			v.add(path, "%q is not a 5-field cron expression", value)
+			return
+		}
+	}
+}
+
+func checkURL(v *validator, path, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(path, "%q is not an http(s) URL", value)
+	}
+}
+
+// checkEnums applies the `enum` tags; empty values are left to the
+// required checks
+func checkEnums(v *validator, rv reflect.Value, path string) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		fv := rv.Field(i)
+		p := joinPath(path, yamlName(f))
+		if isInline(f) {
+			p = path
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			checkEnums(v, fv, p)
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.Struct {
+				for j := 0; j < fv.Len(); j++ {
+					checkEnums(v, fv.Index(j), fmt.Sprintf("%s[%d]", p, j))
+				}
+			}
+		case reflect.String:
+			allowed := f.Tag.Get("enum")
+			if allowed == "" || fv.String() == "" {
+				continue
+			}
+			if !contains(strings.Split(allowed, ","), fv.String()) {
+				v.add(p, "%q is not one of %s", fv.String(), strings.ReplaceAll(allowed, ",", ", "))
+			}
+		}
+	}
+}
+
+var typeOfConfig = reflect.TypeOf(Config{})
+
+// checkKeys walks a YAML tree against the config types and reports unknown
+// keys and values of the wrong kind, with their line
+func checkKeys(n *yaml.Node, t reflect.Type, path string) []FieldError {
+	if n == nil || n.Tag == "!!null" {
+		return nil
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	wrong := func(want string) []FieldError {
+		return []FieldError{{Path: path, Line: n.Line, Message: "expected " + want}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return wrong("a mapping")
+		}
+		fields := structFields(t)
+		var errs []FieldError
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			p := joinPath(path, key.Value)
+			ft, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown field"
+				if s := suggest(key.Value, fields); s != "" {
+					msg += ", did you mean " + s + "?"
+				}
+				errs = append(errs, FieldError{Path: p, Line: key.Line, Message: msg})
+				continue
+			}
+			errs = append(errs, checkKeys(n.Content[i+1], ft, p)...)
+		}
+		return errs
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return wrong("a mapping")
+		}
+		var errs []FieldError
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = append(errs, checkKeys(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value))...)
+		}
+		return errs
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return wrong("a list")
+		}
+		var errs []FieldError
+		for i, item := range n.Content {
+			errs = append(errs, checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	case reflect.Bool:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" {
+			return wrong("true or false")
+		}
+	case reflect.Int:
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!int" {
+			return wrong("an integer")
+		}
+	case reflect.String:
+		if n.Kind != yaml.ScalarNode {
+			return wrong("a string")
+		}
+	}
+	return nil
+}
+
+// structFields maps the YAML keys of t, including inlined structs, to their types
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isInline(f) {
+			for k, ft := range structFields(f.Type) {
+				fields[k] = ft
+			}
+			continue
+		}
+		fields[yamlName(f)] = f.Type
+	}
+	return fields
+}
+
+// suggest returns the known key that only differs from key in case or
+// separators (admin_user -> adminUser)
+func suggest(key string, fields map[string]reflect.Type) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	for k := range fields {
+		if norm(k) == norm(key) {
+			return k
+		}
+	}
+	return ""
+}
+
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+func isInline(f reflect.StructField) bool {
+	_, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	return strings.Contains(opts, "inline")
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
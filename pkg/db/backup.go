@@ -0,0 +1,492 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/secrets"
+)
+
+// BackupTemplate holds the scripts and settings of the logical backups and
+// the CronJob the backup Jobs of every database are made from
+const BackupTemplate = "deployment/postgresql-backup.yaml"
+
+// BackupCredentials is the Secret with the object storage key of the dumps
+const BackupCredentials = "postgresql-backup-s3"
+
+const (
+	backupName  = "postgresql-backup"
+	backupLabel = "app=" + backupName
+)
+
+// What a Job made from the template does (MODE of its scripts)
+const (
+	modeBackup  = "backup"
+	modeRestore = "restore"
+	modeVerify  = "verify"
+	modeList    = "list"
+)
+
+// Dump is a logical backup of a database in the object storage
+type Dump struct {
+	Database string
+	Stamp    string // UTC time of the dump, 20060102-150405
+}
+
+// CronJob is the name of the scheduled backup of d
+func (d Database) CronJob() string {
+	return backupName + "-" + d.Service
+}
+
+// Backups makes the CronJobs and Jobs of the logical backups from the
+// rendered BackupTemplate
+type Backups struct {
+	template []byte
+	settings config.Backup
+}
+
+// NewBackups returns the backups of the rendered template with the
+// settings of backup.databases and backup.location
+func NewBackups(template []byte, settings config.Backup) *Backups {
+	return &Backups{template: template, settings: settings}
+}
+
+// Manifest returns the scripts, the settings and a CronJob per database
+func (b *Backups) Manifest(dbs []Database) ([]byte, error) {
+	return b.render(func(cron *yaml.Node) []*yaml.Node {
+		out := make([]*yaml.Node, 0, len(dbs))
+		for _, d := range dbs {
+			job := clone(cron)
+			meta := lookup(job, "metadata")
+			set(meta, "name", d.CronJob())
+			set(lookup(meta, "labels"), "database", d.Name)
+			set(lookup(job, "spec"), "schedule", b.settings.Databases.Schedule)
+			setEnv(podSpec(lookup(job, "spec")), map[string]string{
+				"MODE":     modeBackup,
+				"DATABASE": d.Name,
+				"ROLE":     d.Role,
+			})
+			out = append(out, job)
+		}
+		return out
+	})
+}
+
+// Schedule applies the CronJobs of dbs and deletes those of the other
+// databases
+func (b *Backups) Schedule(dbs []Database) error {
+	data, err := b.Manifest(dbs)
+	if err != nil {
+		return err
+	}
+	if err := kubectlApply(data); err != nil {
+		return fmt.Errorf("failed to schedule database backups: %w", err)
+	}
+	keep := map[string]bool{}
+	for _, d := range dbs {
+		keep[d.CronJob()] = true
+	}
+	for _, name := range cronJobs() {
+		if !keep[name] {
+			exec.Command("kubectl", "delete", "cronjob", name, "-n", Namespace).Run()
+		}
+	}
+	return nil
+}
+
+// Unschedule deletes every CronJob of the logical backups
+func Unschedule() {
+	for _, name := range cronJobs() {
+		exec.Command("kubectl", "delete", "cronjob", name, "-n", Namespace).Run()
+	}
+}
+
+func cronJobs() []string {
+	out, err := exec.Command("kubectl", "get", "cronjobs", "-n", Namespace, "-l", backupLabel,
+		"-o", "jsonpath={.items[*].metadata.name}").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// Backup dumps the database of d now
+func (b *Backups) Backup(d Database) error {
+	_, err := b.run(d, modeBackup, "")
+	return err
+}
+
+// Verify restores a dump of d (a stamp or "latest") into a scratch database
+func (b *Backups) Verify(d Database, from string) error {
+	_, err := b.run(d, modeVerify, from)
+	return err
+}
+
+// List returns the dumps in the object storage, oldest first
+func (b *Backups) List() ([]Dump, error) {
+	out, err := b.run(Database{Service: "all"}, modeList, "")
+	if err != nil {
+		return nil, err
+	}
+	// store/<bucket>/postgresql/<database>/<stamp>.dump
+	var dumps []Dump
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(strings.TrimSpace(line), "/")
+		if n := len(f); n >= 3 && f[n-3] == "postgresql" && strings.HasSuffix(f[n-1], ".dump") {
+			dumps = append(dumps, Dump{Database: f[n-2], Stamp: strings.TrimSuffix(f[n-1], ".dump")})
+		}
+	}
+	sort.Slice(dumps, func(i, j int) bool {
+		if dumps[i].Database != dumps[j].Database {
+			return dumps[i].Database < dumps[j].Database
+		}
+		return dumps[i].Stamp < dumps[j].Stamp
+	})
+	return dumps, nil
+}
+
+// Find returns the dump of d at from (a stamp or "latest") in the object
+// storage
+func (b *Backups) Find(d Database, from string) (Dump, error) {
+	dumps, err := b.List()
+	if err != nil {
+		return Dump{}, err
+	}
+	var found *Dump
+	for i := range dumps {
+		if dumps[i].Database == d.Name && (from == "latest" || dumps[i].Stamp == from) {
+			found = &dumps[i] // oldest first: the last is the latest
+		}
+	}
+	if found == nil {
+		if from == "latest" {
+			return Dump{}, fmt.Errorf("no backup of %s yet (ceres db backup %s)", d.Name, d.Service)
+		}
+		return Dump{}, fmt.Errorf("no backup of %s at %s (ceres db backups %s)", d.Name, from, d.Service)
+	}
+	return *found, nil
+}
+
+// Restore replaces the database of d with a dump of Find. The service is
+// stopped meanwhile; the restored objects are handed to its role, whose
+// password is set again. The service is started again when the restore
+// fails before the database is dropped; after, a failed restore leaves it
+// stopped: it would start on an empty database.
+func (b *Backups) Restore(c *Client, d Database, dump Dump, password string) error {
+	if dump.Database != d.Name || dump.Stamp == "" {
+		return fmt.Errorf("%s/%s is not a backup of %s", dump.Database, dump.Stamp, d.Name)
+	}
+	stopped, err := stop(d)
+	if err != nil {
+		if serr := start(stopped); serr != nil {
+			return fmt.Errorf("%w; %v", err, serr)
+		}
+		return err
+	}
+	if _, err := b.run(d, modeRestore, dump.Stamp); err != nil {
+		if errors.Is(err, errNotFetched) {
+			if serr := start(stopped); serr != nil {
+				return fmt.Errorf("%w; %v", err, serr)
+			}
+			return err
+		}
+		return fmt.Errorf("%w; %s stays stopped", err, d.Service)
+	}
+	if _, err := c.Ensure(d, password); err != nil {
+		return fmt.Errorf("%w; %s stays stopped", err, d.Service)
+	}
+	return start(stopped)
+}
+
+// errNotFetched is a Job that failed downloading its dump, before its pg
+// step touched a database
+var errNotFetched = errors.New("the dump was not downloaded")
+
+// run applies a Job of mode for d, waits for it and returns the log of its
+// store step
+func (b *Backups) run(d Database, mode, from string) (string, error) {
+	name := fmt.Sprintf("postgresql-%s-%s-%s", mode, d.Service, time.Now().UTC().Format("20060102150405"))
+	data, err := b.render(func(cron *yaml.Node) []*yaml.Node {
+		spec := clone(lookup(lookup(lookup(cron, "spec"), "jobTemplate"), "spec"))
+		// on demand: fail at once and report it
+		setInt(spec, "backoffLimit", 0)
+		setInt(spec, "ttlSecondsAfterFinished", 3600)
+		env := map[string]string{"MODE": mode, "DATABASE": d.Name, "ROLE": d.Role}
+		if from != "" {
+			env["FROM"] = from
+		}
+		setEnv(podSpec(spec), env)
+
+		meta := &yaml.Node{Kind: yaml.MappingNode}
+		set(meta, "name", name)
+		set(meta, "namespace", Namespace)
+		job := &yaml.Node{Kind: yaml.MappingNode}
+		set(job, "apiVersion", "batch/v1")
+		set(job, "kind", "Job")
+		setNode(job, "metadata", meta)
+		setNode(job, "spec", spec)
+		return []*yaml.Node{job}
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := kubectlApply(data); err != nil {
+		return "", fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	defer exec.Command("kubectl", "delete", "job", name, "-n", Namespace, "--wait=false").Run()
+
+	deadline := time.Now().Add(2 * time.Hour)
+	for {
+		out, _ := exec.Command("kubectl", "get", "job", name, "-n", Namespace,
+			"-o", "jsonpath={.status.succeeded}|{.status.failed}").Output()
+		f := strings.Split(strings.TrimSpace(string(out)), "|")
+		if len(f) == 2 && f[0] != "" && f[0] != "0" {
+			break
+		}
+		if len(f) == 2 && f[1] != "" && f[1] != "0" {
+			logs, _ := exec.Command("kubectl", "logs", "job/"+name, "-n", Namespace, "--all-containers", "--prefix").CombinedOutput()
+			err := fmt.Errorf("%s %s failed:\n%s", mode, d.Service, strings.TrimSpace(string(logs)))
+			if !fetched(name) {
+				err = fmt.Errorf("%w: %w", errNotFetched, err)
+			}
+			return "", err
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("%s %s did not finish in 2h", mode, d.Service)
+		}
+		time.Sleep(5 * time.Second)
+	}
+
+	if mode == modeList {
+		out, err := exec.Command("kubectl", "logs", "job/"+name, "-n", Namespace, "-c", "store").Output()
+		return string(out), err
+	}
+	out, _ := exec.Command("kubectl", "logs", "job/"+name, "-n", Namespace, "-c", "pg").Output()
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			fmt.Printf("    ✓ %s\n", line)
+		}
+	}
+	return string(out), nil
+}
+
+// fetched reports whether the fetch step of the Job name completed
+func fetched(name string) bool {
+	out, err := exec.Command("kubectl", "get", "pods", "-n", Namespace, "-l", "job-name="+name,
+		"-o", `jsonpath={.items[*].status.initContainerStatuses[?(@.name=="fetch")].state.terminated.exitCode}`).Output()
+	if err != nil {
+		return true // unknown: assume the worst
+	}
+	codes := strings.Fields(string(out))
+	return len(codes) == 0 || codes[len(codes)-1] == "0"
+}
+
+// render returns the scripts and the settings of the template followed by
+// the documents made from its CronJob
+func (b *Backups) render(fromCron func(cron *yaml.Node) []*yaml.Node) ([]byte, error) {
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	var cron *yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(b.template))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		name := scalar(lookup(root, "metadata"), "name")
+		switch kind := scalar(root, "kind"); {
+		case kind == "CronJob" && name == backupName:
+			cron = root
+			continue
+		case kind == "ConfigMap" && name == backupName:
+			data := lookup(root, "data")
+			set(data, "BUCKET", b.settings.Databases.Bucket)
+			set(data, "RETENTION", olderThan(b.settings.Databases.Retention))
+			set(data, "VERIFY", strconv.FormatBool(b.settings.Databases.Verify))
+			set(data, "S3_URL", b.settings.Location.URL)
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if cron == nil {
+		return nil, fmt.Errorf("%s has no CronJob %s", BackupTemplate, backupName)
+	}
+	for _, n := range fromCron(cron) {
+		if err := enc.Encode(n); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// olderThan turns a retention (720h) into the age mc rm --older-than takes
+// (30d0h0m)
+func olderThan(retention string) string {
+	d, err := time.ParseDuration(retention)
+	if err != nil {
+		return retention
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	return fmt.Sprintf("%dd%dh%dm", days, d/time.Hour, (d%time.Hour)/time.Minute)
+}
+
+// stop scales the workloads of d's service to zero and returns their
+// replicas
+func stop(d Database) (map[secrets.Workload]string, error) {
+	c, err := secrets.Lookup(d.Credential())
+	if err != nil {
+		return nil, err
+	}
+	stopped := map[secrets.Workload]string{}
+	for _, w := range c.Dependents {
+		if w.Engine == secrets.EngineHelm {
+			continue
+		}
+		out, err := exec.Command("kubectl", "get", w.Kind, w.Name, "-n", w.Namespace, "-o", "jsonpath={.spec.replicas}").Output()
+		if err != nil {
+			continue // not deployed
+		}
+		replicas := strings.TrimSpace(string(out))
+		if replicas == "" || replicas == "0" {
+			continue
+		}
+		fmt.Printf("    ⏸️  Stopping %s\n", w)
+		if out, err := exec.Command("kubectl", "scale", w.Kind, w.Name, "-n", w.Namespace, "--replicas=0").CombinedOutput(); err != nil {
+			return stopped, fmt.Errorf("failed to stop %s: %w: %s", w, err, strings.TrimSpace(string(out)))
+		}
+		stopped[w] = replicas
+	}
+	return stopped, nil
+}
+
+// start scales the workloads stop stopped back
+func start(stopped map[secrets.Workload]string) error {
+	for w, replicas := range stopped {
+		fmt.Printf("    ▶️  Starting %s (%s replicas)\n", w, replicas)
+		if out, err := exec.Command("kubectl", "scale", w.Kind, w.Name, "-n", w.Namespace, "--replicas="+replicas).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start %s: %w: %s", w, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func kubectlApply(data []byte) error {
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// podSpec returns the pod spec of a CronJob or Job spec
+func podSpec(spec *yaml.Node) *yaml.Node {
+	if jt := lookup(spec, "jobTemplate"); jt != nil {
+		spec = lookup(jt, "spec")
+	}
+	return lookup(lookup(spec, "template"), "spec")
+}
+
+// setEnv sets the values of the env entries named in values, in every
+// container that has them
+func setEnv(pod *yaml.Node, values map[string]string) {
+	for _, list := range []string{"initContainers", "containers"} {
+		containers := lookup(pod, list)
+		if containers == nil {
+			continue
+		}
+		for _, c := range containers.Content {
+			env := lookup(c, "env")
+			if env == nil {
+				continue
+			}
+			for _, e := range env.Content {
+				if v, ok := values[scalar(e, "name")]; ok {
+					set(e, "value", v)
+				}
+			}
+		}
+	}
+}
+
+// lookup returns the value node of key in a mapping, or nil
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(m *yaml.Node, key string) string {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// set sets a string value
+func set(m *yaml.Node, key, value string) {
+	setNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
+
+// setInt sets an integer value
+func setInt(m *yaml.Node, key string, n int) {
+	setNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(n)})
+}
+
+func setNode(m *yaml.Node, key string, v *yaml.Node) {
+	if m == nil {
+		return
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = v
+			return
+		}
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+}
+
+// clone copies a node tree
+func clone(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = clone(child)
+	}
+	return &c
+}
@@ -0,0 +1,238 @@
+// Package db manages the databases of the shared PostgreSQL (kubectl
+// engine): one database and one owner role per service, whose password is
+// the <service>-db credential of pkg/secrets. It runs psql inside the
+// PostgreSQL pod, or locally through a port-forward, as the superuser of
+// ceres-core/postgresql-secret.
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// Namespace of the shared PostgreSQL
+const Namespace = "ceres-core"
+
+// Superuser and the Secret key of its password
+const (
+	Superuser       = "postgres"
+	SuperuserSecret = "postgresql-secret"
+	SuperuserKey    = "postgres-password"
+)
+
+// Database is the database of one service
+type Database struct {
+	Service string // config key in services
+	Name    string
+	Role    string // owner; its password is the <service>-db credential
+}
+
+// Credential is the secrets catalog entry of the owner's password
+func (d Database) Credential() string {
+	return d.Service + "-db"
+}
+
+// Databases of the services that keep their data in PostgreSQL
+var Databases = []Database{
+	{"keycloak", "keycloak", "keycloak"},
+	{"gitlab", "gitlab", "gitlab"},
+	{"nextcloud", "nextcloud", "nextcloud"},
+	{"mattermost", "mattermost", "mattermost"},
+	{"wiki", "wikijs", "wiki"},
+	{"redmine", "redmine", "redmine"},
+	{"sonarqube", "sonarqube", "sonarqube"},
+}
+
+// Enabled returns the databases of the services enabled in cfg
+func Enabled(cfg config.Config) []Database {
+	var out []Database
+	for _, d := range Databases {
+		if svc, ok := cfg.Services.Lookup(d.Service); ok && svc.Enabled {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Lookup returns the database of a service
+func Lookup(service string) (Database, error) {
+	names := make([]string, 0, len(Databases))
+	for _, d := range Databases {
+		if d.Service == service {
+			return d, nil
+		}
+		names = append(names, d.Service)
+	}
+	return Database{}, fmt.Errorf("no database for %q (%s)", service, strings.Join(names, ", "))
+}
+
+// Client runs psql and pg_dump against the shared PostgreSQL
+type Client struct {
+	password string
+	// pod and container run psql in-cluster; empty with a port-forward
+	pod       string
+	container string
+	forward   *exec.Cmd
+	port      string
+}
+
+// Options controls Connect
+type Options struct {
+	// PortForward runs the local psql and pg_dump through kubectl
+	// port-forward instead of inside the PostgreSQL pod
+	PortForward bool
+}
+
+// Connect reads the superuser password and finds the PostgreSQL pod: the
+// postgresql StatefulSet, or the primary of the CloudNativePG cluster in
+// ha mode
+func Connect(opts Options) (*Client, error) {
+	out, err := exec.Command("kubectl", "get", "secret", SuperuserSecret, "-n", Namespace,
+		"-o", "go-template={{index .data \""+SuperuserKey+"\" | base64decode}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w (is CERES deployed?)", Namespace, SuperuserSecret, err)
+	}
+	c := &Client{password: string(out)}
+
+	if opts.PortForward {
+		if err := c.portForward(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	c.pod, c.container, err = primary()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// primary returns the pod that accepts writes and its PostgreSQL container
+func primary() (pod, container string, err error) {
+	candidates := []struct{ selector, container string }{
+		{"cnpg.io/cluster=postgresql,cnpg.io/instanceRole=primary", "postgres"},
+		{"app=postgresql", "postgresql"},
+	}
+	for _, c := range candidates {
+		out, _ := exec.Command("kubectl", "get", "pods", "-n", Namespace, "-l", c.selector,
+			"--field-selector", "status.phase=Running", "-o", "jsonpath={.items[0].metadata.name}").Output()
+		if pod := strings.TrimSpace(string(out)); pod != "" {
+			return pod, c.container, nil
+		}
+	}
+	return "", "", fmt.Errorf("no running PostgreSQL pod in %s", Namespace)
+}
+
+// portForward forwards a free local port to the postgresql service
+func (c *Client) portForward() error {
+	for _, bin := range []string{"psql", "pg_dump"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			return fmt.Errorf("%s not found: install the PostgreSQL client or drop --port-forward", bin)
+		}
+	}
+	cmd := exec.Command("kubectl", "port-forward", "-n", Namespace, "svc/postgresql", ":5432")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("kubectl port-forward: %w", err)
+	}
+	// Forwarding from 127.0.0.1:54321 -> 5432
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if i, j := strings.LastIndex(line, ":"), strings.Index(line, " ->"); err == nil && i >= 0 && j > i {
+		c.forward, c.port = cmd, line[i+1:j]
+		go io.Copy(io.Discard, stdout)
+		return nil
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return fmt.Errorf("kubectl port-forward svc/postgresql failed: %s", strings.TrimSpace(stderr.String()))
+}
+
+// Close stops the port-forward
+func (c *Client) Close() {
+	if c.forward != nil {
+		c.forward.Process.Kill()
+		c.forward.Wait()
+		c.forward = nil
+	}
+}
+
+// Target is where psql runs, for messages
+func (c *Client) Target() string {
+	if c.pod != "" {
+		return Namespace + "/" + c.pod
+	}
+	return "127.0.0.1:" + c.port + " (port-forward)"
+}
+
+// command runs a PostgreSQL client program as the superuser. In the pod the
+// password is the first line of stdin, so it is not in any process list.
+func (c *Client) command(stdin io.Reader, interactive bool, program string, args ...string) *exec.Cmd {
+	if c.pod == "" {
+		cmd := exec.Command(program, append([]string{"-h", "127.0.0.1", "-p", c.port, "-U", Superuser}, args...)...)
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+c.password)
+		cmd.Stdin = stdin
+		return cmd
+	}
+
+	kubectl := []string{"exec", "-i", "-n", Namespace, c.pod, "-c", c.container}
+	if interactive {
+		// the terminal is stdin: take the password from the container,
+		// the postgres image has it in POSTGRES_PASSWORD, CloudNativePG
+		// trusts its local socket
+		kubectl = append(kubectl, "-t")
+		script := `if [ -n "$POSTGRES_PASSWORD" ]; then PGPASSWORD="$POSTGRES_PASSWORD" exec "$0" -h localhost -U ` + Superuser + ` "$@"; fi; exec "$0" -U ` + Superuser + ` "$@"`
+		cmd := exec.Command("kubectl", append(append(kubectl, "--", "sh", "-c", script, program), args...)...)
+		cmd.Stdin = stdin
+		return cmd
+	}
+	script := `read -r PGPASSWORD; export PGPASSWORD; exec "$0" -h localhost -U ` + Superuser + ` "$@"`
+	cmd := exec.Command("kubectl", append(append(kubectl, "--", "sh", "-c", script, program), args...)...)
+	cmd.Stdin = io.MultiReader(strings.NewReader(c.password+"\n"), stdin)
+	return cmd
+}
+
+// Run runs a psql script in database and returns its unaligned output
+func (c *Client) Run(database, script string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := c.command(strings.NewReader(script), false, "psql",
+		"-d", database, "-v", "ON_ERROR_STOP=1", "-X", "-q", "-t", "-A", "-F", "\t")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("psql %s: %w: %s", database, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Shell opens an interactive psql in database
+func (c *Client) Shell(database string) error {
+	cmd := c.command(os.Stdin, true, "psql", "-d", database)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Dump writes pg_dump of database to w; format is plain or custom
+func (c *Client) Dump(database, format string, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := c.command(strings.NewReader(""), false, "pg_dump",
+		"-d", database, "--format", format, "--no-owner", "--no-privileges")
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_dump %s: %w: %s", database, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is a database as found in PostgreSQL
+type Status struct {
+	Database
+	Exists bool
+	Owner  string
+	Size   string
+}
+
+// Ensure creates the role and database of d, or brings them in line: the
+// role logs in with password and owns the database. Objects created by the
+// superuser (installs older than per-service roles) are handed to the role.
+func (c *Client) Ensure(d Database, password string) (created bool, err error) {
+	status, err := c.status(d)
+	if err != nil {
+		return false, err
+	}
+
+	script := psqlSet("role", d.Role) + psqlSet("pw", password) + psqlSet("db", d.Name) + `
+SELECT format('CREATE ROLE %I LOGIN', :'role') WHERE NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = :'role') \gexec
+SELECT format('ALTER ROLE %I LOGIN PASSWORD %L', :'role', :'pw') \gexec
+SELECT format('CREATE DATABASE %I OWNER %I', :'db', :'role') WHERE NOT EXISTS (SELECT 1 FROM pg_database WHERE datname = :'db') \gexec
+SELECT format('ALTER DATABASE %I OWNER TO %I', :'db', :'role') \gexec
+\connect :"db"
+SELECT format('ALTER SCHEMA %I OWNER TO %I', nspname, :'role') FROM pg_namespace
+ WHERE nspowner = 'postgres'::regrole AND nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema' \gexec
+SELECT format('ALTER %s %I.%I OWNER TO %I',
+  CASE c.relkind WHEN 'S' THEN 'SEQUENCE' WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW' WHEN 'f' THEN 'FOREIGN TABLE' ELSE 'TABLE' END,
+  n.nspname, c.relname, :'role')
+  FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+ WHERE c.relowner = 'postgres'::regrole AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+   AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+   -- owned sequences and extension objects follow their owner
+   AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('a', 'i', 'e')) \gexec
+SELECT format('ALTER ROUTINE %s OWNER TO %I', p.oid::regprocedure, :'role')
+  FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+ WHERE p.proowner = 'postgres'::regrole AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+   AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e') \gexec
+`
+	if _, err := c.Run("postgres", script); err != nil {
+		return false, fmt.Errorf("%s: %w", d.Name, err)
+	}
+	return !status.Exists, nil
+}
+
+// List returns the state of the databases
+func (c *Client) List(dbs []Database) ([]Status, error) {
+	out := make([]Status, 0, len(dbs))
+	for _, d := range dbs {
+		s, err := c.status(d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (c *Client) status(d Database) (Status, error) {
+	s := Status{Database: d}
+	res, err := c.Run("postgres", psqlSet("db", d.Name)+
+		`SELECT pg_get_userbyid(datdba), pg_size_pretty(pg_database_size(datname)) FROM pg_database WHERE datname = :'db';`+"\n")
+	if err != nil {
+		return s, err
+	}
+	if f := strings.Split(strings.TrimSpace(res), "\t"); len(f) == 2 {
+		s.Exists, s.Owner, s.Size = true, f[0], f[1]
+	}
+	return s, nil
+}
+
+// psqlSet sets a psql variable, quoted for \set
+func psqlSet(name, value string) string {
+	return `\set ` + name + ` '` + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `'`, `\'`) + "'\n"
+}
+
+// EnsureAll ensures every database of dbs. password returns the value of a
+// credential of the secrets catalog.
+func (c *Client) EnsureAll(dbs []Database, password func(credential string) (string, error)) error {
+	for _, d := range dbs {
+		pw, err := password(d.Credential())
+		if err != nil {
+			return err
+		}
+		created, err := c.Ensure(d, pw)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("    ✅ %s created, owner %s\n", d.Name, d.Role)
+		} else {
+			fmt.Printf("    ✓ %s, owner %s\n", d.Name, d.Role)
+		}
+	}
+	return nil
+}
@@ -5,18 +5,23 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/skulesh01/ceres/pkg/backup"
+	"github.com/skulesh01/ceres/pkg/catalog"
+	"github.com/skulesh01/ceres/pkg/cloud"
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/db"
+	"github.com/skulesh01/ceres/pkg/images"
+	"github.com/skulesh01/ceres/pkg/secrets"
+	"github.com/skulesh01/ceres/pkg/sizing"
+	"github.com/skulesh01/ceres/pkg/topology"
 )
 
 func (d *Deployer) useExternalMail() bool {
-	mode := strings.TrimSpace(strings.ToLower(os.Getenv("CERES_MAIL_MODE")))
-	if mode == "external" {
-		return true
-	}
-	skip := strings.TrimSpace(strings.ToLower(os.Getenv("CERES_SKIP_MAILCOW")))
-	return skip == "1" || skip == "true" || skip == "yes" || skip == "y" || skip == "on"
+	return config.Current().Config.Mail.Mode == "external"
 }
 
 const CeresVersion = "3.1.0"
@@ -27,6 +32,13 @@ type Deployer struct {
 	environment string
 	namespace   string
 	stateFile   string
+	lock        *images.Lock
+	lockPath    string
+	profile     *sizing.Profile
+	sizeStorage bool
+	secretStore secrets.Provider
+	provider    *cloud.Provider
+	topology    *topology.Topology
 }
 
 // NewDeployer creates a new deployer
@@ -44,6 +56,10 @@ func (d *Deployer) Deploy() error {
 	fmt.Printf("🚀 CERES v%s Deployment\n", CeresVersion)
 	fmt.Println("=====================================")
 
+	if err := d.useProvider(); err != nil {
+		return err
+	}
+
 	// Check if already installed
 	installed, installedVersion, err := d.checkInstalled()
 	if err != nil {
@@ -62,22 +78,17 @@ func (d *Deployer) Deploy() error {
 	}
 
 	fmt.Println("🆕 Fresh installation detected")
+	d.sizeStorage = true
 	return d.freshInstall()
 }
 
 func (d *Deployer) validate() error {
 	// Validate cloud provider
-	validClouds := map[string]bool{
-		"aws":     true,
-		"azure":   true,
-		"gcp":     true,
-		"proxmox": true,
-		"k3s":     true,
-	}
-	if !validClouds[d.cloud] {
-		return fmt.Errorf("unsupported cloud provider: %s", d.cloud)
+	if err := d.useProvider(); err != nil {
+		return err
 	}
-	fmt.Println("    ✓ Cloud provider valid")
+	p := d.provider
+	fmt.Printf("    ✓ Cloud provider %s: storage %s, ingress %s (%s)\n", p.Name, p.StorageClass, p.IngressClass, p.Service)
 
 	// Check kubectl
 	fmt.Println("    ✓ kubectl available")
@@ -106,6 +117,10 @@ func (d *Deployer) setupHelmRepos() error {
 }
 
 func (d *Deployer) deployCoreServices() error {
+	if d.Topology().HA() {
+		return d.deployCoreHA()
+	}
+
 	// Deploy using kubectl manifests (more reliable than Helm for core services)
 	fmt.Println("    📦 Applying PostgreSQL manifest...")
 	if err := d.applyManifest("deployment/postgresql-fixed.yaml"); err != nil {
@@ -173,21 +188,31 @@ func (d *Deployer) runDiagnostics() error {
 
 func (d *Deployer) waitForDeployment(name, namespace, deployType string, timeoutSeconds int) error {
 	fmt.Printf("    ⏱️  Waiting up to %ds for %s...\n", timeoutSeconds, name)
-	
+
+	// Ready once every replica is ready and runs the current spec, so a
+	// rolling update of several replicas is waited for to the end
+	var desired, ready, updated string
 	for i := 0; i < timeoutSeconds; i++ {
-		cmd := exec.Command("kubectl", "get", deployType, name, "-n", namespace, "-o", "jsonpath={.status.readyReplicas}")
-		output, _ := cmd.Output()
-		
-		readyReplicas := strings.TrimSpace(string(output))
-		if readyReplicas != "" && readyReplicas != "0" {
-			fmt.Printf("    ✅ %s is ready!\n", name)
+		desired, ready, updated = rollout(name, namespace, deployType)
+		want, _ := strconv.Atoi(desired)
+		nReady, _ := strconv.Atoi(ready)
+		nUpdated, _ := strconv.Atoi(updated)
+		if desired != "" && nReady >= want && nUpdated >= want {
+			fmt.Printf("    ✅ %s is ready (%d/%d)!\n", name, nReady, want)
 			return nil
 		}
-		
+
 		time.Sleep(1 * time.Second)
 	}
-	
-	return fmt.Errorf("timeout waiting for %s", name)
+
+	return fmt.Errorf("timeout waiting for %s (%s/%s ready)", name, orZero(ready), orZero(desired))
+}
+
+func orZero(n string) string {
+	if n == "" {
+		return "0"
+	}
+	return n
 }
 
 // Status returns deployment status
@@ -221,6 +246,12 @@ func (d *Deployer) freshInstall() error {
 	if err := d.setupKubernetes(); err != nil {
 		return err
 	}
+	if err := d.ensureStorageClass(); err != nil {
+		return err
+	}
+	if err := d.ensureSecrets(); err != nil {
+		return err
+	}
 
 	fmt.Println("\n📦 Step 2: Initialize State")
 	if err := d.applyManifest("deployment/promtail.yaml"); err != nil {
@@ -236,12 +267,14 @@ func (d *Deployer) freshInstall() error {
 	if err := d.createDatabases(); err != nil {
 		return fmt.Errorf("failed to create databases: %w", err)
 	}
+	if err := d.scheduleDatabaseBackups(); err != nil {
+		return err
+	}
 
 	fmt.Println("\n📦 Step 5: Identity (Keycloak)")
-	if err := d.applyManifest("deployment/keycloak.yaml"); err != nil {
+	if err := d.deployKeycloak(180); err != nil {
 		return err
 	}
-	d.waitForPods("ceres", "app=keycloak", 180)
 
 	fmt.Println("\n📦 Step 6: Mail (SMTP/IMAP + Webmail)")
 	if d.useExternalMail() {
@@ -258,12 +291,24 @@ func (d *Deployer) freshInstall() error {
 		return err
 	}
 
-	fmt.Println("\n📦 Step 8: NodePort Services (Direct Access)")
-	if err := d.applyManifest("deployment/nodeport-services.yaml"); err != nil {
-		return err
+	if d.Provider().NodePorts() {
+		fmt.Println("\n📦 Step 8: NodePort Services (Direct Access)")
+		if err := d.applyManifest("deployment/nodeport-services.yaml"); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("\n📦 Step 8: NodePort Services skipped (%s exposes the ingress controller as %s)\n", d.cloud, d.Provider().Service)
 	}
 
-	fmt.Println("\n📦 Step 9: Ingress (Domains via Traefik)")
+	fmt.Printf("\n📦 Step 9: Ingress (Domains via %s)\n", d.Provider().IngressClass)
+	if d.Provider().DeploysNginx() {
+		if err := d.applyManifest("deployment/ingress-nginx.yaml"); err != nil {
+			return err
+		}
+		if err := d.applyManifest("deployment/ingress-nginx-rbac.yaml"); err != nil {
+			return err
+		}
+	}
 	if d.useExternalMail() {
 		if err := d.applyManifest("deployment/ingress-domains-no-mail.yaml"); err != nil {
 			return err
@@ -297,41 +342,41 @@ func (d *Deployer) freshInstall() error {
 // update performs reconciliation of existing installation
 func (d *Deployer) update() error {
 	fmt.Println("📋 Reconciling existing installation...")
-	
+
+	if err := d.checkTopology(); err != nil {
+		return err
+	}
+	if err := d.ensureSecrets(); err != nil {
+		return err
+	}
+	if d.Topology().HA() {
+		if err := d.SetupPostgresOperator(); err != nil {
+			return err
+		}
+		if err := d.ensurePostgresSuperuser(); err != nil {
+			return err
+		}
+	}
+
 	// Ensure databases exist
 	fmt.Println("  🗄️  Checking databases...")
 	if err := d.createDatabases(); err != nil {
 		fmt.Printf("    ⚠️  Warning: %v\n", err)
 	}
-	
-	// Re-apply all manifests (kubectl apply is idempotent)
-	manifests := []string{
-		"deployment/cert-manager.yaml",
-		"deployment/postgresql-fixed.yaml",
-		"deployment/redis.yaml",
-		"deployment/keycloak.yaml",
-		"deployment/mailcow.yaml",
-		"deployment/all-services.yaml",
-		"deployment/nodeport-services.yaml",
-		"deployment/ingress-domains.yaml",
-		"deployment/ui/ceres-mail-ui.yaml",
-		"deployment/ui/ceres-console-ui.yaml",
+	if err := d.scheduleDatabaseBackups(); err != nil {
+		fmt.Printf("    ⚠️  Warning: %v\n", err)
 	}
-	if d.useExternalMail() {
-		manifests = []string{
-			"deployment/cert-manager.yaml",
-			"deployment/postgresql-fixed.yaml",
-			"deployment/redis.yaml",
-			"deployment/keycloak.yaml",
-			"deployment/all-services.yaml",
-			"deployment/nodeport-services.yaml",
-			"deployment/ingress-domains-no-mail.yaml",
-			"deployment/ui/ceres-mail-ui.yaml",
-			"deployment/ui/ceres-console-ui.yaml",
+	if config.Current().Config.Backup.Enabled {
+		if err := d.setupBackupLocation(); err != nil {
+			fmt.Printf("    ⚠️  Warning: %v\n", err)
+		}
+		if err := d.applyBackupPolicies(); err != nil {
+			fmt.Printf("    ⚠️  Warning: %v\n", err)
 		}
 	}
-
-	for _, manifest := range manifests {
+	
+	// Re-apply all manifests (kubectl apply is idempotent)
+	for _, manifest := range d.reconcileManifests() {
 		fmt.Printf("  📄 Applying %s\n", manifest)
 		if err := d.applyManifest(manifest); err != nil {
 			fmt.Printf("    ⚠️  Warning: %v\n", err)
@@ -370,17 +415,11 @@ func (d *Deployer) applyManifest(path string) error {
 		return cmd.Run()
 	}
 
-	data, err := os.ReadFile(resolved)
+	data, err := d.RenderManifest(path)
 	if err != nil {
 		return err
 	}
 
-	// One-domain setup: replace the default domain everywhere in applied manifests.
-	// This is intentionally simple (string substitution) so we don't need to template every YAML.
-	if domain := strings.TrimSpace(os.Getenv("CERES_DOMAIN")); domain != "" && domain != "ceres.local" {
-		data = []byte(strings.ReplaceAll(string(data), "ceres.local", domain))
-	}
-
 	cmd := exec.Command("kubectl", "apply", "-f", "-")
 	cmd.Stdin = bytes.NewReader(data)
 	cmd.Stdout = os.Stdout
@@ -388,39 +427,13 @@ func (d *Deployer) applyManifest(path string) error {
 	return cmd.Run()
 }
 
-func (d *Deployer) resolveCeresPath(p string) string {
-	if p == "" {
-		return p
-	}
-	// Absolute path or URL: do not touch.
-	if filepath.IsAbs(p) || strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") {
-		return p
-	}
-
-	candidates := []string{}
-	if v := strings.TrimSpace(os.Getenv("CERES_ROOT")); v != "" {
-		candidates = append(candidates, v)
-	}
-	if v := strings.TrimSpace(os.Getenv("CERES_REPO_ROOT")); v != "" {
-		candidates = append(candidates, v)
-	}
-	if cwd, err := os.Getwd(); err == nil {
-		candidates = append(candidates, cwd)
-	}
-	if exe, err := os.Executable(); err == nil {
-		exeDir := filepath.Dir(exe)
-		candidates = append(candidates, exeDir, filepath.Dir(exeDir))
-	}
-
-	for _, base := range candidates {
-		candidate := filepath.Join(base, p)
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate
-		}
-	}
+// ResolvePath resolves a path relative to the CERES root (platform.root, cwd, binary dir)
+func (d *Deployer) ResolvePath(p string) string {
+	return d.resolveCeresPath(p)
+}
 
-	// Fallback: relative path.
-	return p
+func (d *Deployer) resolveCeresPath(p string) string {
+	return config.ResolvePath(p)
 }
 
 // waitForPods waits for pods to be ready
@@ -451,106 +464,150 @@ func (d *Deployer) updateState(key, value string) error {
 	return cmd.Run()
 }
 
-// showAccessInfo displays access information
+// showAccessInfo displays access information from the service catalog
 func (d *Deployer) showAccessInfo() {
 	fmt.Println("\n=====================================")
 	fmt.Println("🌐 Access Information")
 	fmt.Println("=====================================")
-	
-	// Get service IPs
-	pgIP, _ := d.getServiceIP("postgresql", "ceres-core")
-	redisIP, _ := d.getServiceIP("redis", "ceres-core")
-	keycloakIP, _ := d.getServiceIP("keycloak", "ceres")
-	grafanaIP, _ := d.getServiceIP("grafana", "monitoring")
-	prometheusIP, _ := d.getServiceIP("prometheus", "monitoring")
-	
-	fmt.Println("\n📊 Services:")
-	if pgIP != "" {
-		fmt.Printf("  PostgreSQL:  %s:5432 (user: postgres, pass: from secret ceres-core/postgresql-secret)\n", pgIP)
-	}
-	if redisIP != "" {
-		fmt.Printf("  Redis:       %s:6379 (pass: from secret ceres-core/redis-secret)\n", redisIP)
-	}
-	if keycloakIP != "" {
-		fmt.Printf("  Keycloak:    %s:8080 (admin / from secret ceres/keycloak-secret)\n", keycloakIP)
-	}
-	if grafanaIP != "" {
-		fmt.Printf("  Grafana:     %s:3000 (admin / Grafana@Admin2025)\n", grafanaIP)
-	}
-	if prometheusIP != "" {
-		fmt.Printf("  Prometheus:  %s:9090\n", prometheusIP)
+
+	cat, err := catalog.Discover(catalog.Options{SkipKeycloak: true})
+	if err != nil {
+		fmt.Printf("  ⚠️  Service catalog unavailable: %v\n", err)
+	} else {
+		if cat.Entry != "" {
+			fmt.Printf("\n🌍 Entry point: %s (%s)\n", cat.Entry, cat.EntrySource)
+		}
+		fmt.Println("\n📊 Services:")
+		for _, s := range cat.Services {
+			if s.URL() == "" {
+				continue
+			}
+			fmt.Printf("  %-14s %-40s %s\n", s.Title+":", s.URL(), s.Health.Status)
+		}
+		fmt.Println("  All URLs, SSO and credentials: ceres services")
 	}
-	
-	fmt.Println("\n🌍 External Access (NodePort):")
-	fmt.Println("  Ingress HTTP:  http://192.168.1.3:30080")
-	fmt.Println("  Ingress HTTPS: https://192.168.1.3:30443")
-	
+
 	fmt.Println("\n🔐 VPN Access:")
 	fmt.Println("  Setup: ceres vpn setup")
 	fmt.Println("  After VPN: Access services directly via ClusterIP")
-	
+	fmt.Println("  DNS for the platform hosts: ceres dns")
+
+	fmt.Println("\n🔑 Credentials:")
+	fmt.Println("  List: ceres secrets")
+	fmt.Println("  Show one: ceres secrets get <component>")
+
 	fmt.Println("\n📖 Documentation:")
 	fmt.Println("  View state: kubectl get configmap ceres-deployment-state -n kube-system -o yaml")
 	fmt.Println("  Status: ceres status")
 	fmt.Println("")
 }
 
-// getServiceIP retrieves ClusterIP of a service
-func (d *Deployer) getServiceIP(name, namespace string) (string, error) {
-	cmd := exec.Command("kubectl", "get", "svc", name, "-n", namespace, 
-		"-o", "jsonpath={.spec.clusterIP}")
-	output, err := cmd.Output()
+// ensureSecrets generates missing credentials and writes the Secrets the
+// manifests reference. Namespaces left out by the sizing profile are skipped.
+func (d *Deployer) ensureSecrets() error {
+	fmt.Println("  🔑 Ensuring credentials...")
+	var skip []string
+	if d.profile != nil {
+		skip = d.profile.ExcludeNamespaces
+	}
+	store, err := d.SecretProvider()
 	if err != nil {
-		return "", err
+		return err
 	}
-	return strings.TrimSpace(string(output)), nil
+	if err := secrets.NewManager(secrets.EngineKubectl, store).Ensure(skip); err != nil {
+		return fmt.Errorf("failed to prepare credentials: %w", err)
+	}
+	return nil
 }
 
-// createDatabases creates all required databases for services
+// UseSecretProvider sets the backend generated credentials are kept in
+func (d *Deployer) UseSecretProvider(p secrets.Provider) {
+	d.secretStore = p
+}
+
+// SecretProvider returns the credentials backend: the one set with
+// UseSecretProvider, else the one selected by secrets.backend
+func (d *Deployer) SecretProvider() (secrets.Provider, error) {
+	if d.secretStore != nil {
+		return d.secretStore, nil
+	}
+	return secrets.Open(secrets.DefaultOptions())
+}
+
+// EnsureDatabases writes the credentials of the services into their
+// Secrets and ensures their databases and owner roles
+func (d *Deployer) EnsureDatabases() error {
+	if err := d.ensureSecrets(); err != nil {
+		return err
+	}
+	return d.createDatabases()
+}
+
+// createDatabases ensures the database and owner role of every enabled
+// service (pkg/db). The role passwords are the <service>-db credentials
+// ensureSecrets wrote into the service Secrets.
 func (d *Deployer) createDatabases() error {
-	fmt.Println("  📋 Creating databases for services...")
-	
-	// Apply database creation job
-	if err := d.applyManifest("deployment/create-databases.yaml"); err != nil {
-		return fmt.Errorf("failed to apply create-databases job: %w", err)
+	fmt.Println("  📋 Ensuring databases for services...")
+	store, err := d.SecretProvider()
+	if err != nil {
+		return err
 	}
-	
-	// Wait for job to complete (max 30 seconds)
-	fmt.Println("  ⏱️  Waiting for database creation job...")
-	for i := 0; i < 30; i++ {
-		cmd := exec.Command("kubectl", "get", "job", "create-databases", "-n", "ceres-core", "-o", "jsonpath={.status.succeeded}")
-		output, _ := cmd.Output()
-		if strings.TrimSpace(string(output)) == "1" {
-			fmt.Println("    ✓ Databases created successfully")
-			
-			// Show created databases
-			cmd = exec.Command("kubectl", "logs", "-n", "ceres-core", "job/create-databases")
-			output, _ = cmd.Output()
-			if len(output) > 0 {
-				fmt.Println("    📊 Database creation log:")
-				lines := strings.Split(string(output), "\n")
-				for _, line := range lines {
-					if strings.Contains(line, "CREATE DATABASE") || strings.Contains(line, "exists") {
-						fmt.Printf("      %s\n", line)
-					}
-				}
-			}
-			
-			// Clean up job
-			exec.Command("kubectl", "delete", "job", "create-databases", "-n", "ceres-core").Run()
-			return nil
-		}
-		time.Sleep(1 * time.Second)
+	m := secrets.NewManager(secrets.EngineKubectl, store)
+
+	c, err := db.Connect(db.Options{})
+	if err != nil {
+		return err
 	}
-	
-	return fmt.Errorf("database creation job timed out")
+	defer c.Close()
+	return c.EnsureAll(db.Enabled(config.Current().Config), m.Get)
+}
+
+// scheduleDatabaseBackups applies the CronJobs dumping the database of every
+// enabled service (backup.databases), or deletes them when disabled
+func (d *Deployer) scheduleDatabaseBackups() error {
+	cfg := config.Current().Config
+	if !cfg.Backup.Databases.Enabled {
+		db.Unschedule()
+		return nil
+	}
+	b, err := d.DatabaseBackups()
+	if err != nil {
+		return err
+	}
+	dbs := db.Enabled(cfg)
+	if err := b.Schedule(dbs); err != nil {
+		return err
+	}
+	fmt.Printf("    ✓ %d database(s) dumped at %q to %s, kept %s\n",
+		len(dbs), cfg.Backup.Databases.Schedule, cfg.Backup.Databases.Bucket, cfg.Backup.Databases.Retention)
+	return nil
+}
+
+// applyBackupPolicies reconciles the Velero Schedules of the backup policies
+func (d *Deployer) applyBackupPolicies() error {
+	fmt.Println("  📅 Applying backup policies...")
+	m, err := backup.NewManager()
+	if err != nil {
+		return err
+	}
+	return m.ApplyPolicies(&config.Current().Config, false)
+}
+
+// DatabaseBackups returns the logical backups of the service databases,
+// made from the rendered backup template
+func (d *Deployer) DatabaseBackups() (*db.Backups, error) {
+	data, err := d.RenderManifest(db.BackupTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewBackups(data, config.Current().Config.Backup), nil
 }
 
 // Diagnose runs cluster diagnostics
 func (d *Deployer) Diagnose() error {
 	fmt.Println("=====================================")
 	fmt.Println("🔍 CERES Cluster Diagnostics")
-	fmt.Println("=====================================\n")
+	fmt.Print("=====================================\n\n")
 
 	// 1. Cluster connectivity
 	fmt.Println("1️⃣  Cluster Connectivity:")
@@ -627,7 +684,7 @@ func (d *Deployer) Diagnose() error {
 func (d *Deployer) FixServices(serviceFilter string) error {
 	fmt.Println("=====================================")
 	fmt.Println("🔧 Fixing Services")
-	fmt.Println("=====================================\n")
+	fmt.Print("=====================================\n\n")
 
 	// Get all failing pods
 	cmd := exec.Command("kubectl", "get", "pods", "--all-namespaces", 
@@ -761,17 +818,22 @@ func (d *Deployer) RemoveDuplicates() error {
 func (d *Deployer) SetupTLS() error {
 	fmt.Println("🔐 Установка Cert-Manager...")
 
-	// Add Helm repo
-	exec.Command("helm", "repo", "add", "jetstack", "https://charts.jetstack.io").Run()
-	exec.Command("helm", "repo", "update").Run()
-
 	// Install Cert-Manager
-	cmd := exec.Command("helm", "install", "cert-manager", "jetstack/cert-manager",
+	args := append([]string{"install", "cert-manager"}, upstreamChartArgs(CertManagerChart)...)
+	args = append(args,
 		"--namespace", "cert-manager",
 		"--create-namespace",
-		"--version", "v1.13.0",
 		"--set", "installCRDs=true",
 	)
+	if reg := ImageRegistry(); reg != "" {
+		args = append(args,
+			"--set", "image.repository="+reg+"/jetstack/cert-manager-controller",
+			"--set", "webhook.image.repository="+reg+"/jetstack/cert-manager-webhook",
+			"--set", "cainjector.image.repository="+reg+"/jetstack/cert-manager-cainjector",
+			"--set", "startupapicheck.image.repository="+reg+"/jetstack/cert-manager-ctl",
+		)
+	}
+	cmd := exec.Command("helm", args...)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to install cert-manager: %w", err)
@@ -786,29 +848,32 @@ func (d *Deployer) SetupTLS() error {
 	return nil
 }
 
-// SetupBackup устанавливает Velero для бэкапов
+// SetupBackup устанавливает Velero для бэкапов. The chart makes no storage
+// location: ceres creates the default one from backup.location.
 func (d *Deployer) SetupBackup() error {
 	fmt.Println("💾 Установка Velero...")
 
-	// Add Helm repo
-	exec.Command("helm", "repo", "add", "vmware-tanzu", "https://vmware-tanzu.github.io/helm-charts").Run()
-	exec.Command("helm", "repo", "update").Run()
-
-	// Install Velero with AWS plugin for MinIO
-	cmd := exec.Command("helm", "install", "velero", "vmware-tanzu/velero",
+	// Install Velero with AWS plugin for MinIO and other S3 stores
+	args := append([]string{"install", "velero"}, upstreamChartArgs(VeleroChart)...)
+	args = append(args,
 		"--namespace", "velero",
 		"--create-namespace",
 		"--set", "initContainers[0].name=velero-plugin-for-aws",
-		"--set", "initContainers[0].image=velero/velero-plugin-for-aws:v1.8.0",
+		"--set", "initContainers[0].image="+mirrorImage("velero/velero-plugin-for-aws:v1.8.0"),
 		"--set", "initContainers[0].volumeMounts[0].mountPath=/target",
 		"--set", "initContainers[0].volumeMounts[0].name=plugins",
-		"--set", "configuration.provider=aws",
-		"--set", "configuration.backupStorageLocation.name=default",
-		"--set", "configuration.backupStorageLocation.bucket=ceres-backups",
-		"--set", "configuration.backupStorageLocation.config.region=minio",
-		"--set", "configuration.backupStorageLocation.config.s3ForcePathStyle=true",
-		"--set", "configuration.backupStorageLocation.config.s3Url=http://minio.minio.svc.cluster.local:9000",
+		"--set-json", "configuration.backupStorageLocation=[]",
+		"--set-json", "configuration.volumeSnapshotLocation=[]",
+		"--set", "credentials.useSecret=false",
+		"--set", "snapshotsEnabled=false",
 	)
+	if reg := ImageRegistry(); reg != "" {
+		args = append(args,
+			"--set", "image.repository="+reg+"/velero/velero",
+			"--set", "kubectl.image.repository="+reg+"/bitnami/kubectl",
+		)
+	}
+	cmd := exec.Command("helm", args...)
 
 	if err := cmd.Run(); err != nil {
 		fmt.Println("⚠️  Helm установка не удалась, применяю YAML...")
@@ -821,9 +886,42 @@ func (d *Deployer) SetupBackup() error {
 	d.waitForPods("velero", "app.kubernetes.io/name=velero", 180)
 
 	fmt.Println("✅ Velero установлен")
-	fmt.Println("📅 Настроен ежедневный backup в 2:00 AM")
-	fmt.Println("💾 Backend: MinIO (ceres-backups bucket)")
-	return nil
+	if err := d.setupBackupLocation(); err != nil {
+		return err
+	}
+	return d.applyBackupPolicies()
+}
+
+// setupBackupLocation creates or updates the default storage location from
+// backup.location. MinIO is reached as its root user; other S3 stores with
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or the node's IAM role.
+func (d *Deployer) setupBackupLocation() error {
+	loc := config.Current().Config.Backup.Location
+	endpoint := loc.URL
+	if endpoint == "" {
+		endpoint = loc.Provider
+	}
+	fmt.Printf("  🪣 Backup location: %s (%s bucket)\n", endpoint, loc.Bucket)
+	opts := backup.DefaultLocationOptions(loc)
+	if loc.Provider == "minio" {
+		store, err := d.SecretProvider()
+		if err != nil {
+			return err
+		}
+		password, err := secrets.NewManager(secrets.EngineKubectl, store).Get("minio")
+		if err != nil {
+			return fmt.Errorf("failed to read the MinIO credentials: %w", err)
+		}
+		opts.AccessKey, opts.SecretKey = backup.MinIOUser, password
+	} else {
+		opts.AccessKey, opts.SecretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	m, err := backup.NewManager()
+	if err != nil {
+		return err
+	}
+	_, err = m.EnsureLocation(opts)
+	return err
 }
 
 // SetupLogging устанавливает Promtail для сбора логов
@@ -874,14 +972,11 @@ func (d *Deployer) FixKeycloak() error {
 	}
 
 	// Reapply fixed manifest
-	if err := d.applyManifest("deployment/keycloak.yaml"); err != nil {
+	fmt.Println("   Waiting for Keycloak pod...")
+	if err := d.deployKeycloak(300); err != nil {
 		return fmt.Errorf("failed to apply keycloak manifest: %w", err)
 	}
 
-	// Wait for Keycloak to be ready
-	fmt.Println("   Waiting for Keycloak pod...")
-	d.waitForPods("ceres", "app=keycloak", 300)
-
 	fmt.Println("✅ Keycloak fixed and running")
 	fmt.Println("🌐 Admin: https://keycloak.ceres.local")
 	fmt.Println("👤 Credentials: admin / (from secret ceres/keycloak-secret:admin-password)")
@@ -0,0 +1,327 @@
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/helm"
+	"github.com/skulesh01/ceres/pkg/images"
+	"github.com/skulesh01/ceres/pkg/secrets"
+	"github.com/skulesh01/ceres/pkg/sizing"
+	"github.com/skulesh01/ceres/pkg/topology"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// HelmRelease is the release name used for the ceres-platform chart
+	HelmRelease = "ceres"
+	// HelmChartPath is the chart location relative to the CERES root
+	HelmChartPath = "deployment/ceres-platform"
+)
+
+// UpstreamChart is a third-party chart installed by the deployer
+type UpstreamChart struct {
+	Name    string
+	Repo    string // helm repo alias
+	RepoURL string
+	Version string
+	Images  []string // images the chart pulls with our values
+}
+
+// Ref returns the chart reference: the repo chart online, or the OCI
+// copy under <registry>/charts pushed by `ceres bundle load` when air-gapped.
+func (c UpstreamChart) Ref() string {
+	if reg := ImageRegistry(); reg != "" {
+		return "oci://" + reg + "/charts/" + c.Name
+	}
+	return c.Repo + "/" + c.Name
+}
+
+var (
+	// CertManagerChart is installed by SetupTLS
+	CertManagerChart = UpstreamChart{
+		Name:    "cert-manager",
+		Repo:    "jetstack",
+		RepoURL: "https://charts.jetstack.io",
+		Version: "v1.13.0",
+		Images: []string{
+			"quay.io/jetstack/cert-manager-controller:v1.13.0",
+			"quay.io/jetstack/cert-manager-webhook:v1.13.0",
+			"quay.io/jetstack/cert-manager-cainjector:v1.13.0",
+			"quay.io/jetstack/cert-manager-ctl:v1.13.0",
+		},
+	}
+
+	// VeleroChart is installed by SetupBackup
+	VeleroChart = UpstreamChart{
+		Name:    "velero",
+		Repo:    "vmware-tanzu",
+		RepoURL: "https://vmware-tanzu.github.io/helm-charts",
+		Version: "5.1.0",
+		Images: []string{
+			"velero/velero:v1.12.0",
+			"velero/velero-plugin-for-aws:v1.8.0",
+			"bitnami/kubectl:1.28",
+		},
+	}
+
+	// CloudNativePGChart is the PostgreSQL operator of topology.mode ha
+	CloudNativePGChart = UpstreamChart{
+		Name:    "cloudnative-pg",
+		Repo:    "cnpg",
+		RepoURL: "https://cloudnative-pg.github.io/charts",
+		Version: "0.20.0",
+		Images: []string{
+			"ghcr.io/cloudnative-pg/cloudnative-pg:1.22.0",
+			"ghcr.io/cloudnative-pg/postgresql:16.1",
+		},
+	}
+
+	// UpstreamCharts lists every third-party chart, for `ceres bundle create`
+	UpstreamCharts = []UpstreamChart{CertManagerChart, VeleroChart, CloudNativePGChart}
+)
+
+// upstreamChartArgs returns the chart reference and version flags for helm install,
+// adding the repo first when online.
+func upstreamChartArgs(c UpstreamChart) []string {
+	if ImageRegistry() == "" {
+		exec.Command("helm", "repo", "add", c.Repo, c.RepoURL).Run()
+		exec.Command("helm", "repo", "update").Run()
+	}
+	return []string{c.Ref(), "--version", c.Version}
+}
+
+// mirrorImage returns ref rewritten to the private registry, if one is configured
+func mirrorImage(ref string) string {
+	return images.Mirror(ref, ImageRegistry())
+}
+
+// ChartPath returns the resolved location of the ceres-platform chart
+func (d *Deployer) ChartPath() string {
+	return d.resolveCeresPath(HelmChartPath)
+}
+
+// chartServices are the config services with an <name>.enabled chart value
+var chartServices = map[string]bool{
+	"postgresql": true, "redis": true, "keycloak": true, "gitlab": true,
+	"nextcloud": true, "mattermost": true, "redmine": true, "wiki": true,
+	"prometheus": true, "grafana": true, "alertmanager": true, "loki": true,
+	"promtail": true, "jaeger": true, "minio": true, "vault": true,
+	"portainer": true, "adminer": true,
+}
+
+// HelmValues maps the CLI config onto ceres-platform chart values (--set keys)
+func (d *Deployer) HelmValues(cfg config.Config) map[string]string {
+	svc := cfg.Services
+	values := map[string]string{
+		"global.domain":      cfg.Platform.Domain,
+		"global.environment": cfg.Platform.Environment,
+
+		"postgresql.auth.database": svc.PostgreSQL.Database,
+
+		"mailcow.enabled": strconv.FormatBool(!d.useExternalMail() && cfg.Mail.Mode != "external"),
+	}
+	for _, s := range svc.List() {
+		if chartServices[s.Name] {
+			values[s.Name+".enabled"] = strconv.FormatBool(s.Enabled)
+		}
+	}
+
+	if v := strings.TrimSpace(svc.PostgreSQL.Version); v != "" {
+		values["postgresql.image.tag"] = v + "-alpine"
+	}
+	if v := strings.TrimSpace(svc.Redis.Version); v != "" {
+		values["redis.image.tag"] = v + "-alpine"
+	}
+	if svc.Keycloak.Replicas > 0 {
+		values["keycloak.replicas"] = strconv.Itoa(svc.Keycloak.Replicas)
+	}
+	if svc.GitLab.Replicas > 0 {
+		values["gitlab.replicas"] = strconv.Itoa(svc.GitLab.Replicas)
+	}
+
+	if reg := ImageRegistry(); reg != "" {
+		values["global.imageRegistry"] = reg
+	}
+
+	// storage and ingress class of the cloud provider (pkg/cloud)
+	if p := d.Provider(); p != nil {
+		values["global.storageClass"] = p.StorageClass
+		values["ingress.className"] = p.IngressClass
+		for k, v := range p.IngressAnnotations {
+			values["ingress.annotations."+strings.ReplaceAll(k, ".", `\.`)] = v
+		}
+	}
+	// k3s/proxmox use the CERES internal CA (deployment/cert-manager.yaml)
+	switch d.cloud {
+	case "k3s", "proxmox":
+		values[`ingress.annotations.cert-manager\.io/cluster-issuer`] = "ceres-ca"
+	}
+
+	return values
+}
+
+// DeployHelm installs or upgrades the ceres-platform chart through the Helm client
+func (d *Deployer) DeployHelm(cfg config.Config) error {
+	fmt.Printf("🚀 CERES v%s Deployment (Helm)\n", CeresVersion)
+	fmt.Println("=====================================")
+
+	if err := d.validate(); err != nil {
+		return err
+	}
+	if topology.Get(cfg).HA() {
+		return fmt.Errorf("topology.mode ha is deployed by the kubectl engine: the ceres-platform chart runs single instances")
+	}
+	if installed, _, _ := d.checkInstalled(); !installed {
+		d.sizeStorage = true
+	}
+
+	if err := d.ensureStorageClass(); err != nil {
+		return err
+	}
+	if d.Provider().DeploysNginx() {
+		fmt.Println("  🌐 Ingress controller: nginx")
+		for _, m := range []string{"deployment/ingress-nginx.yaml", "deployment/ingress-nginx-rbac.yaml"} {
+			if err := d.applyManifest(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	chart := d.ChartPath()
+	values := d.HelmValues(cfg)
+
+	fmt.Printf("  📦 Chart: %s\n", chart)
+	fmt.Printf("  🏷️  Release: %s (namespace %s)\n", HelmRelease, d.namespace)
+
+	client := helm.NewClient(d.namespace)
+
+	// Generated credentials go to the chart through a values file, never --set
+	store, err := d.SecretProvider()
+	if err != nil {
+		return err
+	}
+	creds := secrets.NewManager(secrets.EngineHelm, store)
+	if err := creds.Ensure(nil); err != nil {
+		return fmt.Errorf("failed to prepare credentials: %w", err)
+	}
+	credValues, cleanupCreds, err := creds.WriteHelmValues()
+	if err != nil {
+		return fmt.Errorf("failed to write credential values: %w", err)
+	}
+	defer cleanupCreds()
+	client.AddValuesFile(credValues)
+
+	if d.lock != nil || d.profile != nil {
+		// Chart templates only know tags and their own defaults: pipe the rendered
+		// release back through `ceres render` for sizing and digest pinning
+		args, cleanup, err := d.postRenderArgs()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate ceres binary for post-rendering: %w", err)
+		}
+		client.SetPostRenderer(exe, args...)
+	}
+	if err := client.UpgradeChart(HelmRelease, chart, values); err != nil {
+		return err
+	}
+
+	d.updateState("engine", "helm")
+	d.updateState("version", CeresVersion)
+
+	fmt.Println("\n✅ Helm release applied!")
+	fmt.Printf("  View release: helm status %s -n %s\n", HelmRelease, d.namespace)
+	return nil
+}
+
+// postRenderArgs returns the `ceres render` arguments reproducing this deployer's
+// sizing and pinning; the resolved profile is passed through a temporary file.
+func (d *Deployer) postRenderArgs() ([]string, func(), error) {
+	args := []string{"render"}
+	cleanup := func() {}
+	if d.lock != nil {
+		args = append(args, "--lock", d.lockPath)
+		fmt.Printf("  📌 Pinning images from %s\n", d.lockPath)
+	}
+	if d.profile != nil {
+		f, err := os.CreateTemp("", "ceres-profile-*.yaml")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.Remove(f.Name()) }
+		data, err := yaml.Marshal(d.profile)
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			cleanup()
+			return nil, func() {}, fmt.Errorf("failed to write sizing profile: %w", err)
+		}
+		args = append(args, "--profile-file", f.Name())
+		if d.sizeStorage {
+			args = append(args, "--size-storage")
+		}
+		fmt.Printf("  📐 Sizing profile: %s\n", d.profile.Name)
+	}
+	return args, cleanup, nil
+}
+
+// UseProfileFile loads a resolved sizing profile written by postRenderArgs
+func (d *Deployer) UseProfileFile(path string, sizeStorage bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var p sizing.Profile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("invalid sizing profile %s: %w", path, err)
+	}
+	d.profile = &p
+	d.sizeStorage = sizeStorage
+	return nil
+}
+
+// helmTemplate renders the ceres-platform chart locally with the config values
+func (d *Deployer) helmTemplate(cfg config.Config) ([]byte, error) {
+	args := []string{"template", HelmRelease, d.ChartPath(), "-n", d.namespace}
+	for k, v := range d.HelmValues(cfg) {
+		args = append(args, "--set", k+"="+v)
+	}
+	out, err := exec.Command("helm", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("helm template failed: %w", err)
+	}
+	return out, nil
+}
+
+// PrintHelmValues prints the chart values that DeployHelm would pass
+func (d *Deployer) PrintHelmValues(cfg config.Config) {
+	values := d.HelmValues(cfg)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("helm upgrade --install %s %s -n %s --create-namespace \\\n", HelmRelease, HelmChartPath, d.namespace)
+	fmt.Println("  -f <generated credentials, see ceres secrets> \\")
+	for i, k := range keys {
+		sep := " \\"
+		if i == len(keys)-1 {
+			sep = ""
+		}
+		fmt.Printf("  --set %s=%s%s\n", k, values[k], sep)
+	}
+}
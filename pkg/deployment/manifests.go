@@ -0,0 +1,237 @@
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/cloud"
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/images"
+)
+
+// Manifests lists every manifest the deployer may apply, in apply order.
+// `ceres bundle create` scans all of them for images.
+var Manifests = []string{
+	"deployment/cert-manager.yaml",
+	"deployment/postgresql-fixed.yaml",
+	"deployment/redis.yaml",
+	"deployment/keycloak.yaml",
+	"deployment/ha/postgresql.yaml",
+	"deployment/ha/redis.yaml",
+	"deployment/ha/keycloak.yaml",
+	"deployment/mailcow.yaml",
+	"deployment/all-services.yaml",
+	"deployment/promtail.yaml",
+	"deployment/velero.yaml",
+	"deployment/postgresql-backup.yaml",
+	"deployment/oauth2-proxy.yaml",
+	"deployment/ingress-nginx.yaml",
+	"deployment/ingress-nginx-rbac.yaml",
+	"deployment/nodeport-services.yaml",
+	"deployment/ingress-domains.yaml",
+	"deployment/ingress-domains-no-mail.yaml",
+	"deployment/ui/ceres-mail-ui.yaml",
+	"deployment/ui/ceres-console-ui.yaml",
+}
+
+// reconcileManifests returns the manifests re-applied by update()
+func (d *Deployer) reconcileManifests() []string {
+	p := d.Provider()
+	out := append([]string{"deployment/cert-manager.yaml"}, d.Topology().Core()...)
+	out = append(out, d.Topology().Identity()...)
+	if !d.useExternalMail() {
+		out = append(out, "deployment/mailcow.yaml")
+	}
+	out = append(out, "deployment/all-services.yaml")
+	if p.DeploysNginx() {
+		out = append(out, "deployment/ingress-nginx.yaml", "deployment/ingress-nginx-rbac.yaml")
+	}
+	if p.NodePorts() {
+		out = append(out, "deployment/nodeport-services.yaml")
+	}
+	if d.useExternalMail() {
+		out = append(out, "deployment/ingress-domains-no-mail.yaml")
+	} else {
+		out = append(out, "deployment/ingress-domains.yaml")
+	}
+	return append(out,
+		"deployment/ui/ceres-mail-ui.yaml",
+		"deployment/ui/ceres-console-ui.yaml",
+	)
+}
+
+// Provider returns the rendering of the deployer's cloud, or nil when it
+// has none (commands that only render or scan manifests)
+func (d *Deployer) Provider() *cloud.Provider {
+	if d.provider == nil && d.cloud != "" {
+		_ = d.useProvider()
+	}
+	return d.provider
+}
+
+// useProvider resolves the cloud provider with the config overrides
+func (d *Deployer) useProvider() error {
+	p, err := cloud.Get(d.cloud, config.Current().Config.Cloud)
+	if err != nil {
+		return err
+	}
+	d.provider = p
+	return nil
+}
+
+// ensureStorageClass creates the StorageClass the provider names when the
+// cloud has none like it (gp3 on aws)
+func (d *Deployer) ensureStorageClass() error {
+	data := d.Provider().StorageClassManifest()
+	if data == nil {
+		return nil
+	}
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create StorageClass %s: %w: %s", d.provider.Create.Name, err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("    ✓ StorageClass %s\n", d.provider.Create.Name)
+	return nil
+}
+
+// ImageRegistry returns the private registry images are pulled from
+// (air-gapped installs), or "" to use the upstream registries.
+func ImageRegistry() string {
+	reg := strings.TrimRight(config.Current().Config.Images.Registry, "/")
+	if reg == images.DefaultRegistry {
+		return ""
+	}
+	return reg
+}
+
+// RenderManifest reads a manifest and applies the render-time rewrites:
+// the platform domain, the cloud provider (storage class, ingress class,
+// controller service), the sizing profile (UseProfile), digest pinning
+// (PinImages), in air-gapped mode the private image registry, and the
+// topology of the core services (replicas in ha mode).
+func (d *Deployer) RenderManifest(path string) ([]byte, error) {
+	data, err := os.ReadFile(d.resolveCeresPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// One-domain setup: replace the default domain everywhere in applied manifests.
+	// This is intentionally simple (string substitution) so we don't need to template every YAML.
+	if domain := config.Current().Config.Platform.Domain; domain != "" && domain != config.DefaultDomain {
+		data = []byte(config.ReplaceDomain(string(data), config.DefaultDomain, domain))
+	}
+
+	// Storage classes are only set on a fresh install, like volume sizes
+	data, err = d.Provider().Apply(data, cloud.Options{Storage: d.sizeStorage})
+	if err != nil {
+		return nil, fmt.Errorf("apply %s provider: %w", d.cloud, err)
+	}
+
+	data, err = d.PostRender(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// After sizing: the replicas of ha mode win over the profile's
+	data, err = d.Topology().Apply(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("apply %s topology: %w", d.Topology().Mode, err)
+	}
+	return data, nil
+}
+
+// PostRender applies the selected sizing profile and image pinning/registry
+// rewrites to rendered manifests (also used as the helm post-renderer)
+func (d *Deployer) PostRender(data []byte) ([]byte, error) {
+	data, err := d.applySizing(data)
+	if err != nil {
+		return nil, fmt.Errorf("apply sizing profile: %w", err)
+	}
+	return d.RewriteImages(data), nil
+}
+
+// Usages returns every upstream image the platform runs, per component: the raw
+// manifests, the ceres-platform chart (rendered with `helm template`) and the
+// upstream charts. References are as written, before pinning or registry rewrite.
+func (d *Deployer) Usages() ([]images.Usage, error) {
+	var out []images.Usage
+	for _, path := range Manifests {
+		data, err := os.ReadFile(d.resolveCeresPath(path))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		usages, err := images.Scan(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		out = append(out, usages...)
+	}
+
+	chart := d.ChartPath()
+	if _, err := exec.LookPath("helm"); err == nil {
+		rendered, err := exec.Command("helm", "template", HelmRelease, chart).Output()
+		if err != nil {
+			return nil, fmt.Errorf("helm template %s: %w", chart, err)
+		}
+		usages, err := images.Scan(rendered)
+		if err != nil {
+			return nil, fmt.Errorf("parse rendered %s: %w", chart, err)
+		}
+		out = append(out, usages...)
+	} else {
+		fmt.Println("  ⚠️  helm not found, skipping ceres-platform chart images")
+	}
+
+	for _, c := range UpstreamCharts {
+		for _, ref := range c.Images {
+			out = append(out, images.Usage{Component: c.Name, Kind: "HelmChart", Image: ref})
+		}
+	}
+	return out, nil
+}
+
+// Images returns the unique image references from Usages, in order
+func (d *Deployer) Images() ([]string, error) {
+	usages, err := d.Usages()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, u := range usages {
+		if !seen[u.Image] {
+			seen[u.Image] = true
+			out = append(out, u.Image)
+		}
+	}
+	return out, nil
+}
+
+// PinImages loads a lock file; rendered manifests then reference images by digest
+func (d *Deployer) PinImages(lockPath string) error {
+	if lockPath == "" {
+		lockPath = d.resolveCeresPath(images.LockFile)
+	}
+	lock, err := images.LoadLock(lockPath)
+	if err != nil {
+		return fmt.Errorf("load image lock (run `ceres images lock`): %w", err)
+	}
+	d.lock = lock
+	d.lockPath = lockPath
+	return nil
+}
+
+// RewriteImages applies image pinning and the private registry to a rendered manifest
+func (d *Deployer) RewriteImages(data []byte) []byte {
+	reg := ImageRegistry()
+	if d.lock == nil && reg == "" {
+		return data
+	}
+	return images.RewriteManifest(data, func(ref string) string {
+		return images.Mirror(d.lock.Pin(ref), reg)
+	})
+}
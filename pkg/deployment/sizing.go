@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/sizing"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// UseProfile selects a sizing profile applied to every rendered manifest.
+// An empty name disables sizing.
+func (d *Deployer) UseProfile(name string, overrides map[string]sizing.Size) error {
+	if name == "" {
+		d.profile = nil
+		return nil
+	}
+	p, err := sizing.Get(name, overrides)
+	if err != nil {
+		return err
+	}
+	d.profile = p
+	return nil
+}
+
+// applySizing sizes a rendered manifest with the selected profile.
+// Volumes are only resized on a fresh install (see sizing.Options).
+func (d *Deployer) applySizing(data []byte) ([]byte, error) {
+	if d.profile == nil {
+		return data, nil
+	}
+	return d.profile.Apply(data, sizing.Options{Storage: d.sizeStorage})
+}
+
+// Capacity is the allocatable capacity of the cluster nodes
+type Capacity struct {
+	Nodes  int
+	CPU    resource.Quantity
+	Memory resource.Quantity
+}
+
+// NodeCapacity sums allocatable CPU and memory over all nodes
+func (d *Deployer) NodeCapacity() (*Capacity, error) {
+	out, err := exec.Command("kubectl", "get", "nodes", "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var list struct {
+		Items []struct {
+			Status struct {
+				Allocatable map[string]resource.Quantity `json:"allocatable"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes: %w", err)
+	}
+
+	c := &Capacity{Nodes: len(list.Items)}
+	for _, n := range list.Items {
+		c.CPU.Add(n.Status.Allocatable["cpu"])
+		c.Memory.Add(n.Status.Allocatable["memory"])
+	}
+	return c, nil
+}
+
+// Plan renders what the given engine would deploy, with the selected profile,
+// and adds up requests, limits and storage. nodes is used for DaemonSets.
+func (d *Deployer) Plan(engine string, cfg config.Config, nodes int) (*sizing.Totals, error) {
+	sizeStorage := d.sizeStorage
+	d.sizeStorage = true
+	defer func() { d.sizeStorage = sizeStorage }()
+
+	totals := &sizing.Totals{}
+	switch engine {
+	case "helm":
+		rendered, err := d.helmTemplate(cfg)
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.PostRender(rendered)
+		if err != nil {
+			return nil, err
+		}
+		if err := sizing.Estimate(data, nodes, totals); err != nil {
+			return nil, err
+		}
+	default:
+		manifests := append([]string{"deployment/promtail.yaml"}, d.reconcileManifests()...)
+		for _, m := range manifests {
+			data, err := d.RenderManifest(m)
+			if err != nil {
+				return nil, fmt.Errorf("render %s: %w", m, err)
+			}
+			if err := sizing.Estimate(data, nodes, totals); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", m, err)
+			}
+		}
+	}
+	return totals, nil
+}
@@ -0,0 +1,142 @@
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/topology"
+)
+
+// Topology returns the layout of the core services (topology.mode)
+func (d *Deployer) Topology() *topology.Topology {
+	if d.topology == nil {
+		d.topology = topology.Get(config.Current().Config)
+	}
+	return d.topology
+}
+
+// checkTopology refuses to switch a single-mode install to ha: its
+// PostgreSQL and Redis data is not migrated
+func (d *Deployer) checkTopology() error {
+	if !d.Topology().HA() {
+		return nil
+	}
+	for _, w := range topology.SingleWorkloads {
+		if exec.Command("kubectl", "get", w.Kind, w.Name, "-n", w.Namespace).Run() == nil {
+			return fmt.Errorf("topology.mode is ha but %s of single mode runs: its data is not migrated; back it up and install ha on a new cluster, or set topology.mode single", w)
+		}
+	}
+	return nil
+}
+
+// deployCoreHA deploys PostgreSQL with CloudNativePG and Redis with
+// Sentinel, and waits for every replica
+func (d *Deployer) deployCoreHA() error {
+	t := d.Topology()
+	if c, err := d.NodeCapacity(); err == nil && c.Nodes < 3 {
+		fmt.Printf("    ⚠️  %d node(s): ha replicas share nodes and do not survive a node failure\n", c.Nodes)
+	}
+	if err := d.SetupPostgresOperator(); err != nil {
+		return err
+	}
+	if err := d.ensurePostgresSuperuser(); err != nil {
+		return err
+	}
+
+	fmt.Printf("    📦 Applying PostgreSQL cluster (%d instances)...\n", t.PostgreSQL)
+	if err := d.applyManifest("deployment/ha/postgresql.yaml"); err != nil {
+		return fmt.Errorf("postgresql deployment failed: %w", err)
+	}
+	if err := d.waitForDeployment(topology.PostgreSQL.Name, topology.PostgreSQL.Namespace, topology.PostgreSQL.Kind, 600); err != nil {
+		return err
+	}
+
+	fmt.Printf("    📦 Applying Redis with Sentinel (%d nodes)...\n", t.Redis)
+	if err := d.applyManifest("deployment/ha/redis.yaml"); err != nil {
+		return fmt.Errorf("redis deployment failed: %w", err)
+	}
+	for _, w := range []topology.Workload{topology.Redis, topology.RedisProxy} {
+		if err := d.waitForDeployment(w.Name, w.Namespace, w.Kind, 300); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("    ✓ Core services deployed (ha)")
+	return nil
+}
+
+// deployKeycloak applies the Keycloak manifests of the topology. In ha
+// mode it waits for every replica, single mode for a running pod.
+func (d *Deployer) deployKeycloak(timeoutSec int) error {
+	for _, m := range d.Topology().Identity() {
+		if err := d.applyManifest(m); err != nil {
+			return err
+		}
+	}
+	if d.Topology().HA() {
+		return d.waitForDeployment(topology.Keycloak.Name, topology.Keycloak.Namespace, topology.Keycloak.Kind, timeoutSec*2)
+	}
+	return d.waitForPods("ceres", "app=keycloak", timeoutSec)
+}
+
+// SetupPostgresOperator installs or upgrades the CloudNativePG operator.
+// The PostgreSQL image of its clusters is set here so the private registry
+// applies to it too.
+func (d *Deployer) SetupPostgresOperator() error {
+	fmt.Println("    🐘 Installing CloudNativePG operator...")
+	args := append([]string{"upgrade", "--install", "cnpg"}, upstreamChartArgs(CloudNativePGChart)...)
+	args = append(args,
+		"--namespace", "cnpg-system",
+		"--create-namespace",
+		"--wait",
+		"--set", "config.data.POSTGRES_IMAGE_NAME="+mirrorImage("ghcr.io/cloudnative-pg/postgresql:16.1"),
+	)
+	if reg := ImageRegistry(); reg != "" {
+		args = append(args, "--set", "image.repository="+reg+"/cloudnative-pg/cloudnative-pg")
+	}
+	cmd := exec.Command("helm", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to install cloudnative-pg: %w", err)
+	}
+	return nil
+}
+
+// ensurePostgresSuperuser completes postgresql-superuser, whose password
+// ensureSecrets writes, with the user name CloudNativePG reads from it
+func (d *Deployer) ensurePostgresSuperuser() error {
+	cmd := exec.Command("kubectl", "patch", "secret", "postgresql-superuser", "-n", topology.PostgreSQL.Namespace,
+		"--type", "merge", "-p", `{"stringData":{"username":"postgres"}}`)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to prepare postgresql-superuser: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// rollout reads the desired, ready and updated replicas of a workload.
+// A CloudNativePG Cluster counts instances, all of them up to date once
+// its phase is healthy.
+func rollout(name, namespace, kind string) (desired, ready, updated string) {
+	cnpg := kind == topology.PostgreSQL.Kind
+	resource, path := kind, "{.spec.replicas}|{.status.readyReplicas}|{.status.updatedReplicas}"
+	if cnpg {
+		resource, path = "clusters.postgresql.cnpg.io", "{.spec.instances}|{.status.readyInstances}|{.status.phase}"
+	}
+	out, _ := exec.Command("kubectl", "get", resource, name, "-n", namespace, "-o", "jsonpath="+path).Output()
+	f := strings.Split(strings.TrimSpace(string(out)), "|")
+	for len(f) < 3 {
+		f = append(f, "")
+	}
+	desired, ready, updated = f[0], f[1], f[2]
+	if cnpg {
+		updated = ""
+		if f[2] == "Cluster in healthy state" {
+			updated = desired
+		}
+	}
+	return desired, ready, updated
+}
@@ -0,0 +1,242 @@
+// Package dns lists the host names the platform serves (its ingress hosts)
+// with the address they are reached at, and renders them for the usual
+// resolvers: /etc/hosts, a BIND zone, dnsmasq and CoreDNS.
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Record is one host name of the platform
+type Record struct {
+	Host    string
+	IP      string
+	Ingress string // namespace/name
+	// Source tells where the IP comes from: "ingress status",
+	// "service <ns>/<name>", "node <name>" or "--ip"
+	Source string
+}
+
+// Inventory is the set of host names under Domain
+type Inventory struct {
+	Domain  string
+	Records []Record
+}
+
+// Options controls Discover
+type Options struct {
+	// Domain selects the hosts: the domain itself and its subdomains
+	Domain string
+	// IP overrides the discovered addresses
+	IP string
+}
+
+type ingressList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Rules []struct {
+				Host string `json:"host"`
+			} `json:"rules"`
+			TLS []struct {
+				Hosts []string `json:"hosts"`
+			} `json:"tls"`
+		} `json:"spec"`
+		Status struct {
+			LoadBalancer loadBalancerStatus `json:"loadBalancer"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type loadBalancerStatus struct {
+	Ingress []struct {
+		IP       string `json:"ip"`
+		Hostname string `json:"hostname"`
+	} `json:"ingress"`
+}
+
+// Discover reads the ingress hosts under opts.Domain from the cluster and
+// resolves the address of each: the ingress load balancer status, else the
+// ingress controller's load balancer service, else a node address.
+func Discover(opts Options) (*Inventory, error) {
+	domain := strings.ToLower(strings.Trim(strings.TrimSpace(opts.Domain), "."))
+	if domain == "" {
+		return nil, fmt.Errorf("no domain given")
+	}
+	if opts.IP != "" && net.ParseIP(opts.IP) == nil {
+		return nil, fmt.Errorf("--ip %q is not an IP address", opts.IP)
+	}
+
+	var ingresses ingressList
+	if err := kubectlJSON(&ingresses, "get", "ingresses", "--all-namespaces"); err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{Domain: domain}
+	seen := map[string]bool{}
+	var fallback *Record // resolved once, for ingresses without status
+	for _, ing := range ingresses.Items {
+		var hosts []string
+		for _, r := range ing.Spec.Rules {
+			hosts = append(hosts, r.Host)
+		}
+		for _, t := range ing.Spec.TLS {
+			hosts = append(hosts, t.Hosts...)
+		}
+
+		ip, source := opts.IP, "--ip"
+		if ip == "" {
+			ip, source = statusAddress(ing.Status.LoadBalancer), "ingress status"
+		}
+		if ip == "" {
+			if fallback == nil {
+				fallback = &Record{}
+				fallback.IP, fallback.Source = EntryAddress()
+			}
+			ip, source = fallback.IP, fallback.Source
+		}
+
+		for _, h := range hosts {
+			h = strings.ToLower(h)
+			if seen[h] || strings.Contains(h, "*") || !inDomain(h, domain) {
+				continue
+			}
+			seen[h] = true
+			inv.Records = append(inv.Records, Record{
+				Host:    h,
+				IP:      ip,
+				Ingress: ing.Metadata.Namespace + "/" + ing.Metadata.Name,
+				Source:  source,
+			})
+		}
+	}
+	if len(inv.Records) == 0 {
+		return nil, fmt.Errorf("no ingress hosts under %s in the cluster", domain)
+	}
+	sort.Slice(inv.Records, func(i, j int) bool { return inv.Records[i].Host < inv.Records[j].Host })
+	return inv, nil
+}
+
+// Unresolved returns the hosts no address was found for
+func (inv *Inventory) Unresolved() []string {
+	var out []string
+	for _, r := range inv.Records {
+		if r.IP == "" {
+			out = append(out, r.Host)
+		}
+	}
+	return out
+}
+
+func inDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// statusAddress returns the first load balancer address, resolving host names
+func statusAddress(lb loadBalancerStatus) string {
+	for _, in := range lb.Ingress {
+		if in.IP != "" {
+			return in.IP
+		}
+		if in.Hostname != "" {
+			if ips, err := net.LookupIP(in.Hostname); err == nil && len(ips) > 0 {
+				return ips[0].String()
+			}
+		}
+	}
+	return ""
+}
+
+// controllerNames are the ingress controller services, as deployed by k3s
+// (traefik) and deployment/ingress-nginx.yaml
+var controllerNames = []string{"traefik", "ingress-nginx-controller"}
+
+// EntryAddress returns the load balancer address of the ingress
+// controller, else the address of a node (ExternalIP before InternalIP)
+func EntryAddress() (ip, source string) {
+	var services struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Spec struct {
+				Type string `json:"type"`
+			} `json:"spec"`
+			Status struct {
+				LoadBalancer loadBalancerStatus `json:"loadBalancer"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if kubectlJSON(&services, "get", "services", "--all-namespaces") == nil {
+		for _, name := range controllerNames {
+			for _, svc := range services.Items {
+				if svc.Metadata.Name != name || svc.Spec.Type != "LoadBalancer" {
+					continue
+				}
+				if ip := statusAddress(svc.Status.LoadBalancer); ip != "" {
+					return ip, "service " + svc.Metadata.Namespace + "/" + svc.Metadata.Name
+				}
+			}
+		}
+	}
+
+	if ip, node := NodeAddress(); ip != "" {
+		return ip, "node " + node
+	}
+	return "", ""
+}
+
+// NodeAddress returns the address NodePort services are reached at: the
+// first node ExternalIP, else the first InternalIP
+func NodeAddress() (ip, node string) {
+	var nodes struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Addresses []struct {
+					Type    string `json:"type"`
+					Address string `json:"address"`
+				} `json:"addresses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if kubectlJSON(&nodes, "get", "nodes") != nil {
+		return "", ""
+	}
+	for _, kind := range []string{"ExternalIP", "InternalIP"} {
+		for _, n := range nodes.Items {
+			for _, a := range n.Status.Addresses {
+				if a.Type == kind && net.ParseIP(a.Address) != nil {
+					return a.Address, n.Metadata.Name
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+func kubectlJSON(v any, args ...string) error {
+	args = append(args, "-o", "json")
+	out, err := exec.Command("kubectl", args...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("kubectl %s failed: %s", strings.Join(args[:2], " "), strings.TrimSpace(string(ee.Stderr)))
+		}
+		return fmt.Errorf("kubectl %s failed: %w", strings.Join(args[:2], " "), err)
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("invalid kubectl output: %w", err)
+	}
+	return nil
+}
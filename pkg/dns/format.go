@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats are the output formats of Render
+var Formats = []string{"hosts", "zone", "dnsmasq", "coredns"}
+
+// CoreDNSConfigMap is the config map k3s's CoreDNS imports extra server
+// blocks from (*.server keys); VPN clients resolve through this CoreDNS
+const CoreDNSConfigMap = "coredns-custom"
+
+// Render writes the inventory in one of Formats
+func Render(inv *Inventory, format string) (string, error) {
+	switch format {
+	case "hosts":
+		return Hosts(inv), nil
+	case "zone":
+		return Zone(inv, time.Now()), nil
+	case "dnsmasq":
+		return Dnsmasq(inv), nil
+	case "coredns":
+		return CoreDNS(inv), nil
+	}
+	return "", fmt.Errorf("unknown format %q (one of %s)", format, strings.Join(Formats, ", "))
+}
+
+// Hosts is an /etc/hosts snippet, one line per address
+func Hosts(inv *Inventory) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# CERES %s\n", inv.Domain)
+	for _, ip := range inv.addresses() {
+		fmt.Fprintf(&b, "%s %s\n", ip, strings.Join(inv.hostsAt(ip), " "))
+	}
+	return b.String()
+}
+
+// Zone is a BIND zone file for the domain
+func Zone(inv *Inventory, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", inv.Domain)
+	b.WriteString("$TTL 300\n")
+	fmt.Fprintf(&b, "@\tIN\tSOA\tns.%s. hostmaster.%s. (\n", inv.Domain, inv.Domain)
+	fmt.Fprintf(&b, "\t\t%s01 ; serial\n", now.Format("20060102"))
+	b.WriteString("\t\t3600       ; refresh\n")
+	b.WriteString("\t\t900        ; retry\n")
+	b.WriteString("\t\t604800     ; expire\n")
+	b.WriteString("\t\t300 )      ; minimum\n")
+	b.WriteString("@\tIN\tNS\tns\n")
+	if ips := inv.addresses(); len(ips) > 0 {
+		fmt.Fprintf(&b, "ns\tIN\t%s\t%s\n", recordType(ips[0]), ips[0])
+	}
+	for _, r := range inv.Records {
+		if r.IP == "" {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(r.Host, inv.Domain), ".")
+		if name == "" {
+			name = "@"
+		}
+		fmt.Fprintf(&b, "%s\tIN\t%s\t%s\n", name, recordType(r.IP), r.IP)
+	}
+	return b.String()
+}
+
+// recordType is the zone record type of an address: AAAA for IPv6, else A
+func recordType(ip string) string {
+	if addr := net.ParseIP(ip); addr != nil && addr.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// Dnsmasq is dnsmasq configuration, one address= line per host
+func Dnsmasq(inv *Inventory) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# CERES %s\n", inv.Domain)
+	for _, r := range inv.Records {
+		if r.IP != "" {
+			fmt.Fprintf(&b, "address=/%s/%s\n", r.Host, r.IP)
+		}
+	}
+	return b.String()
+}
+
+// CoreDNS is the coredns-custom config map: a server block for the domain
+// that answers the ingress hosts and forwards everything else
+func CoreDNS(inv *Inventory) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\n")
+	b.WriteString("kind: ConfigMap\n")
+	b.WriteString("metadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", CoreDNSConfigMap)
+	b.WriteString("  namespace: kube-system\n")
+	b.WriteString("data:\n")
+	fmt.Fprintf(&b, "  %s.server: |\n", inv.Domain)
+	fmt.Fprintf(&b, "    %s:53 {\n", inv.Domain)
+	b.WriteString("        errors\n")
+	b.WriteString("        cache 30\n")
+	b.WriteString("        hosts {\n")
+	for _, ip := range inv.addresses() {
+		fmt.Fprintf(&b, "            %s %s\n", ip, strings.Join(inv.hostsAt(ip), " "))
+	}
+	b.WriteString("            fallthrough\n")
+	b.WriteString("        }\n")
+	b.WriteString("        forward . /etc/resolv.conf\n")
+	b.WriteString("    }\n")
+	return b.String()
+}
+
+// addresses returns the distinct IPs of the records, sorted
+func (inv *Inventory) addresses() []string {
+	seen := map[string]bool{}
+	var ips []string
+	for _, r := range inv.Records {
+		if r.IP != "" && !seen[r.IP] {
+			seen[r.IP] = true
+			ips = append(ips, r.IP)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func (inv *Inventory) hostsAt(ip string) []string {
+	var hosts []string
+	for _, r := range inv.Records {
+		if r.IP == ip {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	return hosts
+}
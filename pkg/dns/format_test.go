@@ -0,0 +1,31 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZone(t *testing.T) {
+	inv := &Inventory{Domain: "example.com", Records: []Record{
+		{Host: "example.com", IP: "2001:db8::10"},
+		{Host: "gitlab.example.com", IP: "192.0.2.10"},
+		{Host: "keycloak.example.com", IP: "2001:db8::10"},
+		{Host: "pending.example.com"},
+	}}
+	zone := Zone(inv, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	for _, line := range []string{
+		"ns\tIN\tA\t192.0.2.10\n",
+		"@\tIN\tAAAA\t2001:db8::10\n",
+		"gitlab\tIN\tA\t192.0.2.10\n",
+		"keycloak\tIN\tAAAA\t2001:db8::10\n",
+		"\t\t2024050101 ; serial\n",
+	} {
+		if !strings.Contains(zone, line) {
+			t.Errorf("zone lacks %q:\n%s", line, zone)
+		}
+	}
+	if strings.Contains(zone, "pending") {
+		t.Errorf("host without an address in the zone:\n%s", zone)
+	}
+}
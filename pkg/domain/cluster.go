@@ -0,0 +1,328 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// The cluster is read and patched with kubectl, like the rest of the
+// deployer. Only values that name the old domain are touched.
+
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+	} `json:"ownerReferences,omitempty"`
+}
+
+type ingress struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+	} `json:"spec"`
+}
+
+type certificate struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		CommonName string   `json:"commonName"`
+		DNSNames   []string `json:"dnsNames"`
+	} `json:"spec"`
+}
+
+type configMap struct {
+	Metadata objectMeta        `json:"metadata"`
+	Data     map[string]string `json:"data"`
+}
+
+type container struct {
+	Name string `json:"name"`
+	Env  []struct {
+		Name      string `json:"name"`
+		Value     string `json:"value"`
+		ValueFrom *struct {
+			ConfigMapKeyRef *struct {
+				Name string `json:"name"`
+			} `json:"configMapKeyRef"`
+		} `json:"valueFrom"`
+	} `json:"env"`
+	EnvFrom []struct {
+		ConfigMapRef *struct {
+			Name string `json:"name"`
+		} `json:"configMapRef"`
+	} `json:"envFrom"`
+}
+
+type workload struct {
+	Kind     string     `json:"kind"`
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Template struct {
+			Spec struct {
+				Containers []container `json:"containers"`
+				Volumes    []struct {
+					ConfigMap *struct {
+						Name string `json:"name"`
+					} `json:"configMap"`
+				} `json:"volumes"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// ref is kind/name as kubectl takes it
+func (w workload) ref() string {
+	return strings.ToLower(w.Kind) + "/" + w.Metadata.Name
+}
+
+// usesConfigMap reports whether the pods of w read the config map name
+func (w workload) usesConfigMap(name string) bool {
+	pod := w.Spec.Template.Spec
+	for _, v := range pod.Volumes {
+		if v.ConfigMap != nil && v.ConfigMap.Name == name {
+			return true
+		}
+	}
+	for _, c := range pod.Containers {
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil && e.ConfigMapRef.Name == name {
+				return true
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil && e.ValueFrom.ConfigMapKeyRef.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lastApplied is kubectl's copy of the applied manifest; the next deploy
+// renders it for the new domain
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+// patchOp is a JSON patch operation
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// planCluster collects the ingresses, certificates, config maps and
+// workload env values that name the old domain
+func (p *Plan) planCluster() {
+	var workloads []workload
+	if err := kubectlList("deployments,statefulsets", &workloads); err != nil {
+		p.skip("workloads", err)
+	}
+
+	var configMaps []configMap
+	if err := kubectlList("configmaps", &configMaps); err != nil {
+		p.skip("config maps", err)
+	}
+	for _, cm := range configMaps {
+		patch := map[string]string{}
+		var changes []Change
+		for _, key := range sortedKeys(cm.Data) {
+			v := cm.Data[key]
+			if to := p.replace(v); to != v {
+				patch[key] = to
+				changes = append(changes, lineChanges("data."+key, v, to)...)
+			}
+		}
+		if len(patch) == 0 {
+			continue
+		}
+		step := Step{Kind: "configmap", Name: cm.Metadata.Namespace + "/" + cm.Metadata.Name, Changes: changes}
+		for _, w := range workloads {
+			if w.Metadata.Namespace == cm.Metadata.Namespace && w.usesConfigMap(cm.Metadata.Name) {
+				step.Restarts = append(step.Restarts, w.ref())
+			}
+		}
+		cm, restarts := cm, step.Restarts
+		step.apply = func() error {
+			body, _ := json.Marshal(map[string]any{"data": patch})
+			if err := kubectl("patch", "configmap", cm.Metadata.Name, "-n", cm.Metadata.Namespace, "--type", "merge", "-p", string(body)); err != nil {
+				return err
+			}
+			for _, ref := range restarts {
+				if err := kubectl("rollout", "restart", ref, "-n", cm.Metadata.Namespace); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		p.Steps = append(p.Steps, step)
+	}
+
+	// env values set in the pod template; patching them rolls the pods
+	for _, w := range workloads {
+		var ops []patchOp
+		var changes []Change
+		for i, c := range w.Spec.Template.Spec.Containers {
+			for j, e := range c.Env {
+				if to := p.replace(e.Value); to != e.Value {
+					ops = append(ops, patchOp{Op: "replace", Path: fmt.Sprintf("/spec/template/spec/containers/%d/env/%d/value", i, j), Value: to})
+					changes = append(changes, Change{Field: c.Name + " env " + e.Name, From: e.Value, To: to})
+				}
+			}
+		}
+		if len(ops) == 0 {
+			continue
+		}
+		p.addPatch(strings.ToLower(w.Kind), w.Metadata, ops, changes)
+	}
+
+	var certs []certificate
+	if err := kubectlList("certificates.cert-manager.io", &certs); err != nil {
+		p.skip("certificates", err)
+	}
+	for _, c := range certs {
+		if ownedBy(c.Metadata, "Ingress") {
+			// ingress-shim rewrites these from the ingress TLS hosts
+			continue
+		}
+		var ops []patchOp
+		var changes []Change
+		if to := p.replace(c.Spec.CommonName); to != c.Spec.CommonName {
+			ops = append(ops, patchOp{Op: "replace", Path: "/spec/commonName", Value: to})
+			changes = append(changes, Change{Field: "commonName", From: c.Spec.CommonName, To: to})
+		}
+		for i, name := range c.Spec.DNSNames {
+			if to := p.replace(name); to != name {
+				ops = append(ops, patchOp{Op: "replace", Path: fmt.Sprintf("/spec/dnsNames/%d", i), Value: to})
+				changes = append(changes, Change{Field: fmt.Sprintf("dnsNames[%d]", i), From: name, To: to})
+			}
+		}
+		if len(ops) > 0 {
+			p.addPatch("certificate", c.Metadata, ops, changes)
+		}
+	}
+
+	var ingresses []ingress
+	if err := kubectlList("ingresses", &ingresses); err != nil {
+		p.skip("ingresses", err)
+	}
+	for _, ing := range ingresses {
+		var ops []patchOp
+		var changes []Change
+		for i, r := range ing.Spec.Rules {
+			if to := p.replace(r.Host); to != r.Host {
+				ops = append(ops, patchOp{Op: "replace", Path: fmt.Sprintf("/spec/rules/%d/host", i), Value: to})
+				changes = append(changes, Change{Field: fmt.Sprintf("rules[%d].host", i), From: r.Host, To: to})
+			}
+		}
+		for i, t := range ing.Spec.TLS {
+			for j, h := range t.Hosts {
+				if to := p.replace(h); to != h {
+					ops = append(ops, patchOp{Op: "replace", Path: fmt.Sprintf("/spec/tls/%d/hosts/%d", i, j), Value: to})
+					changes = append(changes, Change{Field: fmt.Sprintf("tls[%d].hosts[%d]", i, j), From: h, To: to})
+				}
+			}
+		}
+		// e.g. the oauth2-proxy auth-url and auth-signin annotations
+		for _, k := range sortedKeys(ing.Metadata.Annotations) {
+			v := ing.Metadata.Annotations[k]
+			if k == lastApplied {
+				continue
+			}
+			if to := p.replace(v); to != v {
+				ops = append(ops, patchOp{Op: "replace", Path: "/metadata/annotations/" + escapePointer(k), Value: to})
+				changes = append(changes, Change{Field: "annotation " + k, From: v, To: to})
+			}
+		}
+		if len(ops) > 0 {
+			p.addPatch("ingress", ing.Metadata, ops, changes)
+		}
+	}
+}
+
+// addPatch adds a step that JSON-patches one object
+func (p *Plan) addPatch(kind string, meta objectMeta, ops []patchOp, changes []Change) {
+	p.Steps = append(p.Steps, Step{
+		Kind:    kind,
+		Name:    meta.Namespace + "/" + meta.Name,
+		Changes: changes,
+		apply: func() error {
+			body, err := json.Marshal(ops)
+			if err != nil {
+				return err
+			}
+			return kubectl("patch", kind, meta.Name, "-n", meta.Namespace, "--type", "json", "-p", string(body))
+		},
+	})
+}
+
+// lineChanges lists the changed lines of a multi-line value
+func lineChanges(field, from, to string) []Change {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+	if len(a) != len(b) {
+		return []Change{{Field: field, From: from, To: to}}
+	}
+	var out []Change
+	for i := range a {
+		if a[i] != b[i] {
+			out = append(out, Change{Field: field, From: strings.TrimSpace(a[i]), To: strings.TrimSpace(b[i])})
+		}
+	}
+	return out
+}
+
+func ownedBy(meta objectMeta, kind string) bool {
+	for _, o := range meta.OwnerReferences {
+		if o.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePointer escapes a key for a JSON pointer (RFC 6901)
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// kubectlList reads the items of a resource in all namespaces
+func kubectlList(resource string, items any) error {
+	out, err := exec.Command("kubectl", "get", resource, "--all-namespaces", "-o", "json").Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("kubectl get %s failed: %s", resource, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return fmt.Errorf("kubectl get %s failed: %w", resource, err)
+	}
+	var list struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return fmt.Errorf("invalid %s list: %w", resource, err)
+	}
+	return json.Unmarshal(list.Items, items)
+}
+
+func kubectl(args ...string) error {
+	if out, err := exec.Command("kubectl", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("kubectl %s failed: %w\n%s", strings.Join(args[:2], " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// Package domain moves an installation to another platform domain: the
+// config files and everything in the cluster that names the old domain
+// (ingress hosts, certificates, Keycloak, oauth2-proxy, mail).
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/sso"
+)
+
+// Change is one value that names the domain
+type Change struct {
+	Field string
+	From  string
+	To    string
+}
+
+// Step changes one artifact, e.g. an ingress or the config file
+type Step struct {
+	Kind    string // "config", "ingress", "certificate", "keycloak", ...
+	Name    string // file or namespace/name
+	Changes []Change
+	// Restarts are the workloads restarted to pick up the change
+	Restarts []string
+
+	apply func() error
+}
+
+// Options selects the files a domain change updates
+type Options struct {
+	// ConfigPath is the CLI config file, default config.DefaultPath()
+	ConfigPath string
+	// InstanceEnvPath is the instance env file, default
+	// config.DefaultInstanceEnvPath; it is only updated when it exists
+	InstanceEnvPath string
+	// RealmFile is the Keycloak realm template (config/keycloak-realm.json)
+	RealmFile string
+	// SkipCluster plans the file changes only
+	SkipCluster bool
+}
+
+// Plan is the set of changes that moves the platform from Old to New
+type Plan struct {
+	Old, New string
+	Steps    []Step
+	// Skipped are the artifacts that could not be inspected, with the reason
+	Skipped []string
+	// Notes are follow-ups the plan cannot do itself
+	Notes []string
+}
+
+// NewPlan inspects the config files and the cluster for values that name
+// oldDomain
+func NewPlan(oldDomain, newDomain string, opts Options) (*Plan, error) {
+	oldDomain = strings.ToLower(strings.TrimSpace(oldDomain))
+	newDomain = strings.ToLower(strings.TrimSpace(newDomain))
+	if oldDomain == "" {
+		return nil, fmt.Errorf("current domain is unknown (set platform.domain or use --from)")
+	}
+	if oldDomain == newDomain {
+		return nil, fmt.Errorf("the platform domain is already %s", newDomain)
+	}
+	check := config.DefaultConfig()
+	check.Platform.Domain = newDomain
+	if err := check.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = config.DefaultPath()
+	}
+	if opts.InstanceEnvPath == "" {
+		opts.InstanceEnvPath = config.DefaultInstanceEnvPath
+	}
+
+	p := &Plan{Old: oldDomain, New: newDomain}
+	if !opts.SkipCluster {
+		p.planKeycloak()
+		p.planCluster()
+	}
+	if err := p.planConfigFile(opts.ConfigPath); err != nil {
+		return nil, err
+	}
+	if err := p.planInstanceEnv(opts.InstanceEnvPath); err != nil {
+		return nil, err
+	}
+	if err := p.planRealmFile(opts.RealmFile); err != nil {
+		return nil, err
+	}
+
+	if v, ok := os.LookupEnv("CERES_DOMAIN"); ok && v != newDomain {
+		p.Notes = append(p.Notes, fmt.Sprintf("CERES_DOMAIN=%s is set in the environment and overrides the config file: update or unset it", v))
+	}
+	if !opts.SkipCluster {
+		p.Notes = append(p.Notes, "DNS: point *."+newDomain+" at the ingress (see `ceres dns`)")
+	}
+	return p, nil
+}
+
+// Empty reports whether nothing names the old domain
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// Apply makes the changes step by step and stops at the first failure
+func (p *Plan) Apply() error {
+	for _, s := range p.Steps {
+		fmt.Printf("  → %s %s\n", s.Kind, s.Name)
+		if err := s.apply(); err != nil {
+			return fmt.Errorf("%s %s: %w", s.Kind, s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Plan) replace(s string) string {
+	return config.ReplaceDomain(s, p.Old, p.New)
+}
+
+func (p *Plan) skip(what string, err error) {
+	p.Skipped = append(p.Skipped, fmt.Sprintf("%s: %v", what, err))
+}
+
+// planKeycloak updates the realm frontend URL and the client URLs
+func (p *Plan) planKeycloak() {
+	m := sso.NewManager()
+	frontend := sso.FrontendURL(p.New)
+	changes, err := m.UpdateRealmDomain(p.replace, frontend, false)
+	if err != nil {
+		p.skip("keycloak", err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	step := Step{Kind: "keycloak", Name: "realm", apply: func() error {
+		_, err := m.UpdateRealmDomain(p.replace, frontend, true)
+		return err
+	}}
+	for _, c := range changes {
+		step.Changes = append(step.Changes, Change{Field: c.Target + " " + c.Field, From: c.From, To: c.To})
+	}
+	p.Steps = append(p.Steps, step)
+}
+
+// planConfigFile sets platform.domain and moves mail.from to the new domain.
+// A missing config file is created so the new domain is kept.
+func (p *Plan) planConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	base := config.DefaultConfig()
+	if len(data) > 0 {
+		if base, err = config.ParseFile(path, data, config.LoadOptions{BaseOnly: true}); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	step := Step{Kind: "config", Name: path}
+	out := data
+	set := func(key, from, to string) error {
+		if out, err = config.SetInFile(out, key, to); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+		step.Changes = append(step.Changes, Change{Field: key, From: from, To: to})
+		return nil
+	}
+	if base.Platform.Domain != p.New {
+		if err := set("platform.domain", base.Platform.Domain, p.New); err != nil {
+			return err
+		}
+	}
+	if from := base.Mail.From; from != "" && p.replace(from) != from {
+		if err := set("mail.from", from, p.replace(from)); err != nil {
+			return err
+		}
+	}
+	if len(step.Changes) == 0 {
+		return nil
+	}
+	if _, err := config.ParseFile(path, out, config.LoadOptions{}); err != nil {
+		return fmt.Errorf("config %s would be invalid: %w", path, err)
+	}
+	step.apply = func() error { return config.WriteFile(path, out) }
+	p.Steps = append(p.Steps, step)
+	return nil
+}
+
+// planInstanceEnv rewrites the domain in the instance env file
+func (p *Plan) planInstanceEnv(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	step := Step{Kind: "instance env", Name: path}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if to := p.replace(line); to != line {
+			key, _, _ := strings.Cut(strings.TrimPrefix(trimmed, "export "), "=")
+			step.Changes = append(step.Changes, Change{Field: strings.TrimSpace(key), From: trimmed, To: strings.TrimSpace(to)})
+			lines[i] = to
+		}
+	}
+	if len(step.Changes) == 0 {
+		return nil
+	}
+	out := []byte(strings.Join(lines, "\n"))
+	step.apply = func() error { return config.WriteFile(path, out) }
+	p.Steps = append(p.Steps, step)
+	return nil
+}
+
+// planRealmFile rewrites a realm template that names the old domain. The
+// stock template uses config.DefaultDomain, which is replaced when the
+// realm is imported, so it is left alone.
+func (p *Plan) planRealmFile(path string) error {
+	if path == "" || p.Old == config.DefaultDomain {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	out := p.replace(string(data))
+	if out == string(data) {
+		return nil
+	}
+	step := Step{Kind: "realm file", Name: path}
+	for i, line := range strings.Split(string(data), "\n") {
+		if to := p.replace(line); to != line {
+			step.Changes = append(step.Changes, Change{Field: fmt.Sprintf("line %d", i+1), From: strings.TrimSpace(line), To: strings.TrimSpace(to)})
+		}
+	}
+	step.apply = func() error { return config.WriteFile(path, []byte(out)) }
+	p.Steps = append(p.Steps, step)
+	return nil
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanFiles(t *testing.T) {
+	stockRealm, err := os.ReadFile("../../config/keycloak-realm.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		old       string
+		config    string // "" for no config file
+		env       string // "" for no instance env
+		realm     string // "" for no realm file
+		changes   map[string][]string
+		want      map[string]string // file contents after Apply
+		unchanged []string
+	}{
+		{
+			name: "no config file",
+			old:  "ceres.local",
+			changes: map[string][]string{
+				"config": {"platform.domain"},
+			},
+			want: map[string]string{
+				"config.yaml": "schemaVersion: 2\nplatform:\n  domain: new.example.org\n",
+			},
+		},
+		{
+			name: "mail.from on the old domain",
+			old:  "old.example.com",
+			config: "schemaVersion: 2\n\n# the public domain\nplatform:\n  domain: old.example.com\n" +
+				"mail:\n  mode: external\n  from: noreply@old.example.com # platform mail\n",
+			changes: map[string][]string{
+				"config": {"platform.domain", "mail.from"},
+			},
+			want: map[string]string{
+				"config.yaml": "schemaVersion: 2\n\n# the public domain\nplatform:\n  domain: new.example.org\n" +
+					"mail:\n  mode: external\n  from: noreply@new.example.org # platform mail\n",
+			},
+		},
+		{
+			name:   "export in the instance env",
+			old:    "old.example.com",
+			config: "schemaVersion: 2\nplatform:\n  domain: new.example.org\n",
+			env:    "# moved from old.example.com\nexport CERES_DOMAIN=old.example.com\nCERES_VPN_ENDPOINT=vpn.old.example.com\nCERES_MAIL_MODE=internal\n",
+			changes: map[string][]string{
+				"instance env": {"CERES_DOMAIN", "CERES_VPN_ENDPOINT"},
+			},
+			want: map[string]string{
+				"ceres.env": "# moved from old.example.com\nexport CERES_DOMAIN=new.example.org\nCERES_VPN_ENDPOINT=vpn.new.example.org\nCERES_MAIL_MODE=internal\n",
+			},
+			unchanged: []string{"config.yaml"},
+		},
+		{
+			name:      "stock realm template",
+			old:       "old.example.com",
+			config:    "schemaVersion: 2\nplatform:\n  domain: new.example.org\n",
+			realm:     string(stockRealm),
+			changes:   map[string][]string{},
+			unchanged: []string{"config.yaml", "realm.json"},
+		},
+		{
+			name:      "stock realm template on the default domain",
+			old:       "ceres.local",
+			config:    "schemaVersion: 2\nplatform:\n  domain: new.example.org\n",
+			realm:     string(stockRealm),
+			changes:   map[string][]string{},
+			unchanged: []string{"realm.json"},
+		},
+		{
+			name:   "realm file on the old domain",
+			old:    "old.example.com",
+			config: "schemaVersion: 2\nplatform:\n  domain: new.example.org\n",
+			realm:  "{\n  \"frontendUrl\": \"https://keycloak.old.example.com\"\n}\n",
+			changes: map[string][]string{
+				"realm file": {"line 2"},
+			},
+			want: map[string]string{
+				"realm.json": "{\n  \"frontendUrl\": \"https://keycloak.new.example.org\"\n}\n",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("CERES_DOMAIN", "new.example.org")
+			dir := t.TempDir()
+			opts := Options{
+				ConfigPath:      filepath.Join(dir, "config.yaml"),
+				InstanceEnvPath: filepath.Join(dir, "ceres.env"),
+				RealmFile:       filepath.Join(dir, "realm.json"),
+				SkipCluster:     true,
+			}
+			files := map[string]string{}
+			for name, data := range map[string]string{"config.yaml": c.config, "ceres.env": c.env, "realm.json": c.realm} {
+				if data == "" {
+					continue
+				}
+				files[name] = data
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p, err := NewPlan(c.old, "new.example.org", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, s := range p.Steps {
+				for _, ch := range s.Changes {
+					got[s.Kind] = append(got[s.Kind], ch.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, c.changes) {
+				t.Errorf("changes = %v, want %v", got, c.changes)
+			}
+
+			if err := p.Apply(); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range c.want {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s =\n%s\nwant\n%s", name, data, want)
+				}
+			}
+			for _, name := range c.unchanged {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != files[name] {
+					t.Errorf("%s changed:\n%s", name, data)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPlanErrors(t *testing.T) {
+	opts := Options{ConfigPath: filepath.Join(t.TempDir(), "config.yaml"), SkipCluster: true}
+	for _, c := range []struct{ old, new string }{
+		{"", "new.example.org"},
+		{"new.example.org", "NEW.example.org"},
+		{"old.example.com", "not a domain"},
+	} {
+		if _, err := NewPlan(c.old, c.new, opts); err == nil {
+			t.Errorf("NewPlan(%q, %q) accepted", c.old, c.new)
+		}
+	}
+}
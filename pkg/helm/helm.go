@@ -8,7 +8,9 @@ import (
 
 // Client represents Helm client
 type Client struct {
-	namespace string
+	namespace    string
+	postRenderer []string
+	valuesFiles  []string
 }
 
 // NewClient creates new Helm client
@@ -18,6 +20,37 @@ func NewClient(namespace string) *Client {
 	}
 }
 
+// SetPostRenderer runs rendered manifests through an executable (helm --post-renderer)
+// on install/upgrade
+func (c *Client) SetPostRenderer(path string, args ...string) {
+	c.postRenderer = append([]string{path}, args...)
+}
+
+func (c *Client) postRendererArgs() []string {
+	if len(c.postRenderer) == 0 {
+		return nil
+	}
+	args := []string{"--post-renderer", c.postRenderer[0]}
+	for _, a := range c.postRenderer[1:] {
+		args = append(args, "--post-renderer-args", a)
+	}
+	return args
+}
+
+// AddValuesFile passes a values file (helm -f) on install/upgrade, e.g. for
+// values that must not appear on the command line
+func (c *Client) AddValuesFile(path string) {
+	c.valuesFiles = append(c.valuesFiles, path)
+}
+
+func (c *Client) valuesFileArgs() []string {
+	var args []string
+	for _, f := range c.valuesFiles {
+		args = append(args, "-f", f)
+	}
+	return args
+}
+
 // AddRepo adds a Helm repository
 func (c *Client) AddRepo(name, url string) error {
 	cmd := exec.Command("helm", "repo", "add", name, url)
@@ -47,6 +80,8 @@ func (c *Client) UpdateRepos() error {
 // InstallChart installs a Helm chart
 func (c *Client) InstallChart(release, chart string, values map[string]string) error {
 	args := []string{"install", release, chart, "-n", c.namespace, "--create-namespace"}
+	args = append(args, c.postRendererArgs()...)
+	args = append(args, c.valuesFileArgs()...)
 	
 	for key, val := range values {
 		args = append(args, "--set", fmt.Sprintf("%s=%s", key, val))
@@ -67,7 +102,9 @@ func (c *Client) InstallChart(release, chart string, values map[string]string) e
 
 // UpgradeChart upgrades a Helm chart
 func (c *Client) UpgradeChart(release, chart string, values map[string]string) error {
-	args := []string{"upgrade", "--install", release, chart, "-n", c.namespace}
+	args := []string{"upgrade", "--install", release, chart, "-n", c.namespace, "--create-namespace"}
+	args = append(args, c.postRendererArgs()...)
+	args = append(args, c.valuesFileArgs()...)
 	
 	for key, val := range values {
 		args = append(args, "--set", fmt.Sprintf("%s=%s", key, val))
@@ -0,0 +1,113 @@
+package images
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistry is the registry assumed for references without a host
+const DefaultRegistry = "docker.io"
+
+// Reference is a parsed container image reference
+type Reference struct {
+	Registry string // registry host, DefaultRegistry when omitted
+	Path     string // repository path as written, without the registry host
+	Tag      string
+	Digest   string
+}
+
+// Parse splits an image reference into registry, path, tag and digest
+func Parse(ref string) Reference {
+	ref = strings.TrimSpace(ref)
+	r := Reference{Registry: DefaultRegistry}
+
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		ref = name
+		r.Digest = digest
+	}
+
+	// A tag is the part after the last colon, unless that colon belongs to a registry port
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		r.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+
+	if first, rest, ok := strings.Cut(ref, "/"); ok && isRegistryHost(first) {
+		r.Registry = first
+		ref = rest
+	}
+	r.Path = ref
+
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r
+}
+
+func isRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
+
+// Repository returns the repository path as the registry API expects it
+// (Docker Hub official images live under library/)
+func (r Reference) Repository() string {
+	if r.Registry == DefaultRegistry && !strings.Contains(r.Path, "/") {
+		return "library/" + r.Path
+	}
+	return r.Path
+}
+
+// String returns the fully qualified reference
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Path
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Mirror returns ref as it is stored in a private registry: the original
+// registry host is replaced by registry, the repository path is kept.
+func Mirror(ref, registry string) string {
+	registry = strings.TrimRight(strings.TrimSpace(registry), "/")
+	if registry == "" || registry == DefaultRegistry {
+		return ref
+	}
+	r := Parse(ref)
+	r.Registry = registry
+	return r.String()
+}
+
+// imageLine matches `image: <ref>` lines in container specs (also as list items)
+var imageLine = regexp.MustCompile(`(?m)^(\s*(?:-\s+)?image:\s*)(["']?)([^"'\s#]+)(["']?)(.*)$`)
+
+// FromManifest returns the unique image references used in a YAML manifest, in order
+func FromManifest(data []byte) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, m := range imageLine.FindAllSubmatch(data, -1) {
+		ref := string(m[3])
+		if strings.Contains(ref, "{{") || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		out = append(out, ref)
+	}
+	return out
+}
+
+// RewriteManifest replaces every image reference in a YAML manifest with fn(ref)
+func RewriteManifest(data []byte, fn func(ref string) string) []byte {
+	return imageLine.ReplaceAllFunc(data, func(line []byte) []byte {
+		m := imageLine.FindSubmatch(line)
+		ref := string(m[3])
+		if strings.Contains(ref, "{{") {
+			return line
+		}
+		out := string(m[1]) + string(m[2]) + fn(ref) + string(m[4]) + string(m[5])
+		return []byte(out)
+	})
+}
@@ -0,0 +1,118 @@
+package images
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// LockFile is the default lock file location relative to the CERES root
+const LockFile = "deployment/images.lock.yaml"
+
+// LockEntry pins one image reference to a manifest digest
+type LockEntry struct {
+	Image  string `yaml:"image"`
+	Digest string `yaml:"digest"`
+}
+
+// Lock maps image references (as written in the manifests) to digests
+type Lock struct {
+	Generated time.Time   `yaml:"generated"`
+	Images    []LockEntry `yaml:"images"`
+}
+
+// LoadLock reads a lock file
+func LoadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+// Save writes the lock file, entries sorted by image
+func (l *Lock) Save(path string) error {
+	sort.Slice(l.Images, func(i, j int) bool { return l.Images[i].Image < l.Images[j].Image })
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	header := "# Generated by `ceres images lock`. Do not edit by hand.\n"
+	return os.WriteFile(path, append([]byte(header), data...), 0644)
+}
+
+// Digest returns the pinned digest for ref, or "". References spelled
+// differently (nginx, docker.io/library/nginx) match on the same registry;
+// references already rewritten to the private registry (images.registry or
+// images.mirror, see Mirror) match their upstream entry.
+func (l *Lock) Digest(ref string) string {
+	if l == nil {
+		return ""
+	}
+	for _, e := range l.Images {
+		if e.Image == ref {
+			return e.Digest
+		}
+	}
+	want := Parse(ref)
+	mirrored := privateRegistry(want.Registry)
+	for _, e := range l.Images {
+		got := Parse(e.Image)
+		if got.Tag != want.Tag {
+			continue
+		}
+		if got.Registry == want.Registry && got.Repository() == want.Repository() {
+			return e.Digest
+		}
+		if mirrored && got.Path == want.Path {
+			return e.Digest
+		}
+	}
+	return ""
+}
+
+// privateRegistry reports whether host is the registry images are mirrored
+// into: images.registry of air-gapped installs or images.mirror
+func privateRegistry(host string) bool {
+	settings := config.Current().Config.Images
+	for _, reg := range []string{settings.Registry, settings.Mirror} {
+		if _, rest, ok := strings.Cut(reg, "://"); ok {
+			reg = rest
+		}
+		reg = strings.TrimRight(strings.TrimSpace(reg), "/")
+		if reg != "" && reg != DefaultRegistry && reg == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Set pins ref to digest
+func (l *Lock) Set(ref, digest string) {
+	for i := range l.Images {
+		if l.Images[i].Image == ref {
+			l.Images[i].Digest = digest
+			return
+		}
+	}
+	l.Images = append(l.Images, LockEntry{Image: ref, Digest: digest})
+}
+
+// Pin returns ref with its locked digest appended (tag kept for readability).
+// Unlocked or already digest-pinned references are returned unchanged.
+func (l *Lock) Pin(ref string) string {
+	digest := l.Digest(ref)
+	if digest == "" || Parse(ref).Digest != "" {
+		return ref
+	}
+	return ref + "@" + digest
+}
@@ -0,0 +1,76 @@
+package images
+
+import (
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+func TestLockDigest(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Images.Registry = "registry.local:5000"
+	config.SetCurrent(&config.Resolved{Config: cfg})
+	defer config.SetCurrent(nil)
+
+	lock := &Lock{Images: []LockEntry{
+		{Image: "nginx:1.25", Digest: "sha256:hub"},
+		{Image: "quay.io/keycloak/keycloak:24.0", Digest: "sha256:quay"},
+	}}
+	cases := []struct {
+		ref, want string
+	}{
+		{"nginx:1.25", "sha256:hub"},
+		{"docker.io/library/nginx:1.25", "sha256:hub"},
+		{"nginx:1.26", ""},
+		{"registry.local:5000/nginx:1.25", "sha256:hub"},
+		{"registry.local:5000/keycloak/keycloak:24.0", "sha256:quay"},
+		// same path on another public registry is a different image
+		{"ghcr.io/keycloak/keycloak:24.0", ""},
+		{"docker.io/keycloak/keycloak:24.0", ""},
+	}
+	for _, c := range cases {
+		if got := lock.Digest(c.ref); got != c.want {
+			t.Errorf("Digest(%q) = %q, want %q", c.ref, got, c.want)
+		}
+	}
+
+	if got := lock.Pin("nginx:1.25"); got != "nginx:1.25@sha256:hub" {
+		t.Errorf("Pin = %q", got)
+	}
+	if got := (*Lock)(nil).Digest("nginx:1.25"); got != "" {
+		t.Errorf("nil lock Digest = %q", got)
+	}
+}
+
+func TestScanOrder(t *testing.T) {
+	manifest := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: ceres
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: web:1
+      containers:
+      - name: web
+        image: web:1
+      - name: proxy
+        image: nginx:1.25
+`)
+	for i := 0; i < 10; i++ {
+		usages, err := Scan(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range usages {
+			got = append(got, u.Container)
+		}
+		if len(got) != 3 || got[0] != "web" || got[1] != "proxy" || got[2] != "migrate" {
+			t.Fatalf("containers = %v", got)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package images
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Status is the update state of one image
+type Status struct {
+	Image         string
+	Tag           string
+	Latest        string // newest tag of the same shape, "" if Tag is current
+	DigestChanged bool   // the tag now points at a different digest than the lock
+	Err           error
+}
+
+// Outdated reports whether the image has a newer tag or a moved digest
+func (s Status) Outdated() bool {
+	return s.Latest != "" || s.DigestChanged
+}
+
+var digits = regexp.MustCompile(`\d+`)
+
+// tagShape turns "16.1-alpine" into a pattern matching tags of the same form ("N.N-alpine")
+func tagShape(tag string) *regexp.Regexp {
+	parts := digits.Split(tag, -1)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, `(\d+)`) + "$")
+}
+
+// NewerTag returns the highest tag in tags that has the same shape as tag and a
+// greater version, or "" if tag is already the newest. Tags without numbers
+// (latest, lts) never have a newer tag; use the digest check for those.
+func NewerTag(tag string, tags []string) string {
+	if !digits.MatchString(tag) {
+		return ""
+	}
+	shape := tagShape(tag)
+	best, bestNums := "", versionNums(tag)
+	for _, t := range tags {
+		if !shape.MatchString(t) {
+			continue
+		}
+		nums := versionNums(t)
+		if compareNums(nums, bestNums) > 0 {
+			best, bestNums = t, nums
+		}
+	}
+	return best
+}
+
+func versionNums(tag string) []int {
+	var nums []int
+	for _, s := range digits.FindAllString(tag, -1) {
+		n, _ := strconv.Atoi(s)
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+func compareNums(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] > b[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,21 @@
+package images
+
+import "testing"
+
+func TestNewerTag(t *testing.T) {
+	tags := []string{"16.1-alpine", "16.4-alpine", "16.10-alpine", "17.0", "17.0-bookworm", "latest"}
+	cases := []struct {
+		tag, want string
+	}{
+		{"16.1-alpine", "16.10-alpine"},
+		{"16.10-alpine", ""},
+		{"16.4", "17.0"},
+		{"latest", ""},
+		{"17.0-bookworm", ""},
+	}
+	for _, c := range cases {
+		if got := NewerTag(c.tag, tags); got != c.want {
+			t.Errorf("NewerTag(%q) = %q, want %q", c.tag, got, c.want)
+		}
+	}
+}
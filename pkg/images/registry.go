@@ -0,0 +1,230 @@
+package images
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// manifestAccept lists the manifest media types we accept, multi-arch indexes first
+// so the digest matches what `docker pull <tag>` resolves to.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// Registry is a minimal Docker Registry HTTP API v2 client (anonymous or basic auth)
+type Registry struct {
+	// URL, when set, sends every lookup to this registry instead of the image's
+	// own host (mirrors, or a stand-in registry for testing)
+	URL      string
+	Username string
+	Password string
+
+	client *http.Client
+	tokens map[string]string
+}
+
+// NewRegistry creates a registry client. url, default images.mirror, overrides the
+// registry host for all lookups; the user is images.user, the password comes from
+// CERES_REGISTRY_PASSWORD.
+func NewRegistry(url string, insecure bool) *Registry {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	settings := config.Current().Config.Images
+	if strings.TrimSpace(url) == "" {
+		url = settings.Mirror
+	}
+	return &Registry{
+		URL:      strings.TrimRight(strings.TrimSpace(url), "/"),
+		Username: settings.User,
+		Password: os.Getenv("CERES_REGISTRY_PASSWORD"),
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		tokens:   map[string]string{},
+	}
+}
+
+func (r *Registry) baseURL(ref Reference) string {
+	if r.URL != "" {
+		if strings.Contains(r.URL, "://") {
+			return r.URL
+		}
+		return "https://" + r.URL
+	}
+	if ref.Registry == DefaultRegistry {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + ref.Registry
+}
+
+// Digest resolves ref's tag to a manifest digest
+func (r *Registry) Digest(ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", r.baseURL(ref), ref.Repository(), ref.Tag)
+
+	resp, err := r.do(http.MethodHead, u, ref)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry returned %s", ref, resp.Status)
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+
+	// Some registries omit the digest header on HEAD: hash the manifest body
+	resp, err = r.do(http.MethodGet, u, ref)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry returned %s", ref, resp.Status)
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Tags lists all tags of ref's repository
+func (r *Registry) Tags(ref Reference) ([]string, error) {
+	base := r.baseURL(ref)
+	u := fmt.Sprintf("%s/v2/%s/tags/list?n=1000", base, ref.Repository())
+
+	var tags []string
+	for u != "" {
+		resp, err := r.do(http.MethodGet, u, ref)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: registry returned %s", ref.Path, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid tags response: %w", ref.Path, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		u = ""
+		if m := linkNext.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			u = m[1]
+			if strings.HasPrefix(u, "/") {
+				u = base + u
+			}
+		}
+	}
+	return tags, nil
+}
+
+// do performs a request, answering a Bearer challenge with an anonymous (or basic-auth) token
+func (r *Registry) do(method, u string, ref Reference) (*http.Response, error) {
+	key := r.baseURL(ref) + "/" + ref.Repository()
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", manifestAccept)
+		if token := r.tokens[key]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if r.Username != "" {
+			req.SetBasicAuth(r.Username, r.Password)
+		}
+		return r.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("%s: unauthorized", ref.Path)
+	}
+
+	token, err := r.fetchToken(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ref.Path, err)
+	}
+	r.tokens[key] = token
+	return send()
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func (r *Registry) fetchToken(challenge string) (string, error) {
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("auth challenge without realm")
+	}
+
+	q := url.Values{}
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	if s := params["scope"]; s != "" {
+		q.Set("scope", s)
+	}
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
@@ -0,0 +1,85 @@
+package images
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeRegistry is a stand-in registry behind a Bearer challenge, with one
+// repository and two pages of tags
+func fakeRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:library/nginx:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token":"secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:library/nginx:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/library/nginx/manifests/1.25":
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		case "/v2/library/nginx/manifests/1.24":
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, "manifest")
+			}
+		case "/v2/library/nginx/tags/list":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/library/nginx/tags/list?n=1000&last=1.24>; rel="next"`)
+				fmt.Fprint(w, `{"tags":["1.24","1.24"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"tags":["1.25","1.26"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegistryDigest(t *testing.T) {
+	srv := fakeRegistry(t)
+	r := NewRegistry(srv.URL, false)
+
+	d, err := r.Digest(Parse("nginx:1.25"))
+	if err != nil || d != "sha256:abc" {
+		t.Fatalf("Digest = %q, %v", d, err)
+	}
+	// no digest header: sha256 of the manifest body
+	d, err = r.Digest(Parse("nginx:1.24"))
+	if err != nil || d != "sha256:05b3abf2579a5eb66403cd78be557fd860633a1fe2103c7642030defe32c657f" {
+		t.Fatalf("Digest = %q, %v", d, err)
+	}
+	if _, err := r.Digest(Parse("nginx:9.9")); err == nil {
+		t.Error("missing tag resolved")
+	}
+	if d, _ := r.Digest(Parse("nginx@sha256:pinned")); d != "sha256:pinned" {
+		t.Errorf("pinned reference looked up: %q", d)
+	}
+}
+
+func TestRegistryTags(t *testing.T) {
+	srv := fakeRegistry(t)
+	tags, err := NewRegistry(srv.URL, false).Tags(Parse("nginx:1.24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(tags, ","); got != "1.24,1.24,1.25,1.26" {
+		t.Fatalf("tags = %s", got)
+	}
+	if newer := NewerTag("1.24", tags); newer != "1.26" {
+		t.Errorf("NewerTag = %q", newer)
+	}
+}
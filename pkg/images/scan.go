@@ -0,0 +1,82 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Usage is one container image used by a workload
+type Usage struct {
+	Component string // <namespace>/<name> of the workload, or the chart name
+	Kind      string
+	Container string
+	Image     string
+}
+
+// Scan returns the container images of every workload in a multi-document YAML manifest
+func Scan(data []byte) ([]Usage, error) {
+	var out []Usage
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		if doc == nil {
+			continue
+		}
+
+		kind, _ := doc["kind"].(string)
+		meta, _ := doc["metadata"].(map[string]interface{})
+		name, _ := meta["name"].(string)
+		component := name
+		if ns, _ := meta["namespace"].(string); ns != "" {
+			component = ns + "/" + name
+		}
+
+		walkContainers(doc["spec"], func(container, image string) {
+			out = append(out, Usage{Component: component, Kind: kind, Container: container, Image: image})
+		})
+	}
+}
+
+// walkContainers finds containers/initContainers lists anywhere under a spec
+// (Deployment, StatefulSet, Job, CronJob, Pod ...)
+func walkContainers(node interface{}, fn func(container, image string)) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// containers before initContainers, in the same order every run
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := v[key]
+			if key == "containers" || key == "initContainers" {
+				list, _ := child.([]interface{})
+				for _, item := range list {
+					c, _ := item.(map[string]interface{})
+					name, _ := c["name"].(string)
+					if image, _ := c["image"].(string); image != "" {
+						fn(name, image)
+					}
+				}
+				continue
+			}
+			walkContainers(child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkContainers(child, fn)
+		}
+	}
+}
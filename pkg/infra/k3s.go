@@ -0,0 +1,148 @@
+package infra
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SSH runs commands on a new node. Host keys are not checked: the node was
+// just created and its address may have belonged to an earlier one.
+type SSH struct {
+	User string
+	Host string
+	Key  string // private key file, empty for the ssh defaults
+}
+
+func (s SSH) command(command string) *exec.Cmd {
+	args := []string{
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+		"-o", "ConnectTimeout=10",
+		"-o", "BatchMode=yes",
+	}
+	if s.Key != "" {
+		args = append(args, "-i", s.Key)
+	}
+	args = append(args, s.User+"@"+s.Host, command)
+	return exec.Command("ssh", args...)
+}
+
+// Output runs command and returns its standard output
+func (s SSH) Output(command string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := s.command(command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("ssh %s@%s %q: %w: %s", s.User, s.Host, command, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Run runs command with its output on the terminal
+func (s SSH) Run(command string) error {
+	cmd := s.command(command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ssh %s@%s %q: %w", s.User, s.Host, command, err)
+	}
+	return nil
+}
+
+// WaitReady waits until the node accepts SSH logins and cloud-init is done
+func (s SSH) WaitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := s.Output("true")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not accept SSH within %s: %w", s.Host, timeout, err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	// images without cloud-init's status command are ready once SSH is up
+	_, _ = s.Output("command -v cloud-init >/dev/null && sudo cloud-init status --wait >/dev/null || true")
+	return nil
+}
+
+// InstallK3s installs a single k3s server on the node. version empty
+// installs the stable channel. The API certificate also covers address.
+func InstallK3s(s SSH, version, address string) error {
+	env := []string{"INSTALL_K3S_EXEC='server --tls-san " + address + " --write-kubeconfig-mode 600'"}
+	if version != "" {
+		env = append(env, "INSTALL_K3S_VERSION='"+version+"'")
+	}
+	script := "curl -sfL https://get.k3s.io | sudo " + strings.Join(env, " ") + " sh -"
+	return s.Run(script)
+}
+
+// FetchKubeconfig reads the k3s kubeconfig from the node and points it at
+// address instead of 127.0.0.1
+func FetchKubeconfig(s SSH, address string) ([]byte, error) {
+	data, err := s.Output("sudo cat /etc/rancher/k3s/k3s.yaml")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("https://127.0.0.1:6443")) {
+		return nil, fmt.Errorf("unexpected kubeconfig from %s: no server https://127.0.0.1:6443", s.Host)
+	}
+	return bytes.ReplaceAll(data, []byte("https://127.0.0.1:6443"), []byte("https://"+address+":6443")), nil
+}
+
+// WaitNodes waits until the nodes of the cluster are Ready
+func WaitNodes(kubeconfig string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := exec.Command("kubectl", "--kubeconfig", kubeconfig, "wait", "--for=condition=Ready", "nodes", "--all", "--timeout=30s").CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cluster nodes not Ready within %s: %s", timeout, strings.TrimSpace(string(out)))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// SSHKey returns the public key file to authorize on new nodes and its
+// private key, if it is next to it: path, else ~/.ssh/id_ed25519.pub or
+// ~/.ssh/id_rsa.pub
+func SSHKey(path string) (public, private string, err error) {
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519.pub", "id_rsa.pub"} {
+			if p := filepath.Join(home, ".ssh", name); fileExists(p) {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return "", "", fmt.Errorf("no SSH public key in ~/.ssh: create one with ssh-keygen or set cloud.proxmox.vm.sshKey")
+		}
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[2:])
+	}
+	if !fileExists(path) {
+		return "", "", fmt.Errorf("SSH public key %s not found", path)
+	}
+	if p := strings.TrimSuffix(path, ".pub"); p != path && fileExists(p) {
+		private = p
+	}
+	return path, private, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
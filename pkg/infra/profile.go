@@ -0,0 +1,113 @@
+// Package infra creates and removes the machines CERES runs on and keeps a
+// cluster profile for each: where the cluster is and its kubeconfig.
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a cluster created by ceres infra up
+type Profile struct {
+	Name      string    `yaml:"name"`
+	Cloud     string    `yaml:"cloud"`
+	Node      string    `yaml:"node,omitempty"` // Proxmox node of the VM
+	VMID      int       `yaml:"vmid,omitempty"`
+	Cluster   string    `yaml:"cluster,omitempty"`   // EKS, AKS or GKE cluster name
+	Workspace string    `yaml:"workspace,omitempty"` // Terraform workspace
+	Address   string    `yaml:"address"`             // Proxmox: the node; Terraform: the ingress load balancer
+	User      string    `yaml:"user,omitempty"`      // SSH user
+	Created   time.Time `yaml:"created"`
+	Endpoint  string    `yaml:"endpoint"`
+}
+
+// ProfilesDir is the directory of the cluster profiles, next to the CLI
+// config: ~/.ceres/clusters
+func ProfilesDir() string {
+	return filepath.Join(filepath.Dir(config.DefaultPath()), "clusters")
+}
+
+// Dir is the directory of the profile
+func (p *Profile) Dir() string {
+	return filepath.Join(ProfilesDir(), p.Name)
+}
+
+// Kubeconfig is the path of the kubeconfig of the cluster
+func (p *Profile) Kubeconfig() string {
+	return filepath.Join(p.Dir(), "kubeconfig")
+}
+
+// Ready reports why the cluster of the profile cannot be used yet: a run of
+// ceres infra up that failed before the endpoint and kubeconfig were saved
+func (p *Profile) Ready() error {
+	if p.Endpoint == "" {
+		return fmt.Errorf("cluster %s is incomplete: no endpoint yet (run ceres infra up again)", p.Name)
+	}
+	if _, err := os.Stat(p.Kubeconfig()); err != nil {
+		return fmt.Errorf("cluster %s is incomplete: no kubeconfig %s (run ceres infra up again)", p.Name, p.Kubeconfig())
+	}
+	return nil
+}
+
+// Save writes the profile to <dir>/profile.yaml
+func (p *Profile) Save() error {
+	if err := os.MkdirAll(p.Dir(), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", p.Dir(), err)
+	}
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(p.Dir(), "profile.yaml"), data, 0600)
+}
+
+// LoadProfile reads the profile called name
+func LoadProfile(name string) (*Profile, error) {
+	path := filepath.Join(ProfilesDir(), name, "profile.yaml")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no cluster profile %q (%s)", name, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Profiles lists the cluster profiles, sorted by name
+func Profiles() ([]*Profile, error) {
+	entries, err := os.ReadDir(ProfilesDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []*Profile
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if p, err := LoadProfile(e.Name()); err == nil {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Remove deletes the profile and its kubeconfig
+func (p *Profile) Remove() error {
+	return os.RemoveAll(p.Dir())
+}
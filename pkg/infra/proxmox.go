@@ -0,0 +1,247 @@
+package infra
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/proxmox"
+)
+
+// Defaults of cloud.proxmox.vm
+const (
+	DefaultName   = "ceres"
+	DefaultUser   = "ceres"
+	DefaultCores  = 4
+	DefaultMemory = 8192
+)
+
+// VMTag marks the VMs CERES created; ceres proxmox notes sync writes to them
+const VMTag = "ceres"
+
+// Proxmox creates the k3s node as a VM cloned from a cloud-init template
+type Proxmox struct {
+	Client *proxmox.Client
+	VM     config.ProxmoxVM
+}
+
+// NewProxmox returns a provisioner for cloud.proxmox of the current config
+func NewProxmox() (*Proxmox, error) {
+	c, err := proxmox.FromConfig()
+	if err != nil {
+		return nil, err
+	}
+	vm := config.Current().Config.Cloud.Proxmox.VM
+	if vm.Name == "" {
+		vm.Name = DefaultName
+	}
+	if vm.User == "" {
+		vm.User = DefaultUser
+	}
+	if vm.Cores == 0 {
+		vm.Cores = DefaultCores
+	}
+	if vm.Memory == 0 {
+		vm.Memory = DefaultMemory
+	}
+	return &Proxmox{Client: c, VM: vm}, nil
+}
+
+// Up clones the template, configures cloud-init, starts the VM, installs
+// k3s on it and saves the cluster profile with its kubeconfig. An existing
+// complete profile of the same name is returned as it is; one left by a run
+// that failed after the VM started is resumed at the k3s install.
+func (p *Proxmox) Up() (*Profile, error) {
+	vm := p.VM
+	if prof, err := LoadProfile(vm.Name); err == nil {
+		if prof.Ready() == nil {
+			fmt.Printf("✅ Cluster %s already exists: VM %d on %s, %s\n", prof.Name, prof.VMID, prof.Node, prof.Address)
+			return prof, nil
+		}
+		if prof.Address == "" {
+			return prof, fmt.Errorf("cluster %s is incomplete: VM %d on %s was not started; remove it with ceres infra down and run ceres infra up again", prof.Name, prof.VMID, prof.Node)
+		}
+		fmt.Printf("🔁 Resuming cluster %s: VM %d on %s, %s\n", prof.Name, prof.VMID, prof.Node, prof.Address)
+		_, privateKey, err := SSHKey(vm.SSHKey)
+		if err != nil {
+			return prof, err
+		}
+		return p.install(prof, privateKey)
+	}
+	if vm.Template == 0 {
+		return nil, fmt.Errorf("cloud.proxmox.vm.template is not set: the VMID of a cloud-init template")
+	}
+	publicKey, privateKey, err := SSHKey(vm.SSHKey)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := os.ReadFile(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := p.Client.Resolve(proxmox.Target{Type: "node"})
+	if err != nil {
+		return nil, err
+	}
+	vms, err := p.Client.VMs()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vms {
+		if v.Name == vm.Name && v.Template == 0 {
+			return nil, fmt.Errorf("a VM named %s already exists (%s) but there is no cluster profile for it; remove it or set cloud.proxmox.vm.name", vm.Name, v.Target())
+		}
+	}
+	vmid := vm.VMID
+	if vmid == 0 {
+		if vmid, err = p.Client.NextID(); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("🖥️  Cloning template %d into VM %d (%s) on %s...\n", vm.Template, vmid, vm.Name, node.Node)
+	err = p.Client.Clone(proxmox.CloneOptions{Node: node.Node, Template: vm.Template, VMID: vmid, Name: vm.Name, Storage: vm.Storage})
+	if err != nil {
+		return nil, err
+	}
+	// saved right away so ceres infra down can remove a half-made VM
+	prof := &Profile{Name: vm.Name, Cloud: "proxmox", Node: node.Node, VMID: vmid, User: vm.User, Created: time.Now().UTC()}
+	if err := prof.Save(); err != nil {
+		return nil, err
+	}
+
+	ipconfig := "ip=dhcp"
+	if vm.IP != "" && vm.IP != "dhcp" {
+		ipconfig = "ip=" + vm.IP + ",gw=" + vm.Gateway
+	}
+	options := url.Values{
+		"cores":     {strconv.Itoa(vm.Cores)},
+		"memory":    {strconv.Itoa(vm.Memory)},
+		"agent":     {"1"},
+		"tags":      {VMTag},
+		"ciuser":    {vm.User},
+		"sshkeys":   {proxmox.SSHKeys(string(keys))},
+		"ipconfig0": {ipconfig},
+	}
+	fmt.Printf("⚙️  Cloud-init: user %s, key %s, %s\n", vm.User, publicKey, ipconfig)
+	if err := p.Client.Configure(node.Node, vmid, options); err != nil {
+		return prof, err
+	}
+	if vm.Disk != "" {
+		cfg, err := p.Client.VMConfig(node.Node, vmid)
+		if err != nil {
+			return prof, err
+		}
+		disk := proxmox.BootDisk(cfg)
+		if disk == "" {
+			return prof, fmt.Errorf("VM %d has no disk to grow", vmid)
+		}
+		fmt.Printf("💾 Growing %s to %s\n", disk, vm.Disk)
+		if err := p.Client.Resize(node.Node, vmid, disk, vm.Disk); err != nil {
+			return prof, err
+		}
+	}
+	fmt.Println("▶️  Starting VM...")
+	if err := p.Client.Start(node.Node, vmid); err != nil {
+		return prof, err
+	}
+
+	address, err := p.address(node.Node, vmid)
+	if err != nil {
+		return prof, err
+	}
+	prof.Address = address
+	if err := prof.Save(); err != nil {
+		return prof, err
+	}
+	return p.install(prof, privateKey)
+}
+
+// install installs k3s on the started VM of prof and completes the profile
+// with its kubeconfig and endpoint
+func (p *Proxmox) install(prof *Profile, privateKey string) (*Profile, error) {
+	address := prof.Address
+	ssh := SSH{User: prof.User, Host: address, Key: privateKey}
+	fmt.Printf("⏳ Waiting for SSH on %s...\n", address)
+	if err := ssh.WaitReady(10 * time.Minute); err != nil {
+		return prof, err
+	}
+	fmt.Println("📦 Installing k3s...")
+	if err := InstallK3s(ssh, p.VM.K3s, address); err != nil {
+		return prof, err
+	}
+	kubeconfig, err := FetchKubeconfig(ssh, address)
+	if err != nil {
+		return prof, err
+	}
+	if err := os.WriteFile(prof.Kubeconfig(), kubeconfig, 0600); err != nil {
+		return prof, err
+	}
+	prof.Endpoint = "https://" + address + ":6443"
+	if err := prof.Save(); err != nil {
+		return prof, err
+	}
+	fmt.Println("⏳ Waiting for the node to be Ready...")
+	if err := WaitNodes(prof.Kubeconfig(), 5*time.Minute); err != nil {
+		return prof, err
+	}
+	fmt.Printf("✅ Cluster %s is up: %s (kubeconfig %s)\n", prof.Name, prof.Endpoint, prof.Kubeconfig())
+	return prof, nil
+}
+
+// address returns the static address of the VM, else waits for the guest
+// agent to report the one DHCP gave it
+func (p *Proxmox) address(node string, vmid int) (string, error) {
+	if vm := p.VM; vm.IP != "" && vm.IP != "dhcp" {
+		ip, _, err := net.ParseCIDR(vm.IP)
+		if err != nil {
+			return "", fmt.Errorf("cloud.proxmox.vm.ip: %w", err)
+		}
+		return ip.String(), nil
+	}
+	fmt.Println("⏳ Waiting for the guest agent to report the address...")
+	deadline := time.Now().Add(5 * time.Minute)
+	for {
+		address, err := p.Client.GuestAddress(node, vmid)
+		if err != nil {
+			return "", err
+		}
+		if address != "" {
+			return address, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("VM %d reported no address within 5m: install qemu-guest-agent in the template or set cloud.proxmox.vm.ip", vmid)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// Down stops and deletes the VM of the profile and removes the profile
+func (p *Proxmox) Down(prof *Profile) error {
+	if prof.VMID != 0 {
+		fmt.Printf("⏹️  Stopping VM %d on %s...\n", prof.VMID, prof.Node)
+		if err := p.Client.Stop(prof.Node, prof.VMID); err != nil && !notFound(err) {
+			return err
+		}
+		fmt.Printf("🗑️  Deleting VM %d...\n", prof.VMID)
+		if err := p.Client.Destroy(prof.Node, prof.VMID); err != nil && !notFound(err) {
+			return err
+		}
+	}
+	if err := prof.Remove(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Cluster %s removed\n", prof.Name)
+	return nil
+}
+
+// notFound reports whether err says the VM does not exist (any more)
+func notFound(err error) bool {
+	return strings.Contains(err.Error(), "does not exist")
+}
@@ -0,0 +1,281 @@
+package infra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/utils"
+)
+
+// TerraformClouds are the clouds the Terraform in infrastructure/ creates
+// a cluster on
+var TerraformClouds = []string{"aws", "azure", "gcp"}
+
+// IsTerraformCloud reports whether cloud is created with Terraform
+func IsTerraformCloud(cloud string) bool {
+	for _, c := range TerraformClouds {
+		if c == cloud {
+			return true
+		}
+	}
+	return false
+}
+
+// Terraform runs terraform in the infrastructure/ module. Each cloud and
+// environment has its own workspace, <cloud>-<environment>, so their
+// states do not replace each other.
+type Terraform struct {
+	// Bin is the terraform binary: $CERES_TERRAFORM, else terraform
+	Bin         string
+	Dir         string
+	Cloud       string
+	Environment string
+	// Vars are passed as -var; Variables fills in the ones of the config
+	Vars map[string]string
+}
+
+// NewTerraform returns a runner for cloud and environment. dir empty is
+// infrastructure/ of the CERES checkout the command runs in.
+func NewTerraform(cloud, environment, dir string) (*Terraform, error) {
+	if !IsTerraformCloud(cloud) {
+		return nil, fmt.Errorf("no Terraform for cloud %q (%s)", cloud, strings.Join(TerraformClouds, ", "))
+	}
+	if environment == "" {
+		environment = "dev"
+	}
+	if dir == "" {
+		root, err := utils.GetProjectRoot()
+		if err != nil {
+			return nil, fmt.Errorf("infrastructure/ not found: run from the CERES checkout or pass --dir")
+		}
+		dir = filepath.Join(root, "infrastructure")
+	}
+	if !utils.DirExists(dir) {
+		return nil, fmt.Errorf("terraform directory %s not found", dir)
+	}
+	bin := os.Getenv("CERES_TERRAFORM")
+	if bin == "" {
+		bin = "terraform"
+	}
+	if _, err := exec.LookPath(bin); err != nil {
+		return nil, fmt.Errorf("%s not found: install Terraform >= 1.5 or set CERES_TERRAFORM", bin)
+	}
+	return &Terraform{Bin: bin, Dir: dir, Cloud: cloud, Environment: environment, Vars: map[string]string{}}, nil
+}
+
+// Workspace is the Terraform workspace of the cloud and environment
+func (t *Terraform) Workspace() string {
+	return t.Cloud + "-" + t.Environment
+}
+
+// ClusterName is the name Terraform gives the Kubernetes cluster
+func (t *Terraform) ClusterName() string {
+	return "ceres-" + t.Environment
+}
+
+// Variables sets the variables of variables.tf that follow from the
+// config: only the selected cloud is enabled
+func (t *Terraform) Variables(cfg *config.Config) {
+	set := func(k, v string) {
+		if _, ok := t.Vars[k]; !ok && v != "" {
+			t.Vars[k] = v
+		}
+	}
+	set("environment", t.Environment)
+	set("cluster_name", t.ClusterName())
+	set("domain_name", cfg.Platform.Domain)
+	for _, c := range append(TerraformClouds, "proxmox") {
+		set(c+"_enabled", fmt.Sprint(c == t.Cloud))
+	}
+	// "local" is the region of the on-premises default config: keep the
+	// region default of variables.tf
+	region := cfg.Cloud.Region
+	if region == "local" {
+		region = ""
+	}
+	switch t.Cloud {
+	case "aws":
+		set("aws_region", region)
+	case "azure":
+		set("azure_location", region)
+		set("azure_subscription_id", cfg.Cloud.Project)
+	case "gcp":
+		set("gcp_region", region)
+		set("gcp_project_id", cfg.Cloud.Project)
+	}
+}
+
+func (t *Terraform) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(t.Bin, args...)
+	cmd.Dir = t.Dir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_INPUT=0")
+	return cmd
+}
+
+// run runs terraform with its output on the terminal
+func (t *Terraform) run(args ...string) error {
+	cmd := t.command(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("terraform %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// output runs terraform and returns its standard output
+func (t *Terraform) output(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := t.command(args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("terraform %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// varArgs returns -var flags for Vars, sorted by name
+func (t *Terraform) varArgs() []string {
+	names := make([]string, 0, len(t.Vars))
+	for k := range t.Vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var args []string
+	for _, k := range names {
+		args = append(args, "-var", k+"="+t.Vars[k])
+	}
+	return args
+}
+
+// Init initializes the module and selects the workspace, creating it the
+// first time
+func (t *Terraform) Init() error {
+	fmt.Printf("🔧 terraform init (%s)\n", t.Dir)
+	if err := t.run("init", "-input=false"); err != nil {
+		return err
+	}
+	fmt.Printf("📂 Workspace %s\n", t.Workspace())
+	if _, err := t.output("workspace", "select", "-or-create", t.Workspace()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Plan shows what Apply would change. planFile, when set, saves the plan.
+func (t *Terraform) Plan(planFile string) error {
+	args := append([]string{"plan", "-input=false"}, t.varArgs()...)
+	if planFile != "" {
+		args = append(args, "-out", planFile)
+	}
+	return t.run(args...)
+}
+
+// Apply creates or updates the infrastructure, from planFile if set
+func (t *Terraform) Apply(planFile string) error {
+	if planFile != "" {
+		return t.run("apply", "-input=false", planFile)
+	}
+	args := append([]string{"apply", "-input=false", "-auto-approve"}, t.varArgs()...)
+	return t.run(args...)
+}
+
+// Destroy removes the infrastructure of the workspace
+func (t *Terraform) Destroy() error {
+	args := append([]string{"destroy", "-input=false", "-auto-approve"}, t.varArgs()...)
+	return t.run(args...)
+}
+
+// Outputs returns the outputs of the workspace, sensitive ones included
+func (t *Terraform) Outputs() (map[string]any, error) {
+	data, err := t.output("output", "-json")
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]struct {
+		Value any `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("terraform output: %w", err)
+	}
+	out := make(map[string]any, len(raw))
+	for k, v := range raw {
+		out[k] = v.Value
+	}
+	return out, nil
+}
+
+// Profile saves the cluster profile of the workspace from the outputs of
+// outputs.tf: the cluster name and endpoint and the kubeconfig. Clouds
+// whose output is no kubeconfig get one from their CLI (aws, gcloud).
+func (t *Terraform) Profile(name string) (*Profile, error) {
+	outputs, err := t.Outputs()
+	if err != nil {
+		return nil, err
+	}
+	str := func(k string) string {
+		s, _ := outputs[k].(string)
+		return s
+	}
+	cluster := str(t.Cloud + "_cluster_name")
+	if cluster == "" {
+		return nil, fmt.Errorf("terraform output %s_cluster_name is empty: was the %s workspace applied?", t.Cloud, t.Workspace())
+	}
+	prof := &Profile{
+		Name:      name,
+		Cloud:     t.Cloud,
+		Cluster:   cluster,
+		Workspace: t.Workspace(),
+		Created:   time.Now().UTC(),
+		Endpoint:  str(t.Cloud + "_cluster_endpoint"),
+	}
+	if old, err := LoadProfile(name); err == nil {
+		prof.Created, prof.Address = old.Created, old.Address
+	}
+	if prof.Endpoint != "" && !strings.HasPrefix(prof.Endpoint, "https://") {
+		prof.Endpoint = "https://" + prof.Endpoint
+	}
+	if err := prof.Save(); err != nil {
+		return nil, err
+	}
+
+	kubeconfig := []byte(str("kubeconfig_" + t.Cloud))
+	if bytes.Contains(kubeconfig, []byte("clusters:")) {
+		if err := os.WriteFile(prof.Kubeconfig(), kubeconfig, 0600); err != nil {
+			return prof, err
+		}
+	} else if err := t.fetchKubeconfig(prof, outputs); err != nil {
+		return prof, err
+	}
+	return prof, nil
+}
+
+// fetchKubeconfig writes the kubeconfig of the profile with the cloud CLI
+func (t *Terraform) fetchKubeconfig(prof *Profile, outputs map[string]any) error {
+	var cmd *exec.Cmd
+	switch t.Cloud {
+	case "aws":
+		region, _ := outputs["aws_region"].(string)
+		cmd = exec.Command("aws", "eks", "update-kubeconfig", "--name", prof.Cluster, "--region", region, "--kubeconfig", prof.Kubeconfig())
+	case "gcp":
+		location, _ := outputs["gcp_cluster_location"].(string)
+		cmd = exec.Command("gcloud", "container", "clusters", "get-credentials", prof.Cluster, "--location", location)
+		cmd.Env = append(os.Environ(), "KUBECONFIG="+prof.Kubeconfig())
+	default:
+		return fmt.Errorf("terraform output kubeconfig_%s holds no kubeconfig", t.Cloud)
+	}
+	fmt.Printf("🔑 %s\n", strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to get the kubeconfig of %s: %w: %s", prof.Cluster, err, strings.TrimSpace(string(out)))
+	}
+	return os.Chmod(prof.Kubeconfig(), 0600)
+}
@@ -0,0 +1,162 @@
+package infra
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// fakeTerraform is the terraform put on PATH: it logs its arguments to
+// $FAKE_TF_LOG and answers output -json with $FAKE_TF_OUTPUTS
+const fakeTerraform = `#!/bin/sh
+echo "$TF_IN_AUTOMATION $(basename "$PWD") $*" >> "$FAKE_TF_LOG"
+case "$1" in
+output) cat "$FAKE_TF_OUTPUTS" ;;
+workspace) [ "$3" = "-or-create" ] || exit 1 ;;
+esac
+`
+
+func setupTerraform(t *testing.T, outputs string) (dir, log string) {
+	t.Helper()
+	home := t.TempDir()
+	bin := filepath.Join(home, "bin")
+	dir = filepath.Join(home, "infrastructure")
+	for _, d := range []string{bin, dir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(fakeTerraform), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log = filepath.Join(home, "calls")
+	out := filepath.Join(home, "outputs.json")
+	if err := os.WriteFile(out, []byte(outputs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("CERES_TERRAFORM", "")
+	t.Setenv("CERES_CONFIG", filepath.Join(home, ".ceres", "config.yaml"))
+	t.Setenv("FAKE_TF_LOG", log)
+	t.Setenv("FAKE_TF_OUTPUTS", out)
+	return dir, log
+}
+
+func calls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestTerraformRuns(t *testing.T) {
+	dir, log := setupTerraform(t, `{}`)
+	if _, err := NewTerraform("proxmox", "", dir); err == nil {
+		t.Fatal("Terraform for proxmox")
+	}
+	tf, err := NewTerraform("gcp", "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.Workspace() != "gcp-dev" {
+		t.Errorf("Workspace = %s", tf.Workspace())
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Platform.Domain = "ceres.example.com"
+	cfg.Cloud.Region = "local"
+	cfg.Cloud.Project = "acme"
+	tf.Vars["cluster_name"] = "mine"
+	tf.Variables(&cfg)
+
+	if err := tf.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Plan("tf.plan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Apply("tf.plan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := "-var aws_enabled=false -var azure_enabled=false -var cluster_name=mine -var domain_name=ceres.example.com" +
+		" -var environment=dev -var gcp_enabled=true -var gcp_project_id=acme -var proxmox_enabled=false"
+	want := []string{
+		"1 infrastructure init -input=false",
+		"1 infrastructure workspace select -or-create gcp-dev",
+		"1 infrastructure plan -input=false " + vars + " -out tf.plan",
+		"1 infrastructure apply -input=false tf.plan",
+		"1 infrastructure destroy -input=false -auto-approve " + vars,
+	}
+	got := calls(t, log)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("terraform calls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTerraformBinary(t *testing.T) {
+	dir, _ := setupTerraform(t, `{}`)
+	t.Setenv("CERES_TERRAFORM", "/nonexistent/terraform")
+	if _, err := NewTerraform("aws", "prod", dir); err == nil || !strings.Contains(err.Error(), "CERES_TERRAFORM") {
+		t.Errorf("missing binary: %v", err)
+	}
+	if _, err := NewTerraform("aws", "prod", filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing directory accepted")
+	}
+}
+
+func TestTerraformProfile(t *testing.T) {
+	dir, _ := setupTerraform(t, `{
+  "azure_cluster_name": {"value": "ceres-prod", "sensitive": false},
+  "azure_cluster_endpoint": {"value": "ceres-prod.hcp.westeurope.azmk8s.io:443"},
+  "kubeconfig_azure": {"value": "apiVersion: v1\nclusters: []\n", "sensitive": true}
+}`)
+	tf, err := NewTerraform("azure", "prod", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := tf.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs["azure_cluster_name"] != "ceres-prod" {
+		t.Errorf("outputs = %v", outputs)
+	}
+
+	prof, err := tf.Profile("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.Cluster != "ceres-prod" || prof.Workspace != "azure-prod" || prof.Endpoint != "https://ceres-prod.hcp.westeurope.azmk8s.io:443" {
+		t.Errorf("profile = %+v", prof)
+	}
+	if err := prof.Ready(); err != nil {
+		t.Error(err)
+	}
+	loaded, err := LoadProfile("prod")
+	if err != nil || loaded.Endpoint != prof.Endpoint {
+		t.Errorf("LoadProfile = %+v, %v", loaded, err)
+	}
+	if info, err := os.Stat(prof.Kubeconfig()); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("kubeconfig: %v", err)
+	}
+}
+
+func TestTerraformProfileNotApplied(t *testing.T) {
+	dir, _ := setupTerraform(t, `{}`)
+	tf, err := NewTerraform("aws", "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tf.Profile("dev"); err == nil || !strings.Contains(err.Error(), "aws-dev workspace") {
+		t.Errorf("Profile of an empty workspace: %v", err)
+	}
+}
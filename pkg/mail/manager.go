@@ -2,23 +2,25 @@ package mail
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
 )
 
 func isExternalMailMode() bool {
-	mode := strings.TrimSpace(strings.ToLower(os.Getenv("CERES_MAIL_MODE")))
-	if mode == "external" {
-		return true
-	}
-	skip := strings.TrimSpace(strings.ToLower(os.Getenv("CERES_SKIP_MAILCOW")))
-	return skip == "1" || skip == "true" || skip == "yes" || skip == "y" || skip == "on"
+	return config.Current().Config.Mail.Mode == "external"
+}
+
+// smtpSettings returns the SMTP relay settings (mail.smtp)
+func smtpSettings() config.SMTP {
+	return config.Current().Config.Mail.SMTP
 }
 
 // Manager управляет почтовым сервером Mailcow
 type Manager struct {
 	namespace string
+	from      string
 }
 
 // NewManager создает новый менеджер почты
@@ -90,7 +92,7 @@ func (m *Manager) ConfigureSMTP(service string) error {
 func (m *Manager) SendTestEmail(to string) error {
 	fmt.Printf("📬 Отправляем тестовое письмо на %s...\n", to)
 
-	if strings.TrimSpace(os.Getenv("CERES_SMTP_HOST")) != "" {
+	if smtpSettings().Host != "" {
 		return m.SendEmail([]string{to}, "CERES Test Email", "This is a test email from CERES.", nil)
 	}
 
@@ -145,10 +147,10 @@ func (m *Manager) showAccessInfo() {
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	if isExternalMailMode() {
 		fmt.Println("🌐 External mail: configured outside Kubernetes")
-		if h := strings.TrimSpace(os.Getenv("CERES_SMTP_HOST")); h != "" {
-			fmt.Printf("📨 SMTP: %s:%s\n", h, strings.TrimSpace(os.Getenv("CERES_SMTP_PORT")))
+		if smtp := smtpSettings(); smtp.Host != "" {
+			fmt.Printf("📨 SMTP: %s:%d\n", smtp.Host, smtp.Port)
 		} else {
-			fmt.Println("📨 SMTP: (not set) set CERES_SMTP_HOST/CERES_SMTP_PORT/CERES_SMTP_USER/CERES_SMTP_PASS")
+			fmt.Println("📨 SMTP: (not set) set mail.smtp in the config (or CERES_SMTP_HOST/CERES_SMTP_PORT/CERES_SMTP_USER) and the smtp-password secret")
 		}
 		fmt.Println("🔐 IMAP/POP3/Webmail: depends on your external mail solution")
 	} else {
@@ -157,5 +159,5 @@ func (m *Manager) showAccessInfo() {
 		fmt.Println("📬 IMAP: mailcow-imap.mailcow.svc:993")
 		fmt.Println("🔐 Домен: @ceres.local")
 	}
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	fmt.Print("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 }
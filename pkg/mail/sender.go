@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"net"
 	"net/smtp"
-	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/secrets"
 )
 
 type Attachment struct {
@@ -25,13 +27,10 @@ func (m *Manager) SendEmail(to []string, subject, body string, attachments []Att
 	if len(to) == 0 {
 		return fmt.Errorf("no recipients")
 	}
-	from := strings.TrimSpace(os.Getenv("CERES_MAIL_FROM"))
-	if from == "" {
-		from = "admin@ceres.local"
-	}
+	from := m.sender()
 
 	// Preferred: send via real SMTP (supports internet mail server deployments).
-	if strings.TrimSpace(os.Getenv("CERES_SMTP_HOST")) != "" {
+	if smtpSettings().Host != "" {
 		msg, err := buildMIMEMessage(from, to, subject, body, attachments)
 		if err != nil {
 			return err
@@ -58,13 +57,40 @@ func (m *Manager) SendEmail(to []string, subject, body string, attachments []Att
 	return nil
 }
 
+// SetFrom overrides the sender address (mail.from) for this manager
+func (m *Manager) SetFrom(from string) {
+	m.from = strings.TrimSpace(from)
+}
+
+// sender returns the From address: SetFrom, mail.from, else admin@<domain>
+func (m *Manager) sender() string {
+	if m.from != "" {
+		return m.from
+	}
+	cfg := config.Current().Config
+	if cfg.Mail.From != "" {
+		return cfg.Mail.From
+	}
+	return "admin@" + cfg.Platform.Domain
+}
+
 func sendViaSMTP(from string, to []string, msg string) error {
-	host := strings.TrimSpace(os.Getenv("CERES_SMTP_HOST"))
-	port := atoiDefault(os.Getenv("CERES_SMTP_PORT"), 587)
-	user := strings.TrimSpace(os.Getenv("CERES_SMTP_USER"))
-	pass := strings.TrimSpace(os.Getenv("CERES_SMTP_PASS"))
-	useStartTLS := parseBoolDefault(os.Getenv("CERES_SMTP_STARTTLS"), true)
-	useTLS := parseBoolDefault(os.Getenv("CERES_SMTP_TLS"), false) // for implicit TLS (e.g. 465)
+	smtpCfg := smtpSettings()
+	host := smtpCfg.Host
+	port := smtpCfg.Port
+	if port == 0 {
+		port = 587
+	}
+	user := smtpCfg.User
+	pass := ""
+	if user != "" {
+		var err error
+		if pass, err = secrets.Resolve("smtp-password", "CERES_SMTP_PASS"); err != nil {
+			return fmt.Errorf("smtp password not found: set CERES_SMTP_PASS or store smtp-password in the secrets backend: %w", err)
+		}
+	}
+	useStartTLS := smtpCfg.StartTLS
+	useTLS := smtpCfg.TLS // for implicit TLS (e.g. 465)
 
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
 
@@ -126,33 +152,6 @@ func sendViaSMTP(from string, to []string, msg string) error {
 	return nil
 }
 
-func atoiDefault(s string, def int) int {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return def
-	}
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		return def
-	}
-	return n
-}
-
-func parseBoolDefault(s string, def bool) bool {
-	s = strings.TrimSpace(strings.ToLower(s))
-	if s == "" {
-		return def
-	}
-	switch s {
-	case "1", "true", "yes", "y", "on":
-		return true
-	case "0", "false", "no", "n", "off":
-		return false
-	default:
-		return def
-	}
-}
-
 func (m *Manager) getMailcowPodName() (string, error) {
 	cmd := exec.Command("kubectl", "get", "pods", "-n", m.namespace, "-l", "app=mailcow", "-o", "jsonpath={.items[0].metadata.name}")
 	out, err := cmd.Output()
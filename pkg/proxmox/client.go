@@ -0,0 +1,198 @@
+// Package proxmox is a client for the parts of the Proxmox VE API CERES
+// uses: the node and VM inventory, the notes (description) of nodes, VMs
+// and containers, and cloning, configuring and removing the k3s node VM.
+// It authenticates with an API token.
+package proxmox
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/secrets"
+)
+
+// DefaultPort is the port of the Proxmox VE API
+const DefaultPort = 8006
+
+// TokenSecretKey is the secrets backend key of the API token secret
+const TokenSecretKey = "proxmox-token"
+
+// Options configures a Client
+type Options struct {
+	// URL is the API base, e.g. https://pve:8006/api2/json. When empty it
+	// is built from Host and Port.
+	URL  string
+	Host string
+	Port int
+	// TokenID is user@realm!name, Secret the token value
+	TokenID string
+	Secret  string
+	// Insecure accepts a self-signed certificate
+	Insecure bool
+	Timeout  time.Duration
+}
+
+// Client calls the Proxmox VE API
+type Client struct {
+	// Node is the node of targets that name none (cloud.proxmox.node);
+	// when empty the cluster must have a single node
+	Node string
+
+	base string
+	auth string
+	http *http.Client
+}
+
+// New returns a client for opts
+func New(opts Options) (*Client, error) {
+	base := strings.TrimRight(opts.URL, "/")
+	if base == "" {
+		if opts.Host == "" {
+			return nil, fmt.Errorf("proxmox host is not set (cloud.proxmox.host or CERES_PROXMOX_HOST)")
+		}
+		port := opts.Port
+		if port == 0 {
+			port = DefaultPort
+		}
+		base = fmt.Sprintf("https://%s:%d/api2/json", opts.Host, port)
+	}
+	if opts.TokenID == "" || opts.Secret == "" {
+		return nil, fmt.Errorf("proxmox API token is not set (cloud.proxmox.tokenID and the %s secret)", TokenSecretKey)
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- opted in with cloud.proxmox.insecure
+	}
+	return &Client{
+		base: base,
+		auth: "PVEAPIToken=" + opts.TokenID + "=" + opts.Secret,
+		http: &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+// FromConfig returns a client for cloud.proxmox of the current config. The
+// token secret is CERES_PROXMOX_TOKEN, else proxmox-token in the secrets
+// backend (see tokenSecret).
+func FromConfig() (*Client, error) {
+	cfg := config.Current().Config.Cloud.Proxmox
+	if cfg.TokenID == "" {
+		return nil, fmt.Errorf("cloud.proxmox.tokenID is not set (user@realm!name, or CERES_PROXMOX_TOKEN_ID)")
+	}
+	secret, err := tokenSecret()
+	if err != nil {
+		return nil, fmt.Errorf("proxmox API token secret not found: set CERES_PROXMOX_TOKEN, or `ceres secrets set %s` (--backend sops before the cluster exists): %w", TokenSecretKey, err)
+	}
+	c, err := New(Options{Host: cfg.Host, Port: cfg.Port, TokenID: cfg.TokenID, Secret: secret, Insecure: cfg.Insecure})
+	if err != nil {
+		return nil, err
+	}
+	c.Node = cfg.Node
+	return c, nil
+}
+
+// tokenSecret returns CERES_PROXMOX_TOKEN, else proxmox-token in the
+// secrets backend. The kubernetes backend cannot be read before ceres infra
+// up created the cluster, so then the sops file of the checkout is tried.
+func tokenSecret() (string, error) {
+	secret, err := secrets.Resolve(TokenSecretKey, "CERES_PROXMOX_TOKEN")
+	if err == nil || errors.Is(err, secrets.ErrNotFound) {
+		return secret, err
+	}
+	opts := secrets.DefaultOptions()
+	if opts.Backend != "" && opts.Backend != secrets.BackendKubernetes {
+		return "", err
+	}
+	local, lerr := secrets.Open(secrets.Options{Backend: secrets.BackendSOPS, File: opts.File})
+	if lerr != nil {
+		return "", err
+	}
+	if v, lerr := local.Get(TokenSecretKey); lerr == nil {
+		return v, nil
+	}
+	return "", err
+}
+
+// Error is an API error response
+type Error struct {
+	Method string
+	Path   string
+	Status int
+	// Message is the reason Proxmox gives, with the failed parameters
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("proxmox %s %s: %d %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// do calls the API and decodes the data member of the response into out
+func (c *Client) do(method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.auth)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxmox %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("proxmox %s %s: %w", method, path, err)
+	}
+
+	var envelope struct {
+		Data   json.RawMessage   `json:"data"`
+		Errors map[string]string `json:"errors"`
+	}
+	_ = json.Unmarshal(data, &envelope)
+	if resp.StatusCode/100 != 2 {
+		// the reason is in the status line, e.g. "401 authentication failure"
+		msg := strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)))
+		for k, v := range envelope.Errors {
+			msg += fmt.Sprintf("; %s: %s", k, strings.TrimSpace(v))
+		}
+		return &Error{Method: method, Path: path, Status: resp.StatusCode, Message: msg}
+	}
+	if out == nil || len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("proxmox %s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+// Version returns the Proxmox VE version, e.g. "8.2.4"
+func (c *Client) Version() (string, error) {
+	var v struct {
+		Version string `json:"version"`
+	}
+	if err := c.do("GET", "/version", nil, &v); err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
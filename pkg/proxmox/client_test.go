@@ -0,0 +1,188 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeAPI is a stand-in Proxmox VE API with one node, a tagged VM, a
+// container and a template
+type fakeAPI struct {
+	notes map[string]string // config path → description
+	calls []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "PVEAPIToken=ceres@pve!ci=secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api2/json")
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	f.calls = append(f.calls, r.Method+" "+path)
+	reply := func(data any) {
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}
+	switch {
+	case path == "/version":
+		reply(map[string]string{"version": "8.2.4"})
+	case path == "/nodes":
+		reply([]map[string]any{{"node": "pve", "status": "online"}})
+	case path == "/cluster/resources?type=vm":
+		reply([]map[string]any{
+			{"vmid": 9000, "name": "ubuntu-template", "node": "pve", "type": "qemu", "tags": "ceres", "template": 1},
+			{"vmid": 101, "name": "db", "node": "pve", "type": "lxc"},
+			{"vmid": 100, "name": "k3s", "node": "pve", "type": "qemu", "tags": "k8s;ceres"},
+		})
+	case path == "/cluster/nextid":
+		reply("102")
+	case strings.HasSuffix(path, "/config") && r.Method == "GET":
+		reply(map[string]string{"description": f.notes[path]})
+	case strings.HasSuffix(path, "/config") && r.Method == "PUT":
+		r.ParseForm()
+		f.notes[path] = r.PostForm.Get("description")
+		reply(nil)
+	case path == "/nodes/pve/qemu/9000/clone":
+		r.ParseForm()
+		if r.PostForm.Get("newid") != "102" || r.PostForm.Get("full") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(nil)
+			return
+		}
+		reply("UPID:pve:0001:0002:0003:qmclone:9000:ceres@pve!ci:")
+	case strings.HasPrefix(path, "/nodes/pve/tasks/"):
+		reply(map[string]string{"status": "stopped", "exitstatus": "OK", "type": "qmclone"})
+	case path == "/nodes/pve/qemu/102/agent/network-get-interfaces":
+		w.WriteHeader(http.StatusInternalServerError)
+		reply(nil)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"data": nil, "errors": map[string]string{"vmid": "invalid format\n"}})
+	}
+}
+
+func newFake(t *testing.T) (*Client, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{notes: map[string]string{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	c, err := New(Options{URL: srv.URL + "/api2/json/", TokenID: "ceres@pve!ci", Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, api
+}
+
+func TestInventory(t *testing.T) {
+	c, _ := newFake(t)
+	if v, err := c.Version(); err != nil || v != "8.2.4" {
+		t.Fatalf("Version = %q, %v", v, err)
+	}
+	vms, err := c.VMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vms) != 3 || vms[0].VMID != 100 || vms[2].VMID != 9000 {
+		t.Fatalf("VMs not sorted by VMID: %+v", vms)
+	}
+	targets, err := c.DefaultTargets("ceres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the template carries the tag too, but has no notes to sync
+	if len(targets) != 1 || targets[0].String() != "qemu/100" {
+		t.Errorf("DefaultTargets = %v", targets)
+	}
+	targets, _ = c.DefaultTargets("missing")
+	if len(targets) != 1 || targets[0].Type != "node" {
+		t.Errorf("DefaultTargets without tagged VMs = %v", targets)
+	}
+}
+
+func TestSyncNotes(t *testing.T) {
+	c, api := newFake(t)
+	api.notes["/nodes/pve/lxc/101/config"] = "Operator notes"
+
+	targets := []Target{{Type: "lxc", VMID: 101}, {Type: "node"}}
+	res, err := c.SyncNotes(targets, "status: ok", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || !res[0].Changed || res[0].Target.Node != "pve" || res[1].Target.String() != "node/pve" {
+		t.Fatalf("dry run = %+v", res)
+	}
+	if api.notes["/nodes/pve/lxc/101/config"] != "Operator notes" {
+		t.Fatal("dry run wrote notes")
+	}
+
+	if _, err := c.SyncNotes(targets, "status: ok", false); err != nil {
+		t.Fatal(err)
+	}
+	want := "Operator notes\n\n" + NotesBegin + "\nstatus: ok\n" + NotesEnd
+	if got := api.notes["/nodes/pve/lxc/101/config"]; got != want {
+		t.Errorf("notes = %q, want %q", got, want)
+	}
+	res, _ = c.SyncNotes(targets, "status: ok", false)
+	if res[0].Changed || res[1].Changed {
+		t.Errorf("unchanged notes rewritten: %+v", res)
+	}
+
+	if _, err := c.Resolve(Target{Type: "qemu", VMID: 555}); err == nil {
+		t.Error("missing VM resolved")
+	}
+}
+
+func TestCloneAndErrors(t *testing.T) {
+	c, api := newFake(t)
+	id, err := c.NextID()
+	if err != nil || id != 102 {
+		t.Fatalf("NextID = %d, %v", id, err)
+	}
+	if err := c.Clone(CloneOptions{Node: "pve", Template: 9000, VMID: id, Name: "k3s"}); err != nil {
+		t.Fatal(err)
+	}
+	if last := api.calls[len(api.calls)-1]; !strings.HasPrefix(last, "GET /nodes/pve/tasks/UPID") {
+		t.Errorf("clone task not waited for: %s", last)
+	}
+
+	// the guest agent is not running yet
+	if addr, err := c.GuestAddress("pve", 102); err != nil || addr != "" {
+		t.Errorf("GuestAddress = %q, %v", addr, err)
+	}
+
+	err = c.Resize("pve", 999, "scsi0", "64G")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != 400 || !strings.Contains(apiErr.Message, "vmid: invalid format") {
+		t.Errorf("Resize error = %v", err)
+	}
+
+	bad, err := New(Options{URL: c.base, TokenID: "ceres@pve!ci", Secret: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bad.Version(); !errors.As(err, &apiErr) || apiErr.Status != 401 {
+		t.Errorf("Version with a wrong token = %v", err)
+	}
+}
+
+func TestMergeNotes(t *testing.T) {
+	block := NotesBegin + "\nnew\n" + NotesEnd
+	cases := []struct {
+		existing, want string
+	}{
+		{"", block},
+		{"keep\n", "keep\n\n" + block},
+		{"before\n" + NotesBegin + "\nold\n" + NotesEnd + "\nafter", "before\n" + block + "\nafter"},
+	}
+	for _, c := range cases {
+		if got := MergeNotes(c.existing, "new\n"); got != c.want {
+			t.Errorf("MergeNotes(%q) = %q, want %q", c.existing, got, c.want)
+		}
+	}
+}
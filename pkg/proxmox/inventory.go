@@ -0,0 +1,156 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node is a cluster node
+type Node struct {
+	Name   string  `json:"node"`
+	Status string  `json:"status"`
+	CPU    float64 `json:"cpu"`
+	MaxCPU int     `json:"maxcpu"`
+	Mem    int64   `json:"mem"`
+	MaxMem int64   `json:"maxmem"`
+	Uptime int64   `json:"uptime"`
+}
+
+// VM is a QEMU virtual machine or an LXC container
+type VM struct {
+	VMID     int    `json:"vmid"`
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	Type     string `json:"type"` // qemu or lxc
+	Status   string `json:"status"`
+	Tags     string `json:"tags"` // separated by ";"
+	Template int    `json:"template"`
+	MaxMem   int64  `json:"maxmem"`
+	MaxCPU   int    `json:"maxcpu"`
+}
+
+// HasTag reports whether the VM carries tag
+func (v VM) HasTag(tag string) bool {
+	for _, t := range strings.FieldsFunc(v.Tags, func(r rune) bool { return r == ';' || r == ',' || r == ' ' }) {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Target returns the notes target of the VM
+func (v VM) Target() Target {
+	return Target{Node: v.Node, Type: v.Type, VMID: v.VMID}
+}
+
+// Nodes lists the cluster nodes, sorted by name
+func (c *Client) Nodes() ([]Node, error) {
+	var nodes []Node
+	if err := c.do("GET", "/nodes", nil, &nodes); err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+// VMs lists the VMs and containers of all nodes, sorted by VMID
+func (c *Client) VMs() ([]VM, error) {
+	var vms []VM
+	if err := c.do("GET", "/cluster/resources?type=vm", nil, &vms); err != nil {
+		return nil, err
+	}
+	sort.Slice(vms, func(i, j int) bool { return vms[i].VMID < vms[j].VMID })
+	return vms, nil
+}
+
+// Target is an object with notes: a node, a VM or a container
+type Target struct {
+	Node string
+	Type string // node, qemu or lxc
+	VMID int
+}
+
+// ParseTarget parses "node", "node/<name>", "qemu/<vmid>" or "lxc/<vmid>"
+func ParseTarget(s string) (Target, error) {
+	kind, id, _ := strings.Cut(strings.TrimSpace(s), "/")
+	switch kind {
+	case "node":
+		return Target{Type: "node", Node: id}, nil
+	case "qemu", "lxc":
+		vmid, err := strconv.Atoi(id)
+		if err != nil || vmid <= 0 {
+			return Target{}, fmt.Errorf("invalid target %q: %s needs a VMID, e.g. %s/100", s, kind, kind)
+		}
+		return Target{Type: kind, VMID: vmid}, nil
+	}
+	return Target{}, fmt.Errorf("invalid target %q (node, node/<name>, qemu/<vmid> or lxc/<vmid>)", s)
+}
+
+func (t Target) String() string {
+	if t.Type == "node" {
+		return "node/" + t.Node
+	}
+	return fmt.Sprintf("%s/%d", t.Type, t.VMID)
+}
+
+// configPath is the API path holding the description of t
+func (t Target) configPath() string {
+	if t.Type == "node" {
+		return "/nodes/" + url.PathEscape(t.Node) + "/config"
+	}
+	return fmt.Sprintf("/nodes/%s/%s/%d/config", url.PathEscape(t.Node), t.Type, t.VMID)
+}
+
+// Resolve fills in the node of t: the node a VM runs on, else c.Node,
+// else the only node of the cluster
+func (c *Client) Resolve(t Target) (Target, error) {
+	if t.Node != "" {
+		return t, nil
+	}
+	if t.Type != "node" {
+		vms, err := c.VMs()
+		if err != nil {
+			return t, err
+		}
+		for _, vm := range vms {
+			if vm.VMID == t.VMID && vm.Type == t.Type {
+				t.Node = vm.Node
+				return t, nil
+			}
+		}
+		return t, fmt.Errorf("%s not found", t)
+	}
+	if c.Node != "" {
+		t.Node = c.Node
+		return t, nil
+	}
+	nodes, err := c.Nodes()
+	if err != nil {
+		return t, err
+	}
+	if len(nodes) != 1 {
+		return t, fmt.Errorf("the cluster has %d nodes: set cloud.proxmox.node or name one (node/<name>)", len(nodes))
+	}
+	t.Node = nodes[0].Name
+	return t, nil
+}
+
+// Description returns the notes of t
+func (c *Client) Description(t Target) (string, error) {
+	var cfg struct {
+		Description string `json:"description"`
+	}
+	if err := c.do("GET", t.configPath(), nil, &cfg); err != nil {
+		return "", err
+	}
+	return cfg.Description, nil
+}
+
+// SetDescription replaces the notes of t
+func (c *Client) SetDescription(t Target, description string) error {
+	return c.do("PUT", t.configPath(), url.Values{"description": {description}}, nil)
+}
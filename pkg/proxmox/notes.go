@@ -0,0 +1,78 @@
+package proxmox
+
+import "strings"
+
+// Markers delimit the generated part of the notes; the text around them is
+// the operator's and is kept. The proxmox-notes-updater CronJob uses the
+// same markers.
+const (
+	NotesBegin = "<!-- CERES-AUTO-NOTES:BEGIN -->"
+	NotesEnd   = "<!-- CERES-AUTO-NOTES:END -->"
+)
+
+// MergeNotes replaces the generated block of existing with payload, or
+// appends the block when there is none
+func MergeNotes(existing, payload string) string {
+	block := NotesBegin + "\n" + strings.TrimRight(payload, "\n") + "\n" + NotesEnd
+	if strings.TrimSpace(existing) == "" {
+		return block
+	}
+	if i := strings.Index(existing, NotesBegin); i >= 0 {
+		if j := strings.Index(existing[i:], NotesEnd); j >= 0 {
+			return existing[:i] + block + existing[i+j+len(NotesEnd):]
+		}
+	}
+	return strings.TrimRight(existing, "\n") + "\n\n" + block
+}
+
+// SyncResult is the outcome of syncing the notes of one target
+type SyncResult struct {
+	Target  Target
+	Changed bool
+	Notes   string
+}
+
+// SyncNotes writes payload into the generated block of each target's notes.
+// Targets whose notes already hold it are left alone; with dryRun nothing
+// is written.
+func (c *Client) SyncNotes(targets []Target, payload string, dryRun bool) ([]SyncResult, error) {
+	var results []SyncResult
+	for _, t := range targets {
+		t, err := c.Resolve(t)
+		if err != nil {
+			return results, err
+		}
+		existing, err := c.Description(t)
+		if err != nil {
+			return results, err
+		}
+		notes := MergeNotes(existing, payload)
+		res := SyncResult{Target: t, Changed: notes != existing, Notes: notes}
+		if res.Changed && !dryRun {
+			if err := c.SetDescription(t, notes); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// DefaultTargets returns the VMs and containers tagged tag, or the node
+// when none is
+func (c *Client) DefaultTargets(tag string) ([]Target, error) {
+	vms, err := c.VMs()
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	for _, vm := range vms {
+		if vm.Template == 0 && vm.HasTag(tag) {
+			targets = append(targets, vm.Target())
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, Target{Type: "node"})
+	}
+	return targets, nil
+}
@@ -0,0 +1,45 @@
+package proxmox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+func TestTokenSecret(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		// no cluster yet
+		"kubectl": "#!/bin/sh\necho 'Unable to connect to the server' >&2\nexit 1\n",
+		"sops":    "#!/bin/sh\necho '{\"proxmox-token\": \"from-sops\"}'\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv("CERES_PROXMOX_TOKEN", "")
+
+	cfg := config.DefaultConfig()
+	cfg.Secrets.File = filepath.Join(dir, "secrets.enc.yaml")
+	config.SetCurrent(&config.Resolved{Config: cfg})
+	defer config.SetCurrent(nil)
+
+	if _, err := tokenSecret(); err == nil {
+		t.Error("token found without a cluster or sops file")
+	}
+	if err := os.WriteFile(cfg.Secrets.File, []byte("sops: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := tokenSecret(); err != nil || secret != "from-sops" {
+		t.Errorf("tokenSecret = %q, %v", secret, err)
+	}
+
+	t.Setenv("CERES_PROXMOX_TOKEN", "from-env")
+	if secret, err := tokenSecret(); err != nil || secret != "from-env" {
+		t.Errorf("tokenSecret = %q, %v", secret, err)
+	}
+}
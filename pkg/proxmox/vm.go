@@ -0,0 +1,176 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NextID returns a free VMID
+func (c *Client) NextID() (int, error) {
+	var id json.Number
+	if err := c.do("GET", "/cluster/nextid", nil, &id); err != nil {
+		return 0, err
+	}
+	n, err := id.Int64()
+	return int(n), err
+}
+
+// qemuPath is the API path of a QEMU VM, with suffix appended
+func qemuPath(node string, vmid int, suffix string) string {
+	return fmt.Sprintf("/nodes/%s/qemu/%d%s", url.PathEscape(node), vmid, suffix)
+}
+
+// task calls an API method that runs as a task and waits for it
+func (c *Client) task(method, path string, form url.Values, timeout time.Duration) error {
+	var upid string
+	if err := c.do(method, path, form, &upid); err != nil {
+		return err
+	}
+	if upid == "" {
+		return nil
+	}
+	return c.Wait(upid, timeout)
+}
+
+// Wait waits for the task upid to finish and returns its failure
+func (c *Client) Wait(upid string, timeout time.Duration) error {
+	// UPID:<node>:<pid>:<pstart>:<starttime>:<type>:<id>:<user>:
+	parts := strings.Split(upid, ":")
+	if len(parts) < 3 || parts[0] != "UPID" {
+		return fmt.Errorf("invalid task ID %q", upid)
+	}
+	path := "/nodes/" + url.PathEscape(parts[1]) + "/tasks/" + url.PathEscape(upid) + "/status"
+	deadline := time.Now().Add(timeout)
+	for {
+		var st struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+			Type       string `json:"type"`
+		}
+		if err := c.do("GET", path, nil, &st); err != nil {
+			return err
+		}
+		if st.Status == "stopped" {
+			if st.ExitStatus != "OK" && !strings.HasPrefix(st.ExitStatus, "WARNINGS") {
+				return fmt.Errorf("proxmox task %s failed: %s", st.Type, st.ExitStatus)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proxmox task %s did not finish within %s", upid, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// CloneOptions describes a full clone of a template
+type CloneOptions struct {
+	Node     string
+	Template int
+	VMID     int
+	Name     string
+	Storage  string // empty: the storage of the template disks
+}
+
+// Clone makes a full clone of a template and waits for the copy
+func (c *Client) Clone(opts CloneOptions) error {
+	form := url.Values{
+		"newid": {strconv.Itoa(opts.VMID)},
+		"name":  {opts.Name},
+		"full":  {"1"},
+	}
+	if opts.Storage != "" {
+		form.Set("storage", opts.Storage)
+	}
+	return c.task("POST", qemuPath(opts.Node, opts.Template, "/clone"), form, 15*time.Minute)
+}
+
+// VMConfig returns the configuration of a QEMU VM
+func (c *Client) VMConfig(node string, vmid int) (map[string]any, error) {
+	var cfg map[string]any
+	if err := c.do("GET", qemuPath(node, vmid, "/config"), nil, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Configure sets options of a QEMU VM, e.g. cores, memory and the
+// cloud-init settings (ciuser, sshkeys, ipconfig0)
+func (c *Client) Configure(node string, vmid int, options url.Values) error {
+	return c.do("PUT", qemuPath(node, vmid, "/config"), options, nil)
+}
+
+// SSHKeys encodes public keys for the sshkeys option, which Proxmox
+// expects URL-encoded inside the form
+func SSHKeys(keys string) string {
+	return strings.ReplaceAll(url.QueryEscape(strings.TrimSpace(keys)), "+", "%20")
+}
+
+// BootDisk returns the first disk of a VM config: scsi0, virtio0, sata0 or ide0
+func BootDisk(cfg map[string]any) string {
+	for _, d := range []string{"scsi0", "virtio0", "sata0", "ide0"} {
+		if v, ok := cfg[d].(string); ok && !strings.Contains(v, "media=cdrom") {
+			return d
+		}
+	}
+	return ""
+}
+
+// Resize grows a disk of a QEMU VM to size, e.g. "64G"
+func (c *Client) Resize(node string, vmid int, disk, size string) error {
+	form := url.Values{"disk": {disk}, "size": {size}}
+	return c.task("PUT", qemuPath(node, vmid, "/resize"), form, 5*time.Minute)
+}
+
+// Start starts a QEMU VM
+func (c *Client) Start(node string, vmid int) error {
+	return c.task("POST", qemuPath(node, vmid, "/status/start"), url.Values{}, 5*time.Minute)
+}
+
+// Stop stops a QEMU VM immediately
+func (c *Client) Stop(node string, vmid int) error {
+	return c.task("POST", qemuPath(node, vmid, "/status/stop"), url.Values{}, 5*time.Minute)
+}
+
+// Destroy deletes a stopped QEMU VM with its disks, and removes it from
+// backup jobs and HA
+func (c *Client) Destroy(node string, vmid int) error {
+	return c.task("DELETE", qemuPath(node, vmid, "?purge=1&destroy-unreferenced-disks=1"), nil, 10*time.Minute)
+}
+
+// GuestAddress returns the first IPv4 address the guest agent reports
+// outside loopback, or "" while the agent is not running yet
+func (c *Client) GuestAddress(node string, vmid int) (string, error) {
+	var out struct {
+		Result []struct {
+			Name        string `json:"name"`
+			IPAddresses []struct {
+				Type    string `json:"ip-address-type"`
+				Address string `json:"ip-address"`
+			} `json:"ip-addresses"`
+		} `json:"result"`
+	}
+	if err := c.do("GET", qemuPath(node, vmid, "/agent/network-get-interfaces"), nil, &out); err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Status == 500 {
+			// "QEMU guest agent is not running"
+			return "", nil
+		}
+		return "", err
+	}
+	for _, iface := range out.Result {
+		for _, a := range iface.IPAddresses {
+			ip := net.ParseIP(a.Address)
+			if a.Type == "ipv4" && ip != nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+				return a.Address, nil
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,220 @@
+package secrets
+
+// Engines the catalog distinguishes. The kubectl engine (deployment/*.yaml)
+// reads app-facing Secrets that ceres writes; the ceres-platform chart renders
+// its own Secrets from the values ceres passes in.
+const (
+	EngineKubectl = "kubectl"
+	EngineHelm    = "helm"
+)
+
+// Catalog lists every generated credential, in rotation-safe order
+var Catalog = []Credential{
+	{
+		Component:   "postgresql",
+		Description: "PostgreSQL superuser password",
+		Env:         "CERES_POSTGRES_PASSWORD",
+		Targets: []Target{
+			kubectl("ceres-core", "postgresql-secret", "postgres-password"),
+			// CloudNativePG superuser in ha mode; the operator applies it
+			kubectl("ceres-core", "postgresql-superuser", "password"),
+			helm("ceres", "ceres-secrets", "POSTGRES_PASSWORD"),
+		},
+		HelmValues: []string{"postgresql.auth.password"},
+		Apply:      alterSuperuser,
+	},
+	{
+		Component:   "redis",
+		Description: "Redis password",
+		Env:         "CERES_REDIS_PASSWORD",
+		Targets: []Target{
+			kubectl("ceres-core", "redis-secret", "redis-password"),
+			kubectl("gitlab", "gitlab-secret", "redis-password"),
+			helm("ceres", "ceres-secrets", "REDIS_PASSWORD"),
+			helm("gitlab", "gitlab-secret", "redis-password"),
+		},
+		HelmValues: []string{"redis.auth.password"},
+		// Redis takes the password from its environment: restart it first
+		Dependents: []Workload{
+			deployment(EngineKubectl, "ceres-core", "redis"),
+			statefulSet(EngineKubectl, "ceres-core", "redis-node"),
+			deployment(EngineKubectl, "ceres-core", "redis-proxy"),
+			statefulSet(EngineHelm, "ceres", "redis"),
+			deployment("", "gitlab", "gitlab"),
+		},
+	},
+	{
+		Component:   "keycloak",
+		Description: "Keycloak admin password (master realm)",
+		Env:         "CERES_KEYCLOAK_ADMIN_PASSWORD",
+		Targets: []Target{
+			kubectl("ceres", "keycloak-secret", "admin-password"),
+			helm("ceres", "ceres-secrets", "KEYCLOAK_ADMIN_PASSWORD"),
+		},
+		HelmValues: []string{"keycloak.auth.adminPassword"},
+		Apply:      resetKeycloakAdmin,
+	},
+	{
+		Component:   "grafana",
+		Description: "Grafana admin password",
+		Env:         "CERES_GRAFANA_ADMIN_PASSWORD",
+		Targets: []Target{
+			kubectl("monitoring", "grafana-secret", "admin-password"),
+			helm("monitoring", "grafana-secret", "admin-password"),
+		},
+		HelmValues: []string{"grafana.adminPassword"},
+		Apply:      resetGrafanaAdmin,
+		Dependents: []Workload{deployment("", "monitoring", "grafana")},
+	},
+	{
+		Component:   "gitlab",
+		Description: "GitLab root password",
+		Env:         "CERES_GITLAB_ROOT_PASSWORD",
+		Targets: []Target{
+			kubectl("gitlab", "gitlab-secret", "root-password"),
+			helm("gitlab", "gitlab-secret", "root-password"),
+			helm("ceres", "ceres-secrets", "GITLAB_ROOT_PASSWORD"),
+		},
+		HelmValues: []string{"gitlab.initialRootPassword"},
+		Apply:      resetGitLabRoot,
+	},
+	{
+		Component:   "nextcloud",
+		Description: "Nextcloud admin password",
+		Env:         "CERES_NEXTCLOUD_ADMIN_PASSWORD",
+		Targets: []Target{
+			kubectl("nextcloud", "nextcloud-secret", "admin-password"),
+			helm("nextcloud", "nextcloud-secret", "admin-password"),
+			helm("ceres", "ceres-secrets", "NEXTCLOUD_ADMIN_PASSWORD"),
+		},
+		HelmValues: []string{"nextcloud.admin.password"},
+		Apply:      resetNextcloudAdmin,
+	},
+	{
+		Component:   "minio",
+		Description: "MinIO root password",
+		Env:         "CERES_MINIO_ROOT_PASSWORD",
+		Targets: []Target{
+			kubectl("minio", "minio-secret", "root-password"),
+			// the logical database backups upload with it (pkg/db)
+			kubectl("ceres-core", "postgresql-backup-s3", "secret-key"),
+			helm("minio", "minio-secret", "root-password"),
+			helm("ceres", "ceres-secrets", "MINIO_ROOT_PASSWORD"),
+		},
+		HelmValues: []string{"minio.rootPassword"},
+		Dependents: []Workload{deployment("", "minio", "minio")},
+	},
+	{
+		Component:   "vault",
+		Description: "Vault dev-mode root token",
+		Env:         "CERES_VAULT_ROOT_TOKEN",
+		Targets: []Target{
+			kubectl("vault", "vault-secret", "root-token"),
+			helm("vault", "vault-secret", "root-token"),
+			helm("ceres", "ceres-secrets", "VAULT_DEV_ROOT_TOKEN"),
+		},
+		HelmValues: []string{"vault.devRootToken"},
+		Dependents: []Workload{deployment("", "vault", "vault")},
+	},
+	{
+		Component:   "oauth2-proxy",
+		Description: "oauth2-proxy cookie secret (rotating signs everyone out)",
+		Env:         "OAUTH2_PROXY_COOKIE_SECRET",
+		Generate:    randomBase64,
+		Targets: []Target{
+			kubectl("oauth2-proxy", "oauth2-proxy-secret", "cookie-secret"),
+		},
+		Dependents: []Workload{deployment(EngineKubectl, "oauth2-proxy", "oauth2-proxy")},
+	},
+	{
+		Component:   "rabbitmq",
+		Description: "RabbitMQ admin password",
+		Env:         "CERES_RABBITMQ_PASSWORD",
+		Targets: []Target{
+			kubectl("rabbitmq", "rabbitmq-secret", "password"),
+		},
+		// The default user is only created with an empty data directory
+		NoRotate: true,
+	},
+	{
+		Component:   "harbor",
+		Description: "Harbor admin password",
+		Env:         "CERES_HARBOR_ADMIN_PASSWORD",
+		Targets: []Target{
+			kubectl("harbor", "harbor-secret", "admin-password"),
+		},
+		NoRotate: true,
+	},
+	{
+		Component:   "harbor-core",
+		Description: "Harbor core shared secret",
+		Targets: []Target{
+			kubectl("harbor", "harbor-secret", "core-secret"),
+		},
+		Dependents: []Workload{deployment(EngineKubectl, "harbor", "harbor-core")},
+	},
+
+	// Per-application database users: the ceres-platform chart's, and on the
+	// kubectl engine the owner roles of `ceres db` (pkg/db)
+	appDatabase("keycloak", "KEYCLOAK_DB_PASSWORD",
+		[]Target{kubectl("ceres", "keycloak-secret", "db-password")},
+		deployment(EngineHelm, "ceres", "keycloak"), deployment(EngineKubectl, "ceres", "keycloak")),
+	appDatabase("gitlab", "GITLAB_DB_PASSWORD",
+		[]Target{helm("gitlab", "gitlab-secret", "db-password"), kubectl("gitlab", "gitlab-secret", "db-password")},
+		deployment("", "gitlab", "gitlab")),
+	appDatabase("nextcloud", "NEXTCLOUD_DB_PASSWORD",
+		[]Target{helm("nextcloud", "nextcloud-secret", "db-password"), kubectl("nextcloud", "nextcloud-secret", "db-password")},
+		deployment("", "nextcloud", "nextcloud")),
+	appDatabase("mattermost", "MATTERMOST_POSTGRES_PASSWORD",
+		[]Target{embedded("mattermost", "mattermost-secret", "datasource"), kubectl("mattermost", "mattermost-secret", "db-password")},
+		deployment("", "mattermost", "mattermost")),
+	appDatabase("redmine", "REDMINE_DB_PASSWORD",
+		[]Target{helm("redmine", "redmine-secret", "db-password"), kubectl("redmine", "redmine-secret", "db-password")},
+		deployment("", "redmine", "redmine")),
+	appDatabase("wiki", "WIKI_DB_PASSWORD",
+		[]Target{helm("wiki", "wikijs-secret", "db-password"), kubectl("wiki", "wikijs-secret", "db-password")},
+		deployment("", "wiki", "wikijs")),
+	{
+		Component:   "sonarqube-db",
+		Description: "PostgreSQL password of the sonarqube database user",
+		Targets:     []Target{kubectl("sonarqube", "sonarqube-secret", "db-password")},
+		Apply:       alterAppUser("sonarqube"),
+		Dependents:  []Workload{deployment(EngineKubectl, "sonarqube", "sonarqube")},
+		Unlike:      "postgresql",
+	},
+}
+
+// appDatabase describes the chart's database user for app (<app>.postgresql.*)
+func appDatabase(app, ceresSecretsKey string, targets []Target, dependents ...Workload) Credential {
+	return Credential{
+		Component:   app + "-db",
+		Description: "PostgreSQL password of the " + app + " database user",
+		Targets:     append([]Target{helm("ceres", "ceres-secrets", ceresSecretsKey)}, targets...),
+		HelmValues:  []string{app + ".postgresql.password"},
+		Apply:       alterAppUser(app),
+		Dependents:  dependents,
+		// the kubectl targets held the superuser password before
+		Unlike: "postgresql",
+	}
+}
+
+func kubectl(namespace, name, key string) Target {
+	return Target{Ref: Ref{namespace, name, key}, Engine: EngineKubectl}
+}
+
+func helm(namespace, name, key string) Target {
+	return Target{Ref: Ref{namespace, name, key}, Engine: EngineHelm}
+}
+
+// embedded is a chart Secret key whose value contains the credential (a URL)
+func embedded(namespace, name, key string) Target {
+	return Target{Ref: Ref{namespace, name, key}, Engine: EngineHelm, Embedded: true}
+}
+
+func deployment(engine, namespace, name string) Workload {
+	return Workload{Engine: engine, Namespace: namespace, Kind: "deployment", Name: name}
+}
+
+func statefulSet(engine, namespace, name string) Workload {
+	return Workload{Engine: engine, Namespace: namespace, Kind: "statefulset", Name: name}
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Rotation hooks change a credential inside the running service. Values are
+// read from stdin inside the container, never passed as kubectl arguments.
+
+// postgres returns the chart or kubectl PostgreSQL workload and its
+// superuser. In ha mode (topology.mode) that is the CloudNativePG primary.
+func (m *Manager) postgres() (Workload, string) {
+	if m.engine == EngineHelm {
+		return statefulSet(EngineHelm, "ceres", "postgresql"), "ceres"
+	}
+	out, _ := exec.Command("kubectl", "get", "pods", "-n", "ceres-core", "-l", "cnpg.io/cluster=postgresql,cnpg.io/instanceRole=primary",
+		"-o", "jsonpath={.items[0].metadata.name}").Output()
+	if pod := strings.TrimSpace(string(out)); pod != "" {
+		return Workload{Engine: EngineKubectl, Namespace: "ceres-core", Kind: "pod", Name: pod}, "postgres"
+	}
+	return statefulSet(EngineKubectl, "ceres-core", "postgresql"), "postgres"
+}
+
+// alterRole sets the password of role, connecting as the superuser
+func (m *Manager) alterRole(superuserPassword, role, password string) error {
+	w, superuser := m.postgres()
+	script := `read -r PGPASSWORD; read -r NEW; export PGPASSWORD
+echo "ALTER ROLE \"` + role + `\" PASSWORD :'pw';" | psql -h localhost -U ` + superuser + ` -d postgres -v ON_ERROR_STOP=1 -v pw="$NEW"`
+	return run(w, script, superuserPassword, password)
+}
+
+func alterSuperuser(m *Manager, old, new string) error {
+	_, superuser := m.postgres()
+	return m.alterRole(old, superuser, new)
+}
+
+func alterAppUser(role string) func(m *Manager, old, new string) error {
+	return func(m *Manager, old, new string) error {
+		superuserPassword, err := m.value("postgresql")
+		if err != nil {
+			return err
+		}
+		return m.alterRole(superuserPassword, role, new)
+	}
+}
+
+func resetKeycloakAdmin(m *Manager, old, new string) error {
+	script := `read -r OLD; read -r NEW; cfg=/tmp/kcadm-$$.config
+/opt/keycloak/bin/kcadm.sh config credentials --config "$cfg" --server http://localhost:8080 --realm master --user admin --password "$OLD" &&
+/opt/keycloak/bin/kcadm.sh set-password --config "$cfg" -r master --username admin --new-password "$NEW"
+rc=$?; rm -f "$cfg"; exit $rc`
+	return run(deployment("", "ceres", "keycloak"), script, old, new)
+}
+
+func resetGrafanaAdmin(m *Manager, old, new string) error {
+	script := `read -r NEW; grafana cli --homepath /usr/share/grafana admin reset-admin-password "$NEW"`
+	return run(deployment("", "monitoring", "grafana"), script, new)
+}
+
+func resetGitLabRoot(m *Manager, old, new string) error {
+	script := `read -r NEW; export NEW
+gitlab-rails runner 'u = User.find_by_username("root"); u.password = u.password_confirmation = ENV["NEW"]; u.save!'`
+	return run(deployment("", "gitlab", "gitlab"), script, new)
+}
+
+func resetNextcloudAdmin(m *Manager, old, new string) error {
+	script := `read -r NEW; export OC_PASS="$NEW"
+su -p -s /bin/sh www-data -c "php /var/www/html/occ user:resetpassword --password-from-env admin"`
+	return run(deployment("", "nextcloud", "nextcloud"), script, new)
+}
+
+// run executes a hook script in a workload; a workload that is not deployed
+// has nothing to update
+func run(w Workload, script string, lines ...string) error {
+	if !workloadExists(w) {
+		fmt.Printf("  ↳ %s not deployed, only the stored value changes\n", w)
+		return nil
+	}
+	return execStdin(w.Namespace, w.Kind+"/"+w.Name, script, lines...)
+}
@@ -0,0 +1,211 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Secret values never go through command-line arguments: objects are sent to
+// kubectl on stdin so they don't show up in process listings or shell history.
+
+type kubeSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeMeta          `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+type kubeMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+}
+
+// readSecret returns the decoded data of a secret; exists is false if it is missing
+func readSecret(namespace, name string) (data map[string]string, meta kubeMeta, exists bool, err error) {
+	out, err := exec.Command("kubectl", "get", "secret", name, "-n", namespace, "-o", "json").Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && strings.Contains(string(ee.Stderr), "NotFound") {
+			return nil, meta, false, nil
+		}
+		return nil, meta, false, fmt.Errorf("kubectl get secret %s/%s failed: %w", namespace, name, err)
+	}
+
+	var s kubeSecret
+	if err := json.Unmarshal(out, &s); err != nil {
+		return nil, meta, false, fmt.Errorf("invalid secret %s/%s: %w", namespace, name, err)
+	}
+	data = make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, meta, false, fmt.Errorf("failed to decode %s/%s key %s: %w", namespace, name, k, err)
+		}
+		data[k] = string(b)
+	}
+	return data, s.Metadata, true, nil
+}
+
+// writeSecret creates the secret or replaces it with the merged keys.
+// Existing keys not in values are kept.
+func writeSecret(namespace, name string, values map[string]string) error {
+	data, meta, exists, err := readSecret(namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := ensureNamespace(namespace); err != nil {
+			return err
+		}
+		data = map[string]string{}
+		meta = kubeMeta{Name: name, Namespace: namespace}
+	}
+	for k, v := range values {
+		data[k] = v
+	}
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels["app.kubernetes.io/managed-by"] = "ceres"
+
+	s := kubeSecret{APIVersion: "v1", Kind: "Secret", Metadata: meta, Type: "Opaque", Data: map[string]string{}}
+	for k, v := range data {
+		s.Data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	verb := "replace"
+	if !exists {
+		verb = "create"
+	}
+	cmd := exec.Command("kubectl", verb, "-f", "-")
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("kubectl %s secret %s/%s failed: %w\n%s", verb, namespace, name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func namespaceExists(namespace string) bool {
+	return exec.Command("kubectl", "get", "namespace", namespace).Run() == nil
+}
+
+func ensureNamespace(namespace string) error {
+	if namespaceExists(namespace) {
+		return nil
+	}
+	if out, err := exec.Command("kubectl", "create", "namespace", namespace).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create namespace %s: %w\n%s", namespace, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// execStdin runs a shell script inside a workload, feeding secret values on stdin (one per line)
+func execStdin(namespace, target, script string, lines ...string) error {
+	cmd := exec.Command("kubectl", "exec", "-i", "-n", namespace, target, "--", "sh", "-c", script)
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("kubectl exec %s/%s failed: %w\n%s", namespace, target, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func workloadExists(w Workload) bool {
+	return exec.Command("kubectl", "get", w.Kind, w.Name, "-n", w.Namespace).Run() == nil
+}
+
+// restart performs a rolling restart and waits for it to finish
+func restart(w Workload) error {
+	ref := w.Kind + "/" + w.Name
+	if out, err := exec.Command("kubectl", "rollout", "restart", ref, "-n", w.Namespace).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restart %s/%s: %w\n%s", w.Namespace, ref, err, strings.TrimSpace(string(out)))
+	}
+	if out, err := exec.Command("kubectl", "rollout", "status", ref, "-n", w.Namespace, "--timeout=10m").CombinedOutput(); err != nil {
+		return fmt.Errorf("%s/%s did not become ready: %w\n%s", w.Namespace, ref, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// KubernetesProvider keeps credentials as keys of one Secret
+type KubernetesProvider struct {
+	ref Ref
+}
+
+// NewKubernetesProvider returns a provider backed by the Secret ref (Key is ignored)
+func NewKubernetesProvider(ref Ref) *KubernetesProvider {
+	return &KubernetesProvider{ref: ref}
+}
+
+// Name implements Provider
+func (p *KubernetesProvider) Name() string {
+	return BackendKubernetes
+}
+
+// Get implements Provider
+func (p *KubernetesProvider) Get(key string) (string, error) {
+	all, err := p.All()
+	if err != nil {
+		return "", err
+	}
+	v, ok := all[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// All implements Provider
+func (p *KubernetesProvider) All() (map[string]string, error) {
+	data, _, _, err := readSecret(p.ref.Namespace, p.ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	return data, nil
+}
+
+// Set implements Provider
+func (p *KubernetesProvider) Set(values map[string]string) error {
+	return writeSecret(p.ref.Namespace, p.ref.Name, values)
+}
+
+// recordRotation notes the rotation time in the deployment state
+func recordRotation(component string) {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]string{rotatedKey + component: time.Now().UTC().Format(time.RFC3339)},
+	})
+	exec.Command("kubectl", "patch", "configmap", "ceres-deployment-state", "-n", "kube-system",
+		"--type", "merge", "-p", string(patch)).Run()
+}
+
+// rotations returns the recorded rotation times by component
+func rotations() map[string]string {
+	out, err := exec.Command("kubectl", "get", "configmap", "ceres-deployment-state", "-n", "kube-system", "-o", "jsonpath={.data}").Output()
+	if err != nil {
+		return nil
+	}
+	var data map[string]string
+	if json.Unmarshal(out, &data) != nil {
+		return nil
+	}
+	times := map[string]string{}
+	for k, v := range data {
+		if strings.HasPrefix(k, rotatedKey) {
+			times[strings.TrimPrefix(k, rotatedKey)] = v
+		}
+	}
+	return times
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// ErrNotFound is returned by Provider.Get for a missing key
+var ErrNotFound = errors.New("secret not found")
+
+// Provider is a backend credentials are kept in. Keys are flat names: the
+// catalog components ("postgresql", "keycloak", ...) plus operator-supplied
+// ones such as "smtp-password".
+type Provider interface {
+	Name() string
+	// Get returns the value of key, or ErrNotFound
+	Get(key string) (string, error)
+	// All returns every stored key
+	All() (map[string]string, error)
+	// Set stores the given keys, keeping the others
+	Set(values map[string]string) error
+}
+
+// Backends
+const (
+	BackendKubernetes = "kubernetes"
+	BackendVault      = "vault"
+	BackendSOPS       = "sops"
+)
+
+// DefaultSOPSFile is the encrypted credentials file used by the sops backend,
+// relative to the CERES root
+const DefaultSOPSFile = "config/secrets.enc.yaml"
+
+// sopsFile resolves a relative sops file against the CERES root: the file
+// config.ResolvePath finds, else the one to create under config.Root()
+func sopsFile(file string) string {
+	if file == "" {
+		file = DefaultSOPSFile
+	}
+	if p := config.ResolvePath(file); p != file || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(config.Root(), file)
+}
+
+// Options selects and configures a backend
+type Options struct {
+	Backend string
+	File    string // sops, relative to the CERES root
+	Vault   VaultOptions
+}
+
+// DefaultOptions returns the backend selection of the resolved config
+// (secrets.*, also set by CERES_SECRETS_BACKEND, CERES_SECRETS_FILE,
+// VAULT_ADDR, ...). The Vault token is only taken from VAULT_TOKEN.
+func DefaultOptions() Options {
+	cfg := config.Current().Config.Secrets
+	return Options{
+		Backend: strings.ToLower(cfg.Backend),
+		File:    cfg.File,
+		Vault: VaultOptions{
+			Address:   cfg.Vault.Address,
+			Token:     strings.TrimSpace(os.Getenv("VAULT_TOKEN")),
+			Namespace: cfg.Vault.Namespace,
+			Mount:     cfg.Vault.Mount,
+			Path:      cfg.Vault.Path,
+		},
+	}
+}
+
+// Open returns the provider for opts
+func Open(opts Options) (Provider, error) {
+	switch opts.Backend {
+	case "", BackendKubernetes:
+		return NewKubernetesProvider(Store), nil
+	case BackendVault:
+		return NewVaultProvider(opts.Vault)
+	case BackendSOPS:
+		return NewSOPSProvider(sopsFile(opts.File)), nil
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q (available: %s, %s, %s)", opts.Backend, BackendKubernetes, BackendVault, BackendSOPS)
+	}
+}
+
+// Default returns the provider selected by the config
+func Default() (Provider, error) {
+	return Open(DefaultOptions())
+}
+
+// Resolve returns the first non-empty env variable, else key from the
+// default provider. ErrNotFound is returned when neither has a value.
+func Resolve(key string, envs ...string) (string, error) {
+	for _, e := range envs {
+		if v := strings.TrimSpace(os.Getenv(e)); v != "" {
+			return v, nil
+		}
+	}
+	p, err := Default()
+	if err != nil {
+		return "", err
+	}
+	v, err := p.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("%s (%s backend): %w", key, p.Name(), err)
+	}
+	return v, nil
+}
@@ -0,0 +1,37 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+func TestSOPSFileUnderRoot(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Platform.Root = root
+	config.SetCurrent(&config.Resolved{Config: cfg})
+	defer config.SetCurrent(nil)
+
+	// a file to be created goes under the root, not the working directory
+	want := filepath.Join(root, DefaultSOPSFile)
+	if got := sopsFile(""); got != want {
+		t.Errorf("sopsFile(\"\") = %s, want %s", got, want)
+	}
+
+	other := filepath.Join(root, "config", "other.enc.yaml")
+	if err := os.MkdirAll(filepath.Dir(other), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := sopsFile("config/other.enc.yaml"); got != other {
+		t.Errorf("sopsFile = %s, want %s", got, other)
+	}
+	if got := sopsFile("/etc/ceres/secrets.enc.yaml"); got != "/etc/ceres/secrets.enc.yaml" {
+		t.Errorf("absolute file moved: %s", got)
+	}
+}
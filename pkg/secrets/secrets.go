@@ -0,0 +1,527 @@
+// Package secrets generates, stores and rotates the platform credentials.
+//
+// Every credential has one canonical value, kept by a Provider: the
+// kube-system/ceres-credentials Secret by default, or Vault or a SOPS file.
+// From there it is copied into the Secrets the kubectl manifests read
+// (targets), or passed to the ceres-platform chart as values. Nothing here
+// prints a secret value unless explicitly asked to (`ceres secrets get`).
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Store is the Secret the kubernetes backend keeps credentials in
+var Store = Ref{Namespace: "kube-system", Name: "ceres-credentials"}
+
+// rotatedKey prefixes rotation times in the deployment state ConfigMap
+const rotatedKey = "secretRotated."
+
+// Ref points to a key in a Kubernetes Secret
+type Ref struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func (r Ref) String() string {
+	if r.Key == "" {
+		return r.Namespace + "/" + r.Name
+	}
+	return r.Namespace + "/" + r.Name + ":" + r.Key
+}
+
+// Target is a Secret key that holds a copy of a credential
+type Target struct {
+	Ref
+	// Engine the target belongs to. kubectl targets are written by ceres;
+	// helm targets are rendered by the chart and only patched on rotation.
+	Engine string
+	// Embedded targets contain the credential inside a larger value (a
+	// connection URL); rotation replaces it in place.
+	Embedded bool
+}
+
+// Workload is restarted after its credential changed
+type Workload struct {
+	Engine    string // "" for both engines
+	Namespace string
+	Kind      string // deployment, statefulset
+	Name      string
+}
+
+func (w Workload) String() string {
+	return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
+
+// Credential is one generated secret and everything that consumes it
+type Credential struct {
+	Component   string
+	Description string
+	// Env overrides the generated value on first install
+	Env string
+	// Generate returns a new value; random hex when nil
+	Generate   func() (string, error)
+	Targets    []Target
+	HelmValues []string
+	// Apply changes the credential inside the running service before the
+	// dependents restart. Nil means a restart is enough.
+	Apply      func(m *Manager, old, new string) error
+	Dependents []Workload
+	// NoRotate marks credentials the service only reads on first start
+	NoRotate bool
+	// Unlike names a credential whose value is not adopted from a target:
+	// older installs kept that credential there
+	Unlike string
+}
+
+func (c *Credential) generate() (string, error) {
+	if c.Generate != nil {
+		return c.Generate()
+	}
+	return randomHex()
+}
+
+// usedBy reports whether the credential exists on an engine
+func (c *Credential) usedBy(engine string) bool {
+	if engine == EngineHelm && len(c.HelmValues) > 0 {
+		return true
+	}
+	for _, t := range c.Targets {
+		if t.Engine == engine {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the catalog entry of a component
+func Lookup(component string) (*Credential, error) {
+	for i := range Catalog {
+		if Catalog[i].Component == component {
+			return &Catalog[i], nil
+		}
+	}
+	names := make([]string, 0, len(Catalog))
+	for _, c := range Catalog {
+		names = append(names, c.Component)
+	}
+	return nil, fmt.Errorf("unknown credential %q (available: %s)", component, strings.Join(names, ", "))
+}
+
+// Manager reads and writes credentials for one deployment engine
+type Manager struct {
+	engine   string
+	provider Provider
+	store    map[string]string
+}
+
+// NewManager returns a manager for the given engine ("" detects it from the
+// deployment state) keeping credentials in p
+func NewManager(engine string, p Provider) *Manager {
+	if engine == "" {
+		engine = DetectEngine()
+	}
+	return &Manager{engine: engine, provider: p}
+}
+
+// DetectEngine returns the engine recorded in the deployment state (kubectl by default)
+func DetectEngine() string {
+	out, err := exec.Command("kubectl", "get", "configmap", "ceres-deployment-state", "-n", "kube-system", "-o", "jsonpath={.data.engine}").Output()
+	if err == nil && strings.TrimSpace(string(out)) == EngineHelm {
+		return EngineHelm
+	}
+	return EngineKubectl
+}
+
+// Engine returns the engine the manager works for
+func (m *Manager) Engine() string {
+	return m.engine
+}
+
+// Provider returns the backend credentials are kept in
+func (m *Manager) Provider() Provider {
+	return m.provider
+}
+
+func (m *Manager) load() error {
+	if m.store != nil {
+		return nil
+	}
+	data, err := m.provider.All()
+	if err != nil {
+		return fmt.Errorf("failed to read credentials from %s: %w", m.provider.Name(), err)
+	}
+	m.store = data
+	return nil
+}
+
+func (m *Manager) save(values map[string]string) error {
+	if err := m.provider.Set(values); err != nil {
+		return fmt.Errorf("failed to write credentials to %s: %w", m.provider.Name(), err)
+	}
+	for k, v := range values {
+		m.store[k] = v
+	}
+	return nil
+}
+
+// Get returns the current value of a credential
+func (m *Manager) Get(component string) (string, error) {
+	if _, err := Lookup(component); err != nil {
+		return "", err
+	}
+	return m.value(component)
+}
+
+// value is Get without the catalog check, for use by the catalog's own hooks
+func (m *Manager) value(component string) (string, error) {
+	if err := m.load(); err != nil {
+		return "", err
+	}
+	v, ok := m.store[component]
+	if !ok {
+		return "", fmt.Errorf("credential %s has not been generated yet (run ceres deploy)", component)
+	}
+	return v, nil
+}
+
+// Ensure generates every missing credential of the engine and, on the kubectl
+// engine, writes the target Secrets. Existing values are never replaced: a
+// value already present in a target (an older install) is adopted into the
+// store. Targets in skipNamespaces are left alone.
+func (m *Manager) Ensure(skipNamespaces []string) error {
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	generated := map[string]string{}
+	for i := range Catalog {
+		c := &Catalog[i]
+		if !c.usedBy(m.engine) {
+			continue
+		}
+		if _, ok := m.store[c.Component]; ok {
+			continue
+		}
+
+		value, origin, err := m.initial(c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Component, err)
+		}
+		generated[c.Component] = value
+		fmt.Printf("    🔑 %s: %s\n", c.Component, origin)
+	}
+	if len(generated) > 0 {
+		if err := m.save(generated); err != nil {
+			return err
+		}
+	}
+
+	if m.engine != EngineKubectl {
+		return nil
+	}
+	for _, secret := range m.targetSecrets(skipNamespaces) {
+		current, _, _, err := readSecret(secret.Namespace, secret.Name)
+		if err != nil {
+			return err
+		}
+		changed := map[string]string{}
+		for key, component := range secret.keys {
+			if v := m.store[component]; current[key] != v {
+				changed[key] = v
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if err := writeSecret(secret.Namespace, secret.Name, changed); err != nil {
+			return err
+		}
+		fmt.Printf("    🔐 Secret %s/%s updated\n", secret.Namespace, secret.Name)
+	}
+	return nil
+}
+
+// initial picks the first value of a credential: adopted from an existing
+// target, taken from the environment, or generated
+func (m *Manager) initial(c *Credential) (value, origin string, err error) {
+	for _, t := range c.Targets {
+		if t.Engine != m.engine || t.Embedded {
+			continue
+		}
+		data, _, _, err := readSecret(t.Namespace, t.Name)
+		if err != nil {
+			return "", "", err
+		}
+		if v := data[t.Key]; v != "" && (c.Unlike == "" || v != m.store[c.Unlike]) {
+			return v, "adopted from " + t.Ref.String(), nil
+		}
+	}
+	if c.Env != "" {
+		if v := strings.TrimSpace(os.Getenv(c.Env)); v != "" {
+			return v, "taken from $" + c.Env, nil
+		}
+	}
+	v, err := c.generate()
+	return v, "generated", err
+}
+
+type targetSecret struct {
+	Namespace, Name string
+	keys            map[string]string // key → component
+}
+
+// targetSecrets groups the kubectl targets by Secret so each is written once
+func (m *Manager) targetSecrets(skipNamespaces []string) []targetSecret {
+	skip := map[string]bool{}
+	for _, ns := range skipNamespaces {
+		skip[ns] = true
+	}
+	index := map[string]*targetSecret{}
+	var order []string
+	for _, c := range Catalog {
+		for _, t := range c.Targets {
+			if t.Engine != m.engine || t.Embedded || skip[t.Namespace] {
+				continue
+			}
+			id := t.Namespace + "/" + t.Name
+			s, ok := index[id]
+			if !ok {
+				s = &targetSecret{Namespace: t.Namespace, Name: t.Name, keys: map[string]string{}}
+				index[id] = s
+				order = append(order, id)
+			}
+			s.keys[t.Key] = c.Component
+		}
+	}
+	out := make([]targetSecret, 0, len(order))
+	for _, id := range order {
+		out = append(out, *index[id])
+	}
+	return out
+}
+
+// WriteHelmValues writes the credentials as a chart values file readable only
+// by the current user, so they never appear on a command line. The caller
+// removes it with cleanup.
+func (m *Manager) WriteHelmValues() (path string, cleanup func(), err error) {
+	if err := m.load(); err != nil {
+		return "", func() {}, err
+	}
+	values := map[string]interface{}{}
+	for _, c := range Catalog {
+		v, ok := m.store[c.Component]
+		if !ok {
+			continue
+		}
+		for _, key := range c.HelmValues {
+			setPath(values, strings.Split(key, "."), v)
+		}
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", func() {}, err
+	}
+
+	dir, err := os.MkdirTemp("", "ceres-secrets-")
+	if err != nil {
+		return "", func() {}, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	path = filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return path, cleanup, nil
+}
+
+func setPath(m map[string]interface{}, path []string, value string) {
+	if len(path) == 1 {
+		m[path[0]] = value
+		return
+	}
+	child, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		m[path[0]] = child
+	}
+	setPath(child, path[1:], value)
+}
+
+// Rotate replaces a credential: the new value is applied to the running
+// service and copied to the targets, then stored, and the dependents are
+// restarted in order. If a step fails the changes already made are undone, so
+// the stored value keeps matching the service and the targets.
+func (m *Manager) Rotate(component string) error {
+	c, err := Lookup(component)
+	if err != nil {
+		return err
+	}
+	if !c.usedBy(m.engine) {
+		return fmt.Errorf("%s is not used by the %s engine", component, m.engine)
+	}
+	if c.NoRotate {
+		return fmt.Errorf("%s cannot be rotated in place: the service only reads it on first start", component)
+	}
+	old, err := m.Get(component)
+	if err != nil {
+		return err
+	}
+	value, err := c.generate()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🔄 Rotating %s (%s)\n", c.Component, c.Description)
+	if c.Apply != nil {
+		if err := c.Apply(m, old, value); err != nil {
+			return fmt.Errorf("%s rejected the new credential, nothing changed: %w", component, err)
+		}
+		fmt.Println("  ✓ Applied to the running service")
+	}
+
+	var updated []targetValue
+	for _, t := range c.Targets {
+		if t.Engine != m.engine {
+			continue
+		}
+		data, _, exists, err := readSecret(t.Namespace, t.Name)
+		if err != nil {
+			return m.undoRotation(c, old, value, updated, err)
+		}
+		if !exists {
+			continue
+		}
+		v := value
+		if t.Embedded {
+			if !strings.Contains(data[t.Key], old) {
+				return m.undoRotation(c, old, value, updated, fmt.Errorf("%s does not contain the current credential", t.Ref))
+			}
+			v = strings.ReplaceAll(data[t.Key], old, value)
+		}
+		if err := writeSecret(t.Namespace, t.Name, map[string]string{t.Key: v}); err != nil {
+			return m.undoRotation(c, old, value, updated, err)
+		}
+		updated = append(updated, targetValue{Target: t, previous: data[t.Key]})
+		fmt.Printf("  ✓ Updated secret %s/%s\n", t.Namespace, t.Name)
+	}
+
+	if err := m.save(map[string]string{component: value}); err != nil {
+		return m.undoRotation(c, old, value, updated, err)
+	}
+	recordRotation(component)
+
+	for _, w := range c.Dependents {
+		if w.Engine != "" && w.Engine != m.engine {
+			continue
+		}
+		if !workloadExists(w) {
+			continue
+		}
+		fmt.Printf("  ♻️  Restarting %s\n", w)
+		if err := restart(w); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("✅ %s rotated\n", c.Component)
+	return nil
+}
+
+// targetValue is a target updated by Rotate with the key's previous content
+type targetValue struct {
+	Target
+	previous string
+}
+
+// undoRotation puts the previous credential back into the targets already
+// updated and the running service after a failed rotation. The error names
+// what could not be restored and still holds the new value; if the service
+// keeps it, the new value is stored so it is not lost.
+func (m *Manager) undoRotation(c *Credential, old, value string, updated []targetValue, cause error) error {
+	var changed []string
+	for i := len(updated) - 1; i >= 0; i-- {
+		t := updated[i]
+		if err := writeSecret(t.Namespace, t.Name, map[string]string{t.Key: t.previous}); err != nil {
+			changed = append(changed, fmt.Sprintf("secret %s/%s (%v)", t.Namespace, t.Name, err))
+			continue
+		}
+		fmt.Printf("  ↩ Restored secret %s/%s\n", t.Namespace, t.Name)
+	}
+	if c.Apply != nil {
+		if err := c.Apply(m, value, old); err != nil {
+			changed = append(changed, fmt.Sprintf("the running service (%v)", err))
+			// the service keeps the new value, which must not be lost
+			if serr := m.save(map[string]string{c.Component: value}); serr != nil {
+				changed = append(changed, fmt.Sprintf("but storing it failed (%v)", serr))
+			} else {
+				changed = append(changed, "which is stored")
+			}
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("rotating %s failed: %w; still using the new value: %s", c.Component, cause, strings.Join(changed, ", "))
+	}
+	return fmt.Errorf("rotating %s failed, the previous value was restored: %w", c.Component, cause)
+}
+
+// Status describes a credential without its value
+type Status struct {
+	Credential *Credential
+	Generated  bool
+	Rotated    string // RFC 3339, empty if never rotated
+	Targets    []string
+}
+
+// List returns the credentials of the engine
+func (m *Manager) List() ([]Status, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	rotated := rotations()
+	var out []Status
+	for i := range Catalog {
+		c := &Catalog[i]
+		if !c.usedBy(m.engine) {
+			continue
+		}
+		_, ok := m.store[c.Component]
+		s := Status{Credential: c, Generated: ok, Rotated: rotated[c.Component]}
+		for _, t := range c.Targets {
+			if t.Engine == m.engine {
+				s.Targets = append(s.Targets, t.Ref.String())
+			}
+		}
+		sort.Strings(s.Targets)
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func randomHex() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomBase64 returns 32 random bytes, the size oauth2-proxy expects for a cookie secret
+func randomBase64() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
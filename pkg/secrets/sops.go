@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SOPSProvider keeps credentials in a SOPS-encrypted YAML file in the repo.
+// Keys are chosen by sops itself: creation rules in .sops.yaml, or
+// SOPS_AGE_RECIPIENTS for a new file; decryption uses SOPS_AGE_KEY_FILE.
+type SOPSProvider struct {
+	file string
+}
+
+// NewSOPSProvider returns a provider for an encrypted file
+func NewSOPSProvider(file string) *SOPSProvider {
+	return &SOPSProvider{file: file}
+}
+
+// Name implements Provider
+func (p *SOPSProvider) Name() string {
+	return BackendSOPS
+}
+
+// Get implements Provider
+func (p *SOPSProvider) Get(key string) (string, error) {
+	all, err := p.All()
+	if err != nil {
+		return "", err
+	}
+	v, ok := all[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// All implements Provider. A missing file is empty.
+func (p *SOPSProvider) All() (map[string]string, error) {
+	if _, err := os.Stat(p.file); os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("sops", "--decrypt", "--output-type", "json", p.file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops --decrypt %s failed: %w\n%s", p.file, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("%s: expected a flat map of credentials: %w", p.file, err)
+	}
+	data := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			data[k] = s
+		} else {
+			data[k] = fmt.Sprint(v)
+		}
+	}
+	return data, nil
+}
+
+// Set implements Provider. The plaintext only goes through a pipe to sops;
+// the file is replaced atomically.
+func (p *SOPSProvider) Set(values map[string]string) error {
+	data, err := p.All()
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		data[k] = v
+	}
+	plain, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sops", "--encrypt", "--input-type", "yaml", "--output-type", "yaml",
+		"--filename-override", p.file, "/dev/stdin")
+	cmd.Stdin = bytes.NewReader(plain)
+	cmd.Stderr = &stderr
+	enc, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("sops --encrypt %s failed: %w\n%s", p.file, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.file), ".secrets-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(enc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.file)
+}
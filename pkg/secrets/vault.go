@@ -0,0 +1,157 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultOptions locates the KV v2 secret credentials are kept in
+type VaultOptions struct {
+	Address   string // VAULT_ADDR
+	Token     string // VAULT_TOKEN
+	Namespace string // VAULT_NAMESPACE (Vault Enterprise)
+	Mount     string // KV v2 mount, default "secret"
+	Path      string // secret path under the mount, default "ceres"
+}
+
+// VaultProvider keeps credentials as the fields of one KV v2 secret
+type VaultProvider struct {
+	opts   VaultOptions
+	client *http.Client
+}
+
+// NewVaultProvider returns a Vault KV v2 provider. A dev-mode server works:
+// `vault server -dev` mounts KV v2 at secret/.
+func NewVaultProvider(opts VaultOptions) (*VaultProvider, error) {
+	opts.Address = strings.TrimRight(opts.Address, "/")
+	if opts.Address == "" {
+		return nil, fmt.Errorf("vault backend needs VAULT_ADDR")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("vault backend needs VAULT_TOKEN")
+	}
+	if opts.Mount == "" {
+		opts.Mount = "secret"
+	}
+	if opts.Path == "" {
+		opts.Path = "ceres"
+	}
+	opts.Mount = strings.Trim(opts.Mount, "/")
+	opts.Path = strings.Trim(opts.Path, "/")
+	return &VaultProvider{opts: opts, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Name implements Provider
+func (p *VaultProvider) Name() string {
+	return BackendVault
+}
+
+func (p *VaultProvider) url() string {
+	return p.opts.Address + "/v1/" + p.opts.Mount + "/data/" + p.opts.Path
+}
+
+func (p *VaultProvider) do(method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, p.url(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.opts.Token)
+	if p.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.opts.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s %s: %w", method, p.opts.Mount+"/"+p.opts.Path, err)
+	}
+	return resp, nil
+}
+
+// Get implements Provider
+func (p *VaultProvider) Get(key string) (string, error) {
+	all, err := p.All()
+	if err != nil {
+		return "", err
+	}
+	v, ok := all[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// All implements Provider
+func (p *VaultProvider) All() (map[string]string, error) {
+	resp, err := p.do(http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, vaultError(resp)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+	out := make(map[string]string, len(body.Data.Data))
+	for k, v := range body.Data.Data {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		} else {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out, nil
+}
+
+// Set implements Provider. KV v2 writes replace the whole secret, so the
+// current fields are read and merged first.
+func (p *VaultProvider) Set(values map[string]string) error {
+	data, err := p.All()
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		data[k] = v
+	}
+	body, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodPost, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return vaultError(resp)
+	}
+	return nil
+}
+
+func vaultError(resp *http.Response) error {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, &body) == nil && len(body.Errors) > 0 {
+		return fmt.Errorf("vault: %s: %s", resp.Status, strings.Join(body.Errors, "; "))
+	}
+	return fmt.Errorf("vault: %s", resp.Status)
+}
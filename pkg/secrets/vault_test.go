@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeVault is a KV v2 stand-in holding one secret at kv/data/platform/ceres
+func fakeVault(t *testing.T) *httptest.Server {
+	t.Helper()
+	var stored map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.Header.Get("X-Vault-Namespace") != "team" {
+			http.Error(w, "no namespace", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/platform/ceres" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": stored}})
+		case http.MethodPost:
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			stored = body.Data
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := fakeVault(t)
+	p, err := NewVaultProvider(VaultOptions{Address: srv.URL + "/", Token: "root", Namespace: "team", Mount: "/kv/", Path: "platform/ceres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := p.All()
+	if err != nil || len(all) != 0 {
+		t.Fatalf("All on a missing secret = %v, %v", all, err)
+	}
+	if _, err := p.Get("postgresql"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing key: %v", err)
+	}
+
+	if err := p.Set(map[string]string{"postgresql": "pg", "keycloak": "kc"}); err != nil {
+		t.Fatal(err)
+	}
+	// KV v2 replaces the whole secret: Set keeps the other keys
+	if err := p.Set(map[string]string{"keycloak": "kc2"}); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"postgresql": "pg", "keycloak": "kc2"} {
+		if got, err := p.Get(key); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+}
+
+func TestVaultProviderErrors(t *testing.T) {
+	srv := fakeVault(t)
+	p, err := NewVaultProvider(VaultOptions{Address: srv.URL, Token: "wrong", Namespace: "team", Mount: "kv", Path: "platform/ceres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.All(); err == nil || err.Error() != "vault: 403 Forbidden: permission denied" {
+		t.Errorf("All with a bad token: %v", err)
+	}
+
+	if _, err := NewVaultProvider(VaultOptions{Token: "root"}); err == nil {
+		t.Error("provider without an address")
+	}
+	if _, err := NewVaultProvider(VaultOptions{Address: srv.URL}); err == nil {
+		t.Error("provider without a token")
+	}
+}
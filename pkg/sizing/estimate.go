@@ -0,0 +1,135 @@
+package sizing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Usage is the resource footprint of one workload (all replicas) or PVC
+type Usage struct {
+	Component   string // <namespace>/<name>
+	Kind        string
+	Replicas    int
+	CPU         resource.Quantity // requests
+	Memory      resource.Quantity
+	CPULimit    resource.Quantity
+	MemoryLimit resource.Quantity
+	Storage     resource.Quantity
+}
+
+// Totals sums usages
+type Totals struct {
+	Usages      []Usage
+	CPU         resource.Quantity
+	Memory      resource.Quantity
+	CPULimit    resource.Quantity
+	MemoryLimit resource.Quantity
+	Storage     resource.Quantity
+}
+
+func (t *Totals) add(u Usage) {
+	t.Usages = append(t.Usages, u)
+	t.CPU.Add(u.CPU)
+	t.Memory.Add(u.Memory)
+	t.CPULimit.Add(u.CPULimit)
+	t.MemoryLimit.Add(u.MemoryLimit)
+	t.Storage.Add(u.Storage)
+}
+
+type manifestDoc struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Replicas *int `yaml:"replicas"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Resources struct {
+						Requests map[string]string `yaml:"requests"`
+						Limits   map[string]string `yaml:"limits"`
+					} `yaml:"resources"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+		VolumeClaimTemplates []struct {
+			Spec claimSpec `yaml:"spec"`
+		} `yaml:"volumeClaimTemplates"`
+		claimSpec `yaml:",inline"`
+	} `yaml:"spec"`
+}
+
+type claimSpec struct {
+	Resources struct {
+		Requests map[string]string `yaml:"requests"`
+	} `yaml:"resources"`
+}
+
+// Estimate adds up requests, limits and storage of the workloads and PVCs in
+// rendered manifests. DaemonSets count once per node. Containers without
+// requests count as zero, so unsized manifests underestimate.
+func Estimate(data []byte, nodes int, totals *Totals) error {
+	if nodes < 1 {
+		nodes = 1
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc manifestDoc
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		u := Usage{Component: doc.Metadata.Name, Kind: doc.Kind}
+		if doc.Metadata.Namespace != "" {
+			u.Component = doc.Metadata.Namespace + "/" + doc.Metadata.Name
+		}
+
+		switch doc.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			u.Replicas = 1
+			if doc.Spec.Replicas != nil {
+				u.Replicas = *doc.Spec.Replicas
+			}
+			if doc.Kind == "DaemonSet" {
+				u.Replicas = nodes
+			}
+			for _, c := range doc.Spec.Template.Spec.Containers {
+				addQuantity(&u.CPU, c.Resources.Requests["cpu"], u.Replicas)
+				addQuantity(&u.Memory, c.Resources.Requests["memory"], u.Replicas)
+				addQuantity(&u.CPULimit, c.Resources.Limits["cpu"], u.Replicas)
+				addQuantity(&u.MemoryLimit, c.Resources.Limits["memory"], u.Replicas)
+			}
+			for _, vct := range doc.Spec.VolumeClaimTemplates {
+				addQuantity(&u.Storage, vct.Spec.Resources.Requests["storage"], u.Replicas)
+			}
+		case "PersistentVolumeClaim":
+			addQuantity(&u.Storage, doc.Spec.Resources.Requests["storage"], 1)
+		default:
+			continue
+		}
+		totals.add(u)
+	}
+}
+
+func addQuantity(q *resource.Quantity, value string, times int) {
+	if value == "" {
+		return
+	}
+	v, err := resource.ParseQuantity(value)
+	if err != nil {
+		return
+	}
+	for i := 0; i < times; i++ {
+		q.Add(v)
+	}
+}
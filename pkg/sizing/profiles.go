@@ -0,0 +1,74 @@
+package sizing
+
+// Profiles are the built-in sizing profiles. Components are keyed by workload
+// name (metadata.name of the Deployment/StatefulSet/DaemonSet), which is the
+// same in deployment/*.yaml and the ceres-platform chart.
+var Profiles = map[string]Profile{
+	"small": {
+		Name:        "small",
+		Description: "Single node, 16GB RAM / 4 CPU: one replica each, duplicate tools left out",
+		Default:     Size{CPU: "50m", Memory: "128Mi", CPULimit: "500m", MemoryLimit: "512Mi"},
+		Components: map[string]Size{
+			"postgresql":   {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "1Gi", Storage: "10Gi"},
+			"redis":        {Replicas: 1, CPU: "50m", Memory: "64Mi", CPULimit: "250m", MemoryLimit: "256Mi", Storage: "2Gi"},
+			"keycloak":     {Replicas: 1, CPU: "250m", Memory: "768Mi", CPULimit: "1", MemoryLimit: "1Gi", Storage: "1Gi"},
+			"gitlab":       {Replicas: 1, CPU: "500m", Memory: "3Gi", CPULimit: "2", MemoryLimit: "4Gi", Storage: "20Gi"},
+			"nextcloud":    {Replicas: 1, CPU: "100m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "512Mi", Storage: "20Gi"},
+			"mattermost":   {Replicas: 1, CPU: "100m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "512Mi"},
+			"prometheus":   {Replicas: 1, CPU: "100m", Memory: "512Mi", CPULimit: "500m", MemoryLimit: "1Gi", Storage: "10Gi"},
+			"grafana":      {Replicas: 1},
+			"loki":         {Replicas: 1, CPU: "100m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "512Mi", Storage: "10Gi"},
+			"minio":        {Replicas: 1, CPU: "50m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "512Mi", Storage: "20Gi"},
+			"mailcow":      {Replicas: 1, CPU: "100m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "512Mi", Storage: "10Gi"},
+			"redmine":      {Replicas: 1, CPU: "100m", Memory: "256Mi", CPULimit: "500m", MemoryLimit: "768Mi", Storage: "5Gi"},
+			"sonarqube":    {Replicas: 1, CPU: "250m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi"},
+			"oauth2-proxy": {Replicas: 1},
+		},
+		// What RemoveDuplicates deletes after the fact: never deploy it on a small node
+		ExcludeNamespaces: []string{"elasticsearch", "kibana", "harbor", "jenkins", "uptime-kuma"},
+	},
+	"medium": {
+		Name:        "medium",
+		Description: "Single large node or 2-3 small nodes, 32GB RAM / 8 CPU",
+		Default:     Size{CPU: "100m", Memory: "256Mi", CPULimit: "1", MemoryLimit: "1Gi"},
+		Components: map[string]Size{
+			"postgresql":    {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi", Storage: "50Gi"},
+			"redis":         {Replicas: 1, CPU: "100m", Memory: "128Mi", CPULimit: "500m", MemoryLimit: "512Mi", Storage: "5Gi"},
+			"keycloak":      {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "5Gi"},
+			"gitlab":        {Replicas: 1, CPU: "1", Memory: "4Gi", CPULimit: "4", MemoryLimit: "6Gi", Storage: "50Gi"},
+			"nextcloud":     {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "1Gi", Storage: "100Gi"},
+			"mattermost":    {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "1Gi"},
+			"prometheus":    {Replicas: 1, CPU: "250m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "50Gi"},
+			"grafana":       {Replicas: 1},
+			"loki":          {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "1Gi", Storage: "30Gi"},
+			"minio":         {Replicas: 1, CPU: "100m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "1Gi", Storage: "50Gi"},
+			"mailcow":       {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "500m", MemoryLimit: "1Gi", Storage: "20Gi"},
+			"redmine":       {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "20Gi"},
+			"elasticsearch": {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi"},
+			"sonarqube":     {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi"},
+			"oauth2-proxy":  {Replicas: 2},
+		},
+	},
+	"large": {
+		Name:        "large",
+		Description: "Multi-node cluster, 64GB+ RAM / 16+ CPU: stateless services scaled out",
+		Default:     Size{CPU: "250m", Memory: "512Mi", CPULimit: "2", MemoryLimit: "2Gi"},
+		Components: map[string]Size{
+			"postgresql":    {Replicas: 1, CPU: "1", Memory: "4Gi", CPULimit: "4", MemoryLimit: "8Gi", Storage: "100Gi"},
+			"redis":         {Replicas: 1, CPU: "250m", Memory: "512Mi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "10Gi"},
+			"keycloak":      {CPU: "1", Memory: "2Gi", CPULimit: "2", MemoryLimit: "4Gi", Storage: "5Gi"},
+			"gitlab":        {Replicas: 1, CPU: "2", Memory: "8Gi", CPULimit: "8", MemoryLimit: "12Gi", Storage: "200Gi"},
+			"nextcloud":     {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi", Storage: "500Gi"},
+			"mattermost":    {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi"},
+			"prometheus":    {Replicas: 1, CPU: "500m", Memory: "2Gi", CPULimit: "2", MemoryLimit: "4Gi", Storage: "100Gi"},
+			"grafana":       {Replicas: 2},
+			"loki":          {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi", Storage: "100Gi"},
+			"minio":         {Replicas: 1, CPU: "250m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi", Storage: "500Gi"},
+			"mailcow":       {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "1", MemoryLimit: "2Gi", Storage: "50Gi"},
+			"redmine":       {Replicas: 1, CPU: "500m", Memory: "1Gi", CPULimit: "2", MemoryLimit: "2Gi", Storage: "50Gi"},
+			"elasticsearch": {Replicas: 1, CPU: "1", Memory: "2Gi", CPULimit: "2", MemoryLimit: "4Gi"},
+			"sonarqube":     {Replicas: 1, CPU: "1", Memory: "2Gi", CPULimit: "2", MemoryLimit: "4Gi"},
+			"oauth2-proxy":  {Replicas: 3},
+		},
+	},
+}
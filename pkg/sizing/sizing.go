@@ -0,0 +1,262 @@
+package sizing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Size is the sizing of one component: replicas, per-container requests and
+// limits, and the size of its persistent volumes
+type Size struct {
+	Replicas    int    `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	CPU         string `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+	Memory      string `yaml:"memory,omitempty" json:"memory,omitempty"`
+	CPULimit    string `yaml:"cpuLimit,omitempty" json:"cpuLimit,omitempty"`
+	MemoryLimit string `yaml:"memoryLimit,omitempty" json:"memoryLimit,omitempty"`
+	Storage     string `yaml:"storage,omitempty" json:"storage,omitempty"`
+}
+
+// merge returns s with the non-empty fields of o applied on top
+func (s Size) merge(o Size) Size {
+	if o.Replicas > 0 {
+		s.Replicas = o.Replicas
+	}
+	if o.CPU != "" {
+		s.CPU = o.CPU
+	}
+	if o.Memory != "" {
+		s.Memory = o.Memory
+	}
+	if o.CPULimit != "" {
+		s.CPULimit = o.CPULimit
+	}
+	if o.MemoryLimit != "" {
+		s.MemoryLimit = o.MemoryLimit
+	}
+	if o.Storage != "" {
+		s.Storage = o.Storage
+	}
+	return s
+}
+
+// Profile is a named set of component sizes
+type Profile struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description,omitempty"`
+	Default     Size            `yaml:"default"` // resources for components not listed
+	Components  map[string]Size `yaml:"components"`
+	// ExcludeNamespaces are left out of the rendered manifests entirely
+	ExcludeNamespaces []string `yaml:"excludeNamespaces,omitempty"`
+}
+
+// Names returns the built-in profile names, sorted
+func Names() []string {
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns a built-in profile with per-component overrides applied
+func Get(name string, overrides map[string]Size) (*Profile, error) {
+	base, ok := Profiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown sizing profile %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	p := base
+	p.Components = make(map[string]Size, len(base.Components)+len(overrides))
+	for c, s := range base.Components {
+		p.Components[c] = s
+	}
+	for c, s := range overrides {
+		p.Components[c] = p.Components[c].merge(s)
+	}
+	return &p, nil
+}
+
+// For returns the size of a component: the profile default merged with its entry
+func (p *Profile) For(component string) Size {
+	return p.Default.merge(p.Components[component])
+}
+
+// claimOwner returns the component a PVC belongs to: the longest component
+// name that equals the claim name or prefixes it ("postgresql-pvc" → postgresql)
+func (p *Profile) claimOwner(claim string) string {
+	owner := ""
+	for c := range p.Components {
+		if (claim == c || strings.HasPrefix(claim, c+"-")) && len(c) > len(owner) {
+			owner = c
+		}
+	}
+	return owner
+}
+
+func (p *Profile) excluded(namespace string) bool {
+	for _, ns := range p.ExcludeNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Options controls Apply
+type Options struct {
+	// Storage resizes PVCs and StatefulSet volumeClaimTemplates. Only safe on a
+	// fresh install: claim templates are immutable and PVCs cannot shrink.
+	Storage bool
+}
+
+// Apply sizes every workload and PVC in a multi-document YAML manifest
+func (p *Profile) Apply(data []byte, opts Options) ([]byte, error) {
+	if p == nil {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+
+		kind := scalar(root, "kind")
+		meta := lookup(root, "metadata")
+		name, namespace := scalar(meta, "name"), scalar(meta, "namespace")
+		if p.excluded(namespace) || (kind == "Namespace" && p.excluded(name)) {
+			continue
+		}
+
+		spec := lookup(root, "spec")
+		switch kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			size := p.For(name)
+			if size.Replicas > 0 && kind != "DaemonSet" {
+				set(spec, "replicas", strconv.Itoa(size.Replicas), "!!int")
+			}
+			podSpec := lookup(lookup(spec, "template"), "spec")
+			if containers := lookup(podSpec, "containers"); containers != nil {
+				for _, c := range containers.Content {
+					setResources(c, size)
+				}
+			}
+			if opts.Storage && size.Storage != "" && kind == "StatefulSet" {
+				if vcts := lookup(spec, "volumeClaimTemplates"); vcts != nil {
+					for _, vct := range vcts.Content {
+						setStorage(lookup(vct, "spec"), size.Storage)
+					}
+				}
+			}
+		case "PersistentVolumeClaim":
+			if owner := p.claimOwner(name); opts.Storage && owner != "" {
+				if storage := p.For(owner).Storage; storage != "" {
+					setStorage(spec, storage)
+				}
+			}
+		}
+
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func setResources(container *yaml.Node, size Size) {
+	if size.CPU == "" && size.Memory == "" && size.CPULimit == "" && size.MemoryLimit == "" {
+		return
+	}
+	res := ensure(container, "resources")
+	if size.CPU != "" {
+		set(ensure(res, "requests"), "cpu", size.CPU, "!!str")
+	}
+	if size.Memory != "" {
+		set(ensure(res, "requests"), "memory", size.Memory, "!!str")
+	}
+	if size.CPULimit != "" {
+		set(ensure(res, "limits"), "cpu", size.CPULimit, "!!str")
+	}
+	if size.MemoryLimit != "" {
+		set(ensure(res, "limits"), "memory", size.MemoryLimit, "!!str")
+	}
+}
+
+func setStorage(claimSpec *yaml.Node, storage string) {
+	if claimSpec == nil {
+		return
+	}
+	set(ensure(ensure(claimSpec, "resources"), "requests"), "storage", storage, "!!str")
+}
+
+// lookup returns the value node of key in a mapping, or nil
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(m *yaml.Node, key string) string {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// ensure returns the mapping under key, creating it if missing
+func ensure(m *yaml.Node, key string) *yaml.Node {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.MappingNode {
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setNode(m, key, v)
+	return v
+}
+
+func set(m *yaml.Node, key, value, tag string) {
+	if m == nil {
+		return
+	}
+	setNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value})
+}
+
+func setNode(m *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = v
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+}
@@ -0,0 +1,180 @@
+package sso
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// URLChange is a realm or client setting that names the platform domain
+type URLChange struct {
+	Target string // "realm ceres" or "client gitlab"
+	Field  string
+	From   string
+	To     string
+}
+
+// clientURLFields are the client settings holding one URL
+var clientURLFields = []string{"rootUrl", "baseUrl", "adminUrl"}
+
+// clientURLLists are the client settings holding a list of URLs
+var clientURLLists = []string{"redirectUris", "webOrigins"}
+
+// postLogoutAttr holds the post-logout redirect URIs, separated by "##"
+const postLogoutAttr = "post.logout.redirect.uris"
+
+// FrontendURL is the realm frontend URL for a platform domain
+func FrontendURL(domain string) string {
+	return "https://keycloak." + domain
+}
+
+// UpdateRealmDomain rewrites the frontend URL of the live realm and the
+// URLs of its clients with rewrite. The changes are returned; they are only
+// made when apply is set.
+func (m *Manager) UpdateRealmDomain(rewrite func(string) string, frontendURL string, apply bool) ([]URLChange, error) {
+	realm := realmName()
+	var changes []URLChange
+
+	var rep map[string]any
+	if err := m.adminJSON("GET", "/realms/"+realm, nil, &rep); err != nil {
+		return nil, err
+	}
+	attrs, _ := rep["attributes"].(map[string]any)
+	if attrs == nil {
+		attrs = map[string]any{}
+	}
+	if cur, _ := attrs["frontendUrl"].(string); cur != frontendURL {
+		changes = append(changes, URLChange{Target: "realm " + realm, Field: "attributes.frontendUrl", From: cur, To: frontendURL})
+		if apply {
+			attrs["frontendUrl"] = frontendURL
+			if err := m.adminJSON("PUT", "/realms/"+realm, map[string]any{"attributes": attrs}, nil); err != nil {
+				return changes, fmt.Errorf("failed to update realm %s: %w", realm, err)
+			}
+		}
+	}
+
+	var clients []map[string]any
+	if err := m.adminJSON("GET", "/realms/"+realm+"/clients", nil, &clients); err != nil {
+		return changes, err
+	}
+	for _, c := range clients {
+		id, _ := c["clientId"].(string)
+		target := "client " + id
+		before := len(changes)
+
+		for _, f := range clientURLFields {
+			if v, ok := c[f].(string); ok && rewrite(v) != v {
+				changes = append(changes, URLChange{Target: target, Field: f, From: v, To: rewrite(v)})
+				c[f] = rewrite(v)
+			}
+		}
+		for _, f := range clientURLLists {
+			list, _ := c[f].([]any)
+			for i, item := range list {
+				if v, ok := item.(string); ok && rewrite(v) != v {
+					changes = append(changes, URLChange{Target: target, Field: fmt.Sprintf("%s[%d]", f, i), From: v, To: rewrite(v)})
+					list[i] = rewrite(v)
+				}
+			}
+		}
+		if a, ok := c["attributes"].(map[string]any); ok {
+			if v, ok := a[postLogoutAttr].(string); ok && rewrite(v) != v {
+				changes = append(changes, URLChange{Target: target, Field: "attributes." + postLogoutAttr, From: v, To: rewrite(v)})
+				a[postLogoutAttr] = rewrite(v)
+			}
+		}
+
+		if apply && len(changes) > before {
+			uuid, _ := c["id"].(string)
+			if err := m.adminJSON("PUT", "/realms/"+realm+"/clients/"+uuid, c, nil); err != nil {
+				return changes, fmt.Errorf("failed to update client %s: %w", id, err)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Clients returns the client IDs registered in the realm
+func (m *Manager) Clients() ([]string, error) {
+	var clients []struct {
+		ClientID string `json:"clientId"`
+	}
+	if err := m.adminJSON("GET", "/realms/"+realmName()+"/clients", nil, &clients); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(clients))
+	for _, c := range clients {
+		ids = append(ids, c.ClientID)
+	}
+	return ids, nil
+}
+
+// adminJSON calls the Keycloak admin REST API from inside the Keycloak pod.
+// The token and the request body are passed on stdin.
+func (m *Manager) adminJSON(method, path string, body, out any) error {
+	token, err := m.getAdminToken()
+	if err != nil {
+		return err
+	}
+	podName, err := m.getKeycloakPod()
+	if err != nil {
+		return err
+	}
+
+	input := token + "\n"
+	script := fmt.Sprintf(`read -r TOKEN; curl -sf -X %s "http://localhost:8080/admin%s" -H "Authorization: Bearer $TOKEN"`, method, path)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		input += string(data)
+		script += ` -H "Content-Type: application/json" --data-binary @-`
+	}
+
+	cmd := exec.Command("kubectl", "exec", "-i", "-n", "ceres", podName, "--", "bash", "-c", script)
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("keycloak %s %s failed: %w", method, path, err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(output, out); err != nil {
+		return fmt.Errorf("keycloak %s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+// renderRealm returns the realm file for the configured domain: the
+// template domain is replaced and the frontend URL set
+func (m *Manager) renderRealm() ([]byte, error) {
+	data, err := os.ReadFile(m.ceresPath("config/keycloak-realm.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read realm file: %w", err)
+	}
+	domain := config.Current().Config.Platform.Domain
+	var rep map[string]any
+	if err := json.Unmarshal([]byte(config.ReplaceDomain(string(data), config.DefaultDomain, domain)), &rep); err != nil {
+		return nil, fmt.Errorf("invalid realm file: %w", err)
+	}
+	attrs, _ := rep["attributes"].(map[string]any)
+	if attrs == nil {
+		attrs = map[string]any{}
+	}
+	attrs["frontendUrl"] = FrontendURL(domain)
+	rep["attributes"] = attrs
+	return json.MarshalIndent(rep, "", "  ")
+}
+
+func realmName() string {
+	if realm := config.Current().Config.SSO.Realm; realm != "" {
+		return realm
+	}
+	return "ceres"
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/skulesh01/ceres/pkg/config"
+	"github.com/skulesh01/ceres/pkg/dns"
+	"github.com/skulesh01/ceres/pkg/secrets"
 )
 
 type Manager struct{}
@@ -17,46 +20,12 @@ func NewManager() *Manager {
 }
 
 func (m *Manager) ceresPath(p string) string {
-	if p == "" {
-		return p
-	}
-	if filepath.IsAbs(p) {
-		return p
-	}
-
-	candidates := []string{}
-	if v := strings.TrimSpace(os.Getenv("CERES_ROOT")); v != "" {
-		candidates = append(candidates, v)
-	}
-	if v := strings.TrimSpace(os.Getenv("CERES_REPO_ROOT")); v != "" {
-		candidates = append(candidates, v)
-	}
-	if cwd, err := os.Getwd(); err == nil {
-		candidates = append(candidates, cwd)
-	}
-	if exe, err := os.Executable(); err == nil {
-		exeDir := filepath.Dir(exe)
-		candidates = append(candidates, exeDir, filepath.Dir(exeDir))
-	}
-
-	for _, base := range candidates {
-		candidate := filepath.Join(base, p)
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate
-		}
-	}
-	return p
+	return config.ResolvePath(p)
 }
 
-func (m *Manager) keycloakAdminPassword() string {
-	if v := strings.TrimSpace(os.Getenv("CERES_KEYCLOAK_ADMIN_PASSWORD")); v != "" {
-		return v
-	}
-	if v := strings.TrimSpace(os.Getenv("KEYCLOAK_ADMIN_PASSWORD")); v != "" {
-		return v
-	}
-	// Default from deployment/keycloak.yaml (ceres/keycloak-secret:admin-password)
-	return "K3yClo@k!2025"
+func (m *Manager) keycloakAdminPassword() (string, error) {
+	// Generated by the deployer (see `ceres secrets`)
+	return secrets.Resolve("keycloak", "CERES_KEYCLOAK_ADMIN_PASSWORD", "KEYCLOAK_ADMIN_PASSWORD")
 }
 
 // Install deploys Keycloak realm and OAuth2 Proxy
@@ -103,14 +72,18 @@ func (m *Manager) Install() error {
 	}
 
 	fmt.Println("\n🌐 Access URLs:")
-	fmt.Println("   Keycloak Admin: https://keycloak.ceres.local")
+	domain := config.Current().Config.Platform.Domain
+	fmt.Printf("   Keycloak Admin: %s\n", FrontendURL(domain))
 	fmt.Println("   Username: admin")
 	fmt.Println("   Password: (from secret ceres/keycloak-secret)")
-	fmt.Println("\n💡 Add to /etc/hosts:")
-	fmt.Println("   192.168.1.3 keycloak.ceres.local gitlab.ceres.local grafana.ceres.local")
-	fmt.Println("   192.168.1.3 chat.ceres.local files.ceres.local wiki.ceres.local")
-	fmt.Println("   192.168.1.3 mail.ceres.local portainer.ceres.local db.ceres.local")
-	fmt.Println("   192.168.1.3 minio.ceres.local prometheus.ceres.local projects.ceres.local vault.ceres.local")
+	if inv, err := dns.Discover(dns.Options{Domain: domain}); err == nil && len(inv.Unresolved()) == 0 {
+		fmt.Println("\n💡 Add to /etc/hosts (or see `ceres dns` for other resolvers):")
+		for _, line := range strings.Split(strings.TrimSpace(dns.Hosts(inv)), "\n") {
+			fmt.Printf("   %s\n", line)
+		}
+	} else {
+		fmt.Println("\n💡 Run `ceres dns` to print the /etc/hosts lines for the platform hosts")
+	}
 
 	return nil
 }
@@ -142,9 +115,25 @@ func (m *Manager) importRealm() error {
 		return err
 	}
 
-	// Copy realm file
+	// Copy the realm file, rendered for the configured domain
+	realmData, err := m.renderRealm()
+	if err != nil {
+		return err
+	}
+	realmFile, err := os.CreateTemp("", "ceres-realm-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(realmFile.Name())
+	if _, err := realmFile.Write(realmData); err != nil {
+		realmFile.Close()
+		return err
+	}
+	if err := realmFile.Close(); err != nil {
+		return err
+	}
 	cmd := exec.Command("kubectl", "cp",
-		m.ceresPath("config/keycloak-realm.json"),
+		realmFile.Name(),
 		fmt.Sprintf("ceres/%s:/tmp/realm.json", podName))
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to copy realm file: %w\n%s", err, output)
@@ -177,9 +166,9 @@ func (m *Manager) importRealmViaAPI() error {
 	}
 
 	// Read realm file
-	realmData, err := os.ReadFile(m.ceresPath("config/keycloak-realm.json"))
+	realmData, err := m.renderRealm()
 	if err != nil {
-		return fmt.Errorf("failed to read realm file: %w", err)
+		return err
 	}
 
 	// Import realm
@@ -211,16 +200,21 @@ func (m *Manager) getAdminToken() (string, error) {
 		return "", err
 	}
 
-	adminPassword := m.keycloakAdminPassword()
-	curlCmd := fmt.Sprintf(`curl -X POST http://localhost:8080/realms/master/protocol/openid-connect/token \
+	adminPassword, err := m.keycloakAdminPassword()
+	if err != nil {
+		return "", err
+	}
+	// The password is read from stdin so it does not appear in process arguments
+	curlCmd := `read -r PW; curl -X POST http://localhost:8080/realms/master/protocol/openid-connect/token \
 		-H "Content-Type: application/x-www-form-urlencoded" \
 		-d "username=admin" \
-		-d "password=%s" \
+		--data-urlencode "password=$PW" \
 		-d "grant_type=password" \
-		-d "client_id=admin-cli" | grep -o '"access_token":"[^"]*"' | cut -d'"' -f4`, adminPassword)
+		-d "client_id=admin-cli" | grep -o '"access_token":"[^"]*"' | cut -d'"' -f4`
 
-	cmd := exec.Command("kubectl", "exec", "-n", "ceres", podName, "--",
+	cmd := exec.Command("kubectl", "exec", "-i", "-n", "ceres", podName, "--",
 		"bash", "-c", curlCmd)
+	cmd.Stdin = strings.NewReader(adminPassword + "\n")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("failed to get admin token: %w\n%s", err, output)
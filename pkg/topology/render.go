@@ -0,0 +1,115 @@
+package topology
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// replaced are the documents of single-mode manifests the ha manifests take
+// the place of, by manifest: Keycloak keeps its data in PostgreSQL, not on
+// a volume
+var replaced = map[string][]Workload{
+	"deployment/keycloak.yaml": {
+		Keycloak,
+		{"PersistentVolumeClaim", "ceres", "keycloak-data"},
+	},
+}
+
+// Apply renders the manifest at path for the topology. In ha mode it drops
+// the documents the ha manifests replace and sets the replica counts; it
+// runs after the sizing profile, which sizes single instances.
+func (t *Topology) Apply(path string, data []byte) ([]byte, error) {
+	if !t.HA() {
+		return data, nil
+	}
+	drop := map[Workload]bool{}
+	for _, w := range replaced[path] {
+		drop[w] = true
+	}
+	replicas := map[Workload]int{
+		PostgreSQL: t.PostgreSQL,
+		Redis:      t.Redis,
+		Keycloak:   t.Keycloak,
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		meta := lookup(root, "metadata")
+		w := Workload{scalar(root, "kind"), scalar(meta, "namespace"), scalar(meta, "name")}
+		if drop[w] {
+			continue
+		}
+
+		if n, ok := replicas[w]; ok && n > 0 {
+			key := "replicas"
+			if w.Kind == PostgreSQL.Kind {
+				key = "instances"
+			}
+			if spec := lookup(root, "spec"); spec != nil {
+				setInt(spec, key, n)
+			}
+		}
+
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// lookup returns the value node of key in a mapping, or nil
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(m *yaml.Node, key string) string {
+	if v := lookup(m, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// setInt sets an integer value
+func setInt(m *yaml.Node, key string, n int) {
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(n)}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = v
+			return
+		}
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+}
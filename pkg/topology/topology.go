@@ -0,0 +1,106 @@
+// Package topology holds how the core services are laid out: one
+// PostgreSQL, Redis and Keycloak each (single), or replicated across nodes
+// (ha) with a CloudNativePG cluster, Redis with Sentinel behind HAProxy and
+// clustered Keycloak, each with a PodDisruptionBudget and anti-affinity.
+// Clients keep their addresses in both modes: postgresql and redis in the
+// core namespace, keycloak in the apps namespace.
+package topology
+
+import (
+	"fmt"
+
+	"github.com/skulesh01/ceres/pkg/config"
+)
+
+// Modes of topology.mode
+const (
+	Single = "single"
+	HA     = "ha"
+)
+
+// Default instance counts in ha mode
+const (
+	DefaultPostgreSQL = 3
+	DefaultRedis      = 3
+	DefaultKeycloak   = 3
+)
+
+// Workload is a replicated workload of the ha manifests
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (w Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// Workloads of the ha manifests, in the order they become ready
+var (
+	PostgreSQL = Workload{"Cluster", "ceres-core", "postgresql"}
+	Redis      = Workload{"StatefulSet", "ceres-core", "redis-node"}
+	RedisProxy = Workload{"Deployment", "ceres-core", "redis-proxy"}
+	Keycloak   = Workload{"Deployment", "ceres", "keycloak"}
+)
+
+// Topology is the layout of the core services
+type Topology struct {
+	Mode string
+	// Replicas of the ha workloads, by name
+	PostgreSQL int
+	Redis      int
+	Keycloak   int
+}
+
+// Get returns the topology of cfg with the defaults filled in
+func Get(cfg config.Config) *Topology {
+	t := &Topology{Mode: cfg.Topology.Mode}
+	if t.Mode == "" {
+		t.Mode = Single
+	}
+	if !t.HA() {
+		return t
+	}
+	t.PostgreSQL = or(cfg.Topology.PostgreSQL, DefaultPostgreSQL)
+	t.Redis = or(cfg.Topology.Redis, DefaultRedis)
+	t.Keycloak = or(cfg.Services.Keycloak.Replicas, DefaultKeycloak)
+	return t
+}
+
+// HA reports whether the core services are replicated
+func (t *Topology) HA() bool {
+	return t != nil && t.Mode == HA
+}
+
+// Core returns the PostgreSQL and Redis manifests, in apply order
+func (t *Topology) Core() []string {
+	if t.HA() {
+		return []string{"deployment/ha/postgresql.yaml", "deployment/ha/redis.yaml"}
+	}
+	return []string{"deployment/postgresql-fixed.yaml", "deployment/redis.yaml"}
+}
+
+// Identity returns the Keycloak manifests, in apply order. In ha mode the
+// realm and config of keycloak.yaml are kept and ha/keycloak.yaml replaces
+// its Deployment and data volume (see Apply).
+func (t *Topology) Identity() []string {
+	if t.HA() {
+		return []string{"deployment/keycloak.yaml", "deployment/ha/keycloak.yaml"}
+	}
+	return []string{"deployment/keycloak.yaml"}
+}
+
+// SingleWorkloads hold the data of a single-mode install. ha mode does not
+// migrate it: an install that runs them is not switched to ha.
+var SingleWorkloads = []Workload{
+	{"StatefulSet", "ceres-core", "postgresql"},
+	{"Deployment", "ceres-core", "redis"},
+}
+
+func or(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/skulesh01/ceres/pkg/config"
 	"github.com/skulesh01/ceres/pkg/mail"
 	"github.com/skulesh01/ceres/pkg/tls"
 	"github.com/skulesh01/ceres/pkg/vpn"
@@ -38,6 +39,8 @@ type ConsoleServer struct {
 	BasicPass  string
 	WorkDir    string
 	Jobs       *JobManager
+
+	services servicesCache
 }
 
 func (s *ConsoleServer) Run() error {
@@ -344,11 +347,7 @@ func (s *ConsoleServer) Run() error {
 			}
 
 			mailMgr := mail.NewManager()
-			oldFrom := os.Getenv("CERES_MAIL_FROM")
-			if cfg.From != "" {
-				_ = os.Setenv("CERES_MAIL_FROM", cfg.From)
-				defer func() { _ = os.Setenv("CERES_MAIL_FROM", oldFrom) }()
-			}
+			mailMgr.SetFrom(cfg.From)
 			if err := mailMgr.SendEmail(recipients, cfg.Subject, cfg.Body, atts); err != nil {
 				s.render(w, mailHTMLConsole, map[string]any{"Cfg": cfg, "Flash": fmt.Sprintf("Ошибка отправки: %v", err)})
 				return
@@ -371,6 +370,13 @@ func (s *ConsoleServer) Run() error {
 		http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
 	}))
 
+	// Service catalog: the landing page and the Proxmox notes read the JSON
+	mux.HandleFunc("/services", s.withAuth(func(w http.ResponseWriter, r *http.Request) {
+		s.render(w, servicesHTML, nil)
+	}))
+
+	mux.HandleFunc("/api/services", s.withAuth(s.handleServicesAPI))
+
 	mux.HandleFunc("/jobs/", s.withAuth(func(w http.ResponseWriter, r *http.Request) {
 		id := strings.TrimPrefix(r.URL.Path, "/jobs/")
 		if id == "" {
@@ -408,13 +414,7 @@ func (s *ConsoleServer) workdir() string {
 	if wd != "" {
 		return wd
 	}
-	if v := strings.TrimSpace(os.Getenv("CERES_ROOT")); v != "" {
-		return v
-	}
-	if cwd, err := os.Getwd(); err == nil {
-		return cwd
-	}
-	return ""
+	return config.Root()
 }
 
 func (s *ConsoleServer) configFile() string {
@@ -422,20 +422,22 @@ func (s *ConsoleServer) configFile() string {
 	if p != "" {
 		return p
 	}
-	return "/var/lib/ceres-ui/console.json"
+	return platformConfig().UI.Console.State
 }
 
 func (s *ConsoleServer) loadConfig() (ConsoleConfig, error) {
+	platform := platformConfig()
+	form := platform.UI.Form
 	cfg := ConsoleConfig{
-		Cloud:       envOr("CERES_UI_CLOUD", "k3s"),
-		Environment: envOr("CERES_UI_ENV", "prod"),
-		Namespace:   envOr("CERES_UI_NAMESPACE", "ceres"),
-		From:        envOr("CERES_UI_FROM", "admin@ceres.local"),
-		To:          envOr("CERES_UI_TO", ""),
-		Subject:     envOr("CERES_UI_SUBJECT", "CERES: VPN + сертификат"),
-		Body:        envOr("CERES_UI_BODY", "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат\n2) WireGuard конфигурация\n\n"),
-		VPNEndpoint: envOr("CERES_UI_VPN_ENDPOINT", "192.168.1.3"),
-		VPNPort:     atoiDefault(os.Getenv("CERES_UI_VPN_PORT"), 51820),
+		Cloud:       or(form.Cloud, "k3s"),
+		Environment: or(form.Environment, platform.Platform.Environment),
+		Namespace:   or(form.Namespace, platform.Namespaces.Apps),
+		From:        or(form.From, mailFrom(platform)),
+		To:          form.To,
+		Subject:     or(form.Subject, "CERES: VPN + сертификат"),
+		Body:        or(form.Body, "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат\n2) WireGuard конфигурация\n\n"),
+		VPNEndpoint: or(form.VPNEndpoint, vpnEndpoint(platform)),
+		VPNPort:     vpnPort(platform),
 		IncludeCA:   true,
 		IncludeVPN:  true,
 	}
@@ -538,6 +540,7 @@ const consoleHTML = `<!doctype html><html><head><meta charset="utf-8"><meta name
   <div class="header">
     <div class="h1">CERES Console</div>
     <div class="actions">
+      <a class="badge" href="/services">Сервисы</a>
       <a class="badge" href="/settings">Настройки</a>
       <a class="badge" href="/mail">Почта / VPN пакет</a>
 	  <a class="badge" href="/ops">Ops</a>
@@ -104,11 +104,7 @@ func (s *Server) Run() error {
 		}
 
 		mailMgr := mail.NewManager()
-		oldFrom := os.Getenv("CERES_MAIL_FROM")
-		if strings.TrimSpace(formCfg.From) != "" {
-			_ = os.Setenv("CERES_MAIL_FROM", formCfg.From)
-			defer func() { _ = os.Setenv("CERES_MAIL_FROM", oldFrom) }()
-		}
+		mailMgr.SetFrom(formCfg.From)
 		if err := mailMgr.SendEmail(recipients, formCfg.Subject, formCfg.Body, atts); err != nil {
 			s.renderIndex(w, r, formCfg, fmt.Sprintf("Ошибка отправки: %v", err))
 			return
@@ -154,17 +150,19 @@ func (s *Server) configFile() string {
 	if p != "" {
 		return p
 	}
-	return "/var/lib/ceres-ui/config.json"
+	return platformConfig().UI.Mail.State
 }
 
 func (s *Server) loadConfig() (Config, error) {
+	platform := platformConfig()
+	form := platform.UI.Form
 	cfg := Config{
-		From:        envOr("CERES_UI_FROM", "admin@ceres.local"),
-		To:          envOr("CERES_UI_TO", ""),
-		Subject:     envOr("CERES_UI_SUBJECT", "CERES: VPN + сертификат"),
-		Body:        envOr("CERES_UI_BODY", "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат (установить в доверенные корневые)\n2) WireGuard конфигурация (импортировать в приложение WireGuard)\n\n"),
-		VPNEndpoint: envOr("CERES_UI_VPN_ENDPOINT", "192.168.1.3"),
-		VPNPort:     atoiDefault(os.Getenv("CERES_UI_VPN_PORT"), 51820),
+		From:        or(form.From, mailFrom(platform)),
+		To:          form.To,
+		Subject:     or(form.Subject, "CERES: VPN + сертификат"),
+		Body:        or(form.Body, "Здравствуйте!\n\nВо вложении:\n1) CERES Root CA сертификат (установить в доверенные корневые)\n2) WireGuard конфигурация (импортировать в приложение WireGuard)\n\n"),
+		VPNEndpoint: or(form.VPNEndpoint, vpnEndpoint(platform)),
+		VPNPort:     vpnPort(platform),
 		IncludeCA:   true,
 		IncludeVPN:  true,
 	}
@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skulesh01/ceres/pkg/catalog"
+)
+
+// servicesTTL is how long a discovered catalog is served; discovery runs
+// several kubectl calls and asks Keycloak for its clients
+const servicesTTL = 30 * time.Second
+
+type servicesCache struct {
+	mu  sync.Mutex
+	cat *catalog.Catalog
+	at  time.Time
+}
+
+// get returns the cached catalog, discovering it again when it is stale
+// or refresh is set
+func (c *servicesCache) get(refresh bool) (*catalog.Catalog, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cat != nil && !refresh && time.Since(c.at) < servicesTTL {
+		return c.cat, nil
+	}
+	cat, err := catalog.Discover(catalog.Options{})
+	if err != nil {
+		return nil, err
+	}
+	c.cat, c.at = cat, time.Now()
+	return cat, nil
+}
+
+// handleServicesAPI serves the service catalog as JSON, or as the Markdown
+// of the Proxmox notes with ?format=markdown. ?refresh=1 skips the cache.
+func (s *ConsoleServer) handleServicesAPI(w http.ResponseWriter, r *http.Request) {
+	cat, err := s.services.get(r.URL.Query().Get("refresh") != "")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(r.URL.Query().Get("format")) == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		_, _ = w.Write([]byte(cat.Markdown()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(cat)
+}
+
+const servicesHTML = `<!doctype html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><title>CERES Services</title>
+<style>` + consoleCSS + `
+.services{display:grid;grid-template-columns:repeat(auto-fill,minmax(320px,1fr));gap:12px}
+.healthy{color:var(--ok)} .degraded,.stopped,.missing{color:#ffc857} .down{color:var(--bad)} .disabled{color:var(--muted)}
+</style></head><body><div class="container">
+	<div class="header">
+		<div class="h1">Сервисы</div>
+		<div class="actions">
+			<a class="badge" href="/api/services">JSON</a>
+			<a class="badge" href="/api/services?format=markdown">Markdown</a>
+			<a class="badge" href="/services?refresh=1">Обновить</a>
+			<a class="badge" href="/">← Назад</a>
+		</div>
+	</div>
+	<div id="flash" class="flash bad" style="display:none"></div>
+	<div id="entry" class="small" style="margin-bottom:12px">Загрузка…</div>
+	<div id="services" class="services"></div>
+</div>
+<script>
+function el(tag, cls, text){const e=document.createElement(tag); if(cls) e.className=cls; if(text!==undefined) e.textContent=text; return e}
+const refresh = new URLSearchParams(location.search).has('refresh') ? '?refresh=1' : '';
+fetch('/api/services'+refresh).then(r=>r.json()).then(cat=>{
+	if(cat.error){ throw new Error(cat.error) }
+	const entry = document.getElementById('entry');
+	entry.textContent = 'Домен: '+cat.domain+(cat.entry ? ' • вход: '+cat.entry+' ('+cat.entrySource+')' : '')+' • '+new Date(cat.generated).toLocaleString();
+	(cat.warnings||[]).forEach(w=>entry.appendChild(el('div','', '⚠️ '+w)));
+	const list = document.getElementById('services');
+	cat.services.forEach(s=>{
+		const card = el('div','card');
+		const head = el('div','actions');
+		head.appendChild(el('div','h1',s.title)).style.fontSize='16px';
+		const h = s.health;
+		head.appendChild(el('span','badge '+h.status, h.status+(h.desired ? ' '+h.ready+'/'+h.desired : '')));
+		card.appendChild(head);
+		card.appendChild(el('div','small', s.namespace+' • SSO: '+s.sso.mode+(s.sso.status ? ' ('+s.sso.status+')' : '')));
+		(s.urls||[]).forEach(u=>{
+			const row = el('div','small');
+			row.appendChild(el('span','', u.kind+': '));
+			if(u.kind==='cluster'){ row.appendChild(el('code','',u.url)) }
+			else { const a=el('a','',u.url); a.href=u.url; a.target='_blank'; row.appendChild(a) }
+			card.appendChild(row);
+		});
+		(s.credentials||[]).forEach(c=>card.appendChild(el('div','small','🔑 '+c.description+': '+c.secret)));
+		list.appendChild(card);
+	});
+}).catch(err=>{
+	const f = document.getElementById('flash');
+	f.style.display='block'; f.textContent='Каталог недоступен: '+err.message;
+	document.getElementById('entry').textContent='';
+});
+</script>
+</body></html>`
@@ -2,10 +2,44 @@ package ui
 
 import (
 	"fmt"
-	"os"
 	"strings"
+
+	"github.com/skulesh01/ceres/pkg/config"
 )
 
+// platformConfig is the resolved platform configuration the UI defaults
+// come from; the CERES_UI_* variables still override it
+func platformConfig() config.Config {
+	return config.Current().Config
+}
+
+// mailFrom returns mail.from, else admin@<domain>
+func mailFrom(cfg config.Config) string {
+	if cfg.Mail.From != "" {
+		return cfg.Mail.From
+	}
+	return "admin@" + cfg.Platform.Domain
+}
+
+// vpnEndpoint returns vpn.endpoint, else the address used before it was configurable
+func vpnEndpoint(cfg config.Config) string {
+	if cfg.VPN.Endpoint != "" {
+		return cfg.VPN.Endpoint
+	}
+	return "192.168.1.3"
+}
+
+// vpnPort returns ui.form.vpnPort, else vpn.port, else the WireGuard default
+func vpnPort(cfg config.Config) int {
+	if cfg.UI.Form.VPNPort != 0 {
+		return cfg.UI.Form.VPNPort
+	}
+	if cfg.VPN.Port != 0 {
+		return cfg.VPN.Port
+	}
+	return 51820
+}
+
 func splitCSV(v string) []string {
 	var out []string
 	for _, part := range strings.Split(v, ",") {
@@ -17,9 +51,9 @@ func splitCSV(v string) []string {
 	return out
 }
 
-func envOr(key, def string) string {
-	v := strings.TrimSpace(os.Getenv(key))
-	if v == "" {
+// or returns v, else def
+func or(v, def string) string {
+	if v = strings.TrimSpace(v); v == "" {
 		return def
 	}
 	return v
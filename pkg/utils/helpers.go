@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/skulesh01/ceres/pkg/config"
 )
 
 // ExecuteCommand executes shell command
@@ -56,8 +58,8 @@ func GetProjectRoot() (string, error) {
 	return "", fmt.Errorf("project root not found")
 }
 
-// GetConfigPath returns the configuration file path
+// GetConfigPath returns the configuration file path ($CERES_CONFIG or
+// ~/.ceres/config.yaml)
 func GetConfigPath() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".ceres", "config.yaml")
+	return config.DefaultPath()
 }
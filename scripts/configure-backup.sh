@@ -46,6 +46,7 @@ if [ -n "$MINIO_IP" ]; then
     echo "🗄️  Configuring S3-compatible backup storage (MinIO)..."
     
     # Create credentials secret
+    MINIO_ROOT_PASSWORD=$(kubectl get secret minio-secret -n minio -o jsonpath='{.data.root-password}' | base64 -d)
     cat <<EOF | kubectl apply -f -
 apiVersion: v1
 kind: Secret
@@ -57,7 +58,7 @@ stringData:
   cloud: |
     [default]
     aws_access_key_id = minioadmin
-    aws_secret_access_key = MinIO@Admin2025
+    aws_secret_access_key = ${MINIO_ROOT_PASSWORD}
 EOF
 
     # Create backup storage location
@@ -0,0 +1,42 @@
+#!/bin/bash
+set -euo pipefail
+
+# Installs a systemd timer that verifies the latest backup every week:
+# restores it into throwaway namespaces, checks it and records a success in
+# the deployment state (ceres backup list shows it).
+
+SERVICE_NAME="ceres-backup-verify"
+CERES_BIN="${CERES_BIN:-$(command -v ceres || echo /opt/ceres/Ceres/bin/ceres)}"
+
+if [ "$(id -u)" -ne 0 ]; then
+  echo "Run as root" >&2
+  exit 1
+fi
+
+cat > "/etc/systemd/system/${SERVICE_NAME}.service" <<EOF2
+[Unit]
+Description=Ceres backup restore drill
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=${CERES_BIN} backup verify --latest --record
+EOF2
+
+cat > "/etc/systemd/system/${SERVICE_NAME}.timer" <<'EOF2'
+[Unit]
+Description=Run the Ceres backup restore drill weekly
+
+[Timer]
+OnCalendar=Sun *-*-* 04:00
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+EOF2
+
+systemctl daemon-reload
+systemctl enable --now "${SERVICE_NAME}.timer"
+
+echo "Installed and started: ${SERVICE_NAME}.timer (journalctl -u ${SERVICE_NAME} for reports)"
@@ -111,6 +111,13 @@ case "${CERES_PROXMOX_NOTES_UPDATE}" in
     ;;
 esac
 
+if [ "${run_proxmox_notes_update}" = true ] && [ -x ./bin/ceres ] && ./bin/ceres config get cloud.proxmox.tokenID 2>/dev/null | grep -q '!'; then
+  # The CLI talks to the Proxmox API directly; the CronJob below is the fallback.
+  echo "[CERES] updating Proxmox notes..."
+  ./bin/ceres proxmox notes sync || echo "[CERES] ceres proxmox notes sync failed (non-fatal)" >&2
+  run_proxmox_notes_update=false
+fi
+
 if [ "${run_proxmox_notes_update}" = true ]; then
   if kubectl -n ceres-management get cronjob proxmox-notes-updater >/dev/null 2>&1; then
     # Check whether token secret looks configured; avoid noisy failures in auto mode.
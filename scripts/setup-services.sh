@@ -155,7 +155,8 @@ kubectl wait --for=condition=ready pod -l app=minio -n minio --timeout=120s 2>/d
 echo -e "${BLUE}  🪣 Creating default buckets...${NC}"
 
 # Create buckets using mc (MinIO Client)
-kubectl exec -n minio deployment/minio -- mc alias set myminio http://localhost:9000 minioadmin MinIO@Admin2025 2>/dev/null || true
+# Credentials come from the pod environment (minio/minio-secret)
+kubectl exec -n minio deployment/minio -- sh -c 'mc alias set myminio http://localhost:9000 "$MINIO_ROOT_USER" "$MINIO_ROOT_PASSWORD"' 2>/dev/null || true
 
 BUCKETS=("backups" "gitlab-artifacts" "gitlab-lfs" "nextcloud-data" "prometheus-data" "grafana-snapshots")
 for bucket in "${BUCKETS[@]}"; do
@@ -277,12 +278,13 @@ for app in "${NEXTCLOUD_APPS[@]}"; do
 done
 
 # Configure external storage (MinIO)
+MINIO_ROOT_PASSWORD=$(kubectl get secret minio-secret -n minio -o jsonpath='{.data.root-password}' | base64 -d)
 kubectl exec -n nextcloud deployment/nextcloud -- php occ app:enable files_external 2>/dev/null || true
 kubectl exec -n nextcloud deployment/nextcloud -- php occ files_external:create "MinIO Storage" amazons3 amazons3::accesskey \
   -c bucket=nextcloud-data \
   -c hostname=minio.minio.svc.cluster.local:9000 \
   -c key=minioadmin \
-  -c secret=MinIO@Admin2025 \
+  -c secret="$MINIO_ROOT_PASSWORD" \
   -c use_ssl=false 2>/dev/null || true
 
 echo -e "${GREEN}  ✅ Nextcloud apps installed: ${NEXTCLOUD_APPS[*]}${NC}"